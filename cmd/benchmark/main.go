@@ -1,10 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math/rand/v2"
 	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	poltergeist "github.com/ghostsecurity/poltergeist/pkg"
@@ -12,21 +19,30 @@ import (
 
 // BenchmarkResult holds the results of a single benchmark run
 type BenchmarkResult struct {
-	Engine          string
-	RuleCount       int
-	FilesScanned    int64
-	FilesSkipped    int64
-	TotalBytes      int64
-	MatchesFound    int64
-	ScanDuration    time.Duration
-	CompileDuration time.Duration
-	ThroughputMBPS  float64
+	Engine          string        `json:"engine"`
+	Mode            string        `json:"mode"`
+	RuleCount       int           `json:"rule_count"`
+	DummyRules      int           `json:"dummy_rules"`
+	FilesScanned    int64         `json:"files_scanned"`
+	FilesSkipped    int64         `json:"files_skipped"`
+	TotalBytes      int64         `json:"total_bytes"`
+	MatchesFound    int64         `json:"matches_found"`
+	ScanDuration    time.Duration `json:"scan_duration_ns"`
+	CompileDuration time.Duration `json:"compile_duration_ns"`
+	ThroughputMBPS  float64       `json:"throughput_mbps"`
+	PeakHeapBytes   int64         `json:"peak_heap_bytes"`
+	Seed            int64         `json:"seed"`
 }
 
 func main() {
 	// Define command line flags
-	engine := flag.String("engine", "all", "Engine to benchmark: go, hyperscan, or all")
+	engine := flag.String("engine", "all", "Engine to benchmark: go, hyperscan, hyperscan-som, or all")
 	maxRules := flag.Int("max-rules", 0, "Maximum number of rules to test (0 = no limit)")
+	mode := flag.String("mode", "all", "Scan mode to benchmark: line, content, or all")
+	deepTree := flag.Bool("deep-tree", false, "Instead, benchmark serial and concurrent directory walks on a generated deep tree of small files")
+	jsonOutput := flag.Bool("json", false, "Write the results to stdout as JSON, with progress on stderr")
+	seedFlag := flag.String("seed", "1", "Seed for generating dummy rules, or random to pick one (the default is fixed, so runs are comparable)")
+	ruleID := flag.String("rule-id", "", "Benchmark only the packaged rules with these comma-separated IDs, without dummy rules")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\nBenchmark the Poltergeist secret scanning engine\n\n")
@@ -36,31 +52,79 @@ func main() {
 	flag.Parse()
 
 	// Validate engine argument
-	if *engine != "go" && *engine != "hyperscan" && *engine != "all" {
-		fmt.Fprintf(os.Stderr, "Error: invalid engine '%s'. Must be 'go', 'hyperscan', or 'all'\n", *engine)
+	if *engine != "go" && *engine != "hyperscan" && *engine != "hyperscan-som" && *engine != "all" {
+		fmt.Fprintf(os.Stderr, "Error: invalid engine '%s'. Must be 'go', 'hyperscan', 'hyperscan-som', or 'all'\n", *engine)
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	seed, err := parseSeed(*seedFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Validate mode argument
+	if *mode != "line" && *mode != "content" && *mode != "all" {
+		fmt.Fprintf(os.Stderr, "Error: invalid mode '%s'. Must be 'line', 'content', or 'all'\n", *mode)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *deepTree && *jsonOutput {
+		fmt.Fprintf(os.Stderr, "Error: -json can't be used with -deep-tree\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Line mode scans files line by line, content mode scans each file as a
+	// single block (which can find secrets spanning multiple lines)
+	var modes []string
+	if *mode == "line" || *mode == "all" {
+		modes = append(modes, "line")
+	}
+	if *mode == "content" || *mode == "all" {
+		modes = append(modes, "content")
+	}
+
 	// For the results referenced in the README.md, we symlinked the Linux
 	// kernel source code to `testdata/benchmark` directory and seeded some
 	// secrets. This is about 1.4GB of content.
 	benchmarkDir := "./pkg/testdata/benchmark/"
 	rulesDir := "./rules"
 
+	// Check if rules directory exists
+	if _, err := os.Stat(rulesDir); os.IsNotExist(err) {
+		log.Fatalf("Rules directory %s does not exist", rulesDir)
+	}
+
+	if *deepTree {
+		rules, err := poltergeist.LoadRulesFromDirectory(rulesDir)
+		if err != nil {
+			log.Fatalf("Failed to load packaged rules: %v", err)
+		}
+		fmt.Println("=== Poltergeist Deep Tree Walk Benchmark ===")
+		benchmarkDeepTree(rules)
+		return
+	}
+
 	// Check if benchmark directory exists
 	if _, err := os.Stat(benchmarkDir); os.IsNotExist(err) {
 		log.Fatalf("Benchmark directory %s does not exist", benchmarkDir)
 	}
 
-	// Check if rules directory exists
-	if _, err := os.Stat(rulesDir); os.IsNotExist(err) {
-		log.Fatalf("Rules directory %s does not exist", rulesDir)
+	// Progress goes to stderr when stdout is reserved for JSON
+	var progress io.Writer = os.Stdout
+	if *jsonOutput {
+		progress = os.Stderr
 	}
 
-	fmt.Println("=== Poltergeist Benchmark Tool ===")
-	fmt.Printf("Benchmark Directory: %s\n", benchmarkDir)
-	fmt.Printf("Rules Directory: %s\n\n", rulesDir)
+	fmt.Fprintln(progress, "=== Poltergeist Benchmark Tool ===")
+	fmt.Fprintf(progress, "Benchmark Directory: %s\n", benchmarkDir)
+	fmt.Fprintf(progress, "Rules Directory: %s\n", rulesDir)
+
+	fmt.Fprintf(progress, "Seed: %d\n\n", seed)
 
 	// Load packaged rules
 	packagedRules, err := poltergeist.LoadRulesFromDirectory(rulesDir)
@@ -68,10 +132,20 @@ func main() {
 		log.Fatalf("Failed to load packaged rules: %v", err)
 	}
 
-	fmt.Printf("Loaded %d packaged rules\n\n", len(packagedRules))
-
 	// Test scenarios: packaged rules + dummy rule counts
 	scenarios := []int{0, 10, 50, 100, 200, 500, 1000}
+
+	// Benchmarking selected rules measures their standalone cost, so dummy
+	// rules would only add noise
+	if *ruleID != "" {
+		packagedRules, err = selectRules(packagedRules, *ruleID)
+		if err != nil {
+			log.Fatalf("Failed to select rules: %v", err)
+		}
+		scenarios = []int{0}
+	}
+
+	fmt.Fprintf(progress, "Loaded %d packaged rules\n\n", len(packagedRules))
 	var allResults []BenchmarkResult
 
 	for _, dummyCount := range scenarios {
@@ -81,63 +155,132 @@ func main() {
 			ruleSet = packagedRules
 		} else {
 			ruleSet = append([]poltergeist.Rule{}, packagedRules...)
-			dummyRules := generateDummyRules(dummyCount)
+			dummyRules := generateDummyRules(dummyCount, seed)
 			ruleSet = append(ruleSet, dummyRules...)
 		}
 
 		// Skip scenario if it exceeds max rules limit
 		if *maxRules > 0 && len(ruleSet) > *maxRules {
 			if dummyCount == 0 {
-				fmt.Printf("=== Skipping %d packaged rules (exceeds max-rules=%d) ===\n", len(packagedRules), *maxRules)
+				fmt.Fprintf(progress, "=== Skipping %d packaged rules (exceeds max-rules=%d) ===\n", len(packagedRules), *maxRules)
 			} else {
-				fmt.Printf("=== Skipping %d packaged + %d dummy rules (%d total, exceeds max-rules=%d) ===\n",
+				fmt.Fprintf(progress, "=== Skipping %d packaged + %d dummy rules (%d total, exceeds max-rules=%d) ===\n",
 					len(packagedRules), dummyCount, len(ruleSet), *maxRules)
 			}
-			fmt.Println()
+			fmt.Fprintln(progress)
 			continue
 		}
 
 		// Print scenario information
 		if dummyCount == 0 {
-			fmt.Printf("=== Testing with %d packaged rules ===\n", len(packagedRules))
+			fmt.Fprintf(progress, "=== Testing with %d packaged rules ===\n", len(packagedRules))
 		} else {
-			fmt.Printf("=== Testing with %d packaged + %d dummy rules (%d total) ===\n",
+			fmt.Fprintf(progress, "=== Testing with %d packaged + %d dummy rules (%d total) ===\n",
 				len(packagedRules), dummyCount, len(ruleSet))
 		}
 
-		// Test with selected engine(s)
-		if *engine == "go" || *engine == "all" {
-			goResult := benchmarkEngine("go", ruleSet, benchmarkDir)
-			allResults = append(allResults, goResult)
-			printResult(goResult)
-		}
+		// Test with selected engine(s) in each selected mode
+		for _, scanMode := range modes {
+			if *engine == "go" || *engine == "all" {
+				goResult := benchmarkEngine("go", scanMode, ruleSet, benchmarkDir)
+				goResult.DummyRules = dummyCount
+				goResult.Seed = seed
+				allResults = append(allResults, goResult)
+				printResult(progress, goResult)
+			}
 
-		if *engine == "hyperscan" || *engine == "all" {
-			if poltergeist.IsHyperscanAvailable() {
-				hyperscanResult := benchmarkEngine("hyperscan", ruleSet, benchmarkDir)
-				allResults = append(allResults, hyperscanResult)
-				printResult(hyperscanResult)
-			} else {
-				if *engine == "hyperscan" {
-					log.Fatalf("Hyperscan engine requested but not available")
+			// Hyperscan is benchmarked both reporting the first match of each
+			// pattern and reporting start offsets with SomLeftMost
+			for _, hsEngine := range []string{"hyperscan", "hyperscan-som"} {
+				if *engine != hsEngine && *engine != "all" {
+					continue
+				}
+				if poltergeist.IsHyperscanAvailable() {
+					hyperscanResult := benchmarkEngine(hsEngine, scanMode, ruleSet, benchmarkDir)
+					hyperscanResult.DummyRules = dummyCount
+					hyperscanResult.Seed = seed
+					allResults = append(allResults, hyperscanResult)
+					printResult(progress, hyperscanResult)
+				} else {
+					if *engine == hsEngine {
+						log.Fatalf("Hyperscan engine requested but not available")
+					}
+					fmt.Fprintf(progress, "%s engine not available, skipping...\n", hsEngine)
 				}
-				fmt.Println("Hyperscan engine not available, skipping...")
 			}
 		}
 
-		fmt.Println()
+		fmt.Fprintln(progress)
+	}
+
+	if *jsonOutput {
+		if err := writeJSONResults(os.Stdout, allResults); err != nil {
+			log.Fatalf("Failed to write JSON results: %v", err)
+		}
+		return
 	}
 
 	// Print summary table
 	printSummaryTable(allResults)
 }
 
-// generateDummyRules creates dummy rules with the specified pattern
-func generateDummyRules(count int) []poltergeist.Rule {
+// selectRules returns the rules with the given comma-separated IDs
+func selectRules(rules []poltergeist.Rule, ids string) ([]poltergeist.Rule, error) {
+	var wanted []string
+	for _, id := range strings.Split(ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			wanted = append(wanted, id)
+		}
+	}
+	if len(wanted) == 0 {
+		return nil, fmt.Errorf("no rule IDs given")
+	}
+	return poltergeist.FilterRulesByID(rules, wanted)
+}
+
+// dummyCharsets are the character classes dummy rule secrets are drawn from,
+// with the characters their test secrets are generated from
+var dummyCharsets = []struct {
+	class  string
+	sample string
+}{
+	{class: `[A-Z0-9+/-]`, sample: "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"},
+	{class: `[A-Z0-9]`, sample: "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"},
+	{class: `[A-F0-9]`, sample: "0123456789abcdef"},
+}
+
+// parseSeed parses the -seed flag: an integer, or random for a seed picked
+// from the time, which is printed so the run can still be reproduced
+func parseSeed(value string) (int64, error) {
+	if value == "random" {
+		return time.Now().UnixNano(), nil
+	}
+	seed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid seed '%s'. Must be an integer or 'random'", value)
+	}
+	return seed, nil
+}
+
+// generateDummyRules creates dummy rules whose secret length, character
+// class, keyword distance, and entropy threshold vary with seed. The same
+// seed always generates the same rules.
+func generateDummyRules(count int, seed int64) []poltergeist.Rule {
+	rng := rand.New(rand.NewPCG(uint64(seed), 0))
 	rules := make([]poltergeist.Rule, count)
 
 	for i := 0; i < count; i++ {
 		ruleNum := fmt.Sprintf("%04d", i+1)
+		charset := dummyCharsets[rng.IntN(len(dummyCharsets))]
+		length := 20 + rng.IntN(69)
+		distance := 10 + rng.IntN(41)
+		entropy := 3.0 + float64(rng.IntN(21))/10
+
+		secret := make([]byte, length)
+		for j := range secret {
+			secret[j] = charset.sample[rng.IntN(len(charset.sample))]
+		}
+
 		rules[i] = poltergeist.Rule{
 			Name: fmt.Sprintf("Dummy Rule %s", ruleNum),
 			ID:   fmt.Sprintf("dummy.%s", ruleNum),
@@ -145,13 +288,13 @@ func generateDummyRules(count int) []poltergeist.Rule {
 			Pattern: fmt.Sprintf(`(?x)
         \b
           (?i)DUMMY%s\w*
-          [\W]{0,40}?
-          ((?i)[A-Z0-9+/-]{86,88}={0,2})
-        \b`, ruleNum),
+          [\W]{0,%d}?
+          ((?i)%s{%d})
+        \b`, ruleNum, distance, charset.class, length),
 			Redact:  []int{4, 4},
-			Entropy: 5.0,
+			Entropy: entropy,
 			Tests: poltergeist.Test{
-				Assert:    []string{fmt.Sprintf("DUMMY%s_KEY=ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789+/ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789+/==", ruleNum)},
+				Assert:    []string{fmt.Sprintf("DUMMY%s_KEY=%s", ruleNum, secret)},
 				AssertNot: []string{"not a match"},
 			},
 			History: []string{"Generated for benchmark testing"},
@@ -161,10 +304,11 @@ func generateDummyRules(count int) []poltergeist.Rule {
 	return rules
 }
 
-// benchmarkEngine tests a single engine with the given rule set
-func benchmarkEngine(engineType string, rules []poltergeist.Rule, benchmarkDir string) BenchmarkResult {
+// benchmarkEngine tests a single engine in the given scan mode with the given rule set
+func benchmarkEngine(engineType string, mode string, rules []poltergeist.Rule, benchmarkDir string) BenchmarkResult {
 	result := BenchmarkResult{
 		Engine:    engineType,
+		Mode:      mode,
 		RuleCount: len(rules),
 	}
 
@@ -175,6 +319,8 @@ func benchmarkEngine(engineType string, rules []poltergeist.Rule, benchmarkDir s
 		engine = poltergeist.NewGoRegexEngine()
 	case "hyperscan":
 		engine = poltergeist.NewHyperscanEngine()
+	case "hyperscan-som":
+		engine = poltergeist.NewHyperscanSOMEngine()
 	default:
 		log.Fatalf("Unknown engine type: %s", engineType)
 	}
@@ -190,14 +336,17 @@ func benchmarkEngine(engineType string, rules []poltergeist.Rule, benchmarkDir s
 
 	// Create scanner
 	scanner := poltergeist.NewScanner(engine)
+	scanner.WholeFile = mode == "content"
 
-	// Measure scan time
+	// Measure scan time and peak heap
+	stopSampling := samplePeakHeap()
 	scanStart := time.Now()
 	_, err = scanner.ScanDirectory(benchmarkDir)
+	result.ScanDuration = time.Since(scanStart)
+	result.PeakHeapBytes = stopSampling()
 	if err != nil {
 		log.Fatalf("Failed to scan directory with %s engine: %v", engineType, err)
 	}
-	result.ScanDuration = time.Since(scanStart)
 
 	// Copy metrics
 	result.FilesScanned = scanner.Metrics.FilesScanned
@@ -213,18 +362,59 @@ func benchmarkEngine(engineType string, rules []poltergeist.Rule, benchmarkDir s
 	return result
 }
 
-// printResult prints the results of a single benchmark run
-func printResult(result BenchmarkResult) {
-	fmt.Printf("Engine: %s\n", result.Engine)
-	fmt.Printf("  Rules: %d\n", result.RuleCount)
-	fmt.Printf("  Compilation Time: %v\n", result.CompileDuration)
-	fmt.Printf("  Scan Time: %v\n", result.ScanDuration)
-	fmt.Printf("  Files Scanned: %d\n", result.FilesScanned)
-	fmt.Printf("  Files Skipped: %d\n", result.FilesSkipped)
-	fmt.Printf("  Total Bytes: %s\n", poltergeist.FormatBytes(result.TotalBytes))
-	fmt.Printf("  Matches Found: %d\n", result.MatchesFound)
-	fmt.Printf("  Throughput: %.2f MB/s\n", result.ThroughputMBPS)
-	fmt.Println()
+// samplePeakHeap forces a GC, then samples the heap every millisecond until
+// the returned function is called, which returns the highest allocation seen
+func samplePeakHeap() func() int64 {
+	runtime.GC()
+	done := make(chan struct{})
+	sampled := make(chan uint64)
+	go func() {
+		var stats runtime.MemStats
+		var highest uint64
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			runtime.ReadMemStats(&stats)
+			highest = max(highest, stats.HeapAlloc)
+			select {
+			case <-done:
+				sampled <- highest
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() int64 {
+		close(done)
+		return int64(<-sampled)
+	}
+}
+
+// writeJSONResults writes results to w as an indented JSON array
+func writeJSONResults(w io.Writer, results []BenchmarkResult) error {
+	if results == nil {
+		results = []BenchmarkResult{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
+
+// printResult prints the results of a single benchmark run to w
+func printResult(w io.Writer, result BenchmarkResult) {
+	fmt.Fprintf(w, "Engine: %s\n", result.Engine)
+	fmt.Fprintf(w, "  Mode: %s\n", result.Mode)
+	fmt.Fprintf(w, "  Rules: %d\n", result.RuleCount)
+	fmt.Fprintf(w, "  Compilation Time: %v\n", result.CompileDuration)
+	fmt.Fprintf(w, "  Scan Time: %v\n", result.ScanDuration)
+	fmt.Fprintf(w, "  Files Scanned: %d\n", result.FilesScanned)
+	fmt.Fprintf(w, "  Files Skipped: %d\n", result.FilesSkipped)
+	fmt.Fprintf(w, "  Total Bytes: %s\n", poltergeist.FormatBytes(result.TotalBytes))
+	fmt.Fprintf(w, "  Matches Found: %d\n", result.MatchesFound)
+	fmt.Fprintf(w, "  Throughput: %.2f MB/s\n", result.ThroughputMBPS)
+	fmt.Fprintf(w, "  Peak Heap: %s\n", poltergeist.FormatBytes(result.PeakHeapBytes))
+	fmt.Fprintln(w)
 }
 
 // printSummaryTable prints a comparison table of all results
@@ -233,22 +423,24 @@ func printSummaryTable(results []BenchmarkResult) {
 	fmt.Println()
 
 	// Header
-	fmt.Printf("%-12s %-6s %-12s %-12s %-12s %-8s %-12s\n",
-		"Engine", "Rules", "Compile(ms)", "Scan(ms)", "Total(ms)", "Matches", "Throughput")
-	fmt.Printf("%-12s %-6s %-12s %-12s %-12s %-8s %-12s\n",
-		"--------", "-----", "-----------", "--------", "---------", "-------", "----------")
+	fmt.Printf("%-14s %-8s %-6s %-12s %-12s %-12s %-8s %-12s %-12s\n",
+		"Engine", "Mode", "Rules", "Compile(ms)", "Scan(ms)", "Total(ms)", "Matches", "Throughput", "Peak Heap")
+	fmt.Printf("%-14s %-8s %-6s %-12s %-12s %-12s %-8s %-12s %-12s\n",
+		"--------", "-------", "-----", "-----------", "--------", "---------", "-------", "----------", "---------")
 
 	// Data rows
 	for _, result := range results {
 		totalTime := result.CompileDuration + result.ScanDuration
-		fmt.Printf("%-12s %-6d %-12.1f %-12.1f %-12.1f %-8d %-12.2f\n",
+		fmt.Printf("%-14s %-8s %-6d %-12.1f %-12.1f %-12.1f %-8d %-12.2f %-12s\n",
 			result.Engine,
+			result.Mode,
 			result.RuleCount,
 			float64(result.CompileDuration.Nanoseconds())/1e6,
 			float64(result.ScanDuration.Nanoseconds())/1e6,
 			float64(totalTime.Nanoseconds())/1e6,
 			result.MatchesFound,
 			result.ThroughputMBPS,
+			poltergeist.FormatBytes(result.PeakHeapBytes),
 		)
 	}
 
@@ -257,72 +449,155 @@ func printSummaryTable(results []BenchmarkResult) {
 	// Performance comparison
 	fmt.Println("=== PERFORMANCE ANALYSIS ===")
 
-	// Group results by rule count
+	fmt.Printf("%-6s %-8s %-15s %-15s %-15s %-15s\n", "Rules", "Mode", "Go Total(ms)", "HS Total(ms)", "SOM Total(ms)", "Speedup")
+	fmt.Printf("%-6s %-8s %-15s %-15s %-15s %-15s\n", "-----", "-------", "------------", "------------", "-------------", "-------")
+
+	for _, row := range summaryRows(results) {
+		goTime, hasGo := row.Totals["go"]
+		hsTime, hasHS := row.Totals["hyperscan"]
+
+		speedup := "N/A"
+		if hasGo && hasHS && hsTime > 0 {
+			speedup = fmt.Sprintf("%.2fx", float64(goTime.Nanoseconds())/float64(hsTime.Nanoseconds()))
+		}
+
+		// Mark the packaged rules only scenario
+		rulesDisplay := fmt.Sprintf("%d", row.RuleCount)
+		if row.Packaged {
+			rulesDisplay += "*"
+		}
+
+		fmt.Printf("%-6s %-8s %-15s %-15s %-15s %-15s\n", rulesDisplay, row.Mode,
+			formatTotal(row.Totals, "go"), formatTotal(row.Totals, "hyperscan"), formatTotal(row.Totals, "hyperscan-som"), speedup)
+	}
+
+	fmt.Println()
+	fmt.Println("* = packaged rules only")
+	fmt.Println("HS = Hyperscan/Vectorscan")
+	fmt.Println("SOM = Hyperscan/Vectorscan with SomLeftMost")
+
+	printModeComparison(results)
+}
+
+// summaryRow is a row of the performance analysis: the total compile and scan
+// time of each engine for one rule count and scan mode
+type summaryRow struct {
+	RuleCount int
+	Packaged  bool // Packaged rules only, without dummy rules
+	Mode      string
+	Totals    map[string]time.Duration
+}
+
+// summaryRows groups results by rule count, in ascending order, then by scan
+// mode, in order of first appearance
+func summaryRows(results []BenchmarkResult) []summaryRow {
 	ruleGroups := make(map[int][]BenchmarkResult)
 	for _, result := range results {
 		ruleGroups[result.RuleCount] = append(ruleGroups[result.RuleCount], result)
 	}
 
-	fmt.Printf("%-6s %-15s %-15s %-15s\n", "Rules", "Go Total(ms)", "HS Total(ms)", "Speedup")
-	fmt.Printf("%-6s %-15s %-15s %-15s\n", "-----", "------------", "------------", "-------")
-
-	// Get all rule counts from results and sort them
-	ruleCounts := make([]int, 0)
+	ruleCounts := make([]int, 0, len(ruleGroups))
 	for ruleCount := range ruleGroups {
 		ruleCounts = append(ruleCounts, ruleCount)
 	}
-
-	// Simple sort
-	for i := 0; i < len(ruleCounts); i++ {
-		for j := i + 1; j < len(ruleCounts); j++ {
-			if ruleCounts[i] > ruleCounts[j] {
-				ruleCounts[i], ruleCounts[j] = ruleCounts[j], ruleCounts[i]
+	sort.Ints(ruleCounts)
+
+	var rows []summaryRow
+	for _, ruleCount := range ruleCounts {
+		group := ruleGroups[ruleCount]
+		for _, mode := range resultModes(group) {
+			row := summaryRow{RuleCount: ruleCount, Mode: mode, Totals: make(map[string]time.Duration)}
+			for _, result := range group {
+				if result.Mode != mode {
+					continue
+				}
+				row.Totals[result.Engine] = result.CompileDuration + result.ScanDuration
+				row.Packaged = result.DummyRules == 0
 			}
+			rows = append(rows, row)
 		}
 	}
+	return rows
+}
 
-	for _, rules := range ruleCounts {
-		group := ruleGroups[rules]
-
-		var goTime, hsTime time.Duration
-		var hasGo, hasHS bool
+// formatTotal formats an engine's total time in milliseconds, or N/A if it
+// wasn't benchmarked
+func formatTotal(totals map[string]time.Duration, engine string) string {
+	total, ok := totals[engine]
+	if !ok {
+		return "N/A"
+	}
+	return fmt.Sprintf("%.1f", float64(total.Nanoseconds())/1e6)
+}
 
-		for _, result := range group {
-			totalTime := result.CompileDuration + result.ScanDuration
-			if result.Engine == "go" {
-				goTime = totalTime
-				hasGo = true
-			} else if result.Engine == "hyperscan" {
-				hsTime = totalTime
-				hasHS = true
-			}
-		}
+// printModeComparison compares line and content mode for each engine and rule
+// count, flagging runs where the two modes found a different number of matches
+// (content mode can find secrets spanning multiple lines that line mode misses)
+func printModeComparison(results []BenchmarkResult) {
+	type modeKey struct {
+		engine    string
+		ruleCount int
+	}
 
-		speedup := "N/A"
-		if hasGo && hasHS && hsTime > 0 {
-			speedup = fmt.Sprintf("%.2fx", float64(goTime.Nanoseconds())/float64(hsTime.Nanoseconds()))
+	lineResults := make(map[modeKey]BenchmarkResult)
+	contentResults := make(map[modeKey]BenchmarkResult)
+	var keys []modeKey
+	for _, result := range results {
+		key := modeKey{engine: result.Engine, ruleCount: result.RuleCount}
+		switch result.Mode {
+		case "line":
+			lineResults[key] = result
+			keys = append(keys, key)
+		case "content":
+			contentResults[key] = result
 		}
+	}
 
-		goTimeStr := "N/A"
-		if hasGo {
-			goTimeStr = fmt.Sprintf("%.1f", float64(goTime.Nanoseconds())/1e6)
-		}
+	// Nothing to compare unless both modes were benchmarked
+	if len(lineResults) == 0 || len(contentResults) == 0 {
+		return
+	}
 
-		hsTimeStr := "N/A"
-		if hasHS {
-			hsTimeStr = fmt.Sprintf("%.1f", float64(hsTime.Nanoseconds())/1e6)
+	fmt.Println()
+	fmt.Println("=== MODE COMPARISON ===")
+	fmt.Printf("%-14s %-6s %-14s %-14s %-14s %-16s %-10s\n",
+		"Engine", "Rules", "Line MB/s", "Content MB/s", "Line Matches", "Content Matches", "Difference")
+	fmt.Printf("%-14s %-6s %-14s %-14s %-14s %-16s %-10s\n",
+		"--------", "-----", "---------", "------------", "------------", "---------------", "----------")
+
+	for _, key := range keys {
+		line := lineResults[key]
+		content, ok := contentResults[key]
+		if !ok {
+			continue
 		}
 
-		// Adjust rules display for packaged rules
-		rulesDisplay := fmt.Sprintf("%d", rules)
-		if rules == 0 && len(results) > 0 {
-			rulesDisplay = fmt.Sprintf("%d*", results[0].RuleCount) // First result should be packaged rules
+		difference := "-"
+		if line.MatchesFound != content.MatchesFound {
+			difference = fmt.Sprintf("%+d", content.MatchesFound-line.MatchesFound)
 		}
 
-		fmt.Printf("%-6s %-15s %-15s %-15s\n", rulesDisplay, goTimeStr, hsTimeStr, speedup)
+		fmt.Printf("%-14s %-6d %-14.2f %-14.2f %-14d %-16d %-10s\n",
+			key.engine,
+			key.ruleCount,
+			line.ThroughputMBPS,
+			content.ThroughputMBPS,
+			line.MatchesFound,
+			content.MatchesFound,
+			difference,
+		)
 	}
+}
 
-	fmt.Println()
-	fmt.Println("* = packaged rules only")
-	fmt.Println("HS = Hyperscan/Vectorscan")
+// resultModes returns the distinct scan modes in results, in order of first appearance
+func resultModes(results []BenchmarkResult) []string {
+	var modes []string
+	seen := make(map[string]bool)
+	for _, result := range results {
+		if !seen[result.Mode] {
+			seen[result.Mode] = true
+			modes = append(modes, result.Mode)
+		}
+	}
+	return modes
 }
@@ -1,91 +1,424 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync/atomic"
+	"text/tabwriter"
 	"time"
 
 	poltergeist "github.com/ghostsecurity/poltergeist/pkg"
 )
 
 const (
-	colorRed    = "\033[31m"
-	colorGreen  = "\033[32m"
-	colorYellow = "\033[33m"
-	colorCyan   = "\033[36m"
-	colorReset  = "\033[0m"
-	colorBold   = "\033[1m"
+	colorRed     = "\033[31m"
+	colorGreen   = "\033[32m"
+	colorYellow  = "\033[33m"
+	colorCyan    = "\033[36m"
+	colorMagenta = "\033[35m"
+	colorReset   = "\033[0m"
+	colorBold    = "\033[1m"
 )
 
 // printUsage displays the command usage information
 func printUsage() {
-	fmt.Fprintf(os.Stderr, "Usage: %s [options] <directory_path|file_path> [pattern1] [pattern2] ...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <directory_path|file_path|repository_url|-> [pattern1] [pattern2] ...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [options] <path> [path] ... -- [pattern1] [pattern2] ...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [options] -pattern <pattern> <path> [path] ...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s <command> [arguments]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  validate <rules_path> [rules_path] ...\n")
+	fmt.Fprintf(os.Stderr, "        Check rule files and run their test cases, exiting %d if any rule fails\n", exitFindings)
+	fmt.Fprintf(os.Stderr, "  test -pattern <regex> -input <string> [-entropy float]\n")
+	fmt.Fprintf(os.Stderr, "        Show how each engine matches a pattern against sample input, exiting %d if nothing matches\n", exitFindings)
+	fmt.Fprintf(os.Stderr, "  new-rule -id <id> -name <name> [-output file]\n")
+	fmt.Fprintf(os.Stderr, "        Write a rule file with every required field and placeholders to fill in\n")
+	fmt.Fprintf(os.Stderr, "\nTo scan a path named like a command, prefix it with ./\n")
 	fmt.Fprintf(os.Stderr, "\nOptions:\n")
 	fmt.Fprintf(os.Stderr, "  -engine string\n")
 	fmt.Fprintf(os.Stderr, "        Pattern engine: 'auto' (default), 'go', or 'hyperscan'\n")
+	fmt.Fprintf(os.Stderr, "  -strict\n")
+	fmt.Fprintf(os.Stderr, "        Fail instead of skipping rules the engine can't compile\n")
+	fmt.Fprintf(os.Stderr, "  -config string\n")
+	fmt.Fprintf(os.Stderr, "        Read settings from a YAML config file (default: %s in the scanned directory, if present)\n", poltergeist.ConfigFile)
 	fmt.Fprintf(os.Stderr, "  -rules string\n")
-	fmt.Fprintf(os.Stderr, "        YAML file or directory containing pattern rules (optional - uses built-in rules if not specified)\n")
+	fmt.Fprintf(os.Stderr, "        Comma-separated YAML files or directories containing pattern rules (optional - uses built-in rules if not specified)\n")
+	fmt.Fprintf(os.Stderr, "  -pattern value\n")
+	fmt.Fprintf(os.Stderr, "        Add a pattern as a rule (repeatable); every argument is then a path to scan\n")
+	fmt.Fprintf(os.Stderr, "  -rule-id value\n")
+	fmt.Fprintf(os.Stderr, "        Only run the rules with these IDs (repeatable or comma-separated)\n")
+	fmt.Fprintf(os.Stderr, "  -tags string\n")
+	fmt.Fprintf(os.Stderr, "        Only run rules with at least one of these comma-separated tags (case-insensitive)\n")
+	fmt.Fprintf(os.Stderr, "  -exclude-tags string\n")
+	fmt.Fprintf(os.Stderr, "        Skip rules with any of these comma-separated tags (case-insensitive)\n")
 	fmt.Fprintf(os.Stderr, "  -dnr\n")
 	fmt.Fprintf(os.Stderr, "        Do not redact - show full matches instead of redacted versions\n")
 	fmt.Fprintf(os.Stderr, "  -low-entropy\n")
 	fmt.Fprintf(os.Stderr, "        Show matches that don't meet minimum entropy requirements\n")
+	fmt.Fprintf(os.Stderr, "  -entropy-threshold float\n")
+	fmt.Fprintf(os.Stderr, "        Replace every rule's minimum entropy with this value, 0 to report every match (default: each rule's own threshold)\n")
+	fmt.Fprintf(os.Stderr, "  -min-severity string\n")
+	fmt.Fprintf(os.Stderr, "        Only report findings at or above a severity: 'low', 'medium', 'high', or 'critical'\n")
+	fmt.Fprintf(os.Stderr, "  -explain-matches\n")
+	fmt.Fprintf(os.Stderr, "        Explain why each match was or wasn't flagged (entropy, threshold, charset, length)\n")
+	fmt.Fprintf(os.Stderr, "  -decode\n")
+	fmt.Fprintf(os.Stderr, "        Also scan the decoded content of base64 and hex strings of 20 or more characters\n")
+	fmt.Fprintf(os.Stderr, "  -git-blame\n")
+	fmt.Fprintf(os.Stderr, "        Show the author and commit of the last change to each finding's line, for files in git working trees\n")
+	fmt.Fprintf(os.Stderr, "  -whole-file\n")
+	fmt.Fprintf(os.Stderr, "        Scan each file as a single block so matches such as PEM private keys can span lines\n")
 	fmt.Fprintf(os.Stderr, "  -format string\n")
-	fmt.Fprintf(os.Stderr, "        Output format: 'text' (default), 'json', or 'md'\n")
+	fmt.Fprintf(os.Stderr, "        Output format: 'text' (default), 'json', 'md', 'sarif', 'csv', or 'html'\n")
+	fmt.Fprintf(os.Stderr, "        JSON output follows docs/scan-results.schema.json; raw matches are only included in JSON and CSV with -dnr\n")
+	fmt.Fprintf(os.Stderr, "  -group\n")
+	fmt.Fprintf(os.Stderr, "        In text output, list each secret found by a rule once, with every file and line it appears on\n")
 	fmt.Fprintf(os.Stderr, "  -output string\n")
-	fmt.Fprintf(os.Stderr, "        Write output to file (auto-detects format from .json or .md extension)\n")
+	fmt.Fprintf(os.Stderr, "        Write output to file, replacing it, with progress on stderr (auto-detects format from .json, .md, .sarif, .csv, or .html extension)\n")
+	fmt.Fprintf(os.Stderr, "  -quiet\n")
+	fmt.Fprintf(os.Stderr, "        Only print findings and the scan summary, and errors (not the banner, rule list, or notices)\n")
+	fmt.Fprintf(os.Stderr, "  -verbose\n")
+	fmt.Fprintf(os.Stderr, "        Log each file scanned, or skipped with the reason, to stderr\n")
+	fmt.Fprintf(os.Stderr, "  -color string\n")
+	fmt.Fprintf(os.Stderr, "        Color text output: 'auto' (default, only when stdout is a terminal and NO_COLOR is unset), 'always', or 'never'\n")
 	fmt.Fprintf(os.Stderr, "  -no-color\n")
-	fmt.Fprintf(os.Stderr, "        Disable colored output (text format only)\n")
+	fmt.Fprintf(os.Stderr, "        Disable colored output, the same as -color never\n")
+	fmt.Fprintf(os.Stderr, "  -workers int\n")
+	fmt.Fprintf(os.Stderr, "        Number of files scanned in parallel (default: twice the number of CPUs)\n")
+	fmt.Fprintf(os.Stderr, "  -max-file-size size\n")
+	fmt.Fprintf(os.Stderr, "        Skip files larger than this size, in bytes or with a KB, MB, or GB suffix (default: 100MB)\n")
+	fmt.Fprintf(os.Stderr, "  -mmap-threshold size\n")
+	fmt.Fprintf(os.Stderr, "        Memory-map files of at least this size and scan each as a single block, which allocates less for large files (default: off)\n")
+	fmt.Fprintf(os.Stderr, "  -include value\n")
+	fmt.Fprintf(os.Stderr, "        Only scan files matching these path globs, such as '**/*.env' (repeatable or comma-separated)\n")
+	fmt.Fprintf(os.Stderr, "  -exclude value\n")
+	fmt.Fprintf(os.Stderr, "        Don't scan paths matching these globs, such as 'testdata/**' (repeatable or comma-separated)\n")
+	fmt.Fprintf(os.Stderr, "  -follow-symlinks\n")
+	fmt.Fprintf(os.Stderr, "        Walk symbolic links to directories, such as mounted trees, scanning each directory once\n")
+	fmt.Fprintf(os.Stderr, "  -no-ignore\n")
+	fmt.Fprintf(os.Stderr, "        Scan files excluded by .gitignore and .poltergeistignore files\n")
+	fmt.Fprintf(os.Stderr, "  -history[=depth]\n")
+	fmt.Fprintf(os.Stderr, "        Scan every file version committed to the git repository at the scan path, optionally only in the most recent depth commits\n")
+	fmt.Fprintf(os.Stderr, "  -diff string\n")
+	fmt.Fprintf(os.Stderr, "        Only report findings added since this older version of the scanned directory or file\n")
+	fmt.Fprintf(os.Stderr, "  -baseline string\n")
+	fmt.Fprintf(os.Stderr, "        Suppress findings recorded in a baseline file, reporting only new findings\n")
+	fmt.Fprintf(os.Stderr, "  -write-baseline string\n")
+	fmt.Fprintf(os.Stderr, "        Write a baseline of the reported findings to a file (before -baseline filtering)\n")
+	fmt.Fprintf(os.Stderr, "  -stats\n")
+	fmt.Fprintf(os.Stderr, "        Print the number of matches per rule after the scan, before entropy and severity filtering\n")
+	fmt.Fprintf(os.Stderr, "  -fail-fast\n")
+	fmt.Fprintf(os.Stderr, "        Stop scanning at the first finding that meets its entropy threshold (for gating runs)\n")
+	fmt.Fprintf(os.Stderr, "  -exit-zero\n")
+	fmt.Fprintf(os.Stderr, "        Exit with code 0 even when findings are reported (for non-gating runs)\n")
 	fmt.Fprintf(os.Stderr, "  -help\n")
 	fmt.Fprintf(os.Stderr, "        Show this help message\n")
 	fmt.Fprintf(os.Stderr, "  -version\n")
 	fmt.Fprintf(os.Stderr, "        Show version information\n")
+	fmt.Fprintf(os.Stderr, "\nSeveral paths can be scanned at once when they are followed by -- or patterns\n")
+	fmt.Fprintf(os.Stderr, "are given with -pattern. The config file is looked for in the first path.\n")
+	fmt.Fprintf(os.Stderr, "\nA path of - scans standard input, reported as %s.\n", stdinName)
+	fmt.Fprintf(os.Stderr, "A git repository URL is shallow cloned to a temporary directory and scanned;\n")
+	fmt.Fprintf(os.Stderr, "set %s to an access token to clone private repositories over HTTPS.\n", gitTokenEnv)
 	fmt.Fprintf(os.Stderr, "\nIf no rules are specified via -rules flag or command-line patterns,\n")
 	fmt.Fprintf(os.Stderr, "the tool will use built-in detection rules for common secrets.\n")
 	fmt.Fprintf(os.Stderr, "\nBy default, only matches that meet minimum entropy requirements are shown.\n")
-	fmt.Fprintf(os.Stderr, "Use -low-entropy to see all matches including low-entropy false positives.\n")
+	fmt.Fprintf(os.Stderr, "Use -entropy-threshold to try a different threshold for every rule, or\n")
+	fmt.Fprintf(os.Stderr, "-low-entropy to disable entropy filtering entirely and see all matches\n")
+	fmt.Fprintf(os.Stderr, "including low-entropy false positives.\n")
+	fmt.Fprintf(os.Stderr, "\nA config file can set workers, max_file_size, engine, tags, exclude_tags,\n")
+	fmt.Fprintf(os.Stderr, "skip_dirs, entropy_threshold, format, include, and exclude.\n")
+	fmt.Fprintf(os.Stderr, "Flags given on the command line override its settings.\n")
+	fmt.Fprintf(os.Stderr, "\nExit codes:\n")
+	fmt.Fprintf(os.Stderr, "  %d    No findings reported (or -exit-zero was set)\n", exitOK)
+	fmt.Fprintf(os.Stderr, "  %d    At least one finding reported, after entropy filtering\n", exitFindings)
+	fmt.Fprintf(os.Stderr, "  %d    Invalid usage, rules, or output, or the scan failed\n", exitError)
+	fmt.Fprintf(os.Stderr, "  %d  Scan interrupted; partial results reported\n", exitInterrupted)
 }
 
+// Exit codes
+const (
+	exitOK          = 0   // Scan completed with no findings (or -exit-zero was set)
+	exitFindings    = 1   // Scan completed and reported at least one finding
+	exitError       = 2   // Invalid usage, rules, or output, or the scan failed
+	exitInterrupted = 130 // Scan was interrupted with Ctrl-C; partial results were reported
+)
+
 // Version information (set by build)
 var version = "dev"
 
+// stdinPath is the scan path that reads standard input, and stdinName the
+// file path its findings are reported under
+const (
+	stdinPath = "-"
+	stdinName = "<stdin>"
+)
+
+// gitTokenEnv is the environment variable holding the access token for
+// cloning private repositories
+const gitTokenEnv = "POLTERGEIST_GIT_TOKEN"
+
 // Command-line flags
 var (
-	engineFlag     = flag.String("engine", "auto", "Pattern engine to use: 'auto', 'go' for Go regex, 'hyperscan' for Hyperscan/Vectorscan")
-	rulesFlag      = flag.String("rules", "", "YAML file or directory containing pattern rules")
-	dnrFlag        = flag.Bool("dnr", false, "Do not redact - show full matches instead of redacted versions")
-	lowEntropyFlag = flag.Bool("low-entropy", false, "Show matches that don't meet minimum entropy requirements")
-	formatFlag     = flag.String("format", "text", "Output format: text, json, md")
-	outputFlag     = flag.String("output", "", "Write output to file (auto-detects format from extension)")
-	noColorFlag    = flag.Bool("no-color", false, "Disable colored output (text format only)")
-	helpFlag       = flag.Bool("help", false, "Show help message")
-	versionFlag    = flag.Bool("version", false, "Show version information")
+	engineFlag        = flag.String("engine", "auto", "Pattern engine to use: 'auto', 'go' for Go regex, 'hyperscan' for Hyperscan/Vectorscan")
+	strictFlag        = flag.Bool("strict", false, "Fail instead of skipping rules the engine can't compile")
+	configFlag        = flag.String("config", "", "Read settings from this YAML config file instead of "+poltergeist.ConfigFile+" in the scanned directory")
+	rulesFlag         = flag.String("rules", "", "Comma-separated YAML files or directories containing pattern rules")
+	tagsFlag          = flag.String("tags", "", "Only run rules with at least one of these comma-separated tags")
+	excludeTagsFlag   = flag.String("exclude-tags", "", "Skip rules with any of these comma-separated tags")
+	dnrFlag           = flag.Bool("dnr", false, "Do not redact - show full matches instead of redacted versions")
+	lowEntropyFlag    = flag.Bool("low-entropy", false, "Show matches that don't meet minimum entropy requirements")
+	entropyFlag       = flag.Float64("entropy-threshold", 0, "Replace every rule's minimum entropy with this value")
+	minSeverityFlag   = flag.String("min-severity", "", "Only report findings at or above this severity: low, medium, high, critical")
+	explainFlag       = flag.Bool("explain-matches", false, "Explain why each match was or wasn't flagged")
+	decodeFlag        = flag.Bool("decode", false, "Also scan the decoded content of base64 and hex strings")
+	gitBlameFlag      = flag.Bool("git-blame", false, "Show who last changed each finding's line, using git blame")
+	wholeFileFlag     = flag.Bool("whole-file", false, "Scan each file as a single block so matches can span lines")
+	formatFlag        = flag.String("format", "text", "Output format: text, json, md, sarif, csv, html")
+	groupFlag         = flag.Bool("group", false, "List each secret once with all of its locations in text output")
+	outputFlag        = flag.String("output", "", "Write output to file (auto-detects format from extension)")
+	quietFlag         = flag.Bool("quiet", false, "Only print findings, the scan summary, and errors")
+	verboseFlag       = flag.Bool("verbose", false, "Log each file scanned or skipped to stderr")
+	colorFlag         = flag.String("color", colorAuto, "Color text output: auto, always, never")
+	noColorFlag       = flag.Bool("no-color", false, "Disable colored output (same as -color never)")
+	noIgnoreFlag      = flag.Bool("no-ignore", false, "Scan files excluded by .gitignore and .poltergeistignore")
+	followFlag        = flag.Bool("follow-symlinks", false, "Walk symbolic links to directories")
+	exitZeroFlag      = flag.Bool("exit-zero", false, "Exit with code 0 even when findings are reported")
+	diffFlag          = flag.String("diff", "", "Only report findings added since this older version of the scan path")
+	baselineFlag      = flag.String("baseline", "", "Suppress findings recorded in this baseline file")
+	writeBaselineFlag = flag.String("write-baseline", "", "Write a baseline of the reported findings to this file")
+	statsFlag         = flag.Bool("stats", false, "Print the number of matches per rule after the scan")
+	failFastFlag      = flag.Bool("fail-fast", false, "Stop scanning at the first finding")
+	workersFlag       = flag.Int("workers", runtime.NumCPU()*2, "Number of files scanned in parallel")
+	helpFlag          = flag.Bool("help", false, "Show help message")
+	versionFlag       = flag.Bool("version", false, "Show version information")
 )
 
+// ruleIDFlag holds the rule IDs selected with -rule-id
+var ruleIDFlag listFlag
+
+// patternFlag holds the patterns given with -pattern
+var patternFlag repeatedFlag
+
+// includeFlag and excludeFlag hold the path globs given with -include and
+// -exclude
+var includeFlag, excludeFlag listFlag
+
+// maxFileSizeFlag holds the size limit set with -max-file-size
+var maxFileSizeFlag = sizeFlag(100 * 1024 * 1024)
+
+// mmapThresholdFlag holds the size set with -mmap-threshold
+var mmapThresholdFlag sizeFlag
+
+// historyFlag holds whether -history was given and its depth limit
+var historyFlag historyDepthFlag
+
+func init() {
+	flag.Var(&patternFlag, "pattern", "Add a pattern as a rule (repeatable); every argument is then a path to scan")
+	flag.Var(&ruleIDFlag, "rule-id", "Only run the rules with these IDs (repeatable or comma-separated)")
+	flag.Var(&includeFlag, "include", "Only scan files matching these path globs (repeatable or comma-separated)")
+	flag.Var(&excludeFlag, "exclude", "Don't scan paths matching these globs (repeatable or comma-separated)")
+	flag.Var(&maxFileSizeFlag, "max-file-size", "Skip files larger than this size, in bytes or with a KB, MB, or GB suffix")
+	flag.Var(&mmapThresholdFlag, "mmap-threshold", "Memory-map files of at least this size and scan each as a single block")
+	flag.Var(&historyFlag, "history", "Scan every file version in the git history of the scan path, optionally only in the most recent `depth` commits")
+}
+
+// commands are the subcommands given as the first argument, each returning
+// the exit code
+var commands = map[string]func(args []string, stdout, stderr io.Writer) int{
+	"validate": runValidate,
+	"test":     runTestPattern,
+	"new-rule": runNewRule,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+
 	flag.Parse()
 
 	if *helpFlag {
 		printUsage()
-		os.Exit(0)
+		os.Exit(exitOK)
 	}
 
 	if *versionFlag {
 		fmt.Printf("poltergeist %s\n", version)
-		os.Exit(0)
+		os.Exit(exitOK)
 	}
 
-	// Determine scan path
-	var scanPath string
-	if flag.NArg() < 1 {
+	// Determine scan paths. Patterns follow a single path, unless paths are
+	// ended with -- or every pattern is given with -pattern.
+	args := flag.Args()
+	scanPaths, patterns := args[:min(len(args), 1)], args[min(len(args), 1):]
+	if i := slices.Index(args, "--"); i >= 0 {
+		scanPaths, patterns = args[:i], args[i+1:]
+	} else if len(patternFlag) > 0 {
+		scanPaths, patterns = args, nil
+	}
+	patterns = append(slices.Clone(patternFlag), patterns...)
+	if len(scanPaths) < 1 {
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitError)
+	}
+	scanPath := scanPaths[0]
+
+	displayPath := strings.Join(scanPaths, ", ")
+	if scanPath == stdinPath {
+		displayPath = stdinName
+	}
+
+	// Load settings from the config file, which flags on the command line
+	// override
+	var config poltergeist.Config
+	if configPath := findConfig(*configFlag, scanPath); configPath != "" {
+		var err error
+		config, err = poltergeist.LoadConfig(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitError)
+		}
+		if err := applyConfig(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid config file %s: %v\n", configPath, err)
+			os.Exit(exitError)
+		}
+	}
+
+	// Determine output format (auto-detect from file extension if output flag is set)
+	outputFormat := *formatFlag
+	if *outputFlag != "" {
+		if strings.HasSuffix(*outputFlag, ".md") && *formatFlag == "text" {
+			outputFormat = "md"
+		} else if strings.HasSuffix(*outputFlag, ".json") && *formatFlag == "text" {
+			outputFormat = "json"
+		} else if strings.HasSuffix(*outputFlag, ".sarif") && *formatFlag == "text" {
+			outputFormat = "sarif"
+		} else if strings.HasSuffix(*outputFlag, ".csv") && *formatFlag == "text" {
+			outputFormat = "csv"
+		} else if strings.HasSuffix(*outputFlag, ".html") && *formatFlag == "text" {
+			outputFormat = "html"
+		}
+	}
+
+	if *groupFlag && outputFormat != "text" {
+		fmt.Fprintf(os.Stderr, "Error: -group only applies to text output\n")
+		os.Exit(exitError)
+	}
+
+	if *quietFlag && *verboseFlag {
+		fmt.Fprintf(os.Stderr, "Error: -quiet and -verbose can't be used together\n")
+		os.Exit(exitError)
+	}
+
+	colorMode := *colorFlag
+	if *noColorFlag {
+		colorMode = colorNever
+	}
+	if _, err := colorEnabled(colorMode, false, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	if *entropyFlag < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -entropy-threshold must not be negative, got %g\n", *entropyFlag)
+		os.Exit(exitError)
+	}
+
+	for _, pattern := range slices.Concat(includeFlag, excludeFlag) {
+		if !poltergeist.ValidGlob(pattern) {
+			fmt.Fprintf(os.Stderr, "Error: invalid path glob %q\n", pattern)
+			os.Exit(exitError)
+		}
+	}
+
+	if len(scanPaths) > 1 {
+		for _, path := range scanPaths {
+			if path == stdinPath || isRemoteURL(path) {
+				fmt.Fprintf(os.Stderr, "Error: standard input and repository URLs can only be scanned on their own\n")
+				os.Exit(exitError)
+			}
+		}
+		if *diffFlag != "" || historyFlag.enabled {
+			fmt.Fprintf(os.Stderr, "Error: -diff and -history can only be used with a single path\n")
+			os.Exit(exitError)
+		}
+	}
+
+	if *diffFlag != "" && scanPath == stdinPath {
+		fmt.Fprintf(os.Stderr, "Error: -diff can't be used when scanning standard input\n")
+		os.Exit(exitError)
+	}
+	if *diffFlag != "" && *failFastFlag {
+		fmt.Fprintf(os.Stderr, "Error: -diff and -fail-fast can't be used together\n")
+		os.Exit(exitError)
+	}
+	if historyFlag.enabled && scanPath == stdinPath {
+		fmt.Fprintf(os.Stderr, "Error: -history can't be used when scanning standard input\n")
+		os.Exit(exitError)
+	}
+	if (*diffFlag != "" || historyFlag.enabled) && isRemoteURL(scanPath) {
+		fmt.Fprintf(os.Stderr, "Error: -diff and -history can't be used when scanning a repository URL\n")
+		os.Exit(exitError)
+	}
+	if historyFlag.enabled && *diffFlag != "" {
+		fmt.Fprintf(os.Stderr, "Error: -history and -diff can't be used together\n")
+		os.Exit(exitError)
+	}
+
+	if *workersFlag < 1 {
+		fmt.Fprintf(os.Stderr, "Error: -workers must be at least 1, got %d\n", *workersFlag)
+		os.Exit(exitError)
+	}
+
+	if *minSeverityFlag != "" && !poltergeist.ValidSeverity(*minSeverityFlag) {
+		fmt.Fprintf(os.Stderr, "Error: unknown severity %q (use %s)\n", *minSeverityFlag, strings.Join(poltergeist.Severities, ", "))
+		os.Exit(exitError)
+	}
+
+	// Load the baseline up front so a bad file fails before scanning
+	var baseline []byte
+	if *baselineFlag != "" {
+		data, err := os.ReadFile(*baselineFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read baseline: %v\n", err)
+			os.Exit(exitError)
+		}
+		if _, err := poltergeist.ParseBaseline(data); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid baseline %s: %v\n", *baselineFlag, err)
+			os.Exit(exitError)
+		}
+		baseline = data
+	}
+
+	// Keep stdout parseable when it carries machine-readable output, and
+	// keep progress on the terminal when the report goes to a file
+	var status io.Writer = os.Stdout
+	if outputFormat != "text" || *outputFlag != "" {
+		status = os.Stderr
+	}
+
+	// Notices about files written and findings suppressed go to stderr, and
+	// like the banner are dropped with -quiet
+	var notices io.Writer = os.Stderr
+	if *quietFlag {
+		status = io.Discard
+		notices = io.Discard
 	}
-	scanPath = flag.Arg(0)
 
 	// Collect rules from various sources
 	var rules []poltergeist.Rule
@@ -93,20 +426,19 @@ func main() {
 
 	// Load rules from YAML file or directory if specified
 	if *rulesFlag != "" {
-		yamlRules, err := poltergeist.LoadRules(*rulesFlag)
+		yamlRules, err := poltergeist.LoadRulesFromPaths(splitList(*rulesFlag))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to load rules: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitError)
 		}
 		rules = append(rules, yamlRules...)
 	}
 
 	// Add command-line patterns as rules
-	for i := 1; i < flag.NArg(); i++ {
-		pattern := flag.Arg(i)
+	for i, pattern := range patterns {
 		rules = append(rules, poltergeist.Rule{
-			Name:    fmt.Sprintf("CLI Pattern %d", i),
-			ID:      fmt.Sprintf("cli.pattern.%d", i),
+			Name:    fmt.Sprintf("CLI Pattern %d", i+1),
+			ID:      fmt.Sprintf("cli.pattern.%d", i+1),
 			Pattern: pattern,
 			Tags:    []string{"cli"},
 		})
@@ -117,16 +449,45 @@ func main() {
 		defaultRules, err := poltergeist.LoadDefaultRules()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to load default rules: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitError)
 		}
 		rules = append(rules, defaultRules...)
-		fmt.Printf("Using built-in rules (%d patterns loaded)\n", len(defaultRules))
+		fmt.Fprintf(status, "Using built-in rules (%d patterns loaded)\n", len(defaultRules))
 	}
 
+	// Rules can ship disabled; only report the ones that will run
+	rules = poltergeist.EnabledRules(rules)
+
 	// Ensure we have at least one rule
 	if len(rules) == 0 {
 		fmt.Fprintf(os.Stderr, "No patterns available. This should not happen with default rules.\n")
-		os.Exit(1)
+		os.Exit(exitError)
+	}
+
+	// Select rules by ID
+	if len(ruleIDFlag) > 0 {
+		rules, err = poltergeist.FilterRulesByID(rules, ruleIDFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to select rules: %v\n", err)
+			os.Exit(exitError)
+		}
+	}
+
+	// Select rules by tag
+	if *tagsFlag != "" || *excludeTagsFlag != "" {
+		rules = poltergeist.FilterRulesByTags(rules, splitList(*tagsFlag), splitList(*excludeTagsFlag))
+		if len(rules) == 0 {
+			fmt.Fprintf(os.Stderr, "No rules match the selected tags.\n")
+			os.Exit(exitError)
+		}
+	}
+
+	// Override the rules' entropy thresholds for quick experiments, if the
+	// flag was given or set by the config file; 0 reports every match
+	if flagSet("entropy-threshold") {
+		for i := range rules {
+			rules[i].Entropy = *entropyFlag
+		}
 	}
 
 	// Select appropriate engine
@@ -141,43 +502,114 @@ func main() {
 		engine = poltergeist.NewHyperscanEngine()
 	default:
 		fmt.Fprintf(os.Stderr, "Invalid engine: %s\n", selectedEngine)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 
 	// Compile all rules
 	err = engine.CompileRules(rules)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to compile rules with %s engine: %v\n", engine.Name(), err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 
 	// Ensure engine cleanup
 	defer engine.Close()
 
+	// Rules the engine couldn't compile are skipped, unless -strict is set
+	var warnings []poltergeist.CompileWarning
+	if warner, ok := engine.(poltergeist.CompileWarner); ok {
+		warnings = warner.Warnings()
+	}
+	if len(warnings) > 0 {
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+		if *strictFlag {
+			fmt.Fprintf(os.Stderr, "Failed to compile %d rules with %s engine (-strict)\n", len(warnings), engine.Name())
+			os.Exit(exitError)
+		}
+	}
+
 	// Create scanner with optimized settings
-	scanner := poltergeist.NewScannerWithOptions(engine, runtime.NumCPU()*2, 100*1024*1024)
+	scanner := poltergeist.NewScannerWithOptions(engine, *workersFlag, int64(maxFileSizeFlag))
 	scanner.DisableRedaction = *dnrFlag
+	scanner.ExplainMatches = *explainFlag
+	scanner.DecodeEncodedBlobs = *decodeFlag
+	scanner.WholeFile = *wholeFileFlag
+	scanner.MmapThreshold = int64(mmapThresholdFlag)
+	scanner.GitBlame = *gitBlameFlag
+	scanner.MaxCommits = historyFlag.depth
+	scanner.RemoteToken = os.Getenv(gitTokenEnv)
+	scanner.RespectIgnoreFiles = !*noIgnoreFlag
+	scanner.FollowSymlinks = *followFlag
+	if config.SkipDirs != nil {
+		scanner.SkipDirs = config.SkipDirs
+	}
+	scanner.IncludeGlobs = includeFlag
+	scanner.ExcludeGlobs = excludeFlag
+	logLevel := slog.LevelInfo
+	if *verboseFlag {
+		logLevel = slog.LevelDebug
+	} else if *quietFlag {
+		logLevel = slog.LevelError
+	}
+	scanner.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+	if *failFastFlag {
+		scanner.MaxFindings = 1
+	}
 
-	fmt.Printf("Starting secret scan with %d workers using %s engine...\n", scanner.WorkerCount, engine.Name())
-	fmt.Printf("Scanning: %s\n", scanPath)
-	fmt.Printf("Rules loaded: %d patterns\n", len(rules))
+	fmt.Fprintf(status, "Starting secret scan with %d workers using %s engine...\n", scanner.WorkerCount, engine.Name())
+	fmt.Fprintf(status, "Scanning: %s\n", displayPath)
+	if *diffFlag != "" {
+		fmt.Fprintf(status, "Comparing with: %s\n", *diffFlag)
+	}
+	if historyFlag.enabled {
+		fmt.Fprintf(status, "Git history: %s\n", historyFlag.String())
+	}
+	fmt.Fprintf(status, "Rules loaded: %d patterns\n", len(rules))
 	for _, rule := range rules {
-		fmt.Printf("  - %s (ID: %s)\n", rule.Name, rule.ID)
+		fmt.Fprintf(status, "  - %s (ID: %s)\n", rule.Name, rule.ID)
 	}
 
-	fmt.Println()
+	fmt.Fprintln(status)
 
 	start := time.Now()
-	results, err := scanner.ScanDirectory(scanPath)
-	if err != nil {
+	var results []poltergeist.ScanResult
+	var removed []poltergeist.ScanResult
+	var lowEntropyCount int
+	var interrupted bool
+	if scanPath == stdinPath {
+		results, err = scanStdin(scanner, os.Stdin)
+	} else {
+		// Stop the scan on Ctrl-C and report what was found so far
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		if *diffFlag != "" {
+			results, removed, err = poltergeist.DiffScanContext(ctx, scanner, *diffFlag, scanPath)
+		} else if historyFlag.enabled {
+			results, err = poltergeist.ScanGitHistoryContext(ctx, scanPath, scanner)
+		} else if len(scanPaths) > 1 {
+			results, err = scanner.ScanPathsContext(ctx, scanPaths)
+		} else if isRemoteURL(scanPath) {
+			results, err = poltergeist.ScanRemoteRepo(ctx, scanPath, scanner)
+		} else if *gitBlameFlag {
+			results, err = scanner.ScanDirectoryContext(ctx, scanPath)
+		} else {
+			resultsCh, errc := scanner.ScanDirectoryStream(ctx, scanPath)
+			results, lowEntropyCount, err = collectFindings(resultsCh, errc, *lowEntropyFlag)
+		}
+		interrupted = errors.Is(err, context.Canceled)
+
+		// Restore default signal handling so a second Ctrl-C exits immediately
+		stop()
+	}
+	if err != nil && !interrupted {
 		fmt.Fprintf(os.Stderr, "Scan failed: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 	duration := time.Since(start)
 
 	// Filter results based on entropy if flag is not set
 	var filteredResults []poltergeist.ScanResult
-	var lowEntropyCount int
 
 	for _, result := range results {
 		if result.RuleEntropyThresholdMet || *lowEntropyFlag {
@@ -187,57 +619,203 @@ func main() {
 		}
 	}
 
+	if *minSeverityFlag != "" {
+		filteredResults = poltergeist.FilterBySeverity(filteredResults, *minSeverityFlag)
+	}
+
+	if *diffFlag != "" {
+		var removedCount int
+		for _, result := range removed {
+			if (result.RuleEntropyThresholdMet || *lowEntropyFlag) && (*minSeverityFlag == "" || poltergeist.SeverityAtLeast(result.Severity, *minSeverityFlag)) {
+				removedCount++
+			}
+		}
+		fmt.Fprintf(notices, "Diff against %s: %d findings added, %d removed\n", *diffFlag, len(filteredResults), removedCount)
+	}
+
+	if *writeBaselineFlag != "" {
+		data, err := poltergeist.GenerateBaseline(filteredResults)
+		if err == nil {
+			err = os.WriteFile(*writeBaselineFlag, data, 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing baseline: %v\n", err)
+			os.Exit(exitError)
+		}
+		fmt.Fprintf(notices, "Baseline of %d findings written to %s\n", len(filteredResults), *writeBaselineFlag)
+	}
+
+	if baseline != nil {
+		newResults := poltergeist.FilterAgainstBaseline(filteredResults, baseline)
+		if suppressed := len(filteredResults) - len(newResults); suppressed > 0 {
+			fmt.Fprintf(notices, "%d findings suppressed by baseline %s\n", suppressed, *baselineFlag)
+		}
+		filteredResults = newResults
+	}
+
 	// Gather metrics
 	filesScanned := atomic.LoadInt64(&scanner.Metrics.FilesScanned)
 	filesSkipped := atomic.LoadInt64(&scanner.Metrics.FilesSkipped)
 	totalBytes := atomic.LoadInt64(&scanner.Metrics.TotalBytes)
 	matchesFound := atomic.LoadInt64(&scanner.Metrics.MatchesFound)
 
-	// Determine output format (auto-detect from file extension if output flag is set)
-	outputFormat := *formatFlag
-	if *outputFlag != "" {
-		if strings.HasSuffix(*outputFlag, ".md") && *formatFlag == "text" {
-			outputFormat = "md"
-		} else if strings.HasSuffix(*outputFlag, ".json") && *formatFlag == "text" {
-			outputFormat = "json"
-		}
-	}
-
-	// Determine if we should use colors
-	useColor := !*noColorFlag && isTerminal() && *outputFlag == "" && outputFormat == "text"
+	// Determine if we should use colors; auto only colors text written to a
+	// terminal, never to a file
+	useColor, _ := colorEnabled(colorMode, isTerminal() && *outputFlag == "", os.Getenv("NO_COLOR"))
+	useColor = useColor && outputFormat == "text"
 
 	// Format output
 	var output string
-	var exitCode int
 
 	switch outputFormat {
 	case "json":
-		output, exitCode = formatJSON(filteredResults, filesScanned, filesSkipped, totalBytes, matchesFound, lowEntropyCount)
+		output, err = formatJSON(filteredResults, filesScanned, filesSkipped, totalBytes, matchesFound, lowEntropyCount, *dnrFlag)
+	case "sarif":
+		output, err = formatSARIF(filteredResults, rules)
+	case "csv":
+		output, err = formatCSV(filteredResults, *dnrFlag)
+	case "html":
+		output, err = formatHTML(filteredResults, rules, poltergeist.ScanMetrics{
+			FilesScanned: filesScanned,
+			FilesSkipped: filesSkipped,
+			TotalBytes:   totalBytes,
+			MatchesFound: matchesFound,
+		})
 	case "md", "markdown":
-		output, exitCode = formatMarkdown(filteredResults, scanPath, filesScanned, filesSkipped, totalBytes, matchesFound, lowEntropyCount, duration)
+		output = formatMarkdown(filteredResults, displayPath, filesScanned, filesSkipped, totalBytes, matchesFound, lowEntropyCount, duration)
 	case "text":
-		output, exitCode = formatText(filteredResults, filesScanned, filesSkipped, totalBytes, matchesFound, lowEntropyCount, duration, useColor, *dnrFlag)
+		output = formatText(filteredResults, filesScanned, filesSkipped, totalBytes, matchesFound, lowEntropyCount, duration, useColor, *dnrFlag, *groupFlag)
 	default:
-		fmt.Fprintf(os.Stderr, "Error: unknown format %q (use text, json, or md)\n", outputFormat)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (use text, json, md, sarif, csv, or html)\n", outputFormat)
+		os.Exit(exitError)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error formatting output: %v\n", err)
+		os.Exit(exitError)
 	}
 
 	// Write to file or stdout
 	if *outputFlag != "" {
 		if err := os.WriteFile(*outputFlag, []byte(output), 0644); err != nil {
 			fmt.Fprintf(os.Stderr, "Error writing to file: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitError)
 		}
-		fmt.Fprintf(os.Stderr, "Report written to %s\n", *outputFlag)
+		fmt.Fprintf(notices, "Report written to %s\n", *outputFlag)
 	} else {
 		fmt.Print(output)
 	}
 
-	os.Exit(exitCode)
+	if *statsFlag {
+		// Statistics were asked for, so -quiet doesn't drop them
+		statsOutput := status
+		if *quietFlag {
+			statsOutput = os.Stderr
+		}
+		printRuleStats(statsOutput, scanner.RuleStats(), rules)
+	}
+
+	if interrupted {
+		fmt.Fprintf(os.Stderr, "Scan interrupted: results are partial (%d files scanned)\n", filesScanned)
+		os.Exit(exitInterrupted)
+	}
+
+	// Low-entropy matches shown with -low-entropy are not findings
+	var findings int
+	for _, result := range filteredResults {
+		if result.RuleEntropyThresholdMet {
+			findings++
+		}
+	}
+	os.Exit(findingsExitCode(findings, *exitZeroFlag))
+}
+
+// collectFindings collects the results of a streamed directory scan, sorted,
+// dropping matches below their entropy threshold as they arrive unless
+// keepLowEntropy is set, and returns the number dropped. On large trees low
+// entropy matches can vastly outnumber findings, so they aren't held in memory.
+func collectFindings(results <-chan poltergeist.ScanResult, errc <-chan error, keepLowEntropy bool) ([]poltergeist.ScanResult, int, error) {
+	var findings []poltergeist.ScanResult
+	var lowEntropyCount int
+	for result := range results {
+		if result.RuleEntropyThresholdMet || keepLowEntropy {
+			findings = append(findings, result)
+		} else {
+			lowEntropyCount++
+		}
+	}
+
+	poltergeist.SortResults(findings)
+	return findings, lowEntropyCount, <-errc
 }
 
-// formatText formats results as colored text output
-func formatText(results []poltergeist.ScanResult, filesScanned, filesSkipped, totalBytes, matchesFound int64, lowEntropyCount int, duration time.Duration, useColor bool, showFullMatch bool) (string, int) {
+// scanStdin scans content read from r as a single file named stdinName,
+// counting it in the scanner metrics as a directory scan would
+func scanStdin(scanner *poltergeist.Scanner, r io.Reader) ([]poltergeist.ScanResult, error) {
+	counter := &countingReader{r: r}
+	results, err := scanner.ScanReader(counter, stdinName)
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&scanner.Metrics.FilesScanned, 1)
+	atomic.AddInt64(&scanner.Metrics.TotalBytes, counter.n)
+	atomic.AddInt64(&scanner.Metrics.MatchesFound, int64(len(results)))
+	return results, nil
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// printRuleStats prints a table of the matches found per rule, most matches
+// first, followed by the number of rules that found nothing
+func printRuleStats(w io.Writer, stats map[string]int64, rules []poltergeist.Rule) {
+	var matched []poltergeist.Rule
+	for _, rule := range rules {
+		if stats[rule.ID] > 0 {
+			matched = append(matched, rule)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, b := stats[matched[i].ID], stats[matched[j].ID]
+		if a != b {
+			return a > b
+		}
+		return matched[i].ID < matched[j].ID
+	})
+
+	fmt.Fprintf(w, "\nRule statistics:\n")
+	if len(matched) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "  MATCHES\tRULE ID\tNAME\n")
+		for _, rule := range matched {
+			fmt.Fprintf(tw, "  %d\t%s\t%s\n", stats[rule.ID], rule.ID, rule.Name)
+		}
+		tw.Flush()
+	}
+	fmt.Fprintf(w, "  %d of %d rules found no matches\n", len(rules)-len(matched), len(rules))
+}
+
+// findingsExitCode returns the exit code for a completed scan that reported
+// the given number of findings, regardless of output format
+func findingsExitCode(findings int, exitZero bool) int {
+	if findings > 0 && !exitZero {
+		return exitFindings
+	}
+	return exitOK
+}
+
+// formatText formats results as colored text output, listed by file or, when
+// group is set, by secret
+func formatText(results []poltergeist.ScanResult, filesScanned, filesSkipped, totalBytes, matchesFound int64, lowEntropyCount int, duration time.Duration, useColor bool, showFullMatch bool, group bool) string {
 	var sb strings.Builder
 
 	sb.WriteString(fmt.Sprintf("\n%s\n", divider(50)))
@@ -255,22 +833,52 @@ func formatText(results []poltergeist.ScanResult, filesScanned, filesSkipped, to
 		} else {
 			sb.WriteString(fmt.Sprintf("%s No secrets found!\n\n", green("✓", useColor)))
 		}
-		return sb.String(), 0
+		return sb.String()
 	}
 
 	sb.WriteString(fmt.Sprintf("Secrets found:  %s", red(fmt.Sprintf("%d", len(results)), useColor)))
 	if lowEntropyCount > 0 {
 		sb.WriteString(fmt.Sprintf(" (%d low-entropy filtered)", lowEntropyCount))
 	}
-	sb.WriteString("\n\n")
+	sb.WriteString("\n")
+	sb.WriteString(fmt.Sprintf("Unique secrets: %d\n\n", poltergeist.CountUniqueSecrets(results)))
 
-	// Group results by file
-	fileResults := make(map[string][]poltergeist.ScanResult)
+	if group {
+		writeGroupedFindings(&sb, results, useColor, showFullMatch)
+	} else {
+		writeFindingsByFile(&sb, results, useColor, showFullMatch)
+	}
+
+	// Metrics footer
+	sb.WriteString(fmt.Sprintf("%s\n", divider(50)))
+	sb.WriteString(fmt.Sprintf("Files skipped: %d (binary/large files)\n", filesSkipped))
+	sb.WriteString(fmt.Sprintf("Scan completed in %v\n\n", duration))
+
+	sb.WriteString(fmt.Sprintf("%s Review and address the secrets above.\n\n", yellow("!", useColor)))
+	return sb.String()
+}
+
+// groupByFile groups results by the file they were found in, with files in
+// the order of their first result, so output follows the order of results
+func groupByFile(results []poltergeist.ScanResult) [][]poltergeist.ScanResult {
+	var groups [][]poltergeist.ScanResult
+	index := make(map[string]int)
 	for _, result := range results {
-		fileResults[result.FilePath] = append(fileResults[result.FilePath], result)
+		i, ok := index[result.FilePath]
+		if !ok {
+			i = len(groups)
+			index[result.FilePath] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], result)
 	}
+	return groups
+}
 
-	for filePath, fileMatches := range fileResults {
+// writeFindingsByFile writes each finding to sb under the file it was found in
+func writeFindingsByFile(sb *strings.Builder, results []poltergeist.ScanResult, useColor bool, showFullMatch bool) {
+	for _, fileMatches := range groupByFile(results) {
+		filePath := fileMatches[0].FilePath
 		sb.WriteString(fmt.Sprintf("%s %s %s (%d matches)\n",
 			red("●", useColor),
 			bold(filePath, useColor),
@@ -280,8 +888,8 @@ func formatText(results []poltergeist.ScanResult, filesScanned, filesSkipped, to
 		for _, match := range fileMatches {
 			sb.WriteString(fmt.Sprintf("  %s Line %s: %s\n",
 				yellow("└─", useColor),
-				cyan(fmt.Sprintf("%d", match.LineNumber), useColor),
-				match.RuleName))
+				cyan(fmt.Sprintf("%d:%d", match.LineNumber, match.Column), useColor),
+				magenta(match.RuleName, useColor)))
 
 			displayMatch := match.Redacted
 			if showFullMatch {
@@ -293,11 +901,20 @@ func formatText(results []poltergeist.ScanResult, filesScanned, filesSkipped, to
 				displayMatch = displayMatch[:77] + "..."
 			}
 
-			sb.WriteString(fmt.Sprintf("     %s\n", displayMatch))
+			sb.WriteString(fmt.Sprintf("     %s\n", red(displayMatch, useColor)))
 
 			if match.RuleID != "" {
 				sb.WriteString(fmt.Sprintf("     ID: %s\n", match.RuleID))
 			}
+			if match.Severity != "" {
+				sb.WriteString(fmt.Sprintf("     Severity: %s\n", match.Severity))
+			}
+			if match.Encoding != "" {
+				sb.WriteString(fmt.Sprintf("     Decoded from: %s\n", match.Encoding))
+			}
+			if match.GitCommit != "" {
+				sb.WriteString(fmt.Sprintf("     Commit: %.12s by %s on %s\n", match.GitCommit, match.GitAuthor, match.GitTimestamp.Format(time.DateOnly)))
+			}
 
 			// Display entropy information
 			metStr := "No"
@@ -306,33 +923,79 @@ func formatText(results []poltergeist.ScanResult, filesScanned, filesSkipped, to
 			}
 			sb.WriteString(fmt.Sprintf("     Entropy: %.2f | Threshold: %.2f | Met: %s\n",
 				match.Entropy, match.RuleEntropyThreshold, metStr))
+
+			if match.Explanation != nil {
+				sb.WriteString(fmt.Sprintf("     Why: %s\n", match.Explanation.Summary))
+			}
 		}
 		sb.WriteString("\n")
 	}
+}
 
-	// Metrics footer
-	sb.WriteString(fmt.Sprintf("%s\n", divider(50)))
-	sb.WriteString(fmt.Sprintf("Files skipped: %d (binary/large files)\n", filesSkipped))
-	sb.WriteString(fmt.Sprintf("Scan completed in %v\n\n", duration))
+// writeGroupedFindings writes each secret to sb once per rule that found it,
+// followed by every location it was found at
+func writeGroupedFindings(sb *strings.Builder, results []poltergeist.ScanResult, useColor bool, showFullMatch bool) {
+	for _, finding := range poltergeist.GroupBySecret(results) {
+		displayMatch := finding.Redacted
+		if showFullMatch {
+			displayMatch = finding.Match
+		}
 
-	sb.WriteString(fmt.Sprintf("%s Review and address the secrets above.\n\n", yellow("!", useColor)))
-	return sb.String(), 1
+		// Truncate very long matches
+		if len(displayMatch) > 80 {
+			displayMatch = displayMatch[:77] + "..."
+		}
+
+		sb.WriteString(fmt.Sprintf("%s %s (%d locations)\n",
+			red("●", useColor),
+			red(displayMatch, useColor),
+			len(finding.Locations)))
+		sb.WriteString(fmt.Sprintf("     Rule: %s\n", magenta(finding.RuleName, useColor)))
+		if finding.RuleID != "" {
+			sb.WriteString(fmt.Sprintf("     ID: %s\n", finding.RuleID))
+		}
+		if finding.Severity != "" {
+			sb.WriteString(fmt.Sprintf("     Severity: %s\n", finding.Severity))
+		}
+		for _, location := range finding.Locations {
+			sb.WriteString(fmt.Sprintf("  %s %s\n",
+				yellow("└─", useColor),
+				cyan(fmt.Sprintf("%s:%d", location.FilePath, location.LineNumber), useColor)))
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// jsonResult is a finding in JSON output. The raw match is only included when
+// redaction is disabled.
+type jsonResult struct {
+	poltergeist.ScanResult
+	Match string `json:"match,omitempty"`
 }
 
 // formatJSON formats results as JSON
-func formatJSON(results []poltergeist.ScanResult, filesScanned, filesSkipped, totalBytes, matchesFound int64, lowEntropyCount int) (string, int) {
+func formatJSON(results []poltergeist.ScanResult, filesScanned, filesSkipped, totalBytes, matchesFound int64, lowEntropyCount int, showFullMatch bool) (string, error) {
+	findings := make([]jsonResult, len(results))
+	for i, result := range results {
+		findings[i] = jsonResult{ScanResult: result}
+		if showFullMatch {
+			findings[i].Match = result.Match
+		}
+	}
+
 	output := struct {
 		Summary struct {
-			FilesScanned int64 `json:"files_scanned"`
-			FilesSkipped int64 `json:"files_skipped"`
-			TotalBytes   int64 `json:"total_bytes"`
-			MatchesFound int64 `json:"matches_found"`
-			HighEntropy  int   `json:"high_entropy_matches"`
-			LowEntropy   int   `json:"low_entropy_matches"`
+			FilesScanned  int64 `json:"files_scanned"`
+			FilesSkipped  int64 `json:"files_skipped"`
+			TotalBytes    int64 `json:"total_bytes"`
+			MatchesFound  int64 `json:"matches_found"`
+			HighEntropy   int   `json:"high_entropy_matches"`
+			LowEntropy    int   `json:"low_entropy_matches"`
+			UniqueSecrets int   `json:"unique_secrets"`
 		} `json:"summary"`
-		Results []poltergeist.ScanResult `json:"results"`
+		Results []jsonResult `json:"results"`
 	}{
-		Results: results,
+		Results: findings,
 	}
 
 	output.Summary.FilesScanned = filesScanned
@@ -341,21 +1004,54 @@ func formatJSON(results []poltergeist.ScanResult, filesScanned, filesSkipped, to
 	output.Summary.MatchesFound = matchesFound
 	output.Summary.HighEntropy = len(results)
 	output.Summary.LowEntropy = lowEntropyCount
+	output.Summary.UniqueSecrets = poltergeist.CountUniqueSecrets(results)
 
 	data, err := json.MarshalIndent(output, "", "  ")
 	if err != nil {
-		return fmt.Sprintf("Error encoding JSON: %v\n", err), 1
+		return "", fmt.Errorf("failed to encode JSON: %w", err)
+	}
+
+	return string(data) + "\n", nil
+}
+
+// formatSARIF formats results as a SARIF 2.1.0 log
+func formatSARIF(results []poltergeist.ScanResult, rules []poltergeist.Rule) (string, error) {
+	var sb strings.Builder
+	if err := poltergeist.WriteSARIF(&sb, results, rules); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+// formatCSV formats results as CSV, with the raw match in a final column if
+// showFullMatch is set
+func formatCSV(results []poltergeist.ScanResult, showFullMatch bool) (string, error) {
+	write := poltergeist.WriteCSV
+	if showFullMatch {
+		write = poltergeist.WriteCSVWithMatches
 	}
 
-	exitCode := 0
-	if len(results) > 0 {
-		exitCode = 1
+	var sb strings.Builder
+	if err := write(&sb, results); err != nil {
+		return "", err
 	}
-	return string(data) + "\n", exitCode
+
+	return sb.String(), nil
+}
+
+// formatHTML formats results as a self-contained HTML report
+func formatHTML(results []poltergeist.ScanResult, rules []poltergeist.Rule, metrics poltergeist.ScanMetrics) (string, error) {
+	var sb strings.Builder
+	if err := poltergeist.WriteHTMLReport(&sb, results, rules, metrics); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
 }
 
 // formatMarkdown formats results as markdown
-func formatMarkdown(results []poltergeist.ScanResult, scanPath string, filesScanned, filesSkipped, totalBytes, matchesFound int64, lowEntropyCount int, duration time.Duration) (string, int) {
+func formatMarkdown(results []poltergeist.ScanResult, scanPath string, filesScanned, filesSkipped, totalBytes, matchesFound int64, lowEntropyCount int, duration time.Duration) string {
 	var sb strings.Builder
 
 	sb.WriteString("# Secret Scan Report\n\n")
@@ -369,6 +1065,7 @@ func formatMarkdown(results []poltergeist.ScanResult, scanPath string, filesScan
 	sb.WriteString(fmt.Sprintf("| Files skipped | %d |\n", filesSkipped))
 	sb.WriteString(fmt.Sprintf("| Total content | %s |\n", poltergeist.FormatBytes(totalBytes)))
 	sb.WriteString(fmt.Sprintf("| Secrets found | %d |\n", len(results)))
+	sb.WriteString(fmt.Sprintf("| Unique secrets | %d |\n", poltergeist.CountUniqueSecrets(results)))
 	if lowEntropyCount > 0 {
 		sb.WriteString(fmt.Sprintf("| Low-entropy filtered | %d |\n", lowEntropyCount))
 	}
@@ -379,28 +1076,28 @@ func formatMarkdown(results []poltergeist.ScanResult, scanPath string, filesScan
 		if lowEntropyCount > 0 {
 			sb.WriteString(fmt.Sprintf("\n*Note: %d low-entropy matches were filtered out.*\n", lowEntropyCount))
 		}
-		return sb.String(), 0
+		return sb.String()
 	}
 
 	sb.WriteString("## Findings\n\n")
 
-	// Group results by file
-	fileResults := make(map[string][]poltergeist.ScanResult)
-	for _, result := range results {
-		fileResults[result.FilePath] = append(fileResults[result.FilePath], result)
-	}
-
-	for filePath, fileMatches := range fileResults {
-		sb.WriteString(fmt.Sprintf("### `%s`\n\n", filePath))
+	for _, fileMatches := range groupByFile(results) {
+		sb.WriteString(fmt.Sprintf("### `%s`\n\n", fileMatches[0].FilePath))
 		sb.WriteString(fmt.Sprintf("**Matches:** %d\n\n", len(fileMatches)))
 
 		for i, match := range fileMatches {
 			sb.WriteString(fmt.Sprintf("#### Finding %d\n\n", i+1))
-			sb.WriteString(fmt.Sprintf("- **Line:** %d\n", match.LineNumber))
+			sb.WriteString(fmt.Sprintf("- **Line:** %d, column %d\n", match.LineNumber, match.Column))
 			sb.WriteString(fmt.Sprintf("- **Rule:** %s\n", match.RuleName))
 			if match.RuleID != "" {
 				sb.WriteString(fmt.Sprintf("- **Rule ID:** %s\n", match.RuleID))
 			}
+			if match.Severity != "" {
+				sb.WriteString(fmt.Sprintf("- **Severity:** %s\n", match.Severity))
+			}
+			if match.Encoding != "" {
+				sb.WriteString(fmt.Sprintf("- **Decoded from:** %s\n", match.Encoding))
+			}
 			sb.WriteString(fmt.Sprintf("- **Match:** `%s`\n", match.Redacted))
 			sb.WriteString(fmt.Sprintf("- **Entropy:** %.2f\n", match.Entropy))
 			sb.WriteString(fmt.Sprintf("- **Threshold:** %.2f\n", match.RuleEntropyThreshold))
@@ -409,15 +1106,213 @@ func formatMarkdown(results []poltergeist.ScanResult, scanPath string, filesScan
 				metStr = "Yes"
 			}
 			sb.WriteString(fmt.Sprintf("- **Threshold Met:** %s\n", metStr))
+			if match.Explanation != nil {
+				sb.WriteString(fmt.Sprintf("- **Why:** %s\n", match.Explanation.Summary))
+			}
 			sb.WriteString("\n")
 		}
 	}
 
-	return sb.String(), 1
+	return sb.String()
 }
 
 // Helper functions
 
+// listFlag is a flag that may be repeated or given comma-separated values
+type listFlag []string
+
+// String implements flag.Value
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set implements flag.Value
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, splitList(value)...)
+	return nil
+}
+
+// repeatedFlag is a flag that may be repeated, keeping each value whole
+type repeatedFlag []string
+
+// String implements flag.Value
+func (f *repeatedFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+// Set implements flag.Value
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// sizeFlag is a flag holding a size in bytes, given as a number of bytes or
+// with a KB, MB, or GB suffix
+type sizeFlag int64
+
+// String implements flag.Value
+func (f *sizeFlag) String() string {
+	return poltergeist.FormatBytes(int64(*f))
+}
+
+// Set implements flag.Value
+func (f *sizeFlag) Set(value string) error {
+	size, err := poltergeist.ParseSize(value)
+	if err != nil {
+		return err
+	}
+	*f = sizeFlag(size)
+	return nil
+}
+
+// isRemoteURL reports whether a scan path is the URL of a git repository to
+// clone rather than a local path
+func isRemoteURL(scanPath string) bool {
+	for _, scheme := range []string{"https://", "http://", "ssh://", "git://", "file://"} {
+		if strings.HasPrefix(scanPath, scheme) {
+			return true
+		}
+	}
+
+	// scp-like syntax, such as git@github.com:org/repo.git
+	user, rest, ok := strings.Cut(scanPath, "@")
+	return ok && user != "" && !strings.ContainsAny(user, `/\`) && strings.Contains(rest, ":")
+}
+
+// historyDepthFlag is -history, which may be given alone to scan the whole
+// history or with a depth to scan only the most recent commits
+type historyDepthFlag struct {
+	enabled bool
+	depth   int
+}
+
+// String implements flag.Value
+func (f *historyDepthFlag) String() string {
+	if f.depth > 0 {
+		return fmt.Sprintf("last %d commits", f.depth)
+	}
+	if f.enabled {
+		return "all commits"
+	}
+	return ""
+}
+
+// Set implements flag.Value
+func (f *historyDepthFlag) Set(value string) error {
+	// -history alone is set to "true"; 0 and 1 are depths, not booleans
+	if enabled, err := strconv.ParseBool(value); err == nil && value != "0" && value != "1" {
+		*f = historyDepthFlag{enabled: enabled}
+		return nil
+	}
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth < 1 {
+		return fmt.Errorf("depth must be a positive number of commits, got %q", value)
+	}
+	*f = historyDepthFlag{enabled: true, depth: depth}
+	return nil
+}
+
+// IsBoolFlag lets -history be given without a depth
+func (f *historyDepthFlag) IsBoolFlag() bool {
+	return true
+}
+
+// findConfig returns the config file to load: the -config flag's value if set,
+// or the config file at the root of a scanned directory if there is one
+func findConfig(configFlag, scanPath string) string {
+	if configFlag != "" {
+		return configFlag
+	}
+	if scanPath == stdinPath || isRemoteURL(scanPath) {
+		return ""
+	}
+
+	configPath := filepath.Join(scanPath, poltergeist.ConfigFile)
+	if info, err := os.Stat(configPath); err != nil || info.IsDir() {
+		return ""
+	}
+	return configPath
+}
+
+// applyConfig sets the flags that weren't given on the command line from the
+// settings of a config file
+func applyConfig(config poltergeist.Config) error {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	values := map[string]string{
+		"engine":        config.Engine,
+		"format":        config.Format,
+		"max-file-size": config.MaxFileSize,
+		"tags":          strings.Join(config.Tags, ","),
+		"exclude-tags":  strings.Join(config.ExcludeTags, ","),
+		"include":       strings.Join(config.Include, ","),
+		"exclude":       strings.Join(config.Exclude, ","),
+	}
+	if config.Workers != 0 {
+		values["workers"] = strconv.Itoa(config.Workers)
+	}
+	if config.EntropyThreshold != 0 {
+		values["entropy-threshold"] = strconv.FormatFloat(config.EntropyThreshold, 'g', -1, 64)
+	}
+
+	for name, value := range values {
+		if value == "" || given[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// flagSet reports whether the named flag was given on the command line or set
+// from a config file
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Color modes for -color
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// colorEnabled reports whether to color text output in a -color mode. Auto
+// colors output to a terminal unless the NO_COLOR environment variable is set
+// to a non-empty value (https://no-color.org); always and never override both.
+func colorEnabled(mode string, isTTY bool, noColor string) (bool, error) {
+	switch mode {
+	case colorAuto:
+		return isTTY && noColor == "", nil
+	case colorAlways:
+		return true, nil
+	case colorNever:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown color mode %q (use %s, %s, or %s)", mode, colorAuto, colorAlways, colorNever)
+	}
+}
+
 func isTerminal() bool {
 	fileInfo, _ := os.Stdout.Stat()
 	return (fileInfo.Mode() & os.ModeCharDevice) != 0
@@ -455,6 +1350,13 @@ func cyan(s string, useColor bool) string {
 	return s
 }
 
+func magenta(s string, useColor bool) string {
+	if useColor {
+		return colorMagenta + s + colorReset
+	}
+	return s
+}
+
 func bold(s string, useColor bool) string {
 	if useColor {
 		return colorBold + s + colorReset
@@ -0,0 +1,970 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	poltergeist "github.com/ghostsecurity/poltergeist/pkg"
+)
+
+// testResults returns scan results covering the fields written by the formatters
+func testResults() []poltergeist.ScanResult {
+	return []poltergeist.ScanResult{
+		{
+			FilePath:                "config/app.env",
+			LineNumber:              3,
+			Column:                  22,
+			EndLineNumber:           3,
+			EndColumn:               42,
+			Match:                   "tok_aZ3kQ9xLm2Pw7vRt",
+			Redacted:                "tok_*****7vRt",
+			RuleName:                "Test Token",
+			RuleID:                  "test.token",
+			Severity:                "high",
+			Entropy:                 4.12,
+			RuleEntropyThreshold:    3.5,
+			RuleEntropyThresholdMet: true,
+		},
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		dnr       bool
+		wantMatch bool
+	}{
+		{name: "redacted", dnr: false, wantMatch: false},
+		{name: "do not redact", dnr: true, wantMatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := formatJSON(testResults(), 10, 2, 2048, 3, 2, tt.dnr)
+			if err != nil {
+				t.Fatalf("formatJSON failed: %v", err)
+			}
+
+			var parsed struct {
+				Summary map[string]int64 `json:"summary"`
+				Results []map[string]any `json:"results"`
+			}
+			if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+				t.Fatalf("Output is not valid JSON: %v\n%s", err, output)
+			}
+
+			wantSummary := map[string]int64{
+				"files_scanned":        10,
+				"files_skipped":        2,
+				"total_bytes":          2048,
+				"matches_found":        3,
+				"high_entropy_matches": 1,
+				"low_entropy_matches":  2,
+				"unique_secrets":       1,
+			}
+			for key, want := range wantSummary {
+				if got := parsed.Summary[key]; got != want {
+					t.Errorf("summary.%s = %d, expected %d", key, got, want)
+				}
+			}
+
+			if len(parsed.Results) != 1 {
+				t.Fatalf("Expected 1 result, got %d", len(parsed.Results))
+			}
+			result := parsed.Results[0]
+
+			wantFields := map[string]any{
+				"file_path":                  "config/app.env",
+				"line_number":                float64(3),
+				"column":                     float64(22),
+				"end_line_number":            float64(3),
+				"end_column":                 float64(42),
+				"redacted":                   "tok_*****7vRt",
+				"rule_name":                  "Test Token",
+				"rule_id":                    "test.token",
+				"severity":                   "high",
+				"entropy":                    4.12,
+				"rule_entropy_threshold":     3.5,
+				"rule_entropy_threshold_met": true,
+			}
+			for key, want := range wantFields {
+				if got := result[key]; got != want {
+					t.Errorf("results[0].%s = %v, expected %v", key, got, want)
+				}
+			}
+
+			match, hasMatch := result["match"]
+			if hasMatch != tt.wantMatch {
+				t.Errorf("Expected match present = %v, got %v", tt.wantMatch, hasMatch)
+			}
+			if tt.wantMatch && match != "tok_aZ3kQ9xLm2Pw7vRt" {
+				t.Errorf("Expected raw match with -dnr, got %v", match)
+			}
+		})
+	}
+}
+
+func TestFormatCSV(t *testing.T) {
+	for _, showFullMatch := range []bool{false, true} {
+		output, err := formatCSV(testResults(), showFullMatch)
+		if err != nil {
+			t.Fatalf("formatCSV failed: %v", err)
+		}
+
+		records, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to parse CSV: %v\n%s", err, output)
+		}
+		if len(records) != 2 {
+			t.Fatalf("Expected a header and 1 row, got %d records", len(records))
+		}
+
+		row := records[1]
+		if row[0] != "config/app.env" || row[1] != "3" || row[3] != "test.token" || row[6] != "tok_*****7vRt" || row[7] != "true" {
+			t.Errorf("Unexpected CSV row: %q", row)
+		}
+		if got := strings.Contains(output, "tok_aZ3kQ9xLm2Pw7vRt"); got != showFullMatch {
+			t.Errorf("Raw match in CSV = %t, expected %t with showFullMatch %t", got, showFullMatch, showFullMatch)
+		}
+	}
+}
+
+func TestFormatJSONMatchesSchema(t *testing.T) {
+	data, err := os.ReadFile("../../docs/scan-results.schema.json")
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+
+	var schema struct {
+		Properties map[string]struct {
+			Properties map[string]any `json:"properties"`
+		} `json:"properties"`
+		Defs map[string]struct {
+			Required   []string       `json:"required"`
+			Properties map[string]any `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Schema is not valid JSON: %v", err)
+	}
+
+	output, err := formatJSON(testResults(), 1, 0, 10, 1, 0, true)
+	if err != nil {
+		t.Fatalf("formatJSON failed: %v", err)
+	}
+
+	var parsed struct {
+		Summary map[string]any   `json:"summary"`
+		Results []map[string]any `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+
+	// Every emitted field must be documented in the schema
+	for key := range parsed.Summary {
+		if _, ok := schema.Properties["summary"].Properties[key]; !ok {
+			t.Errorf("summary.%s is missing from the schema", key)
+		}
+	}
+	for key := range parsed.Results[0] {
+		if _, ok := schema.Defs["result"].Properties[key]; !ok {
+			t.Errorf("results[].%s is missing from the schema", key)
+		}
+	}
+
+	// Every required field must be emitted
+	for _, key := range schema.Defs["result"].Required {
+		if _, ok := parsed.Results[0][key]; !ok {
+			t.Errorf("Required field %s is missing from the output", key)
+		}
+	}
+}
+
+// buildBinary builds the command for integration tests, returning its path
+func buildBinary(t *testing.T) string {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping binary integration test in short mode")
+	}
+
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	bin := filepath.Join(t.TempDir(), "poltergeist")
+	build := exec.Command(goBin, "build", "-o", bin, ".")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build binary: %v\n%s", err, output)
+	}
+	return bin
+}
+
+func TestExitCodes(t *testing.T) {
+	bin := buildBinary(t)
+
+	pattern := `tok_[a-zA-Z0-9]{16}`
+	baseline := filepath.Join(t.TempDir(), "baseline.json")
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "findings text", args: []string{"-engine", "go", "testdata/findings", pattern}, want: exitFindings},
+		{name: "findings json", args: []string{"-engine", "go", "-format", "json", "testdata/findings", pattern}, want: exitFindings},
+		{name: "findings sarif", args: []string{"-engine", "go", "-format", "sarif", "testdata/findings", pattern}, want: exitFindings},
+		{name: "findings csv", args: []string{"-engine", "go", "-format", "csv", "testdata/findings", pattern}, want: exitFindings},
+		{name: "findings html", args: []string{"-engine", "go", "-format", "html", "testdata/findings", pattern}, want: exitFindings},
+		{name: "findings md", args: []string{"-engine", "go", "-format", "md", "testdata/findings", pattern}, want: exitFindings},
+		{name: "only low-entropy matches shown", args: []string{"-engine", "go", "-low-entropy", "-entropy-threshold", "4.5", "testdata/findings", pattern}, want: exitOK},
+		{name: "findings exit zero", args: []string{"-engine", "go", "-exit-zero", "testdata/findings", pattern}, want: exitOK},
+		{name: "no findings", args: []string{"-engine", "go", "testdata/clean", pattern}, want: exitOK},
+		{name: "validate", args: []string{"validate", "../../rules"}, want: exitOK},
+		{name: "validate without rules path", args: []string{"validate"}, want: exitError},
+		{name: "test pattern", args: []string{"test", "-pattern", pattern, "-input", "tok_aZ3kQ9xLm2Pw7vRt"}, want: exitOK},
+		{name: "uncompilable pattern skipped", args: []string{"-engine", "go", "testdata/findings", pattern, `tok\Z`}, want: exitFindings},
+		{name: "uncompilable pattern strict", args: []string{"-engine", "go", "-strict", "testdata/findings", pattern, `tok\Z`}, want: exitError},
+		{name: "write baseline", args: []string{"-engine", "go", "-write-baseline", baseline, "testdata/findings", pattern}, want: exitFindings},
+		{name: "baseline suppresses findings", args: []string{"-engine", "go", "-baseline", baseline, "testdata/findings", pattern}, want: exitOK},
+		{name: "below min severity", args: []string{"-engine", "go", "-min-severity", "high", "testdata/findings", pattern}, want: exitOK},
+		{name: "at min severity", args: []string{"-engine", "go", "-min-severity", "medium", "testdata/findings", pattern}, want: exitFindings},
+		{name: "invalid min severity", args: []string{"-engine", "go", "-min-severity", "severe", "testdata/findings", pattern}, want: exitError},
+		{name: "excluded tag", args: []string{"-engine", "go", "-tags", "cli", "-exclude-tags", "CLI", "testdata/findings", pattern}, want: exitError},
+		{name: "included tag", args: []string{"-engine", "go", "-tags", "cli", "testdata/findings", pattern}, want: exitFindings},
+		{name: "rule id", args: []string{"-engine", "go", "-rule-id", "cli.pattern.1", "testdata/findings", pattern}, want: exitFindings},
+		{name: "unknown rule id", args: []string{"-engine", "go", "-rule-id", "cli.pattern.1,cli.pattern.9", "testdata/findings", pattern}, want: exitError},
+		{name: "fail fast", args: []string{"-engine", "go", "-fail-fast", "testdata/findings", pattern}, want: exitFindings},
+		{name: "fail fast no findings", args: []string{"-engine", "go", "-fail-fast", "testdata/clean", pattern}, want: exitOK},
+		{name: "decode", args: []string{"-engine", "go", "-decode", "testdata/findings", pattern}, want: exitFindings},
+		{name: "git blame", args: []string{"-engine", "go", "-git-blame", "testdata/findings", pattern}, want: exitFindings},
+		{name: "mmap", args: []string{"-engine", "go", "-mmap-threshold", "1B", "testdata/findings", pattern}, want: exitFindings},
+		{name: "invalid mmap threshold", args: []string{"-engine", "go", "-mmap-threshold", "big", "testdata/findings", pattern}, want: exitError},
+		{name: "follow symlinks", args: []string{"-engine", "go", "-follow-symlinks", "testdata/findings", pattern}, want: exitFindings},
+		{name: "whole file", args: []string{"-engine", "go", "-whole-file", "testdata/findings", pattern}, want: exitFindings},
+		{name: "stats", args: []string{"-engine", "go", "-stats", "testdata/findings", pattern}, want: exitFindings},
+		{name: "group", args: []string{"-engine", "go", "-group", "testdata/findings", pattern}, want: exitFindings},
+		{name: "group json", args: []string{"-engine", "go", "-group", "-format", "json", "testdata/findings", pattern}, want: exitError},
+		{name: "missing baseline", args: []string{"-engine", "go", "-baseline", "testdata/missing.json", "testdata/findings", pattern}, want: exitError},
+		{name: "invalid format", args: []string{"-engine", "go", "-format", "xml", "testdata/findings", pattern}, want: exitError},
+		{name: "workers", args: []string{"-engine", "go", "-workers", "1", "testdata/findings", pattern}, want: exitFindings},
+		{name: "invalid workers", args: []string{"-engine", "go", "-workers", "0", "testdata/findings", pattern}, want: exitError},
+		{name: "max file size", args: []string{"-engine", "go", "-max-file-size", "1KB", "testdata/findings", pattern}, want: exitFindings},
+		{name: "file over max file size", args: []string{"-engine", "go", "-max-file-size", "16B", "testdata/findings", pattern}, want: exitOK},
+		{name: "invalid max file size", args: []string{"-engine", "go", "-max-file-size", "lots", "testdata/findings", pattern}, want: exitError},
+		{name: "quiet", args: []string{"-engine", "go", "-quiet", "testdata/findings", pattern}, want: exitFindings},
+		{name: "quiet and verbose", args: []string{"-engine", "go", "-quiet", "-verbose", "testdata/findings", pattern}, want: exitError},
+		{name: "color always", args: []string{"-engine", "go", "-color", "always", "testdata/findings", pattern}, want: exitFindings},
+		{name: "invalid color", args: []string{"-engine", "go", "-color", "sometimes", "testdata/findings", pattern}, want: exitError},
+		{name: "invalid entropy threshold", args: []string{"-engine", "go", "-entropy-threshold", "-1", "testdata/findings", pattern}, want: exitError},
+		{name: "include", args: []string{"-engine", "go", "-include", "**/*.env", "testdata/findings", pattern}, want: exitFindings},
+		{name: "include matching nothing", args: []string{"-engine", "go", "-include", "**/*.go", "testdata/findings", pattern}, want: exitOK},
+		{name: "exclude", args: []string{"-engine", "go", "-exclude", "*.env", "testdata/findings", pattern}, want: exitOK},
+		{name: "include and exclude", args: []string{"-engine", "go", "-include", "**/*.env", "-exclude", "config.env", "testdata/findings", pattern}, want: exitOK},
+		{name: "invalid glob", args: []string{"-engine", "go", "-exclude", "[a-", "testdata/findings", pattern}, want: exitError},
+		{name: "diff adds", args: []string{"-engine", "go", "-diff", "testdata/diff/old", "testdata/diff/new", pattern}, want: exitFindings},
+		{name: "diff unchanged", args: []string{"-engine", "go", "-diff", "testdata/diff/new", "testdata/diff/new", pattern}, want: exitOK},
+		{name: "diff missing old path", args: []string{"-engine", "go", "-diff", "testdata/diff/missing", "testdata/diff/new", pattern}, want: exitError},
+		{name: "diff fail fast", args: []string{"-engine", "go", "-diff", "testdata/diff/old", "-fail-fast", "testdata/diff/new", pattern}, want: exitError},
+		{name: "history not a repository", args: []string{"-engine", "go", "-history", t.TempDir(), pattern}, want: exitError},
+		{name: "history invalid depth", args: []string{"-engine", "go", "-history=0", "testdata/findings", pattern}, want: exitError},
+		{name: "history diff", args: []string{"-engine", "go", "-history", "-diff", "testdata/diff/old", "testdata/diff/new", pattern}, want: exitError},
+		{name: "history stdin", args: []string{"-engine", "go", "-history=5", "-", pattern}, want: exitError},
+		{name: "missing remote repository", args: []string{"-engine", "go", "file://" + filepath.Join(t.TempDir(), "missing.git"), pattern}, want: exitError},
+		{name: "history remote repository", args: []string{"-engine", "go", "-history", "https://github.com/org/repo.git", pattern}, want: exitError},
+		{name: "missing path", args: []string{}, want: exitError},
+		{name: "multiple paths with stdin", args: []string{"-engine", "go", "-pattern", pattern, "testdata/findings", "-"}, want: exitError},
+		{name: "multiple paths with diff", args: []string{"-engine", "go", "-diff", "testdata/diff/old", "testdata/findings", "testdata/diff/new", "--", pattern}, want: exitError},
+		{name: "missing one of multiple paths", args: []string{"-engine", "go", "testdata/findings", "testdata/missing", "--", pattern}, want: exitError},
+		{name: "invalid pattern", args: []string{"-engine", "go", "testdata/findings", "[unclosed"}, want: exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(bin, tt.args...)
+			output, err := cmd.CombinedOutput()
+
+			code := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatalf("Failed to run binary: %v", err)
+			}
+
+			if code != tt.want {
+				t.Errorf("Expected exit code %d, got %d\n%s", tt.want, code, output)
+			}
+		})
+	}
+}
+
+func TestCollectFindings(t *testing.T) {
+	results := make(chan poltergeist.ScanResult, 3)
+	results <- poltergeist.ScanResult{FilePath: "b.env", LineNumber: 1, RuleEntropyThresholdMet: true}
+	results <- poltergeist.ScanResult{FilePath: "a.env", LineNumber: 2, RuleEntropyThresholdMet: false}
+	results <- poltergeist.ScanResult{FilePath: "a.env", LineNumber: 1, RuleEntropyThresholdMet: true}
+	close(results)
+	errc := make(chan error, 1)
+	errc <- errors.New("scan failed")
+	close(errc)
+
+	findings, lowEntropyCount, err := collectFindings(results, errc, false)
+	if err == nil || err.Error() != "scan failed" {
+		t.Errorf("Expected the scan error, got %v", err)
+	}
+	if lowEntropyCount != 1 {
+		t.Errorf("Expected 1 low entropy match dropped, got %d", lowEntropyCount)
+	}
+	if len(findings) != 2 || findings[0].FilePath != "a.env" || findings[1].FilePath != "b.env" {
+		t.Errorf("Expected the 2 findings sorted by path, got %+v", findings)
+	}
+}
+
+func TestScanStdin(t *testing.T) {
+	bin := buildBinary(t)
+
+	cmd := exec.Command(bin, "-engine", "go", "-format", "json", "-", `tok_[a-zA-Z0-9]{16}`)
+	cmd.Stdin = strings.NewReader("APP_NAME=demo\nAPP_TOKEN=tok_aZ3kQ9xLm2Pw7vRt\n")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitFindings {
+		t.Fatalf("Expected exit code %d, got %v", exitFindings, err)
+	}
+
+	var output struct {
+		Summary struct {
+			FilesScanned int64 `json:"files_scanned"`
+			TotalBytes   int64 `json:"total_bytes"`
+		} `json:"summary"`
+		Results []struct {
+			FilePath   string `json:"file_path"`
+			LineNumber int    `json:"line_number"`
+			RuleID     string `json:"rule_id"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		t.Fatalf("Failed to parse output: %v\n%s", err, stdout.String())
+	}
+
+	if len(output.Results) != 1 {
+		t.Fatalf("Expected 1 finding, got %+v", output.Results)
+	}
+	if result := output.Results[0]; result.FilePath != stdinName || result.LineNumber != 2 || result.RuleID != "cli.pattern.1" {
+		t.Errorf("Unexpected finding: %+v", result)
+	}
+	if output.Summary.FilesScanned != 1 || output.Summary.TotalBytes != 45 {
+		t.Errorf("Expected 1 file of 45 bytes scanned, got %+v", output.Summary)
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	bin := buildBinary(t)
+
+	output := filepath.Join(t.TempDir(), "report.json")
+	if err := os.WriteFile(output, []byte("stale report that is longer than the new one"+strings.Repeat(".", 4096)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(bin, "-engine", "go", "-format", "json", "-output", output, "testdata/findings", `tok_[a-zA-Z0-9]{16}`)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitFindings {
+		t.Fatalf("Expected exit code %d, got %v\n%s", exitFindings, err, stderr.String())
+	}
+
+	// Progress and status go to stderr, leaving stdout empty
+	if stdout.Len() != 0 {
+		t.Errorf("Expected no output on stdout, got:\n%s", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "Report written to "+output) {
+		t.Errorf("Expected status on stderr, got:\n%s", stderr.String())
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var report struct {
+		Summary struct {
+			FilesScanned int64 `json:"files_scanned"`
+		} `json:"summary"`
+		Results []struct {
+			FilePath string `json:"file_path"`
+			RuleID   string `json:"rule_id"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Report is not valid JSON: %v\n%s", err, data)
+	}
+	if len(report.Results) != 1 || report.Results[0].RuleID != "cli.pattern.1" || report.Summary.FilesScanned != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+}
+
+func TestQuietAndVerbose(t *testing.T) {
+	bin := buildBinary(t)
+	pattern := `tok_[a-zA-Z0-9]{16}`
+
+	run := func(t *testing.T, args ...string) (string, string) {
+		t.Helper()
+		cmd := exec.Command(bin, args...)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		var exitErr *exec.ExitError
+		if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitFindings {
+			t.Fatalf("Expected exit code %d, got %v\n%s", exitFindings, err, stderr.String())
+		}
+		return stdout.String(), stderr.String()
+	}
+
+	banner := []string{"Starting secret scan", "Scanning: testdata/findings", "Rules loaded", "CLI Pattern 1 (ID: cli.pattern.1)"}
+
+	t.Run("default", func(t *testing.T) {
+		stdout, _ := run(t, "-engine", "go", "testdata/findings", pattern)
+		for _, line := range banner {
+			if !strings.Contains(stdout, line) {
+				t.Errorf("Expected %q in output:\n%s", line, stdout)
+			}
+		}
+	})
+
+	t.Run("quiet text", func(t *testing.T) {
+		stdout, stderr := run(t, "-engine", "go", "-quiet", "testdata/findings", pattern)
+		for _, line := range banner {
+			if strings.Contains(stdout+stderr, line) {
+				t.Errorf("Expected no %q with -quiet:\n%s%s", line, stdout, stderr)
+			}
+		}
+		if !strings.Contains(stdout, "SCAN SUMMARY") || !strings.Contains(stdout, "tok_") {
+			t.Errorf("Expected the finding and summary with -quiet:\n%s", stdout)
+		}
+		if stderr != "" {
+			t.Errorf("Expected nothing on stderr with -quiet, got:\n%s", stderr)
+		}
+	})
+
+	t.Run("quiet json", func(t *testing.T) {
+		stdout, stderr := run(t, "-engine", "go", "-quiet", "-format", "json", "testdata/findings", pattern)
+		for _, line := range banner {
+			if strings.Contains(stderr, line) {
+				t.Errorf("Expected no %q with -quiet:\n%s", line, stderr)
+			}
+		}
+
+		var output struct {
+			Results []json.RawMessage `json:"results"`
+		}
+		if err := json.Unmarshal([]byte(stdout), &output); err != nil || len(output.Results) != 1 {
+			t.Errorf("Expected JSON output with 1 result, got %v:\n%s", err, stdout)
+		}
+	})
+
+	t.Run("verbose", func(t *testing.T) {
+		_, stderr := run(t, "-engine", "go", "-verbose", "testdata/findings", pattern)
+		if !strings.Contains(stderr, `msg="scanned file" path=testdata/findings/`) {
+			t.Errorf("Expected scanned files to be logged with -verbose:\n%s", stderr)
+		}
+	})
+}
+
+// TestEntropyThreshold checks that -entropy-threshold replaces the rules'
+// thresholds; the fixture's token has an entropy of about 4.12
+func TestEntropyThreshold(t *testing.T) {
+	bin := buildBinary(t)
+	pattern := `tok_[a-zA-Z0-9]{16}`
+
+	tests := []struct {
+		name           string
+		args           []string
+		ruleFile       bool
+		wantCode       int
+		wantHigh       int
+		wantLow        int
+		wantThresholds float64
+	}{
+		{name: "rule threshold", wantCode: exitFindings, wantHigh: 1},
+		{name: "below token entropy", args: []string{"-entropy-threshold", "4"}, wantCode: exitFindings, wantHigh: 1, wantThresholds: 4},
+		{name: "above token entropy", args: []string{"-entropy-threshold", "4.5"}, wantCode: exitOK, wantLow: 1},
+		{name: "above token entropy with low-entropy", args: []string{"-entropy-threshold", "4.5", "-low-entropy"}, wantCode: exitOK, wantHigh: 1, wantThresholds: 4.5},
+		{name: "rule file threshold", ruleFile: true, wantCode: exitOK, wantLow: 1},
+		{name: "zero threshold", args: []string{"-entropy-threshold", "0"}, ruleFile: true, wantCode: exitFindings, wantHigh: 1},
+	}
+
+	// A rule requiring more entropy than the token has
+	rulePath := filepath.Join(t.TempDir(), "token.yaml")
+	ruleYAML := "rules:\n  - name: Test Token\n    id: test.token.1\n    pattern: " + pattern + "\n    entropy: 5.0\n    redact: [4, 4]\n"
+	if err := os.WriteFile(rulePath, []byte(ruleYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-engine", "go", "-format", "json"}, tt.args...)
+			if tt.ruleFile {
+				args = append(args, "-rules", rulePath, "testdata/findings")
+			} else {
+				args = append(args, "testdata/findings", pattern)
+			}
+			cmd := exec.Command(bin, args...)
+			var stdout bytes.Buffer
+			cmd.Stdout = &stdout
+
+			code := 0
+			var exitErr *exec.ExitError
+			if err := cmd.Run(); errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatalf("Failed to run binary: %v", err)
+			}
+			if code != tt.wantCode {
+				t.Errorf("Expected exit code %d, got %d", tt.wantCode, code)
+			}
+
+			var output struct {
+				Summary struct {
+					HighEntropy int `json:"high_entropy_matches"`
+					LowEntropy  int `json:"low_entropy_matches"`
+				} `json:"summary"`
+				Results []struct {
+					Threshold float64 `json:"rule_entropy_threshold"`
+				} `json:"results"`
+			}
+			if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+				t.Fatalf("Failed to parse JSON output: %v\n%s", err, stdout.String())
+			}
+			if output.Summary.HighEntropy != tt.wantHigh || output.Summary.LowEntropy != tt.wantLow {
+				t.Errorf("Expected %d high and %d low entropy matches, got %d and %d", tt.wantHigh, tt.wantLow, output.Summary.HighEntropy, output.Summary.LowEntropy)
+			}
+			for _, result := range output.Results {
+				if result.Threshold != tt.wantThresholds {
+					t.Errorf("Expected threshold %g, got %g", tt.wantThresholds, result.Threshold)
+				}
+			}
+		})
+	}
+}
+
+// TestConfigPrecedence checks that flags override the config file, which
+// overrides the defaults; the fixture's token has an entropy of about 4.12
+func TestConfigPrecedence(t *testing.T) {
+	bin := buildBinary(t)
+	pattern := `tok_[a-zA-Z0-9]{16}`
+
+	fixture, err := os.ReadFile("testdata/findings/config.env")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.env"), fixture, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := "format: json\nentropy_threshold: 4.5\n"
+	if err := os.WriteFile(filepath.Join(dir, poltergeist.ConfigFile), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	unknown := filepath.Join(t.TempDir(), "unknown.yaml")
+	if err := os.WriteFile(unknown, []byte("format: json\nthreshold: 4.5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	excluding := filepath.Join(t.TempDir(), "excluding.yaml")
+	if err := os.WriteFile(excluding, []byte("exclude: [\"*.env\"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantJSON bool
+	}{
+		{name: "default", args: []string{"testdata/findings"}, wantCode: exitFindings},
+		{name: "file", args: []string{dir}, wantCode: exitOK, wantJSON: true},
+		{name: "flag beats file", args: []string{"-entropy-threshold", "4", "-format", "text", dir}, wantCode: exitFindings},
+		{name: "config flag", args: []string{"-config", filepath.Join(dir, poltergeist.ConfigFile), "testdata/findings"}, wantCode: exitOK, wantJSON: true},
+		{name: "config exclude", args: []string{"-config", excluding, "testdata/findings"}, wantCode: exitOK},
+		{name: "unknown key", args: []string{"-config", unknown, "testdata/findings"}, wantCode: exitError},
+		{name: "missing config", args: []string{"-config", filepath.Join(dir, "missing.yaml"), "testdata/findings"}, wantCode: exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(append([]string{"-engine", "go"}, tt.args...), pattern)
+			cmd := exec.Command(bin, args...)
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			code := 0
+			var exitErr *exec.ExitError
+			if err := cmd.Run(); errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatalf("Failed to run binary: %v", err)
+			}
+			if code != tt.wantCode {
+				t.Fatalf("Expected exit code %d, got %d\n%s", tt.wantCode, code, stderr.String())
+			}
+			if code == exitError {
+				return
+			}
+
+			if isJSON := json.Valid(stdout.Bytes()); isJSON != tt.wantJSON {
+				t.Errorf("JSON output = %t, expected %t:\n%s", isJSON, tt.wantJSON, stdout.String())
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	bin := buildBinary(t)
+
+	// The new tree adds one secret, removes another, and moves a third
+	cmd := exec.Command(bin, "-engine", "go", "-format", "json", "-diff", "testdata/diff/old", "testdata/diff/new", `tok_[a-zA-Z0-9]{16}`)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitFindings {
+		t.Fatalf("Expected exit code %d, got %v\n%s", exitFindings, err, stderr.String())
+	}
+
+	var output struct {
+		Results []struct {
+			FilePath   string `json:"file_path"`
+			LineNumber int    `json:"line_number"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		t.Fatalf("Failed to parse JSON output: %v\n%s", err, stdout.String())
+	}
+	if len(output.Results) != 1 || output.Results[0].FilePath != filepath.Join("testdata", "diff", "new", "config.env") || output.Results[0].LineNumber != 4 {
+		t.Errorf("Expected only the added finding, got %+v", output.Results)
+	}
+	if !strings.Contains(stderr.String(), "Diff against testdata/diff/old: 1 findings added, 1 removed") {
+		t.Errorf("Expected a diff summary on stderr:\n%s", stderr.String())
+	}
+}
+
+func TestHistory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	bin := buildBinary(t)
+
+	// Commit a secret, then delete it
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_GLOBAL="+os.DevNull,
+			"GIT_CONFIG_NOSYSTEM=1",
+			"GIT_AUTHOR_NAME=Test Author",
+			"GIT_AUTHOR_EMAIL=author@example.com",
+			"GIT_COMMITTER_NAME=Test Author",
+			"GIT_COMMITTER_EMAIL=author@example.com",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	git("init", "-q")
+	if err := os.WriteFile(filepath.Join(repo, "config.env"), []byte("TOKEN=tok_aZ3kQ9xLm2Pw7vRt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", ".")
+	git("commit", "-q", "-m", "Add config")
+	git("rm", "-q", "config.env")
+	git("commit", "-q", "-m", "Remove config")
+
+	pattern := `tok_[a-zA-Z0-9]{16}`
+	if err := exec.Command(bin, "-engine", "go", repo, pattern).Run(); err != nil {
+		t.Fatalf("Expected no findings in the working tree, got %v", err)
+	}
+
+	cmd := exec.Command(bin, "-engine", "go", "-format", "json", "-history", repo, pattern)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitFindings {
+		t.Fatalf("Expected exit code %d, got %v\n%s", exitFindings, err, stderr.String())
+	}
+
+	var output struct {
+		Results []struct {
+			FilePath  string `json:"file_path"`
+			GitAuthor string `json:"git_author"`
+			GitCommit string `json:"git_commit"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		t.Fatalf("Failed to parse JSON output: %v\n%s", err, stdout.String())
+	}
+	if len(output.Results) != 1 || output.Results[0].FilePath != "config.env" || output.Results[0].GitAuthor != "Test Author" || len(output.Results[0].GitCommit) != 40 {
+		t.Errorf("Expected the deleted secret with its commit, got %+v", output.Results)
+	}
+
+	// The latest commit only deletes the secret
+	if err := exec.Command(bin, "-engine", "go", "-history=1", repo, pattern).Run(); err != nil {
+		t.Errorf("Expected no findings in the latest commit, got %v", err)
+	}
+}
+
+func TestIsRemoteURL(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "https://github.com/org/repo.git", want: true},
+		{path: "ssh://git@github.com/org/repo.git", want: true},
+		{path: "file:///srv/git/repo.git", want: true},
+		{path: "git@github.com:org/repo.git", want: true},
+		{path: "testdata/findings", want: false},
+		{path: "/home/me/repo", want: false},
+		{path: "-", want: false},
+		{path: "dir/user@host:file", want: false},
+		{path: "@host:repo", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isRemoteURL(tt.path); got != tt.want {
+			t.Errorf("isRemoteURL(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	tests := []struct {
+		mode    string
+		isTTY   bool
+		noColor string
+		want    bool
+		wantErr bool
+	}{
+		{mode: "auto", isTTY: true, want: true},
+		{mode: "auto", isTTY: false, want: false},
+		{mode: "auto", isTTY: true, noColor: "1", want: false},
+		{mode: "always", isTTY: false, want: true},
+		{mode: "always", isTTY: false, noColor: "1", want: true},
+		{mode: "never", isTTY: true, want: false},
+		{mode: "sometimes", isTTY: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := colorEnabled(tt.mode, tt.isTTY, tt.noColor)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("colorEnabled(%q, %t, %q) error = %v, wantErr %t", tt.mode, tt.isTTY, tt.noColor, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("colorEnabled(%q, %t, %q) = %t, expected %t", tt.mode, tt.isTTY, tt.noColor, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTextColor(t *testing.T) {
+	results := testResults()
+
+	colored := formatText(results, 1, 0, 100, 1, 0, time.Second, true, false, false)
+	for _, want := range []string{colorMagenta + "Test Token" + colorReset, colorRed + "tok_*****7vRt" + colorReset, colorCyan + "3:22" + colorReset} {
+		if !strings.Contains(colored, want) {
+			t.Errorf("Expected %q in colored output:\n%s", want, colored)
+		}
+	}
+
+	if plain := formatText(results, 1, 0, 100, 1, 0, time.Second, false, false, false); strings.Contains(plain, "\033[") {
+		t.Errorf("Expected no escape codes without color:\n%s", plain)
+	}
+}
+
+// TestColorOutput checks that -color auto never colors output that isn't
+// written to a terminal
+func TestColorOutput(t *testing.T) {
+	bin := buildBinary(t)
+	pattern := `tok_[a-zA-Z0-9]{16}`
+
+	tests := []struct {
+		name string
+		args []string
+		env  []string
+		want bool
+	}{
+		{name: "auto", args: []string{"-color", "auto"}, want: false},
+		{name: "always", args: []string{"-color", "always"}, want: true},
+		{name: "always with NO_COLOR", args: []string{"-color", "always"}, env: []string{"NO_COLOR=1"}, want: true},
+		{name: "no-color", args: []string{"-color", "always", "-no-color"}, want: false},
+		{name: "always json", args: []string{"-color", "always", "-format", "json"}, want: false},
+		{name: "always sarif", args: []string{"-color", "always", "-format", "sarif"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(append([]string{"-engine", "go"}, tt.args...), "testdata/findings", pattern)
+			cmd := exec.Command(bin, args...)
+			cmd.Env = append(os.Environ(), tt.env...)
+			var stdout bytes.Buffer
+			cmd.Stdout = &stdout
+
+			var exitErr *exec.ExitError
+			if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitFindings {
+				t.Fatalf("Expected exit code %d, got %v", exitFindings, err)
+			}
+			if got := strings.Contains(stdout.String(), "\033["); got != tt.want {
+				t.Errorf("Escape codes in output = %t, expected %t:\n%s", got, tt.want, stdout.String())
+			}
+		})
+	}
+}
+
+// TestOutputFileOrder checks that findings are grouped by file in the same
+// order on every run, not the order of a map
+func TestOutputFileOrder(t *testing.T) {
+	bin := buildBinary(t)
+	pattern := `tok_[a-zA-Z0-9]{16}`
+
+	dir := t.TempDir()
+	for i := range 8 {
+		content := fmt.Sprintf("TOKEN=tok_aZ3kQ9xLm2Pw7v%02d\n", i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.env", i)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, format := range []string{"text", "md"} {
+		t.Run(format, func(t *testing.T) {
+			run := func() string {
+				cmd := exec.Command(bin, "-engine", "go", "-quiet", "-format", format, dir, pattern)
+				var stdout bytes.Buffer
+				cmd.Stdout = &stdout
+
+				var exitErr *exec.ExitError
+				if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitFindings {
+					t.Fatalf("Expected exit code %d, got %v", exitFindings, err)
+				}
+
+				// Drop the lines with the date and duration, which differ
+				// between runs
+				var lines []string
+				for _, line := range strings.Split(stdout.String(), "\n") {
+					if !strings.Contains(line, "Date:") && !strings.Contains(line, "duration") && !strings.Contains(line, "completed in") {
+						lines = append(lines, line)
+					}
+				}
+				return strings.Join(lines, "\n")
+			}
+
+			first := run()
+			for i := range 8 {
+				if !strings.Contains(first, fmt.Sprintf("%d.env", i)) {
+					t.Fatalf("Expected findings in %d.env:\n%s", i, first)
+				}
+				if i > 0 && strings.Index(first, fmt.Sprintf("%d.env", i-1)) > strings.Index(first, fmt.Sprintf("%d.env", i)) {
+					t.Errorf("Expected %d.env before %d.env:\n%s", i-1, i, first)
+				}
+			}
+			for range 3 {
+				if output := run(); output != first {
+					t.Fatalf("Expected the same output on every run, got:\n%s\nthen:\n%s", first, output)
+				}
+			}
+		})
+	}
+}
+
+func TestScanMultiplePaths(t *testing.T) {
+	bin := buildBinary(t)
+	pattern := `tok_[a-zA-Z0-9]{16}`
+
+	for _, args := range [][]string{
+		{"-pattern", pattern, "testdata/findings", "testdata/diff/new"},
+		{"testdata/findings", "testdata/diff/new", "--", pattern},
+	} {
+		cmd := exec.Command(bin, append([]string{"-engine", "go", "-format", "json"}, args...)...)
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+
+		var exitErr *exec.ExitError
+		if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitFindings {
+			t.Fatalf("%v: expected exit code %d, got %v", args, exitFindings, err)
+		}
+
+		var output struct {
+			Summary struct {
+				FilesScanned int `json:"files_scanned"`
+			} `json:"summary"`
+			Results []struct {
+				FilePath   string `json:"file_path"`
+				LineNumber int    `json:"line_number"`
+				RuleID     string `json:"rule_id"`
+			} `json:"results"`
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+			t.Fatalf("%v: invalid JSON output: %v\n%s", args, err, stdout.String())
+		}
+
+		var got []string
+		for _, result := range output.Results {
+			if result.RuleID != "cli.pattern.1" {
+				t.Errorf("%v: expected only cli.pattern.1 findings, got %s", args, result.RuleID)
+			}
+			got = append(got, fmt.Sprintf("%s:%d", filepath.ToSlash(result.FilePath), result.LineNumber))
+		}
+		want := []string{"testdata/diff/new/config.env:3", "testdata/diff/new/config.env:4", "testdata/findings/config.env:2"}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("%v: expected findings %v, got %v", args, want, got)
+		}
+		if output.Summary.FilesScanned != 2 {
+			t.Errorf("%v: expected 2 files scanned, got %d", args, output.Summary.FilesScanned)
+		}
+	}
+}
+
+func TestPrintRuleStats(t *testing.T) {
+	rules := []poltergeist.Rule{
+		{Name: "Token A", ID: "test.a"},
+		{Name: "Token B", ID: "test.b"},
+		{Name: "Token C", ID: "test.c"},
+	}
+	stats := map[string]int64{"test.a": 2, "test.b": 7}
+
+	var buf bytes.Buffer
+	printRuleStats(&buf, stats, rules)
+	output := buf.String()
+
+	// Rules with the most matches come first
+	b, a := strings.Index(output, "test.b"), strings.Index(output, "test.a")
+	if b < 0 || a < 0 || b > a {
+		t.Errorf("Expected test.b before test.a, got:\n%s", output)
+	}
+	if !strings.Contains(output, "7") || !strings.Contains(output, "Token B") {
+		t.Errorf("Expected counts and rule names, got:\n%s", output)
+	}
+	if strings.Contains(output, "test.c") || !strings.Contains(output, "1 of 3 rules found no matches") {
+		t.Errorf("Expected test.c to be summarized as unmatched, got:\n%s", output)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	poltergeist "github.com/ghostsecurity/poltergeist/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+// ruleTemplate is the rule file written by the new-rule command. Every
+// required field is set, so only the placeholder pattern and test cases need
+// replacing for the rule to pass validation.
+var ruleTemplate = template.Must(template.New("rule").Funcs(template.FuncMap{"yaml": yamlString}).Parse(`rules:
+  - name: {{yaml .Name}}
+    id: {{.ID}}
+    description: TODO describe the secret this rule detects.
+    tags:
+      - {{yaml .Tag}}
+    pattern: |
+      (?x)
+        \b
+          (TODO_REPLACE_WITH_PATTERN)
+        \b
+    entropy: 3.0
+    redact: [4, 4]
+    tests:
+      assert:
+        - TODO a line containing a secret the pattern must report
+      assert_not:
+        - TODO a similar line the pattern must not report
+    history:
+      - {{.Date}} initial version
+`))
+
+// yamlString returns s as a YAML scalar, quoted if needed
+func yamlString(s string) (string, error) {
+	out, err := yaml.Marshal(s)
+	return strings.TrimSuffix(string(out), "\n"), err
+}
+
+// runNewRule runs the new-rule command, writing a rule file with the given
+// ID and name and placeholders for the fields to fill in. It returns the exit
+// code.
+func runNewRule(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("new-rule", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	id := flags.String("id", "", "Rule ID, such as aws.session.token (lowercase letters, digits, and periods)")
+	name := flags.String("name", "", "Human-readable rule name")
+	output := flags.String("output", "", "File to write the rule to (default <id>.yaml)")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s new-rule -id <id> -name <name> [-output file]\n", os.Args[0])
+		fmt.Fprintf(stderr, "\nWrites a rule file with every required field, and placeholder pattern and\n")
+		fmt.Fprintf(stderr, "test cases to replace before the rule passes validate.\n\nOptions:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitError
+	}
+	if *id == "" || *name == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return exitError
+	}
+	if !poltergeist.ValidRuleID(*id) {
+		fmt.Fprintf(stderr, "Error: invalid rule ID '%s': use lowercase letters, digits, and periods only\n", *id)
+		return exitError
+	}
+
+	path := *output
+	if path == "" {
+		path = *id + ".yaml"
+	}
+
+	var content strings.Builder
+	err := ruleTemplate.Execute(&content, struct{ ID, Name, Tag, Date string }{
+		ID:   *id,
+		Name: *name,
+		Tag:  strings.Split(*id, ".")[0],
+		Date: time.Now().Format(time.DateOnly),
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to write rule: %v\n", err)
+		return exitError
+	}
+
+	// Never overwrite an existing rule file
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to create rule file: %v\n", err)
+		return exitError
+	}
+	if _, err := io.WriteString(file, content.String()); err != nil {
+		file.Close()
+		fmt.Fprintf(stderr, "Failed to write rule file: %v\n", err)
+		return exitError
+	}
+	if err := file.Close(); err != nil {
+		fmt.Fprintf(stderr, "Failed to write rule file: %v\n", err)
+		return exitError
+	}
+
+	fmt.Fprintf(stdout, "Wrote rule %s to %s\n", *id, path)
+	fmt.Fprintf(stdout, "Replace its pattern and test cases, then check it with: %s validate %s\n", os.Args[0], path)
+	return exitOK
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	poltergeist "github.com/ghostsecurity/poltergeist/pkg"
+)
+
+func TestNewRuleCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aws.yaml")
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-id", "aws.session.token", "-name", "AWS Session Token: temporary", "-output", path}
+	if code := runNewRule(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code %d, got %d\n%s", exitOK, code, stderr.String())
+	}
+
+	// The scaffolded rule loads, so it passes Validate
+	rules, err := poltergeist.LoadRulesFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load the scaffolded rule: %v", err)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("Expected 1 rule, got %d", len(rules))
+	}
+	rule := rules[0]
+	if rule.ID != "aws.session.token" || rule.Name != "AWS Session Token: temporary" {
+		t.Errorf("Expected the given ID and name, got %s and %q", rule.ID, rule.Name)
+	}
+	if len(rule.Tags) != 1 || rule.Tags[0] != "aws" {
+		t.Errorf("Expected the tag aws, got %v", rule.Tags)
+	}
+
+	// Only the placeholder pattern not matching the placeholder assert case
+	// fails validation
+	problems := poltergeist.ValidateRules(rules)
+	if len(problems) == 0 {
+		t.Fatal("Expected the placeholder test case to fail validation")
+	}
+	for _, problem := range problems {
+		if !strings.HasPrefix(problem.Err.Error(), "assert case 1 doesn't match") {
+			t.Errorf("Expected only the placeholder assert case to fail, got %v", problem)
+		}
+	}
+
+	// An existing file isn't overwritten
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := runNewRule([]string{"-id", "aws.session.token.2", "-name", "Other", "-output", path}, &stdout, &stderr); code != exitError {
+		t.Errorf("Expected exit code %d for an existing file, got %d", exitError, code)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Error("Expected the existing file to be left unchanged")
+	}
+
+	// Invalid arguments
+	for _, args := range [][]string{
+		{"-name", "Missing ID"},
+		{"-id", "aws.missing.name"},
+		{"-id", "AWS_Token", "-name", "Invalid ID"},
+	} {
+		if code := runNewRule(args, &stdout, &stderr); code != exitError {
+			t.Errorf("Expected exit code %d for %v, got %d", exitError, args, code)
+		}
+	}
+}
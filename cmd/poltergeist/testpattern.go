@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	poltergeist "github.com/ghostsecurity/poltergeist/pkg"
+)
+
+// runTestPattern runs the test command, matching a pattern against sample
+// input with the Go regex engine and Hyperscan, if it is available. It prints
+// each engine's matches with their span, redacted text, and entropy, and
+// returns the exit code: exitFindings if nothing matched, or exitError if an
+// engine couldn't compile the pattern.
+func runTestPattern(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	pattern := flags.String("pattern", "", "Regex pattern to test, which may use (?x) extended syntax")
+	input := flags.String("input", "", "Sample input to match the pattern against")
+	entropy := flags.Float64("entropy", 0, "Minimum entropy a match must have to be reported by a rule")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s test -pattern <regex> -input <string> [-entropy float]\n", os.Args[0])
+		fmt.Fprintf(stderr, "\nMatches a pattern against sample input with every available engine, showing\n")
+		fmt.Fprintf(stderr, "each match's span, redacted text, and entropy.\n\nOptions:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitError
+	}
+	if *pattern == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return exitError
+	}
+	if *entropy < 0 {
+		fmt.Fprintf(stderr, "Error: -entropy must not be negative, got %g\n", *entropy)
+		return exitError
+	}
+
+	rule := poltergeist.Rule{
+		Name:    "Test Pattern",
+		ID:      "cli.test.1",
+		Pattern: *pattern,
+		Entropy: *entropy,
+	}
+
+	engines := []poltergeist.PatternEngine{poltergeist.NewGoRegexEngine()}
+	if poltergeist.IsHyperscanAvailable() {
+		engines = append(engines, poltergeist.NewHyperscanEngine())
+	}
+
+	fmt.Fprintf(stdout, "Normalized pattern: %s\n", poltergeist.NormalizeExtendedRegex(*pattern))
+
+	code := exitFindings
+	for _, engine := range engines {
+		defer engine.Close()
+
+		fmt.Fprintf(stdout, "\n%s:\n", engine.Name())
+		if err := engine.CompileRules([]poltergeist.Rule{rule}); err != nil {
+			fmt.Fprintf(stdout, "  Failed to compile: %v\n", err)
+			code = exitError
+			continue
+		}
+
+		matches := engine.FindAllInLine(*input)
+		if len(matches) == 0 {
+			fmt.Fprintf(stdout, "  No match\n")
+			continue
+		}
+		if code != exitError {
+			code = exitOK
+		}
+
+		for _, match := range matches {
+			threshold := "meets"
+			if !match.RuleEntropyThresholdMet {
+				threshold = "below"
+			}
+			fmt.Fprintf(stdout, "  Match at [%d:%d]: %s\n", match.Start, match.End, match.Redacted)
+			fmt.Fprintf(stdout, "    Entropy: %.2f (%s minimum %.2f)\n", match.Entropy, threshold, *entropy)
+		}
+	}
+
+	return code
+}
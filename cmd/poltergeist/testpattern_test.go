@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTestPatternCommand(t *testing.T) {
+	pattern := "(?x)\n  \\b\n    (tok_[a-zA-Z0-9]{16}) # the token\n  \\b\n"
+
+	tests := []struct {
+		name   string
+		args   []string
+		want   int
+		output []string
+	}{
+		{
+			name: "match",
+			args: []string{"-pattern", pattern, "-input", "TOKEN=tok_aZ3kQ9xLm2Pw7vRt", "-entropy", "3"},
+			want: exitOK,
+			output: []string{
+				"Normalized pattern: \\b(tok_[a-zA-Z0-9]{16})\\b\n",
+				"Go Regex:\n  Match at [6:26]: tok_*****7vRt\n    Entropy: 4.12 (meets minimum 3.00)\n",
+			},
+		},
+		{
+			name:   "match below entropy",
+			args:   []string{"-pattern", pattern, "-input", "TOKEN=tok_aaaaaaaaaaaaaaaa", "-entropy", "3"},
+			want:   exitOK,
+			output: []string{"Entropy: 1.12 (below minimum 3.00)"},
+		},
+		{
+			name:   "no match",
+			args:   []string{"-pattern", pattern, "-input", "TOKEN=tok_short"},
+			want:   exitFindings,
+			output: []string{"Go Regex:\n  No match\n"},
+		},
+		{
+			name:   "invalid pattern",
+			args:   []string{"-pattern", "tok_[unclosed", "-input", "tok_"},
+			want:   exitError,
+			output: []string{"Go Regex:\n  Failed to compile: "},
+		},
+		{name: "missing pattern", args: []string{"-input", "tok_"}, want: exitError},
+		{name: "negative entropy", args: []string{"-pattern", pattern, "-entropy", "-1"}, want: exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runTestPattern(tt.args, &stdout, &stderr); code != tt.want {
+				t.Errorf("Expected exit code %d, got %d\n%s%s", tt.want, code, stdout.String(), stderr.String())
+			}
+			for _, want := range tt.output {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("Expected output containing %q, got:\n%s", want, stdout.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	poltergeist "github.com/ghostsecurity/poltergeist/pkg"
+)
+
+// runValidate runs the validate command, loading the rules at the paths in
+// args and checking them with ValidateRules. It prints whether each rule
+// passed, with the problems found in those that didn't, and returns the exit
+// code: exitFindings if any rule failed.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s validate <rules_path> [rules_path] ...\n", os.Args[0])
+		fmt.Fprintf(stderr, "\nChecks the YAML rule files or directories of rule files at each path and runs\n")
+		fmt.Fprintf(stderr, "their assert and assert_not test cases with every available engine.\n")
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitError
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitError
+	}
+
+	rules, err := poltergeist.LoadRulesFromPaths(flags.Args())
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to load rules: %v\n", err)
+		return exitError
+	}
+
+	problems := make(map[string][]error)
+	for _, problem := range poltergeist.ValidateRules(rules) {
+		problems[problem.RuleID] = append(problems[problem.RuleID], problem.Err)
+	}
+
+	// Rules sharing an ID are listed once, with the problems of all of them
+	var passed, failed int
+	listed := make(map[string]bool)
+	for _, rule := range rules {
+		if listed[rule.ID] {
+			continue
+		}
+		listed[rule.ID] = true
+
+		if len(problems[rule.ID]) == 0 {
+			passed++
+			fmt.Fprintf(stdout, "PASS  %s\n", rule.ID)
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(stdout, "FAIL  %s\n", rule.ID)
+		for _, err := range problems[rule.ID] {
+			fmt.Fprintf(stdout, "      %v\n", err)
+		}
+	}
+
+	fmt.Fprintf(stdout, "\n%d rules checked: %d passed, %d failed\n", passed+failed, passed, failed)
+	if failed > 0 {
+		return exitFindings
+	}
+	return exitOK
+}
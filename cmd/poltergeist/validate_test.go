@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRuleYAML is a rule file with one rule that passes validation, and a
+// placeholder for a second rule's assert case
+const testRuleYAML = `rules:
+  - name: Test Token
+    id: test.token.1
+    description: A test token.
+    tags: [test]
+    pattern: '\b(tok_[a-zA-Z0-9]{16})\b'
+    redact: [4, 4]
+    entropy: 3.0
+    tests:
+      assert:
+        - TOKEN=tok_aZ3kQ9xLm2Pw7vRt
+      assert_not:
+        - TOKEN=tok_aaaaaaaaaaaaaaaa
+    history:
+      - 2026-01-01 initial version
+  - name: Other Token
+    id: test.token.2
+    description: Another test token.
+    tags: [test]
+    pattern: '\b(oth_[a-zA-Z0-9]{16})\b'
+    redact: [4, 4]
+    entropy: 3.0
+    tests:
+      assert:
+        - %s
+      assert_not:
+        - TOKEN=oth_aaaaaaaaaaaaaaaa
+    history:
+      - 2026-01-01 initial version
+`
+
+func TestValidateCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		assertCase string
+		want       int
+		output     []string
+	}{
+		{
+			name:       "passing rules",
+			assertCase: "TOKEN=oth_aZ3kQ9xLm2Pw7vRt",
+			want:       exitOK,
+			output:     []string{"PASS  test.token.1\n", "PASS  test.token.2\n", "2 rules checked: 2 passed, 0 failed"},
+		},
+		{
+			name:       "failing assert case",
+			assertCase: "TOKEN=oth_tooshort",
+			want:       exitFindings,
+			output:     []string{"PASS  test.token.1\n", "FAIL  test.token.2\n      assert case 1 doesn't match (Go Regex)\n", "2 rules checked: 1 passed, 1 failed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.yaml")
+			if err := os.WriteFile(path, []byte(strings.Replace(testRuleYAML, "%s", tt.assertCase, 1)), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			if code := runValidate([]string{path}, &stdout, &stderr); code != tt.want {
+				t.Errorf("Expected exit code %d, got %d\n%s%s", tt.want, code, stdout.String(), stderr.String())
+			}
+			for _, want := range tt.output {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("Expected output containing %q, got:\n%s", want, stdout.String())
+				}
+			}
+		})
+	}
+
+	// The packaged rules pass
+	var stdout, stderr bytes.Buffer
+	if code := runValidate([]string{"../../rules"}, &stdout, &stderr); code != exitOK {
+		t.Errorf("Expected the packaged rules to pass, got exit code %d\n%s%s", code, stdout.String(), stderr.String())
+	}
+
+	// Usage and load errors
+	if code := runValidate(nil, &stdout, &stderr); code != exitError {
+		t.Errorf("Expected exit code %d without a rules path, got %d", exitError, code)
+	}
+	if code := runValidate([]string{"testdata/missing"}, &stdout, &stderr); code != exitError {
+		t.Errorf("Expected exit code %d for a missing rules path, got %d", exitError, code)
+	}
+}
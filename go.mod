@@ -5,3 +5,7 @@ go 1.25.6
 require github.com/flier/gohs v1.2.3
 
 require gopkg.in/yaml.v3 v3.0.1
+
+require golang.org/x/net v0.57.0
+
+require golang.org/x/text v0.40.0
@@ -0,0 +1,270 @@
+package poltergeist
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxDecompressedSize is the default Scanner.MaxDecompressedSize
+const DefaultMaxDecompressedSize = 100 * 1024 * 1024
+
+// DefaultMaxArchiveSize is the default Scanner.MaxArchiveSize
+const DefaultMaxArchiveSize = 1024 * 1024 * 1024
+
+// DefaultMaxArchiveEntries is the default Scanner.MaxArchiveEntries
+const DefaultMaxArchiveEntries = 10000
+
+// maxArchiveDepth is the deepest nesting of compressed files and archives
+// that is scanned, so self-containing archives can't recurse forever
+const maxArchiveDepth = 8
+
+// ArchiveSeparator separates the path of a compressed file or archive from
+// the path of the content within it in result paths, for example
+// "logs/app.log.gz!app.log" or "bundle.zip!config/app.env"
+const ArchiveSeparator = "!"
+
+// ErrDecompressedSizeLimit is returned when decompressed content exceeds
+// Scanner.MaxDecompressedSize or Scanner.MaxArchiveSize
+var ErrDecompressedSizeLimit = errors.New("decompressed size exceeds limit")
+
+// ErrArchiveEntryLimit is returned when an archive has more entries than
+// Scanner.MaxArchiveEntries
+var ErrArchiveEntryLimit = errors.New("archive entries exceed limit")
+
+// gzipMagic is the header that starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// zipMagic is the header that starts every zip archive with entries
+var zipMagic = []byte("PK\x03\x04")
+
+// tarMagicOffset is the offset of the format magic in a tar header
+const tarMagicOffset = 257
+
+// isGzip reports whether content starts with the gzip header
+func isGzip(head []byte) bool {
+	return bytes.HasPrefix(head, gzipMagic)
+}
+
+// isZip reports whether content starts with a zip entry header
+func isZip(head []byte) bool {
+	return bytes.HasPrefix(head, zipMagic)
+}
+
+// isTar reports whether content starts with a POSIX or GNU tar header
+func isTar(head []byte) bool {
+	return len(head) >= tarMagicOffset+5 && string(head[tarMagicOffset:tarMagicOffset+5]) == "ustar"
+}
+
+// hasArchiveExtension reports whether a file is named like a compressed file
+// or archive that can be scanned
+func hasArchiveExtension(filePath string) bool {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".gz", ".tar", ".zip":
+		return true
+	}
+	return false
+}
+
+// scanGzip decompresses a gzip stream and scans its content, reporting results
+// under the archive path joined with the name of the compressed file. A
+// compressed tar is scanned as a single archive, as "bundle.tar.gz!file".
+func (s *Scanner) scanGzip(r io.Reader, filePath string, depth int) ([]ScanResult, bool, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read gzip: %w", err)
+	}
+	defer zr.Close()
+
+	head, content, err := sniff(&sizeLimitReader{r: zr, limit: s.MaxDecompressedSize}, archiveSniffBytes)
+	if err != nil {
+		return nil, false, err
+	}
+	if isTar(head) {
+		return s.scanTar(content, filePath, depth)
+	}
+
+	// Prefer the original name stored in the header over the archive's name
+	name := path.Base(filepath.ToSlash(zr.Name))
+	if zr.Name == "" {
+		name = filepath.Base(filePath)
+		name = name[:len(name)-len(filepath.Ext(name))]
+	}
+
+	return s.scanStream(content, filePath+ArchiveSeparator+name, depth+1)
+}
+
+// scanTar scans each regular file in a tar archive
+func (s *Scanner) scanTar(r io.Reader, filePath string, depth int) ([]ScanResult, bool, error) {
+	budget := s.newArchiveBudget()
+	tr := tar.NewReader(r)
+
+	var results []ScanResult
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return results, false, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read tar: %w", err)
+		}
+
+		if err := budget.addEntry(); err != nil {
+			return nil, false, err
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		entryResults, err := s.scanEntry(budget.reader(tr), filePath, header.Name, depth)
+		if err != nil {
+			return nil, false, err
+		}
+		results = append(results, entryResults...)
+	}
+}
+
+// scanZip scans each regular file in a zip archive. Archives that aren't
+// read from a file are buffered in memory, up to MaxDecompressedSize.
+func (s *Scanner) scanZip(file io.Reader, content io.Reader, filePath string, depth int) ([]ScanResult, bool, error) {
+	var ra io.ReaderAt
+	var size int64
+
+	if f, ok := file.(interface {
+		io.ReaderAt
+		Stat() (fs.FileInfo, error)
+	}); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, false, err
+		}
+		ra, size = f, info.Size()
+	} else {
+		data, err := io.ReadAll(&sizeLimitReader{r: content, limit: s.MaxDecompressedSize})
+		if err != nil {
+			return nil, false, err
+		}
+		ra, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read zip: %w", err)
+	}
+
+	budget := s.newArchiveBudget()
+
+	var results []ScanResult
+	for _, entry := range zr.File {
+		if err := budget.addEntry(); err != nil {
+			return nil, false, err
+		}
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read zip entry %s: %w", entry.Name, err)
+		}
+		entryResults, err := s.scanEntry(budget.reader(rc), filePath, entry.Name, depth)
+		rc.Close()
+		if err != nil {
+			return nil, false, err
+		}
+		results = append(results, entryResults...)
+	}
+
+	return results, false, nil
+}
+
+// scanEntry scans an archive entry, skipping binary entries
+func (s *Scanner) scanEntry(r io.Reader, filePath, name string, depth int) ([]ScanResult, error) {
+	results, _, err := s.scanStream(r, filePath+ArchiveSeparator+path.Clean(name), depth+1)
+	return results, err
+}
+
+// archiveBudget enforces the entry and aggregate size limits of an archive
+type archiveBudget struct {
+	maxEntries int
+	maxEntry   int64 // Maximum decompressed size of each entry
+	maxTotal   int64 // Maximum decompressed size of all entries, or 0 for no limit
+	entries    int
+	total      int64
+}
+
+// newArchiveBudget returns the limits for scanning one archive
+func (s *Scanner) newArchiveBudget() *archiveBudget {
+	return &archiveBudget{
+		maxEntries: s.MaxArchiveEntries,
+		maxEntry:   s.MaxDecompressedSize,
+		maxTotal:   s.MaxArchiveSize,
+	}
+}
+
+// addEntry counts an entry, failing once there are more than maxEntries
+func (b *archiveBudget) addEntry() error {
+	b.entries++
+	if b.maxEntries > 0 && b.entries > b.maxEntries {
+		return fmt.Errorf("%w of %d", ErrArchiveEntryLimit, b.maxEntries)
+	}
+	return nil
+}
+
+// reader limits an entry to the per-entry size and the remaining total
+func (b *archiveBudget) reader(r io.Reader) io.Reader {
+	return &sizeLimitReader{r: r, limit: b.maxEntry, total: b}
+}
+
+// sizeLimitReader fails with ErrDecompressedSizeLimit once more than limit
+// bytes have been read, or once an archive's entries total more than its
+// limit, guarding against decompression bombs
+type sizeLimitReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+	total *archiveBudget // Archive the reader counts towards, if any
+}
+
+// Read implements io.Reader
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n, fmt.Errorf("%w of %s", ErrDecompressedSizeLimit, FormatBytes(l.limit))
+	}
+
+	if l.total != nil {
+		l.total.total += int64(n)
+		if l.total.maxTotal > 0 && l.total.total > l.total.maxTotal {
+			return n, fmt.Errorf("%w of %s for the archive", ErrDecompressedSizeLimit, FormatBytes(l.total.maxTotal))
+		}
+	}
+
+	return n, err
+}
+
+// archiveSniffBytes is the number of bytes at the start of a file read to
+// detect archives, enough for the tar signature at offset 257
+const archiveSniffBytes = 512
+
+// sniff reads the first size bytes of r for file type detection, returning
+// them and a reader of the whole content
+func sniff(r io.Reader, size int) ([]byte, io.Reader, error) {
+	head := make([]byte, size)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+
+	return head, io.MultiReader(bytes.NewReader(head), r), nil
+}
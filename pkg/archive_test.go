@@ -0,0 +1,249 @@
+package poltergeist
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// gzipContent compresses content, storing name in the gzip header if set
+func gzipContent(t *testing.T, name, content string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Name = name
+	if _, err := zw.Write([]byte(content)); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	return buf.String()
+}
+
+// zipContent builds a zip archive of the given entries
+func zipContent(t *testing.T, entries map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range slices.Sorted(maps.Keys(entries)) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		if _, err := w.Write([]byte(entries[name])); err != nil {
+			t.Fatalf("Failed to write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+	return buf.String()
+}
+
+// tarContent builds a tar archive of the given entries
+func tarContent(t *testing.T, entries map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range slices.Sorted(maps.Keys(entries)) {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(entries[name]))}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(entries[name])); err != nil {
+			t.Fatalf("Failed to write tar entry: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to write tar: %v", err)
+	}
+	return buf.String()
+}
+
+func TestScanGzip(t *testing.T) {
+	dir := t.TempDir()
+	content := "first line\nTOKEN=tok_aZ3kQ9xLm2Pw7vRt\n"
+	named := writeTestFile(t, dir, "logs/app.log.gz", gzipContent(t, "app-2024.log", content))
+	unnamed := writeTestFile(t, dir, "logs/env.txt.gz", gzipContent(t, "", content))
+	sniffed := writeTestFile(t, dir, "logs/rotated.log", gzipContent(t, "rotated.log", content))
+
+	scanner := newTestScanner(t, []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+	})
+
+	results, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	want := []string{
+		named + ArchiveSeparator + "app-2024.log",
+		unnamed + ArchiveSeparator + "env.txt",
+		sniffed + ArchiveSeparator + "rotated.log",
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %d results, got %d: %+v", len(want), len(results), results)
+	}
+	for i, path := range want {
+		if results[i].FilePath != path || results[i].LineNumber != 2 || results[i].Match != "tok_aZ3kQ9xLm2Pw7vRt" {
+			t.Errorf("Result %d = %s:%d %q, expected %s:2", i, results[i].FilePath, results[i].LineNumber, results[i].Match, path)
+		}
+	}
+}
+
+func TestScanGzipSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat("padding\n", 1000) + "TOKEN=tok_aZ3kQ9xLm2Pw7vRt\n"
+	path := writeTestFile(t, dir, "big.log.gz", gzipContent(t, "big.log", content))
+
+	scanner := newTestScanner(t, []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+	})
+
+	// Content over the limit is an error rather than partially scanned
+	scanner.MaxDecompressedSize = 1024
+	report, err := scanner.ScanDirectoryReport(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("ScanDirectoryReport failed: %v", err)
+	}
+	if len(report.Results) != 0 {
+		t.Errorf("Expected no results over the limit, got %+v", report.Results)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Path != path || !errors.Is(report.Errors[0], ErrDecompressedSizeLimit) {
+		t.Errorf("Expected a size limit error for %s, got %v", path, report.Errors)
+	}
+
+	// Content within the limit is scanned
+	scanner.MaxDecompressedSize = int64(len(content))
+	results, err := scanner.ScanFile(path)
+	if err != nil {
+		t.Fatalf("ScanFile failed: %v", err)
+	}
+	if len(results) != 1 || results[0].FilePath != path+ArchiveSeparator+"big.log" {
+		t.Errorf("Expected 1 result within the limit, got %+v", results)
+	}
+
+	// Gzip files are skipped as binary when decompression is disabled
+	scanner.MaxDecompressedSize = 0
+	scanner.ResetMetrics()
+	results, err = scanner.ScanDirectory(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if len(results) != 0 || scanner.MetricsSnapshot().FilesSkipped != 1 {
+		t.Errorf("Expected the gzip file to be skipped, got %d results and metrics %+v", len(results), scanner.MetricsSnapshot())
+	}
+}
+
+func TestScanArchives(t *testing.T) {
+	entries := map[string]string{
+		"README.md":                    "Nothing to see here\n",
+		"internal/config/app.env":      "# config\nTOKEN=tok_aZ3kQ9xLm2Pw7vRt\n",
+		"internal/assets/logo.bin":     "\x00\x01tok_bB8nM4cV1xZ6qW0e",
+		"internal/nested/inner.zip":    zipContent(t, map[string]string{"deep/key.txt": "tok_cC7mN3bV2xZ5qW9r\n"}),
+		"internal/logs/rotated.log.gz": gzipContent(t, "rotated.log", "tok_dD6lK2jH1gF4dS8a\n"),
+	}
+
+	dir := t.TempDir()
+	zipPath := writeTestFile(t, dir, "bundle.zip", zipContent(t, entries))
+	tarPath := writeTestFile(t, dir, "bundle.tar.gz", gzipContent(t, "bundle.tar", tarContent(t, entries)))
+
+	scanner := newTestScanner(t, []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+	})
+
+	results, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	var want []string
+	for _, archive := range []string{tarPath, zipPath} {
+		want = append(want,
+			archive+"!internal/config/app.env:2",
+			archive+"!internal/logs/rotated.log.gz!rotated.log:1",
+			archive+"!internal/nested/inner.zip!deep/key.txt:1",
+		)
+	}
+
+	var got []string
+	for _, result := range results {
+		got = append(got, fmt.Sprintf("%s:%d", result.FilePath, result.LineNumber))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Got results:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestScanArchiveLimits(t *testing.T) {
+	entries := map[string]string{
+		"a.txt": strings.Repeat("a", 600) + "\n",
+		"b.txt": strings.Repeat("b", 600) + "\n",
+		"c.txt": "tok_aZ3kQ9xLm2Pw7vRt\n",
+	}
+
+	tests := []struct {
+		name       string
+		maxSize    int64
+		maxEntries int
+		wantErr    error
+	}{
+		{name: "within limits", maxSize: 2048, maxEntries: 3},
+		{name: "too many entries", maxSize: 2048, maxEntries: 2, wantErr: ErrArchiveEntryLimit},
+		{name: "too large in total", maxSize: 1024, maxEntries: 3, wantErr: ErrDecompressedSizeLimit},
+		{name: "no limits", maxSize: 0, maxEntries: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, archive := range []string{"bundle.zip", "bundle.tar"} {
+				content := zipContent(t, entries)
+				if archive == "bundle.tar" {
+					content = tarContent(t, entries)
+				}
+				writeTestFile(t, dir, archive, content)
+			}
+
+			scanner := newTestScanner(t, []Rule{
+				{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+			})
+			scanner.MaxArchiveSize = tt.maxSize
+			scanner.MaxArchiveEntries = tt.maxEntries
+
+			report, err := scanner.ScanDirectoryReport(context.Background(), dir)
+			if err != nil {
+				t.Fatalf("ScanDirectoryReport failed: %v", err)
+			}
+
+			if tt.wantErr == nil {
+				if len(report.Results) != 2 || len(report.Errors) != 0 {
+					t.Errorf("Expected a result from each archive, got %d results and errors %v", len(report.Results), report.Errors)
+				}
+				return
+			}
+
+			if len(report.Results) != 0 || len(report.Errors) != 2 {
+				t.Fatalf("Expected both archives to fail, got %d results and errors %v", len(report.Results), report.Errors)
+			}
+			for _, scanErr := range report.Errors {
+				if !errors.Is(scanErr, tt.wantErr) {
+					t.Errorf("%s: expected %v, got %v", scanErr.Path, tt.wantErr, scanErr.Err)
+				}
+			}
+		})
+	}
+}
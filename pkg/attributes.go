@@ -0,0 +1,166 @@
+package poltergeist
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// gitAttributesFile is the name of the per-directory git attributes file
+const gitAttributesFile = ".gitattributes"
+
+// textAttribute is how git attributes classify a file's content
+type textAttribute int
+
+const (
+	textUnspecified textAttribute = iota // Left to the scanner's binary checks
+	textSet                              // "text": scanned as text whatever its extension or content
+	textUnset                            // "binary" or "-text": skipped as binary without being read
+)
+
+// attributePattern is a single parsed line of a .gitattributes file that sets
+// or clears the text attribute
+type attributePattern struct {
+	segments []string // Slash-separated glob segments, as in ignorePattern
+	text     textAttribute
+}
+
+// attributesFile holds the patterns of one .gitattributes file along with the
+// directory they are relative to
+type attributesFile struct {
+	dir      string // Directory containing the file, as a name within the scanned fs.FS
+	patterns []attributePattern
+}
+
+// attributesMatcher classifies names within a walked fs.FS from the
+// .gitattributes files found along their path. Like ignoreMatcher, it is safe
+// for concurrent use provided each directory is entered before its contents
+// are checked.
+type attributesMatcher struct {
+	fsys  fs.FS
+	mu    sync.RWMutex               // Guards files
+	files map[string]*attributesFile // .gitattributes files keyed by directory
+}
+
+// newAttributesMatcher creates a matcher for a walk of fsys
+func newAttributesMatcher(fsys fs.FS) *attributesMatcher {
+	return &attributesMatcher{
+		fsys:  fsys,
+		files: make(map[string]*attributesFile),
+	}
+}
+
+// enterDir loads the .gitattributes of a directory about to be walked
+func (m *attributesMatcher) enterDir(dir string) {
+	data, err := fs.ReadFile(m.fsys, path.Join(dir, gitAttributesFile))
+	if err != nil {
+		return
+	}
+
+	if patterns := parseGitAttributes(string(data)); len(patterns) > 0 {
+		m.mu.Lock()
+		m.files[dir] = &attributesFile{dir: dir, patterns: patterns}
+		m.mu.Unlock()
+	}
+}
+
+// text returns the text attribute of a file. Attributes files are consulted
+// from the shallowest directory to the deepest, and the last matching pattern
+// wins.
+func (m *attributesMatcher) text(name string) textAttribute {
+	text := textUnspecified
+
+	// Collect ancestor directories from the walk root down to the parent
+	var dirs []string
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == "." || dir == "/" {
+			break
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if file, ok := m.files[dirs[i]]; ok {
+			text = file.match(name, text)
+		}
+	}
+
+	return text
+}
+
+// match applies the file's patterns to name, returning the updated attribute
+func (f *attributesFile) match(name string, text textAttribute) textAttribute {
+	rel := name
+	if f.dir != "." {
+		if !strings.HasPrefix(name, f.dir+"/") {
+			return text
+		}
+		rel = strings.TrimPrefix(name, f.dir+"/")
+	}
+
+	segments := strings.Split(rel, "/")
+	for _, pattern := range f.patterns {
+		if matchIgnoreSegments(pattern.segments, segments) {
+			text = pattern.text
+		}
+	}
+
+	return text
+}
+
+// parseGitAttributes parses .gitattributes content, keeping the lines that
+// affect the text attribute. "binary" and "-text" unset it, "text" sets it,
+// and "!text" and "text=auto" leave it to the scanner. Patterns match like
+// gitignore patterns, except that negative patterns and patterns ending in
+// '/' match nothing, as in git.
+func parseGitAttributes(content string) []attributePattern {
+	var patterns []attributePattern
+
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		pattern, attrs := fields[0], fields[1:]
+		if strings.HasPrefix(pattern, "!") || strings.HasSuffix(pattern, "/") {
+			continue
+		}
+
+		// The last attribute on the line wins
+		text, found := textUnspecified, false
+		for _, attr := range attrs {
+			switch {
+			case attr == "binary" || attr == "-text":
+				text, found = textUnset, true
+			case attr == "text":
+				text, found = textSet, true
+			case attr == "!text" || strings.HasPrefix(attr, "text="):
+				text, found = textUnspecified, true
+			}
+		}
+		if !found {
+			continue
+		}
+
+		// A slash at the start or in the middle anchors the pattern to the
+		// directory of the attributes file
+		anchored := strings.Contains(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+		if pattern == "" {
+			continue
+		}
+
+		segments := strings.Split(pattern, "/")
+		if !anchored {
+			segments = append([]string{"**"}, segments...)
+		}
+
+		patterns = append(patterns, attributePattern{segments: segments, text: text})
+	}
+
+	return patterns
+}
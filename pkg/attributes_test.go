@@ -0,0 +1,108 @@
+package poltergeist
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestGitAttributesPatterns(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes string
+		path       string
+		text       textAttribute
+	}{
+		{name: "binary macro", attributes: "*.pdf binary", path: "docs/manual.pdf", text: textUnset},
+		{name: "unset text", attributes: "*.dat -text", path: "a/b/dump.dat", text: textUnset},
+		{name: "set text", attributes: "*.bin text", path: "firmware.bin", text: textSet},
+		{name: "auto text", attributes: "*.dat binary\n*.dat text=auto", path: "dump.dat", text: textUnspecified},
+		{name: "unspecified text", attributes: "*.dat binary\ndump.dat !text", path: "dump.dat", text: textUnspecified},
+		{name: "last attribute on line wins", attributes: "*.dat text -text", path: "dump.dat", text: textUnset},
+		{name: "later line wins", attributes: "*.dat binary\nkeep.dat text", path: "keep.dat", text: textSet},
+		{name: "other attributes only", attributes: "*.go diff=golang eol=lf", path: "main.go", text: textUnspecified},
+		{name: "no match", attributes: "*.pdf binary", path: "manual.txt", text: textUnspecified},
+		{name: "anchored", attributes: "/vendor/*.dat binary", path: "src/vendor/dump.dat", text: textUnspecified},
+		{name: "double star", attributes: "assets/** binary", path: "assets/img/logo.svg", text: textUnset},
+		{name: "negative pattern ignored", attributes: "!*.dat binary", path: "dump.dat", text: textUnspecified},
+		{name: "directory pattern ignored", attributes: "assets/ binary", path: "assets/logo.svg", text: textUnspecified},
+		{name: "comment", attributes: "# *.dat binary", path: "dump.dat", text: textUnspecified},
+		{name: "crlf line endings", attributes: "*.dat binary\r\n", path: "dump.dat", text: textUnset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &attributesFile{dir: ".", patterns: parseGitAttributes(tt.attributes)}
+			if got := file.match(tt.path, textUnspecified); got != tt.text {
+				t.Errorf("attributes %q on %q = %v, expected %v", tt.attributes, tt.path, got, tt.text)
+			}
+		})
+	}
+}
+
+func TestScanRespectsGitAttributes(t *testing.T) {
+	secret := []byte("TOKEN=tok_abcd1234\n")
+	fsys := fstest.MapFS{
+		".gitattributes":        {Data: []byte("*.dat binary\n*.bin text\nlegacy/** -text\n")},
+		"app.txt":               {Data: secret},
+		"dump.dat":              {Data: secret},
+		"firmware.bin":          {Data: append([]byte("\x00\x01"), secret...)},
+		"legacy/.gitattributes": {Data: []byte("keep.txt !text\n")},
+		"legacy/old.txt":        {Data: secret},
+		"legacy/keep.txt":       {Data: secret},
+		"docs/.gitattributes":   {Data: []byte("*.dat text\n")},
+		"docs/notes.dat":        {Data: secret},
+	}
+
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	}
+
+	scanner := newTestScanner(t, rules)
+	results, err := scanner.ScanFS(fsys, ".")
+	if err != nil {
+		t.Fatalf("ScanFS failed: %v", err)
+	}
+
+	expected := map[string]bool{
+		"app.txt":         true,
+		"firmware.bin":    true,
+		"legacy/keep.txt": true,
+		"docs/notes.dat":  true,
+	}
+	if len(results) != len(expected) {
+		t.Errorf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for _, result := range results {
+		if !expected[result.FilePath] {
+			t.Errorf("Unexpected result from %s", result.FilePath)
+		}
+	}
+
+	// dump.dat, legacy/old.txt, and legacy/.gitattributes are skipped as binary
+	if scanner.Metrics.FilesSkipped != 3 {
+		t.Errorf("Expected 3 files skipped, got %d", scanner.Metrics.FilesSkipped)
+	}
+	if scanner.Metrics.FilesScanned != 6 {
+		t.Errorf("Expected 6 files scanned, got %d", scanner.Metrics.FilesScanned)
+	}
+
+	// Without attributes, text files are scanned and binary content is skipped
+	scanner = newTestScanner(t, rules)
+	scanner.RespectGitAttributes = false
+	results, err = scanner.ScanFS(fsys, ".")
+	if err != nil {
+		t.Fatalf("ScanFS failed: %v", err)
+	}
+	if len(results) != 5 {
+		t.Errorf("Expected 5 results with attributes disabled, got %d", len(results))
+	}
+	for _, result := range results {
+		if result.FilePath == "firmware.bin" {
+			t.Errorf("Expected firmware.bin to be skipped as binary with attributes disabled")
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package poltergeist
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// base64SkipChars is the number of leading characters that depend on the
+// bytes before s when s starts at each offset within a 3-byte group
+var base64SkipChars = [3]int{0, 2, 3}
+
+// GenerateBase64Patterns returns the base64 fragments that appear in any
+// base64 encoding of content containing s, for finding a known value inside
+// encoded data such as a JWT without decoding it. Since base64 encodes 3
+// bytes at a time, s encodes differently at each of the 3 offsets it may
+// start at, and the characters that also depend on the surrounding bytes
+// (including padding) are trimmed. Fragments are given in both the standard
+// and URL-safe alphabets, without duplicates.
+func GenerateBase64Patterns(s string) []string {
+	var patterns []string
+	seen := make(map[string]bool)
+
+	for offset := range 3 {
+		data := make([]byte, offset, offset+len(s))
+		data = append(data, s...)
+
+		for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding} {
+			encoded := strings.TrimRight(encoding.EncodeToString(data), "=")
+			if len(data)%3 != 0 {
+				// The last character also encodes the bytes after s
+				encoded = encoded[:len(encoded)-1]
+			}
+			if len(encoded) <= base64SkipChars[offset] {
+				continue
+			}
+
+			pattern := encoded[base64SkipChars[offset]:]
+			if !seen[pattern] {
+				seen[pattern] = true
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+
+	return patterns
+}
+
+// FindBase64PatternsInToken reports whether the base64 encoded token contains
+// search, at any offset and in either alphabet, returning the fragment of the
+// token that encodes it
+func FindBase64PatternsInToken(token, search string) (bool, string) {
+	for _, pattern := range GenerateBase64Patterns(search) {
+		if strings.Contains(token, pattern) {
+			return true, pattern
+		}
+	}
+	return false, ""
+}
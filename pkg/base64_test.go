@@ -0,0 +1,73 @@
+package poltergeist
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestGenerateBase64Patterns(t *testing.T) {
+	patterns := GenerateBase64Patterns("secret")
+
+	// "secret" is 6 bytes, so at offset 0 it encodes exactly with no padding
+	want := map[string]bool{
+		"c2VjcmV0": true, // Offset 0
+		"NlY3Jld":  true, // Offset 1, "AHNlY3JldA==" trimmed of the characters shared with other bytes
+		"zZWNyZX":  true, // Offset 2, "AABzZWNyZXQ=" trimmed likewise
+	}
+	for _, pattern := range patterns {
+		delete(want, pattern)
+	}
+	if len(want) != 0 {
+		t.Errorf("GenerateBase64Patterns(\"secret\") = %v, missing %v", patterns, want)
+	}
+
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "=") {
+			t.Errorf("Pattern %q contains padding", pattern)
+		}
+		if seen[pattern] {
+			t.Errorf("Duplicate pattern %q", pattern)
+		}
+		seen[pattern] = true
+	}
+
+	// Alphabets only differ for values that encode to + or /
+	if urlSafe := GenerateBase64Patterns("\xfb\xff\xbf>>>"); !strings.Contains(strings.Join(urlSafe, " "), "-") {
+		t.Errorf("Expected URL-safe patterns, got %v", urlSafe)
+	}
+}
+
+func TestFindBase64PatternsInToken(t *testing.T) {
+	search := "tok_aZ3kQ9xLm2Pw7vRt"
+
+	tests := []struct {
+		name  string
+		token string
+		found bool
+	}{
+		{name: "full string", token: base64.StdEncoding.EncodeToString([]byte(search)), found: true},
+		{name: "offset 0", token: base64.RawURLEncoding.EncodeToString([]byte(`{"k":"` + search + `"}`)), found: true},
+		{name: "offset 1", token: base64.RawURLEncoding.EncodeToString([]byte(`{"ke":"` + search + `"}`)), found: true},
+		{name: "offset 2", token: base64.RawURLEncoding.EncodeToString([]byte(`{"key":"` + search + `"}`)), found: true},
+		{name: "padded end", token: base64.StdEncoding.EncodeToString([]byte("x" + search)), found: true},
+		{name: "other value", token: base64.StdEncoding.EncodeToString([]byte("tok_bB8nM4cV1xZ6qW0e")), found: false},
+		{name: "not encoded", token: search, found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, pattern := FindBase64PatternsInToken(tt.token, search)
+			if found != tt.found {
+				t.Fatalf("FindBase64PatternsInToken(%q) = %v, expected %v", tt.token, found, tt.found)
+			}
+			if found && !strings.Contains(tt.token, pattern) {
+				t.Errorf("Returned pattern %q is not in the token", pattern)
+			}
+			if !found && pattern != "" {
+				t.Errorf("Expected no pattern, got %q", pattern)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package poltergeist
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// baselineVersion is the version of the baseline file format
+const baselineVersion = 1
+
+// Baseline is a set of accepted findings, identified by fingerprint
+type Baseline struct {
+	Version  int             `json:"version"`
+	Findings []BaselineEntry `json:"findings"`
+}
+
+// BaselineEntry is a single accepted finding. The rule ID and file path are
+// recorded to make baseline files reviewable; only the fingerprint is used
+// for matching. The secret itself is never stored.
+type BaselineEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	RuleID      string `json:"rule_id"`
+	FilePath    string `json:"file_path"`
+}
+
+// GenerateBaseline serializes the fingerprints of results as a baseline.
+// Duplicate findings are collapsed and entries are sorted so the output is
+// stable across runs.
+func GenerateBaseline(results []ScanResult) ([]byte, error) {
+	seen := make(map[string]bool, len(results))
+	baseline := Baseline{
+		Version:  baselineVersion,
+		Findings: make([]BaselineEntry, 0, len(results)),
+	}
+
+	for _, result := range results {
+		fp := result.Fingerprint()
+		if seen[fp] {
+			continue
+		}
+		seen[fp] = true
+
+		baseline.Findings = append(baseline.Findings, BaselineEntry{
+			Fingerprint: fp,
+			RuleID:      result.RuleID,
+			FilePath:    result.URIPath(),
+		})
+	}
+
+	sort.Slice(baseline.Findings, func(i, j int) bool {
+		a, b := baseline.Findings[i], baseline.Findings[j]
+		if a.FilePath != b.FilePath {
+			return a.FilePath < b.FilePath
+		}
+		if a.RuleID != b.RuleID {
+			return a.RuleID < b.RuleID
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode baseline: %w", err)
+	}
+
+	return append(data, '\n'), nil
+}
+
+// ParseBaseline parses a baseline produced by GenerateBaseline
+func ParseBaseline(data []byte) (*Baseline, error) {
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline: %w", err)
+	}
+
+	if baseline.Version != baselineVersion {
+		return nil, fmt.Errorf("unsupported baseline version %d", baseline.Version)
+	}
+
+	return &baseline, nil
+}
+
+// FilterAgainstBaseline returns the results whose fingerprints are not in the
+// baseline. If the baseline can't be parsed, results are returned unfiltered;
+// use ParseBaseline to validate a baseline first.
+func FilterAgainstBaseline(results []ScanResult, baseline []byte) []ScanResult {
+	parsed, err := ParseBaseline(baseline)
+	if err != nil {
+		return results
+	}
+
+	accepted := make(map[string]bool, len(parsed.Findings))
+	for _, entry := range parsed.Findings {
+		accepted[entry.Fingerprint] = true
+	}
+
+	var filtered []ScanResult
+	for _, result := range results {
+		if !accepted[result.Fingerprint()] {
+			filtered = append(filtered, result)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,120 @@
+package poltergeist
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBaseline(t *testing.T) {
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-zA-Z0-9]{16}`,
+		},
+	}
+
+	original := "A=tok_aZ3kQ9xLm2Pw7vRt\nB=tok_bB8nM4cV1xZ6qW0e\nC=tok_aZ3kQ9xLm2Pw7vRt\n"
+	results, err := newTestScanner(t, rules).ScanReader(strings.NewReader(original), "config/app.env")
+	if err != nil {
+		t.Fatalf("ScanReader failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	t.Run("generate", func(t *testing.T) {
+		data, err := GenerateBaseline(results)
+		if err != nil {
+			t.Fatalf("GenerateBaseline failed: %v", err)
+		}
+
+		if strings.Contains(string(data), "tok_aZ3kQ9xLm2Pw7vRt") {
+			t.Error("Baseline must not contain the raw secret")
+		}
+
+		var baseline Baseline
+		if err := json.Unmarshal(data, &baseline); err != nil {
+			t.Fatalf("Baseline is not valid JSON: %v", err)
+		}
+
+		// The repeated secret collapses into a single entry
+		if len(baseline.Findings) != 2 {
+			t.Errorf("Expected 2 baseline entries, got %d", len(baseline.Findings))
+		}
+		for _, entry := range baseline.Findings {
+			if entry.RuleID != "test.token" || entry.FilePath != "config/app.env" || len(entry.Fingerprint) != 64 {
+				t.Errorf("Unexpected baseline entry: %+v", entry)
+			}
+		}
+
+		again, err := GenerateBaseline([]ScanResult{results[2], results[1], results[0]})
+		if err != nil {
+			t.Fatalf("GenerateBaseline failed: %v", err)
+		}
+		if string(again) != string(data) {
+			t.Error("Expected baseline output to be independent of result order")
+		}
+	})
+
+	t.Run("suppress", func(t *testing.T) {
+		data, err := GenerateBaseline(results)
+		if err != nil {
+			t.Fatalf("GenerateBaseline failed: %v", err)
+		}
+
+		// Moving the secrets to different lines doesn't defeat the baseline
+		moved := "# header\n\nB=tok_bB8nM4cV1xZ6qW0e\nA=tok_aZ3kQ9xLm2Pw7vRt\n"
+		movedResults, err := newTestScanner(t, rules).ScanReader(strings.NewReader(moved), "config/app.env")
+		if err != nil {
+			t.Fatalf("ScanReader failed: %v", err)
+		}
+
+		if filtered := FilterAgainstBaseline(movedResults, data); len(filtered) != 0 {
+			t.Errorf("Expected all findings to be suppressed, got %d", len(filtered))
+		}
+	})
+
+	t.Run("new finding survives", func(t *testing.T) {
+		data, err := GenerateBaseline(results)
+		if err != nil {
+			t.Fatalf("GenerateBaseline failed: %v", err)
+		}
+
+		updated := original + "D=tok_nEwS3cr3tV4lu3Xy\n"
+		updatedResults, err := newTestScanner(t, rules).ScanReader(strings.NewReader(updated), "config/app.env")
+		if err != nil {
+			t.Fatalf("ScanReader failed: %v", err)
+		}
+
+		// The same secret in a different file is also a new finding
+		otherFile, err := newTestScanner(t, rules).ScanReader(strings.NewReader("A=tok_aZ3kQ9xLm2Pw7vRt\n"), "config/other.env")
+		if err != nil {
+			t.Fatalf("ScanReader failed: %v", err)
+		}
+
+		filtered := FilterAgainstBaseline(append(updatedResults, otherFile...), data)
+		if len(filtered) != 2 {
+			t.Fatalf("Expected 2 new findings, got %d", len(filtered))
+		}
+		if filtered[0].Match != "tok_nEwS3cr3tV4lu3Xy" || filtered[0].LineNumber != 4 {
+			t.Errorf("Expected new secret on line 4 to survive, got %q on line %d", filtered[0].Match, filtered[0].LineNumber)
+		}
+		if filtered[1].FilePath != "config/other.env" {
+			t.Errorf("Expected finding in another file to survive, got %s", filtered[1].FilePath)
+		}
+	})
+
+	t.Run("invalid baseline", func(t *testing.T) {
+		if _, err := ParseBaseline([]byte("not json")); err == nil {
+			t.Error("Expected an error for an invalid baseline")
+		}
+		if _, err := ParseBaseline([]byte(`{"version": 99, "findings": []}`)); err == nil {
+			t.Error("Expected an error for an unsupported baseline version")
+		}
+		if filtered := FilterAgainstBaseline(results, []byte("not json")); len(filtered) != len(results) {
+			t.Errorf("Expected an invalid baseline to suppress nothing, got %d of %d results", len(filtered), len(results))
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package poltergeist
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uncommittedCommit is the commit git blame reports for lines that haven't
+// been committed yet
+const uncommittedCommit = "0000000000000000000000000000000000000000"
+
+// blameLine is who last changed a line, according to git blame
+type blameLine struct {
+	author    string
+	commit    string
+	timestamp time.Time
+}
+
+// blameResults sets GitAuthor, GitCommit, and GitTimestamp on results in git
+// working trees, running git blame once per file. Files outside a repository,
+// uncommitted lines, and git failures leave the fields unset.
+func (s *Scanner) blameResults(ctx context.Context, results []ScanResult) {
+	if len(results) == 0 {
+		return
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		if s.Logger != nil {
+			s.Logger.Debug("skipped git blame", "reason", "git not found")
+		}
+		return
+	}
+
+	files := make(map[string][]int)
+	var order []string
+	for i, result := range results {
+		if _, ok := files[result.FilePath]; !ok {
+			order = append(order, result.FilePath)
+		}
+		files[result.FilePath] = append(files[result.FilePath], i)
+	}
+
+	for _, path := range order {
+		if ctx.Err() != nil {
+			return
+		}
+
+		var lines []int
+		for _, i := range files[path] {
+			lines = append(lines, results[i].LineNumber)
+		}
+
+		blamed, err := gitBlame(ctx, path, lines)
+		if err != nil {
+			if s.Logger != nil {
+				s.Logger.Debug("skipped git blame", "path", path, "error", err)
+			}
+			continue
+		}
+
+		for _, i := range files[path] {
+			if line, ok := blamed[results[i].LineNumber]; ok {
+				results[i].GitAuthor = line.author
+				results[i].GitCommit = line.commit
+				results[i].GitTimestamp = line.timestamp
+			}
+		}
+	}
+}
+
+// gitBlame runs git blame on the given lines of a file, returning who last
+// changed each committed line
+func gitBlame(ctx context.Context, path string, lines []int) (map[int]blameLine, error) {
+	args := []string{"-C", filepath.Dir(path), "blame", "--porcelain"}
+	seen := make(map[int]bool)
+	for _, line := range lines {
+		if line < 1 || seen[line] {
+			continue
+		}
+		seen[line] = true
+		args = append(args, "-L", fmt.Sprintf("%d,%d", line, line))
+	}
+	args = append(args, "--", filepath.Base(path))
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git blame failed: %s", msg)
+		}
+		return nil, fmt.Errorf("git blame failed: %w", err)
+	}
+
+	return parseBlamePorcelain(out), nil
+}
+
+// parseBlamePorcelain parses git blame --porcelain output into who last
+// changed each line, by final line number. Commit details are only given the
+// first time a commit appears. Uncommitted lines are left out.
+func parseBlamePorcelain(out []byte) map[int]blameLine {
+	type commitInfo struct {
+		author string
+		time   int64
+		tz     *time.Location
+	}
+	commits := make(map[string]*commitInfo)
+	lineCommits := make(map[int]string)
+
+	var current *commitInfo
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Each group starts with "<commit> <original line> <final line> [<lines>]"
+		// and ends with the line's content, prefixed with a tab
+		if strings.HasPrefix(line, "\t") {
+			current = nil
+			continue
+		}
+		if current == nil {
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				continue
+			}
+			final, err := strconv.Atoi(fields[2])
+			if err != nil {
+				continue
+			}
+			commit := fields[0]
+			if commits[commit] == nil {
+				commits[commit] = &commitInfo{tz: time.UTC}
+			}
+			current = commits[commit]
+			lineCommits[final] = commit
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			current.author = value
+		case "author-time":
+			current.time, _ = strconv.ParseInt(value, 10, 64)
+		case "author-tz":
+			current.tz = parseBlameTZ(value)
+		}
+	}
+
+	blamed := make(map[int]blameLine, len(lineCommits))
+	for final, commit := range lineCommits {
+		if commit == uncommittedCommit {
+			continue
+		}
+		info := commits[commit]
+		blamed[final] = blameLine{
+			author:    info.author,
+			commit:    commit,
+			timestamp: time.Unix(info.time, 0).In(info.tz),
+		}
+	}
+	return blamed
+}
+
+// parseBlameTZ parses a git time zone offset such as +0200 or -0530
+func parseBlameTZ(tz string) *time.Location {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return time.UTC
+	}
+	hours, err1 := strconv.Atoi(tz[1:3])
+	minutes, err2 := strconv.Atoi(tz[3:5])
+	if err1 != nil || err2 != nil {
+		return time.UTC
+	}
+
+	offset := hours*3600 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone(tz, offset)
+}
@@ -0,0 +1,145 @@
+package poltergeist
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// initTestRepo creates a git repository in a temporary directory, skipping
+// the test if git isn't installed
+func initTestRepo(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	return dir
+}
+
+// runGit runs git in dir as a fixed test author, isolated from the user's
+// git config, and returns its trimmed output
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL="+os.DevNull,
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=Test Author",
+		"GIT_AUTHOR_EMAIL=author@example.com",
+		"GIT_AUTHOR_DATE=2024-03-01T12:00:00+02:00",
+		"GIT_COMMITTER_NAME=Test Committer",
+		"GIT_COMMITTER_EMAIL=committer@example.com",
+		"GIT_COMMITTER_DATE=2024-03-01T12:00:00+02:00",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestScannerGitBlame(t *testing.T) {
+	repo := initTestRepo(t)
+	writeTestFile(t, repo, filepath.Join("config", "app.env"), "APP_NAME=demo\nTOKEN=tok_committed\n")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "Add config")
+	commit := runGit(t, repo, "rev-parse", "HEAD")
+
+	// A line added since the commit isn't blamed on anyone
+	writeTestFile(t, repo, filepath.Join("config", "app.env"), "APP_NAME=demo\nTOKEN=tok_committed\nOTHER=tok_uncommitted\n")
+
+	// Nor are files outside a repository
+	outside := t.TempDir()
+	writeTestFile(t, outside, "app.env", "TOKEN=tok_outside1\n")
+
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8,}`,
+		},
+	}
+
+	scanner := newTestScanner(t, rules)
+	scanner.GitBlame = true
+	results, err := scanner.ScanDirectory(repo)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	committed, uncommitted := results[0], results[1]
+	if committed.LineNumber != 2 || committed.GitAuthor != "Test Author" || committed.GitCommit != commit {
+		t.Errorf("Expected line 2 to be blamed on Test Author in %s, got %q in %q", commit, committed.GitAuthor, committed.GitCommit)
+	}
+	if want := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC); !committed.GitTimestamp.Equal(want) {
+		t.Errorf("Expected timestamp %v, got %v", want, committed.GitTimestamp)
+	}
+	if _, offset := committed.GitTimestamp.Zone(); offset != 2*3600 {
+		t.Errorf("Expected the author's +02:00 offset, got %v", committed.GitTimestamp)
+	}
+	if uncommitted.GitAuthor != "" || uncommitted.GitCommit != "" || !uncommitted.GitTimestamp.IsZero() {
+		t.Errorf("Expected no blame for an uncommitted line, got %+v", uncommitted)
+	}
+
+	results, err = scanner.ScanFile(filepath.Join(outside, "app.env"))
+	if err != nil {
+		t.Fatalf("ScanFile failed: %v", err)
+	}
+	if len(results) != 1 || results[0].GitAuthor != "" || results[0].GitCommit != "" {
+		t.Errorf("Expected a result without blame outside a repository, got %+v", results)
+	}
+
+	// Blame is opt-in
+	results, err = newTestScanner(t, rules).ScanDirectory(repo)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if len(results) == 0 || results[0].GitAuthor != "" {
+		t.Errorf("Expected no blame without Scanner.GitBlame, got %+v", results)
+	}
+}
+
+func TestParseBlamePorcelain(t *testing.T) {
+	out := "1111111111111111111111111111111111111111 3 3 1\n" +
+		"author Jane Doe\n" +
+		"author-mail <jane@example.com>\n" +
+		"author-time 1700000000\n" +
+		"author-tz -0530\n" +
+		"summary Add keys\n" +
+		"filename keys.txt\n" +
+		"\tKEY=tok_abcdefgh\n" +
+		"1111111111111111111111111111111111111111 9 7\n" +
+		"\tOTHER=tok_ijklmnop\n" +
+		uncommittedCommit + " 8 8 1\n" +
+		"author Not Committed Yet\n" +
+		"author-time 1700000100\n" +
+		"author-tz +0000\n" +
+		"filename keys.txt\n" +
+		"\tNEW=tok_qrstuvwx\n"
+
+	blamed := parseBlamePorcelain([]byte(out))
+	if len(blamed) != 2 {
+		t.Fatalf("Expected 2 blamed lines, got %d: %+v", len(blamed), blamed)
+	}
+	for _, line := range []int{3, 7} {
+		got := blamed[line]
+		if got.author != "Jane Doe" || got.commit != strings.Repeat("1", 40) || got.timestamp.Unix() != 1700000000 {
+			t.Errorf("Unexpected blame for line %d: %+v", line, got)
+		}
+		if _, offset := got.timestamp.Zone(); offset != -(5*3600 + 30*60) {
+			t.Errorf("Expected a -05:30 offset for line %d, got %v", line, got.timestamp)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package poltergeist
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is the name of the config file loaded from the root of a scanned
+// directory
+const ConfigFile = ".poltergeist.yaml"
+
+// Config holds scan settings read from a config file, so a scan can be
+// repeated without passing the same flags. Zero values leave the setting to
+// the command line or its default.
+type Config struct {
+	Workers          int      `yaml:"workers"`           // Number of files scanned in parallel
+	MaxFileSize      string   `yaml:"max_file_size"`     // Size limit in bytes or with a KB, MB, or GB suffix
+	Engine           string   `yaml:"engine"`            // Pattern engine: auto, go, or hyperscan
+	Tags             []string `yaml:"tags"`              // Only run rules with at least one of these tags
+	ExcludeTags      []string `yaml:"exclude_tags"`      // Skip rules with any of these tags
+	SkipDirs         []string `yaml:"skip_dirs"`         // Replaces DefaultSkipDirs
+	EntropyThreshold float64  `yaml:"entropy_threshold"` // Replaces every rule's minimum entropy
+	Format           string   `yaml:"format"`            // Output format
+	Include          []string `yaml:"include"`           // Globs of the only paths to scan, see Scanner.IncludeGlobs
+	Exclude          []string `yaml:"exclude"`           // Globs of paths not to scan, see Scanner.ExcludeGlobs
+}
+
+// LoadConfig reads and validates a YAML config file. Unknown keys are an
+// error, so misspelled settings aren't silently ignored.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if err := config.validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// validate checks the config's settings
+func (c Config) validate() error {
+	var errs []error
+
+	if c.Workers < 0 {
+		errs = append(errs, fmt.Errorf("workers must not be negative, got %d", c.Workers))
+	}
+	if c.MaxFileSize != "" {
+		if _, err := ParseSize(c.MaxFileSize); err != nil {
+			errs = append(errs, fmt.Errorf("max_file_size: %w", err))
+		}
+	}
+	switch c.Engine {
+	case "", "auto", "go", "hyperscan":
+	default:
+		errs = append(errs, fmt.Errorf("unknown engine %q (use auto, go, or hyperscan)", c.Engine))
+	}
+	if c.EntropyThreshold < 0 {
+		errs = append(errs, fmt.Errorf("entropy_threshold must not be negative, got %g", c.EntropyThreshold))
+	}
+	for _, pattern := range slices.Concat(c.SkipDirs, c.Include, c.Exclude) {
+		if !ValidGlob(pattern) {
+			errs = append(errs, fmt.Errorf("invalid glob %q", pattern))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// sizeUnits are the size suffixes accepted by ParseSize, longest first
+var sizeUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a positive size such as 1048576, 512KB, 50MB, or 1.5GB,
+// case-insensitively. Units are powers of 1024, as shown by FormatBytes.
+func ParseSize(value string) (int64, error) {
+	number := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := 1.0
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid size %q (use bytes or a KB, MB, or GB suffix, such as 50MB)", value)
+	}
+	if n*multiplier >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", value)
+	}
+	size := int64(n * multiplier)
+	if size < 1 {
+		return 0, fmt.Errorf("size must be positive, got %q", value)
+	}
+	return size, nil
+}
+
+// matchGlob reports whether a slash-separated path matches a glob, in which a
+// "**" segment matches any number of directories and other segments are
+// matched as by path.Match
+func matchGlob(pattern, name string) bool {
+	return matchIgnoreSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// ValidGlob reports whether pattern is a well-formed glob for
+// Scanner.IncludeGlobs and ExcludeGlobs
+func ValidGlob(pattern string) bool {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return false
+		}
+	}
+	return pattern != ""
+}
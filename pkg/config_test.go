@@ -0,0 +1,123 @@
+package poltergeist
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Config
+		wantErr string
+	}{
+		{
+			name: "all settings",
+			content: `workers: 4
+max_file_size: 10MB
+engine: go
+tags: [cloud, vcs]
+exclude_tags: [generic]
+skip_dirs: [.git, third_party]
+entropy_threshold: 3.5
+format: json
+include: ["**/*.env", "**/*.js"]
+exclude:
+  - "**/*.min.js"
+  - testdata/**
+`,
+			want: Config{
+				Workers:          4,
+				MaxFileSize:      "10MB",
+				Engine:           "go",
+				Tags:             []string{"cloud", "vcs"},
+				ExcludeTags:      []string{"generic"},
+				SkipDirs:         []string{".git", "third_party"},
+				EntropyThreshold: 3.5,
+				Format:           "json",
+				Include:          []string{"**/*.env", "**/*.js"},
+				Exclude:          []string{"**/*.min.js", "testdata/**"},
+			},
+		},
+		{name: "size in bytes", content: "max_file_size: 1048576\n", want: Config{MaxFileSize: "1048576"}},
+		{name: "empty", content: "", want: Config{}},
+		{name: "comments only", content: "# nothing set yet\n", want: Config{}},
+		{name: "unknown key", content: "workers: 4\nworker_count: 8\n", wantErr: "field worker_count not found"},
+		{name: "wrong type", content: "workers: many\n", wantErr: "failed to parse config file"},
+		{name: "negative workers", content: "workers: -1\n", wantErr: "workers must not be negative"},
+		{name: "invalid size", content: "max_file_size: lots\n", wantErr: "max_file_size: invalid size"},
+		{name: "unknown engine", content: "engine: pcre\n", wantErr: `unknown engine "pcre"`},
+		{name: "negative entropy", content: "entropy_threshold: -2\n", wantErr: "entropy_threshold must not be negative"},
+		{name: "invalid glob", content: "exclude: [\"src/[a-\"]\n", wantErr: `invalid glob "src/[a-"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ConfigFile)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadConfig(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadConfig = %+v, expected %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), ConfigFile)); err == nil {
+		t.Error("Expected an error for a missing config file")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "1048576", want: 1048576},
+		{value: "512B", want: 512},
+		{value: "64KB", want: 64 << 10},
+		{value: "50MB", want: 50 << 20},
+		{value: "2GB", want: 2 << 30},
+		{value: "1.5GB", want: 3 << 29},
+		{value: "10mb", want: 10 << 20},
+		{value: "10M", want: 10 << 20},
+		{value: " 8 KB ", want: 8 << 10},
+		{value: "", wantErr: true},
+		{value: "MB", wantErr: true},
+		{value: "lots", wantErr: true},
+		{value: "10TB", wantErr: true},
+		{value: "0", wantErr: true},
+		{value: "-5MB", wantErr: true},
+		{value: "1e30GB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSize(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, expected error %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, expected %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package poltergeist
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// csvHeader names the columns written by WriteCSV
+var csvHeader = []string{"file", "line", "column", "rule_id", "rule_name", "severity", "redacted", "entropy_met"}
+
+// WriteCSV writes results as CSV, with a header row and one row per result.
+// Only the redacted match is written; see WriteCSVWithMatches for the raw
+// match.
+func WriteCSV(w io.Writer, results []ScanResult) error {
+	return writeCSV(w, results, false)
+}
+
+// WriteCSVWithMatches is like WriteCSV but adds a final match column holding
+// the raw, unredacted match
+func WriteCSVWithMatches(w io.Writer, results []ScanResult) error {
+	return writeCSV(w, results, true)
+}
+
+func writeCSV(w io.Writer, results []ScanResult, withMatches bool) error {
+	cw := csv.NewWriter(w)
+
+	header := csvHeader
+	if withMatches {
+		header = append(header[:len(header):len(header)], "match")
+	}
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	for _, result := range results {
+		row := []string{
+			result.FilePath,
+			strconv.Itoa(result.LineNumber),
+			strconv.Itoa(result.Column),
+			result.RuleID,
+			result.RuleName,
+			result.Severity,
+			result.Redacted,
+			strconv.FormatBool(result.RuleEntropyThresholdMet),
+		}
+		if withMatches {
+			row = append(row, result.Match)
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
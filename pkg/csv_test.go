@@ -0,0 +1,95 @@
+package poltergeist
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var csvTestResults = []ScanResult{
+	{
+		FilePath:                "config/app.env",
+		LineNumber:              3,
+		Column:                  7,
+		Match:                   "tok_aZ3kQ9xLm2Pw7vRt",
+		Redacted:                "tok_*****7vRt",
+		RuleName:                "Test Token",
+		RuleID:                  "test.token",
+		Severity:                "high",
+		RuleEntropyThresholdMet: true,
+	},
+	{
+		// Fields that need quoting
+		FilePath:   "docs/notes, \"draft\".md",
+		LineNumber: 12,
+		Column:     1,
+		Match:      "key_0123456789abcdef",
+		Redacted:   "key_*****\ncdef",
+		RuleName:   "Key, Generic",
+		RuleID:     "test.key",
+	},
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, csvTestResults); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+
+	want := [][]string{
+		{"file", "line", "column", "rule_id", "rule_name", "severity", "redacted", "entropy_met"},
+		{"config/app.env", "3", "7", "test.token", "Test Token", "high", "tok_*****7vRt", "true"},
+		{"docs/notes, \"draft\".md", "12", "1", "test.key", "Key, Generic", "", "key_*****\ncdef", "false"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("CSV records = %q, expected %q", records, want)
+	}
+
+	for _, result := range csvTestResults {
+		if strings.Contains(buf.String(), result.Match) {
+			t.Errorf("Expected the raw match %q not to be written", result.Match)
+		}
+	}
+}
+
+func TestWriteCSVWithMatches(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSVWithMatches(&buf, csvTestResults); err != nil {
+		t.Fatalf("WriteCSVWithMatches failed: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected a header and 2 rows, got %d records", len(records))
+	}
+
+	header := records[0]
+	if header[len(header)-1] != "match" || len(header) != len(csvHeader)+1 {
+		t.Errorf("Expected a final match column, got header %q", header)
+	}
+	for i, result := range csvTestResults {
+		if got := records[i+1][len(header)-1]; got != result.Match {
+			t.Errorf("Row %d match = %q, expected %q", i+1, got, result.Match)
+		}
+	}
+}
+
+func TestWriteCSVNoResults(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, nil); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	if got, want := buf.String(), strings.Join(csvHeader, ",")+"\n"; got != want {
+		t.Errorf("Expected only the header, got %q", got)
+	}
+}
@@ -0,0 +1,172 @@
+package poltergeist
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/flier/gohs/hyperscan"
+)
+
+// databaseMagic starts every saved Hyperscan database, and changes whenever
+// the file format or how patterns are compiled changes
+var databaseMagic = []byte("PGHSDB02")
+
+// ErrDatabaseMismatch is returned by LoadDatabase when a saved database was
+// compiled from a different rule set
+var ErrDatabaseMismatch = errors.New("hyperscan database was compiled from different rules")
+
+// SaveDatabase writes the compiled Hyperscan database to path, so later runs
+// can skip compiling the same rules with LoadDatabase. The file starts with a
+// hash of the rule set given to CompileRules, which LoadDatabase uses to
+// reject stale databases, followed by the rules skipped as Warnings.
+func (e *HyperscanEngine) SaveDatabase(path string) error {
+	if e.database == nil {
+		return errors.New("no hyperscan database has been compiled")
+	}
+
+	data, err := e.database.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to serialize hyperscan database: %w", err)
+	}
+
+	buf := make([]byte, 0, len(databaseMagic)+len(e.ruleSetSum)+len(data))
+	buf = append(buf, databaseMagic...)
+	buf = append(buf, e.ruleSetSum[:]...)
+	buf = binary.AppendUvarint(buf, uint64(len(e.warnings)))
+	for _, warning := range e.warnings {
+		buf = appendString(buf, warning.RuleID)
+		buf = appendString(buf, warning.Err.Error())
+	}
+	buf = append(buf, data...)
+
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		return fmt.Errorf("failed to write hyperscan database: %w", err)
+	}
+	return nil
+}
+
+// LoadDatabase loads a database saved by SaveDatabase instead of compiling
+// rules, which must be the rules the database was compiled from. It returns
+// an error wrapping ErrDatabaseMismatch if they aren't, in which case the
+// rules should be compiled with CompileRules instead. Rules skipped when the
+// database was compiled are skipped again and reported by Warnings.
+func (e *HyperscanEngine) LoadDatabase(path string, rules []Rule) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read hyperscan database: %w", err)
+	}
+
+	headerLen := len(databaseMagic) + sha256.Size
+	if len(buf) < headerLen || !bytes.HasPrefix(buf, databaseMagic) {
+		return fmt.Errorf("%s is not a saved hyperscan database", path)
+	}
+
+	e.warnings = nil
+	if _, err := e.prepareRules(rules); err != nil {
+		return err
+	}
+
+	hash := e.ruleSetHash()
+	if !bytes.Equal(buf[len(databaseMagic):headerLen], hash[:]) {
+		return fmt.Errorf("%w: %s", ErrDatabaseMismatch, path)
+	}
+
+	// Skip the rules that were skipped when compiling, with their warnings
+	warnings, data, err := e.readWarnings(buf[headerLen:])
+	if err != nil {
+		return fmt.Errorf("%s is not a saved hyperscan database: %w", path, err)
+	}
+	if len(warnings) > 0 {
+		compiled := slices.DeleteFunc(EnabledRules(rules), func(rule Rule) bool {
+			return slices.ContainsFunc(warnings, func(w CompileWarning) bool { return w.RuleID == rule.ID })
+		})
+		if _, err := e.prepareRules(compiled); err != nil {
+			return err
+		}
+	}
+
+	database, err := hyperscan.UnmarshalBlockDatabase(data)
+	if err != nil {
+		return fmt.Errorf("failed to deserialize hyperscan database: %w", err)
+	}
+
+	if err := e.useDatabase(database); err != nil {
+		return err
+	}
+	e.ruleSetSum = hash
+	e.warnings = warnings
+	return nil
+}
+
+// readWarnings reads the skipped rules SaveDatabase writes after the header,
+// for rules prepared with prepareRules, returning their warnings and the rest
+// of buf
+func (e *HyperscanEngine) readWarnings(buf []byte) ([]CompileWarning, []byte, error) {
+	count, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return nil, nil, errors.New("invalid skipped rule count")
+	}
+	buf = buf[n:]
+
+	var warnings []CompileWarning
+	for range count {
+		var id, message string
+		var ok bool
+		if id, buf, ok = readString(buf); !ok {
+			return nil, nil, errors.New("truncated skipped rule")
+		}
+		if message, buf, ok = readString(buf); !ok {
+			return nil, nil, errors.New("truncated skipped rule")
+		}
+
+		i := slices.IndexFunc(e.rules, func(rule RuntimeRule) bool { return rule.ID == id })
+		if i == -1 {
+			return nil, nil, fmt.Errorf("unknown skipped rule '%s'", id)
+		}
+		warnings = append(warnings, CompileWarning{
+			RuleID:   id,
+			RuleName: e.rules[i].Name,
+			Engine:   e.Name(),
+			Err:      errors.New(message),
+		})
+	}
+	return warnings, buf, nil
+}
+
+// appendString appends s to buf prefixed with its length
+func appendString(buf []byte, s string) []byte {
+	return append(binary.AppendUvarint(buf, uint64(len(s))), s...)
+}
+
+// readString reads a string written by appendString from the start of buf,
+// returning it and the rest of buf
+func readString(buf []byte) (string, []byte, bool) {
+	n, size := binary.Uvarint(buf)
+	if size <= 0 || n > uint64(len(buf)-size) {
+		return "", nil, false
+	}
+	buf = buf[size:]
+	return string(buf[:n]), buf[n:], true
+}
+
+// ruleSetHash returns a hash of everything the compiled database depends on:
+// the engine mode and each enabled rule's patterns, in order
+func (e *HyperscanEngine) ruleSetHash() [sha256.Size]byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "som=%t\x00", e.somLeftMost)
+	for _, rule := range e.rules {
+		fmt.Fprintf(h, "%s\x00%d\x00", rule.ID, len(rule.Patterns))
+		for _, pattern := range rule.Patterns {
+			fmt.Fprintf(h, "%s\x00", pattern)
+		}
+	}
+
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
@@ -0,0 +1,180 @@
+package poltergeist
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var databaseTestRules = []Rule{
+	{
+		Name:    "Test Token",
+		ID:      "test.token",
+		Pattern: `\b(tok_[a-zA-Z0-9]{16})\b`,
+		Redact:  []int{4, 0},
+		Entropy: 1.0,
+	},
+	{
+		Name:     "Test Key",
+		ID:       "test.key",
+		Patterns: []string{`\bkey_([a-f0-9]{24})\b`, `\bsk-([a-zA-Z0-9]{20})\b`},
+		Redact:   []int{0, 0},
+		Entropy:  1.0,
+	},
+}
+
+func TestHyperscanDatabaseRoundTrip(t *testing.T) {
+	if !IsHyperscanAvailable() {
+		t.Skip("Hyperscan is not available")
+	}
+
+	content := []byte("a = tok_AbCdEf0123456789\nb = key_0123456789abcdef01234567 sk-AbCdEfGhIjKlMnOpQrSt\n")
+	path := filepath.Join(t.TempDir(), "rules.db")
+
+	compiled := NewHyperscanEngine().(*HyperscanEngine)
+	defer compiled.Close()
+	if err := compiled.CompileRules(databaseTestRules); err != nil {
+		t.Fatalf("CompileRules failed: %v", err)
+	}
+	if err := compiled.SaveDatabase(path); err != nil {
+		t.Fatalf("SaveDatabase failed: %v", err)
+	}
+
+	loaded := NewHyperscanEngine().(*HyperscanEngine)
+	defer loaded.Close()
+	if err := loaded.LoadDatabase(path, databaseTestRules); err != nil {
+		t.Fatalf("LoadDatabase failed: %v", err)
+	}
+
+	want := compiled.FindAllInContent(content)
+	if len(want) != 3 {
+		t.Fatalf("Expected 3 matches from the compiled database, got %d: %+v", len(want), want)
+	}
+	if got := loaded.FindAllInContent(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("Loaded database matches differ:\n got: %+v\nwant: %+v", got, want)
+	}
+
+	// A database compiled from other rules is rejected
+	changed := []Rule{databaseTestRules[0]}
+	if err := NewHyperscanEngine().(*HyperscanEngine).LoadDatabase(path, changed); !errors.Is(err, ErrDatabaseMismatch) {
+		t.Errorf("Expected ErrDatabaseMismatch for a different rule set, got %v", err)
+	}
+
+	// As is one compiled for the other engine mode
+	if err := NewHyperscanSOMEngine().(*HyperscanEngine).LoadDatabase(path, databaseTestRules); !errors.Is(err, ErrDatabaseMismatch) {
+		t.Errorf("Expected ErrDatabaseMismatch for the SOM engine, got %v", err)
+	}
+}
+
+func TestHyperscanDatabaseRoundTripWithSkippedRule(t *testing.T) {
+	if !IsHyperscanAvailable() {
+		t.Skip("Hyperscan is not available")
+	}
+
+	// A rule Hyperscan can't compile is skipped with a warning
+	rules := append(slices.Clone(databaseTestRules), Rule{
+		Name:    "Broken",
+		ID:      "test.broken",
+		Pattern: `tok_(?<unsupported`,
+		Redact:  []int{0, 0},
+	})
+	content := []byte("a = tok_AbCdEf0123456789\n")
+	path := filepath.Join(t.TempDir(), "rules.db")
+
+	compiled := NewHyperscanEngine().(*HyperscanEngine)
+	defer compiled.Close()
+	if err := compiled.CompileRules(rules); err != nil {
+		t.Fatalf("CompileRules failed: %v", err)
+	}
+	if len(compiled.Warnings()) != 1 {
+		t.Fatalf("Expected 1 warning, got %v", compiled.Warnings())
+	}
+	if err := compiled.SaveDatabase(path); err != nil {
+		t.Fatalf("SaveDatabase failed: %v", err)
+	}
+
+	// The database loads for the same rules, skipping the same rule
+	loaded := NewHyperscanEngine().(*HyperscanEngine)
+	defer loaded.Close()
+	if err := loaded.LoadDatabase(path, rules); err != nil {
+		t.Fatalf("LoadDatabase failed: %v", err)
+	}
+	if got, want := loaded.Warnings(), compiled.Warnings(); len(got) != 1 || got[0].String() != want[0].String() {
+		t.Errorf("Expected the loaded warnings %v, got %v", want, got)
+	}
+	if got, want := len(loaded.Rules()), len(compiled.Rules()); got != want {
+		t.Errorf("Expected %d rules loaded, got %d", want, got)
+	}
+	if got, want := loaded.FindAllInContent(content), compiled.FindAllInContent(content); len(want) != 1 || !reflect.DeepEqual(got, want) {
+		t.Errorf("Loaded database matches differ:\n got: %+v\nwant: %+v", got, want)
+	}
+
+	// Only the compiled rules are a different rule set
+	if err := NewHyperscanEngine().(*HyperscanEngine).LoadDatabase(path, databaseTestRules); !errors.Is(err, ErrDatabaseMismatch) {
+		t.Errorf("Expected ErrDatabaseMismatch without the skipped rule, got %v", err)
+	}
+}
+
+func TestLoadDatabaseRejectsInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	// A header for a different rule set, which is rejected before the
+	// database itself is read
+	other := &HyperscanEngine{}
+	if _, err := other.prepareRules(databaseTestRules[:1]); err != nil {
+		t.Fatalf("prepareRules failed: %v", err)
+	}
+	hash := other.ruleSetHash()
+	stale := append(append(append([]byte{}, databaseMagic...), hash[:]...), "database"...)
+
+	// A header for the rule set, claiming a skipped rule it doesn't hold
+	current := &HyperscanEngine{}
+	if _, err := current.prepareRules(databaseTestRules); err != nil {
+		t.Fatalf("prepareRules failed: %v", err)
+	}
+	hash = current.ruleSetHash()
+	truncated := append(append(append([]byte{}, databaseMagic...), hash[:]...), 1)
+
+	tests := []struct {
+		name    string
+		content []byte
+		wantIs  error
+		wantErr string
+	}{
+		{name: "not a database", content: []byte("rules:\n  - id: test.token\n"), wantErr: "not a saved hyperscan database"},
+		{name: "truncated header", content: databaseMagic, wantErr: "not a saved hyperscan database"},
+		{name: "stale rule set", content: stale, wantIs: ErrDatabaseMismatch},
+		{name: "truncated skipped rules", content: truncated, wantErr: "not a saved hyperscan database"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "-")+".db")
+			if err := os.WriteFile(path, tt.content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := (&HyperscanEngine{}).LoadDatabase(path, databaseTestRules)
+			if err == nil {
+				t.Fatal("Expected LoadDatabase to fail")
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("Expected %v, got %v", tt.wantIs, err)
+			}
+			if tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSaveDatabaseWithoutCompiling(t *testing.T) {
+	err := (&HyperscanEngine{}).SaveDatabase(filepath.Join(t.TempDir(), "rules.db"))
+	if err == nil {
+		t.Error("Expected SaveDatabase to fail before rules are compiled")
+	}
+}
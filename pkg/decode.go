@@ -0,0 +1,99 @@
+package poltergeist
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDecodeDepth is how many layers of encoding are decoded, so that decoded
+// content that is itself encoded is scanned once more but can't loop
+const maxDecodeDepth = 2
+
+// encodedBlobPattern matches runs long enough to hold an encoded secret in
+// standard or URL-safe base64, or hex
+var encodedBlobPattern = regexp.MustCompile(`[A-Za-z0-9+/_-]{20,}={0,2}`)
+
+// hexBlobPattern matches runs that are entirely hex
+var hexBlobPattern = regexp.MustCompile(`^(?:[0-9a-fA-F]{2}){16,}$`)
+
+// base64Encodings are tried in turn to decode a base64 run
+var base64Encodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.RawStdEncoding,
+	base64.URLEncoding,
+	base64.RawURLEncoding,
+}
+
+// encodedMatches decodes the base64 and hex runs in text and returns the
+// matches found in the decoded content. Each match spans the encoded run in
+// text and records the encodings it was found under in Encoding.
+func (s *Scanner) encodedMatches(text string) []MatchResult {
+	return s.decodeAndMatch(text, 1)
+}
+
+// decodeAndMatch finds matches in the decoded runs of text at the given
+// decoding depth
+func (s *Scanner) decodeAndMatch(text string, depth int) []MatchResult {
+	var results []MatchResult
+
+	for _, loc := range encodedBlobPattern.FindAllStringIndex(text, -1) {
+		encoding, decoded, ok := decodeBlob(text[loc[0]:loc[1]])
+		if !ok {
+			continue
+		}
+
+		for _, line := range strings.Split(decoded, "\n") {
+			line = strings.TrimSuffix(line, "\r")
+
+			matches := filterOverlappingGenericMatches(s.Engine.FindAllInLine(line))
+			if s.DedupeOverlaps {
+				matches = dedupeOverlappingMatches(matches)
+			}
+			if depth < maxDecodeDepth {
+				matches = append(matches, s.decodeAndMatch(line, depth+1)...)
+			}
+
+			for _, match := range matches {
+				match.Start, match.End = loc[0], loc[1]
+				match.Encoding = joinEncodings(encoding, match.Encoding)
+				results = append(results, match)
+			}
+		}
+	}
+
+	return results
+}
+
+// decodeBlob decodes a hex or base64 run, reporting the encoding. Runs that
+// don't decode to text are rejected, since secrets are printable.
+func decodeBlob(blob string) (string, string, bool) {
+	if hexBlobPattern.MatchString(blob) {
+		if decoded, err := hex.DecodeString(blob); err == nil && isDecodedText(decoded) {
+			return "hex", string(decoded), true
+		}
+	}
+
+	for _, encoding := range base64Encodings {
+		if decoded, err := encoding.DecodeString(blob); err == nil && isDecodedText(decoded) {
+			return "base64", string(decoded), true
+		}
+	}
+
+	return "", "", false
+}
+
+// isDecodedText reports whether decoded bytes look like text worth scanning
+func isDecodedText(decoded []byte) bool {
+	return len(decoded) > 0 && utf8.Valid(decoded) && !isBinaryContent(decoded, DefaultBinaryThreshold)
+}
+
+// joinEncodings returns the encodings of a match, outermost first
+func joinEncodings(outer, inner string) string {
+	if inner == "" {
+		return outer
+	}
+	return outer + "+" + inner
+}
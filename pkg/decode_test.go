@@ -0,0 +1,90 @@
+package poltergeist
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestDecodeEncodedBlobs(t *testing.T) {
+	rules, err := LoadDefaultRules()
+	if err != nil {
+		t.Fatalf("LoadDefaultRules failed: %v", err)
+	}
+	rules, err = FilterRulesByID(rules, []string{"ghost.aws.1"})
+	if err != nil {
+		t.Fatalf("FilterRulesByID failed: %v", err)
+	}
+
+	secret := "Bu/9qrIw9+rocEIxAssiTudEqV6k+qbB3VIhKBBJ"
+	plain := "export AWS_SECRET_ACCESS_KEY=" + secret
+
+	tests := []struct {
+		name     string
+		blob     string
+		encoding string
+	}{
+		{name: "base64", blob: base64.StdEncoding.EncodeToString([]byte(plain)), encoding: "base64"},
+		{name: "base64 url", blob: base64.RawURLEncoding.EncodeToString([]byte(plain)), encoding: "base64"},
+		{name: "hex", blob: hex.EncodeToString([]byte(plain)), encoding: "hex"},
+		{name: "nested", blob: base64.StdEncoding.EncodeToString([]byte("creds: " + hex.EncodeToString([]byte(plain)))), encoding: "base64+hex"},
+	}
+
+	for _, tt := range tests {
+		for _, wholeFile := range []bool{false, true} {
+			content := "# deploy config\ncredentials: \"" + tt.blob + "\"\n"
+
+			scanner := newTestScanner(t, rules)
+			scanner.WholeFile = wholeFile
+
+			results, err := scanner.ScanReader(strings.NewReader(content), "deploy.yaml")
+			if err != nil {
+				t.Fatalf("%s: ScanReader failed: %v", tt.name, err)
+			}
+			if len(results) != 0 {
+				t.Errorf("%s: expected no results without decoding, got %d", tt.name, len(results))
+			}
+
+			scanner.DecodeEncodedBlobs = true
+			results, err = scanner.ScanReader(strings.NewReader(content), "deploy.yaml")
+			if err != nil {
+				t.Fatalf("%s: ScanReader failed: %v", tt.name, err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("%s WholeFile=%v: expected 1 result after decoding, got %d: %+v", tt.name, wholeFile, len(results), results)
+			}
+
+			// The finding spans the encoded run in the file
+			result := results[0]
+			wantColumn := len(`credentials: "`) + 1
+			if result.Match != secret || result.Encoding != tt.encoding || result.LineNumber != 2 ||
+				result.Column != wantColumn || result.EndColumn != wantColumn+len(tt.blob) {
+				t.Errorf("%s WholeFile=%v: got %q encoding %q at %d:%d-%d, expected %q encoding %q at 2:%d-%d",
+					tt.name, wholeFile, result.Match, result.Encoding, result.LineNumber, result.Column, result.EndColumn,
+					secret, tt.encoding, wantColumn, wantColumn+len(tt.blob))
+			}
+		}
+	}
+}
+
+func TestDecodeBlob(t *testing.T) {
+	tests := []struct {
+		name string
+		blob string
+		ok   bool
+	}{
+		{name: "base64 text", blob: base64.StdEncoding.EncodeToString([]byte("some decoded text")), ok: true},
+		{name: "hex text", blob: hex.EncodeToString([]byte("some decoded text")), ok: true},
+		{name: "base64 binary", blob: base64.StdEncoding.EncodeToString([]byte{0x00, 0xff, 0x10, 0x80, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b}), ok: false},
+		{name: "identifier", blob: "ThisIsJustALongIdentifierName", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, ok := decodeBlob(tt.blob); ok != tt.ok {
+				t.Errorf("decodeBlob(%q) ok = %v, expected %v", tt.blob, ok, tt.ok)
+			}
+		})
+	}
+}
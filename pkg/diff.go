@@ -0,0 +1,83 @@
+package poltergeist
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DiffScan scans two versions of a directory tree and returns the findings
+// introduced in newRoot, which aren't in oldRoot, and the findings removed
+// from it, which are only in oldRoot. Findings are compared by Fingerprint
+// with file paths relative to each root, so a secret that only moved lines
+// is in neither list, while one that moved to another file is in both.
+// Added findings have paths within newRoot and removed findings paths within
+// oldRoot. Scanner metrics accumulate over both scans.
+func DiffScan(scanner *Scanner, oldRoot, newRoot string) (added, removed []ScanResult, err error) {
+	return DiffScanContext(context.Background(), scanner, oldRoot, newRoot)
+}
+
+// DiffScanContext is like DiffScan but stops scanning once ctx is done, in
+// which case it returns ctx.Err() and no findings, as a diff of partial scans
+// would be misleading.
+func DiffScanContext(ctx context.Context, scanner *Scanner, oldRoot, newRoot string) (added, removed []ScanResult, err error) {
+	// A missing tree would otherwise look like one without findings
+	for _, root := range []string{oldRoot, newRoot} {
+		if _, err := os.Stat(root); err != nil {
+			return nil, nil, fmt.Errorf("failed to diff scan: %w", err)
+		}
+	}
+
+	oldResults, err := scanner.ScanDirectoryContext(ctx, oldRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	newResults, err := scanner.ScanDirectoryContext(ctx, newRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oldFingerprints := diffFingerprints(oldResults, oldRoot)
+	newFingerprints := diffFingerprints(newResults, newRoot)
+
+	newSet := make(map[string]bool, len(newFingerprints))
+	for _, fp := range newFingerprints {
+		newSet[fp] = true
+	}
+	oldSet := make(map[string]bool, len(oldFingerprints))
+	for i, fp := range oldFingerprints {
+		oldSet[fp] = true
+		if !newSet[fp] {
+			removed = append(removed, oldResults[i])
+		}
+	}
+	for i, fp := range newFingerprints {
+		if !oldSet[fp] {
+			added = append(added, newResults[i])
+		}
+	}
+
+	return added, removed, nil
+}
+
+// diffFingerprints returns the Fingerprint of each result of scanning root,
+// with its path relative to root. Results of scanning a single file have the
+// path ".", so two versions of a file can be diffed whatever their names.
+func diffFingerprints(results []ScanResult, root string) []string {
+	info, err := os.Stat(root)
+	isDir := err == nil && info.IsDir()
+
+	fingerprints := make([]string, len(results))
+	for i, result := range results {
+		rel := "."
+		if isDir {
+			if rel, err = filepath.Rel(root, result.FilePath); err != nil {
+				rel = result.FilePath
+			}
+		}
+		result.FilePath = rel
+		fingerprints[i] = result.Fingerprint()
+	}
+	return fingerprints
+}
@@ -0,0 +1,73 @@
+package poltergeist
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffScan(t *testing.T) {
+	oldDir, newDir := t.TempDir(), t.TempDir()
+
+	// The new tree removes one secret, adds another, and moves a third to a
+	// different line
+	writeTestFile(t, oldDir, "config.env", "TOKEN=tok_removed1\n")
+	writeTestFile(t, oldDir, filepath.Join("app", "keys.txt"), "KEY=tok_unchanged\n")
+	writeTestFile(t, newDir, "config.env", "TOKEN=\n")
+	writeTestFile(t, newDir, filepath.Join("app", "keys.txt"), "# keys\nKEY=tok_unchanged\n")
+	writeTestFile(t, newDir, filepath.Join("app", "new.env"), "TOKEN=tok_added123\n")
+
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8,9}`,
+		},
+	}
+
+	added, removed, err := DiffScan(newTestScanner(t, rules), oldDir, newDir)
+	if err != nil {
+		t.Fatalf("DiffScan failed: %v", err)
+	}
+
+	if got := diffSummary(added); !reflect.DeepEqual(got, []string{filepath.Join(newDir, "app", "new.env") + " tok_added123"}) {
+		t.Errorf("Unexpected added findings: %v", got)
+	}
+	if got := diffSummary(removed); !reflect.DeepEqual(got, []string{filepath.Join(oldDir, "config.env") + " tok_removed1"}) {
+		t.Errorf("Unexpected removed findings: %v", got)
+	}
+
+	// Identical trees differ in nothing
+	added, removed, err = DiffScan(newTestScanner(t, rules), newDir, newDir)
+	if err != nil {
+		t.Fatalf("DiffScan failed: %v", err)
+	}
+	if len(added) != 0 || len(removed) != 0 {
+		t.Errorf("Expected no differences between identical trees, got %v added and %v removed", diffSummary(added), diffSummary(removed))
+	}
+
+	// Two versions of a single file are compared whatever their names
+	added, removed, err = DiffScan(newTestScanner(t, rules), filepath.Join(oldDir, "app", "keys.txt"), filepath.Join(newDir, "app", "new.env"))
+	if err != nil {
+		t.Fatalf("DiffScan failed: %v", err)
+	}
+	if len(added) != 1 || len(removed) != 1 || added[0].Match != "tok_added123" || removed[0].Match != "tok_unchanged" {
+		t.Errorf("Unexpected file diff: %v added and %v removed", diffSummary(added), diffSummary(removed))
+	}
+}
+
+func TestDiffScanMissingRoot(t *testing.T) {
+	rules := []Rule{{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-z0-9]{8}`}}
+	if _, _, err := DiffScan(newTestScanner(t, rules), filepath.Join(t.TempDir(), "missing"), t.TempDir()); err == nil {
+		t.Error("Expected an error for a missing old root")
+	}
+}
+
+// diffSummary describes findings by path and match
+func diffSummary(results []ScanResult) []string {
+	var summary []string
+	for _, result := range results {
+		summary = append(summary, result.FilePath+" "+result.Match)
+	}
+	return summary
+}
@@ -0,0 +1,71 @@
+package poltergeist
+
+import (
+	"bytes"
+	"io"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// utf8BOM is the UTF-8 byte order mark, which is stripped before scanning so
+// it doesn't shift columns or stop anchored patterns matching the first line
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// utf16MinTextRatio is the fraction of 16-bit code units in content without a
+// byte order mark that must be printable ASCII with a null high byte for the
+// content to be read as UTF-16
+const utf16MinTextRatio = 0.95
+
+// detectUTF16 returns the UTF-16 encoding of content starting with head, or
+// nil if it isn't UTF-16. Content is UTF-16 if it starts with a byte order
+// mark, or if nearly every code unit is printable ASCII, the null bytes of
+// which would otherwise get it skipped as binary.
+func detectUTF16(head []byte) encoding.Encoding {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xff, 0xfe}):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(head, []byte{0xfe, 0xff}):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	}
+
+	units := len(head) / 2
+	if units < 2 {
+		return nil
+	}
+
+	var little, big int
+	for i := 0; i+1 < len(head); i += 2 {
+		if head[i+1] == 0 && isPrintableASCII(head[i]) {
+			little++
+		}
+		if head[i] == 0 && isPrintableASCII(head[i+1]) {
+			big++
+		}
+	}
+
+	switch {
+	case float64(little)/float64(units) >= utf16MinTextRatio:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case float64(big)/float64(units) >= utf16MinTextRatio:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	}
+	return nil
+}
+
+// isPrintableASCII reports whether b is a printable ASCII character, tab,
+// newline, or carriage return
+func isPrintableASCII(b byte) bool {
+	return (b >= 0x20 && b < 0x7f) || b == '\t' || b == '\n' || b == '\r'
+}
+
+// decodeUTF16 returns a reader transcoding r to UTF-8 if the content starting
+// with head is UTF-16, and whether it is
+func decodeUTF16(head []byte, r io.Reader) (io.Reader, bool) {
+	enc := detectUTF16(head)
+	if enc == nil {
+		return r, false
+	}
+	return transform.NewReader(r, enc.NewDecoder()), true
+}
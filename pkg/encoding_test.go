@@ -0,0 +1,113 @@
+package poltergeist
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes s as UTF-16 in the given byte order, with a byte order
+// mark if bom is set
+func encodeUTF16(s string, order binary.ByteOrder, bom bool) []byte {
+	units := utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xfeff}, units...)
+	}
+	data := make([]byte, 2*len(units))
+	for i, unit := range units {
+		order.PutUint16(data[2*i:], unit)
+	}
+	return data
+}
+
+func TestScanUTF16(t *testing.T) {
+	content := "# settings\r\nname = app\r\nTOKEN=tok_aZ3kQ9xLm2Pw7vRt\r\n"
+	files := map[string][]byte{
+		"le-bom.env": encodeUTF16(content, binary.LittleEndian, true),
+		"be-bom.env": encodeUTF16(content, binary.BigEndian, true),
+		"le.env":     encodeUTF16(content, binary.LittleEndian, false),
+		"be.env":     encodeUTF16(content, binary.BigEndian, false),
+	}
+
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, mmap := range []bool{false, true} {
+		scanner := newTestScanner(t, []Rule{{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`}})
+		if mmap {
+			scanner.MmapThreshold = 1
+		}
+
+		results, err := scanner.ScanDirectory(dir)
+		if err != nil {
+			t.Fatalf("ScanDirectory failed: %v", err)
+		}
+		if scanner.Metrics.FilesSkipped != 0 {
+			t.Errorf("mmap %v: expected no files skipped as binary, got %d", mmap, scanner.Metrics.FilesSkipped)
+		}
+		if len(results) != len(files) {
+			t.Fatalf("mmap %v: expected %d results, got %d: %+v", mmap, len(files), len(results), results)
+		}
+		for _, result := range results {
+			if result.Match != "tok_aZ3kQ9xLm2Pw7vRt" || result.LineNumber != 3 || result.Column != 7 {
+				t.Errorf("mmap %v: expected the token at 3:7 of %s, got %q at %d:%d",
+					mmap, filepath.Base(result.FilePath), result.Match, result.LineNumber, result.Column)
+			}
+		}
+	}
+}
+
+func TestDetectUTF16(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want bool
+	}{
+		{name: "little endian bom", head: []byte{0xff, 0xfe, 'a', 0}, want: true},
+		{name: "big endian bom", head: []byte{0xfe, 0xff, 0, 'a'}, want: true},
+		{name: "little endian text", head: encodeUTF16("key = value\n", binary.LittleEndian, false), want: true},
+		{name: "big endian text", head: encodeUTF16("key = value\n", binary.BigEndian, false), want: true},
+		{name: "utf-8 text", head: []byte("key = value\n"), want: false},
+		{name: "binary", head: []byte{0x7f, 'E', 'L', 'F', 2, 1, 1, 0, 0, 0, 0, 0}, want: false},
+		{name: "too short", head: []byte{'a', 0}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectUTF16(tt.head) != nil; got != tt.want {
+				t.Errorf("detectUTF16(%q) = %v, expected %v", tt.head, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanUTF8BOM(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "config.env", "\xef\xbb\xbfTOKEN=tok_aZ3kQ9xLm2Pw7vRt\nOTHER=1\n")
+
+	rules := []Rule{{Name: "Anchored Token", ID: "test.anchored", Pattern: `^TOKEN=(tok_[a-zA-Z0-9]{16})`}}
+	for _, mode := range []string{"line", "whole file", "mmap"} {
+		scanner := newTestScanner(t, rules)
+		scanner.WholeFile = mode == "whole file"
+		if mode == "mmap" {
+			scanner.MmapThreshold = 1
+		}
+
+		results, err := scanner.ScanDirectory(dir)
+		if err != nil {
+			t.Fatalf("%s: ScanDirectory failed: %v", mode, err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("%s: expected the anchored rule to match after the BOM, got %d results", mode, len(results))
+		}
+		if result := results[0]; result.LineNumber != 1 || result.Column != 7 {
+			t.Errorf("%s: expected the match at 1:7, got %d:%d", mode, result.LineNumber, result.Column)
+		}
+	}
+}
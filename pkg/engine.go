@@ -1,9 +1,13 @@
 package poltergeist
 
 import (
+	"cmp"
+	"crypto/sha256"
 	"fmt"
 	"regexp"
-	"strings"
+	"runtime"
+	"slices"
+	"strconv"
 	"sync"
 
 	"github.com/flier/gohs/hyperscan"
@@ -27,40 +31,152 @@ type PatternEngine interface {
 	Name() string
 }
 
+// CompileWarner is implemented by engines that skip the rules they can't
+// compile instead of failing, such as the Go regex and Hyperscan engines. It
+// is separate from PatternEngine so other engines needn't implement it.
+type CompileWarner interface {
+	// Warnings returns the rules skipped by the last CompileRules because the
+	// engine couldn't compile them
+	Warnings() []CompileWarning
+}
+
+// CompileWarning reports a rule an engine skipped because it couldn't compile
+// one of the rule's patterns. Other rules are still compiled, so a pattern
+// only one engine supports doesn't stop the rest of the rules being used.
+type CompileWarning struct {
+	RuleID   string
+	RuleName string
+	Engine   string
+	Err      error
+}
+
+// String describes the skipped rule and why it was skipped
+func (w CompileWarning) String() string {
+	return fmt.Sprintf("%s skipped rule '%s' (%s): %v", w.Engine, w.RuleName, w.RuleID, w.Err)
+}
+
+// CheckRuleCompatibility compiles rule with both the Go regex and Hyperscan
+// engines, reporting whether each accepts it and the error from each that
+// doesn't. Disabled rules are checked as if they were enabled.
+func CheckRuleCompatibility(rule Rule) (goOK, hsOK bool, goErr, hsErr error) {
+	rule.Enabled = nil
+
+	goEngine := NewGoRegexEngine()
+	defer goEngine.Close()
+	goErr = compileRule(goEngine, rule)
+
+	hsEngine := NewHyperscanEngine()
+	defer hsEngine.Close()
+	hsErr = compileRule(hsEngine, rule)
+
+	return goErr == nil, hsErr == nil, goErr, hsErr
+}
+
+// compileRule compiles rule alone with engine, reporting a panic while
+// compiling as an error
+func compileRule(engine PatternEngine, rule Rule) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s engine panicked compiling rule '%s': %v", engine.Name(), rule.Name, r)
+		}
+	}()
+	return engine.CompileRules([]Rule{rule})
+}
+
 // HyperscanEngine implements PatternEngine using Hyperscan/Vectorscan
 type HyperscanEngine struct {
 	database        hyperscan.BlockDatabase
 	scratchPool     sync.Pool
 	rules           []RuntimeRule
-	goRegexPatterns []*regexp.Regexp // Pre-compiled Go regex for quickMatch refinement
+	patternRules    []int            // Index into rules of the rule each compiled pattern belongs to
+	goRegexPatterns []*regexp.Regexp // Pre-compiled Go regex for quickMatch refinement, per pattern
+	captureGroups   []int            // Index of the capture group holding the secret, per pattern, or -1 for the default
+	multiPattern    bool             // Whether any rule has more than one pattern
+
+	somLeftMost     bool             // Whether patterns are compiled with SomLeftMost instead of SingleMatch
+	anchoredRegexes []*regexp.Regexp // Go regex anchored at the start of text, per pattern, for SomLeftMost matches
+
+	warnings   []CompileWarning  // Rules skipped by the last CompileRules
+	ruleSetSum [sha256.Size]byte // ruleSetHash of every rule given to the last CompileRules, for SaveDatabase
 }
 
+// newScratch allocates Hyperscan scratch space for a database. Tests replace
+// it to simulate allocation failures.
+var newScratch = hyperscan.NewManagedScratch
+
 // NewHyperscanEngine creates a new Hyperscan engine
 func NewHyperscanEngine() PatternEngine {
 	return &HyperscanEngine{}
 }
 
-// CompileRules compiles multiple rules for Hyperscan
+// NewHyperscanSOMEngine creates a Hyperscan engine that compiles patterns with
+// SomLeftMost, so Hyperscan reports where each match starts. Every match is
+// reported instead of the first per pattern, with each line's matches found
+// from the reported starts as the Go regex engine would find them. Patterns
+// that Hyperscan can't track the start of fail to compile.
+func NewHyperscanSOMEngine() PatternEngine {
+	return &HyperscanEngine{somLeftMost: true}
+}
+
+// CompileRules compiles multiple rules for Hyperscan, skipping disabled rules.
+// Rules with a pattern Hyperscan can't compile are skipped and reported by
+// Warnings, unless none of the rules compile.
 func (e *HyperscanEngine) CompileRules(rules []Rule) error {
-	e.rules = make([]RuntimeRule, len(rules))
-	for i, rule := range rules {
-		e.rules[i] = rule.ToRuntimeRule()
+	e.warnings = nil
+
+	rulePatterns, err := e.prepareRules(rules)
+	if err != nil {
+		return err
 	}
+	e.ruleSetSum = e.ruleSetHash()
+	patterns := e.newPatterns(rulePatterns)
 
-	// Pre-compile Go regex patterns for quickMatch refinement
-	e.goRegexPatterns = make([]*regexp.Regexp, len(rules))
-	for i, rule := range rules {
-		compiled, err := regexp.Compile(NormalizeExtendedRegex(rule.Pattern))
-		if err != nil {
-			e.goRegexPatterns[i] = nil // Graceful fallback - Hyperscan may still work
+	// Test each pattern individually first to identify rules that fail to compile
+	errs := patternErrors(patterns)
+	skipped := make(map[string]bool)
+	for i, err := range errs {
+		rule := e.rules[e.patternRules[i]]
+		if err == nil || skipped[rule.ID] {
 			continue
 		}
-		e.goRegexPatterns[i] = compiled
+		skipped[rule.ID] = true
+		e.warnings = append(e.warnings, CompileWarning{
+			RuleID:   rule.ID,
+			RuleName: rule.Name,
+			Engine:   e.Name(),
+			Err:      fmt.Errorf("failed to compile pattern %s: %w", redactSecrets(rulePatterns[i]), redactedError{err}),
+		})
 	}
 
-	// Create hyperscan patterns for all rules
-	patterns := make([]*hyperscan.Pattern, len(rules))
-	for i, rule := range rules {
+	if len(skipped) > 0 {
+		if len(skipped) == len(e.rules) {
+			i := slices.IndexFunc(errs, func(err error) bool { return err != nil })
+			rule := e.rules[e.patternRules[i]]
+			return fmt.Errorf("failed to compile pattern for rule '%s' (pattern: %s): %w",
+				rule.Name, redactSecrets(rulePatterns[i]), redactedError{errs[i]})
+		}
+
+		compiled := slices.DeleteFunc(EnabledRules(rules), func(rule Rule) bool { return skipped[rule.ID] })
+		if rulePatterns, err = e.prepareRules(compiled); err != nil {
+			return err
+		}
+		patterns = e.newPatterns(rulePatterns)
+	}
+
+	// Compile all patterns into a single database
+	database, err := hyperscan.NewBlockDatabase(patterns...)
+	if err != nil {
+		return fmt.Errorf("failed to compile hyperscan patterns: %w", redactedError{err})
+	}
+
+	return e.useDatabase(database)
+}
+
+// newPatterns creates the Hyperscan patterns for rule patterns, with IDs in
+// the order of the patterns
+func (e *HyperscanEngine) newPatterns(rulePatterns []string) []*hyperscan.Pattern {
+	patterns := make([]*hyperscan.Pattern, len(rulePatterns))
+	for i, pattern := range rulePatterns {
 		// Pattern compilation flags:
 		//
 		// `Caseless`
@@ -77,9 +193,9 @@ func (e *HyperscanEngine) CompileRules(rules []Rule) error {
 		// newline characters by default, so without this flag the . token will not cross line
 		// boundaries.
 		//
-		// Currently enabled. However, we do not currently care about newlines, as we are
-		// processing lines at a time. This doesn't have any effect not, but we will likely want
-		// it enabled if/when we start processing raw content.
+		// Currently enabled. Lines are scanned without their newline, so this only matters when
+		// scanning whole files, where it lets patterns such as PEM blocks span lines. The Go
+		// regex engine compiles patterns with (?s) to match.
 		//
 		//
 		// `SomLeftMost`
@@ -87,7 +203,8 @@ func (e *HyperscanEngine) CompileRules(rules []Rule) error {
 		// when a match is reported for this expression. (By default, no start of match is
 		// returned.)
 		//
-		// Currently not enabled. Cannot be used with `SingleMatch`.
+		// Enabled instead of `SingleMatch` by NewHyperscanSOMEngine. Cannot be used with
+		// `SingleMatch`.
 		//
 		//
 		// `SingleMatch`
@@ -98,26 +215,93 @@ func (e *HyperscanEngine) CompileRules(rules []Rule) error {
 		// will be returned.
 		//
 		// Currently enabled. Some patterns can cause multiple matches, exploding the results. For
-		// now, we only want one match per pattern.
+		// now, we only want one match per pattern. With `SomLeftMost`, matches are reduced to
+		// their distinct starts instead, see somMatches.
 		//
-		patterns[i] = hyperscan.NewPattern(rule.Pattern, hyperscan.DotAll|hyperscan.SingleMatch)
+		flags := hyperscan.DotAll | hyperscan.SingleMatch
+		if e.somLeftMost {
+			flags = hyperscan.DotAll | hyperscan.SomLeftMost
+		}
+		patterns[i] = hyperscan.NewPattern(pattern, flags)
 		patterns[i].Id = int(i)
 	}
+	return patterns
+}
 
-	// Test each pattern individually first to identify rules that fail to compile
-	for i, pattern := range patterns {
-		rule := rules[i]
-		_, err := hyperscan.NewBlockDatabase(pattern)
+// prepareRules sets up the engine's rules and the Go regex used alongside
+// the Hyperscan database, skipping disabled rules. It returns every rule
+// pattern in the order of their Hyperscan pattern IDs.
+func (e *HyperscanEngine) prepareRules(rules []Rule) ([]string, error) {
+	rules = EnabledRules(rules)
+
+	e.rules = make([]RuntimeRule, len(rules))
+	for i, rule := range rules {
+		if err := checkRuleType(rule); err != nil {
+			return nil, err
+		}
+		if err := checkAllowlist(rule); err != nil {
+			return nil, err
+		}
+		if err := checkValidator(rule); err != nil {
+			return nil, err
+		}
+		e.rules[i] = rule.ToRuntimeRule()
+	}
+
+	// Each of a rule's patterns is compiled separately and mapped back to the rule
+	e.patternRules = nil
+	e.multiPattern = false
+	var rulePatterns []string
+	for i := range e.rules {
+		for _, pattern := range e.rules[i].Patterns {
+			e.patternRules = append(e.patternRules, i)
+			rulePatterns = append(rulePatterns, pattern)
+		}
+		e.multiPattern = e.multiPattern || len(e.rules[i].Patterns) > 1
+	}
+
+	// Pre-compile Go regex patterns for quickMatch refinement, and for
+	// matching when no scratch space can be allocated
+	e.goRegexPatterns = make([]*regexp.Regexp, len(rulePatterns))
+	e.captureGroups = make([]int, len(rulePatterns))
+	for i, pattern := range rulePatterns {
+		e.captureGroups[i] = -1
+
+		compiled, err := regexp.Compile("(?s)" + NormalizeExtendedRegex(pattern))
 		if err != nil {
-			return fmt.Errorf("failed to compile pattern for rule '%s' (pattern: %s): %w",
-				rule.Name, rule.Pattern, err)
+			e.goRegexPatterns[i] = nil // Graceful fallback - Hyperscan may still work
+			continue
+		}
+		e.goRegexPatterns[i] = compiled
+
+		rule := e.rules[e.patternRules[i]]
+		if e.captureGroups[i], err = captureGroupIndex(compiled, rule.CaptureGroup); err != nil {
+			return nil, fmt.Errorf("rule '%s' has invalid capture group: %w", rule.Name, err)
 		}
 	}
 
-	// Compile all patterns into a single database
-	database, err := hyperscan.NewBlockDatabase(patterns...)
+	// With SomLeftMost, matches are found from the starts Hyperscan reports
+	e.anchoredRegexes = nil
+	if e.somLeftMost {
+		e.anchoredRegexes = make([]*regexp.Regexp, len(rulePatterns))
+		for i, pattern := range rulePatterns {
+			// Graceful fallback to the Hyperscan match if compilation fails
+			e.anchoredRegexes[i], _ = compileAnchored(pattern)
+		}
+	}
+
+	return rulePatterns, nil
+}
+
+// useDatabase makes the engine scan with database, allocating its scratch
+// space
+func (e *HyperscanEngine) useDatabase(database hyperscan.BlockDatabase) error {
+	// Allocate scratch space up front, so a failure is reported here instead of
+	// every scan finding nothing
+	scratch, err := newScratch(database)
 	if err != nil {
-		return fmt.Errorf("failed to compile hyperscan patterns: %w", err)
+		database.Close()
+		return fmt.Errorf("failed to allocate hyperscan scratch space: %w", err)
 	}
 
 	e.database = database
@@ -125,13 +309,14 @@ func (e *HyperscanEngine) CompileRules(rules []Rule) error {
 	// Initialize scratch pool
 	e.scratchPool = sync.Pool{
 		New: func() any {
-			scratch, err := hyperscan.NewManagedScratch(database)
+			scratch, err := newScratch(database)
 			if err != nil {
 				return nil
 			}
 			return scratch
 		},
 	}
+	e.scratchPool.Put(scratch)
 
 	return nil
 }
@@ -142,27 +327,33 @@ func (e *HyperscanEngine) FindAllInLine(line string) []MatchResult {
 		return nil
 	}
 
-	// Get scratch space from pool
-	scratchInterface := e.scratchPool.Get()
-	if scratchInterface == nil {
-		return nil
+	// Get scratch space from pool, falling back to Go regex if none can be
+	// allocated rather than missing matches
+	scratch, ok := e.scratchPool.Get().(*hyperscan.Scratch)
+	if !ok {
+		return e.findAllWithGoRegex(line)
 	}
-	scratch := scratchInterface.(*hyperscan.Scratch)
 	defer e.scratchPool.Put(scratch)
 
 	var results []MatchResult
+	var hits []somHit
 
 	// Scan the line
 	err := e.database.Scan([]byte(line), scratch, func(id uint, from, to uint64, flags uint, data any) error {
+		if e.somLeftMost {
+			hits = append(hits, somHit{id: id, from: from, to: to})
+			return nil
+		}
+
 		match := line[from:to]
 
 		// Use the pattern ID to identify which rule matched
-		rule := e.rules[id]
+		rule := e.rules[e.patternRules[id]]
 
 		// We don't get the beginning of the match (SOM) from Hyperscan when using
 		// `SingleMatch`, which is mutually exclusive with `SomLeftMost`. So we use our
 		// own quick match to refine the line match down to an exact `from` and `to`.
-		matches := quickMatchWithRegex(line, e.goRegexPatterns[id])
+		matches := quickMatchWithRegex(line, e.goRegexPatterns[id], e.captureGroups[id])
 		if len(matches) > 0 {
 			from = matches[0]
 			to = matches[1]
@@ -171,37 +362,9 @@ func (e *HyperscanEngine) FindAllInLine(line string) []MatchResult {
 			match = line[from:to]
 		}
 
-		// Always redact the match - never show raw secrets
-		var redacted string
-		if len(rule.Redact) > 0 &&
-			rule.Redact[0] > 0 &&
-			rule.Redact[1] > 0 &&
-			len(match) > rule.Redact[0]+rule.Redact[1] {
-			// Use rule-specific redaction offsets
-			redacted = match[:rule.Redact[0]] + strings.Repeat("*", min(5, len(match))) + match[len(match)-rule.Redact[1]:]
-		} else if len(match) > 8 {
-			// Fallback: show first 4 and last 4 chars
-			redacted = match[:4] + strings.Repeat("*", min(5, len(match)-8)) + match[len(match)-4:]
-		} else {
-			// Very short match: fully redact
-			redacted = strings.Repeat("*", len(match))
-		}
-
-		// Calculate entropy and check if it meets the minimum requirement
-		entropy := ShannonEntropy(match)
-		entropyMet := entropy >= rule.Entropy
-
-		results = append(results, MatchResult{
-			Start:                   int(from),
-			End:                     int(to),
-			Match:                   match,
-			Redacted:                redacted,
-			RuleName:                rule.Name,
-			RuleID:                  rule.ID,
-			Entropy:                 entropy,
-			RuleEntropyThreshold:    rule.Entropy,
-			RuleEntropyThresholdMet: entropyMet,
-		})
+		if result, ok := newMatchResult(rule, match, int(from), int(to)); ok {
+			results = append(results, result)
+		}
 
 		return nil
 	}, nil)
@@ -209,6 +372,14 @@ func (e *HyperscanEngine) FindAllInLine(line string) []MatchResult {
 		return nil
 	}
 
+	if e.somLeftMost {
+		results = e.somMatches(line, hits)
+	}
+
+	if e.multiPattern {
+		results = dedupeMatches(results)
+	}
+
 	return results
 }
 
@@ -218,61 +389,190 @@ func (e *HyperscanEngine) FindAllInContent(content []byte) []MatchResult {
 		return nil
 	}
 
-	// Get scratch space from pool
-	scratchInterface := e.scratchPool.Get()
-	if scratchInterface == nil {
-		return nil
+	// Get scratch space from pool, falling back to Go regex if none can be
+	// allocated rather than missing matches
+	scratch, ok := e.scratchPool.Get().(*hyperscan.Scratch)
+	if !ok {
+		return e.findAllWithGoRegex(string(content))
 	}
-	scratch := scratchInterface.(*hyperscan.Scratch)
 	defer e.scratchPool.Put(scratch)
 
 	var results []MatchResult
+	var hits []somHit
 
 	// Scan the content
 	err := e.database.Scan(content, scratch, func(id uint, from, to uint64, flags uint, data any) error {
-		match := string(content[from:to])
-
-		// Use the pattern ID to identify which rule matched
-		rule := e.rules[id]
-
-		// Always redact the match - never show raw secrets
-		var redacted string
-		if len(rule.Redact) > 0 &&
-			rule.Redact[0] > 0 &&
-			rule.Redact[1] > 0 &&
-			len(match) > rule.Redact[0]+rule.Redact[1] {
-			// Use rule-specific redaction offsets
-			redacted = match[:rule.Redact[0]] + strings.Repeat("*", min(5, len(match))) + match[len(match)-rule.Redact[1]:]
-		} else if len(match) > 8 {
-			// Fallback: show first 4 and last 4 chars
-			redacted = match[:4] + strings.Repeat("*", min(5, len(match)-8)) + match[len(match)-4:]
-		} else {
-			// Very short match: fully redact
-			redacted = strings.Repeat("*", len(match))
-		}
-
-		// Calculate entropy and check if it meets the minimum requirement
-		entropy := ShannonEntropy(match)
-		entropyMet := entropy >= rule.Entropy
-
-		results = append(results, MatchResult{
-			Start:                   int(from),
-			End:                     int(to),
-			Match:                   match,
-			Redacted:                redacted,
-			RuleName:                rule.Name,
-			RuleID:                  rule.ID,
-			Entropy:                 entropy,
-			RuleEntropyThreshold:    rule.Entropy,
-			RuleEntropyThresholdMet: entropyMet,
-		})
-
+		hits = append(hits, somHit{id: id, from: from, to: to})
 		return nil
 	}, nil)
 	if err != nil {
 		return nil
 	}
 
+	if e.somLeftMost {
+		results = e.somMatches(string(content), hits)
+	} else {
+		results = e.contentMatches(content, hits)
+	}
+
+	if e.multiPattern {
+		results = dedupeMatches(results)
+	}
+
+	return results
+}
+
+// patternErrors compiles each pattern into its own database in parallel,
+// returning the error compiling each pattern, or nil if it compiles. Errors are
+// in pattern order, so the rules reported don't depend on which worker
+// finishes first.
+func patternErrors(patterns []*hyperscan.Pattern) []error {
+	errs := make([]error, len(patterns))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(runtime.NumCPU(), len(patterns)) {
+		wg.Go(func() {
+			for i := range jobs {
+				database, err := hyperscan.NewBlockDatabase(patterns[i])
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				database.Close()
+			}
+		})
+	}
+
+	for i := range patterns {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return errs
+}
+
+// findAllWithGoRegex finds all matches in text with the Go regex patterns
+// used for refinement, for when Hyperscan can't scan. Patterns that don't
+// compile as Go regex are skipped.
+func (e *HyperscanEngine) findAllWithGoRegex(text string) []MatchResult {
+	var results []MatchResult
+
+	for i, pattern := range e.goRegexPatterns {
+		if pattern == nil {
+			continue
+		}
+		for _, loc := range pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := secretSpan(loc, e.captureGroups[i])
+			if result, ok := newMatchResult(e.rules[e.patternRules[i]], text[start:end], start, end); ok {
+				results = append(results, result)
+			}
+		}
+	}
+
+	if e.multiPattern {
+		results = dedupeMatches(results)
+	}
+
+	return results
+}
+
+// compileAnchored compiles a rule pattern as Go regex that only matches at
+// the start of text, with . matching newlines as with the Go regex engine
+func compileAnchored(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`(?s)^(?:` + NormalizeExtendedRegex(pattern) + `)`)
+}
+
+// somHit is a match reported by Hyperscan. Without SomLeftMost, from is
+// always 0.
+type somHit struct {
+	id       uint
+	from, to uint64
+}
+
+// contentMatches expands the matches Hyperscan reports with SingleMatch, at
+// most one per pattern and without a start, to every match the Go regex
+// engine finds in content for the patterns that matched. Patterns that don't
+// compile as Go regex keep the span Hyperscan reported.
+func (e *HyperscanEngine) contentMatches(content []byte, hits []somHit) []MatchResult {
+	slices.SortFunc(hits, func(a, b somHit) int {
+		return cmp.Compare(a.id, b.id)
+	})
+
+	var results []MatchResult
+	for i, hit := range hits {
+		if i > 0 && hits[i-1].id == hit.id {
+			continue
+		}
+		rule := e.rules[e.patternRules[hit.id]]
+
+		re := e.goRegexPatterns[hit.id]
+		if re == nil {
+			from, to := int(hit.from), int(hit.to)
+			if result, ok := newMatchResult(rule, string(content[from:to]), from, to); ok {
+				results = append(results, result)
+			}
+			continue
+		}
+
+		for _, loc := range re.FindAllSubmatchIndex(content, -1) {
+			start, end := secretSpan(loc, e.captureGroups[hit.id])
+			if result, ok := newMatchResult(rule, string(content[start:end]), start, end); ok {
+				results = append(results, result)
+			}
+		}
+	}
+
+	return results
+}
+
+// somMatches reduces the matches Hyperscan reports with SomLeftMost, one for
+// every end offset of every match, to the matches the Go regex engine finds.
+// For each pattern, the leftmost start that doesn't overlap the previous
+// match is matched with the anchored Go regex to find its end and secret
+// span, so offsets are the same as with the Go regex engine.
+func (e *HyperscanEngine) somMatches(text string, hits []somHit) []MatchResult {
+	// Hits are reported in order of their end, so order them by pattern and
+	// start, longest first
+	slices.SortFunc(hits, func(a, b somHit) int {
+		return cmp.Or(cmp.Compare(a.id, b.id), cmp.Compare(a.from, b.from), cmp.Compare(b.to, a.to))
+	})
+
+	var results []MatchResult
+	prevID, prevEnd := -1, 0
+	for _, hit := range hits {
+		if int(hit.id) != prevID {
+			prevID, prevEnd = int(hit.id), 0
+		}
+
+		// Skip repeated starts and starts within the previous match
+		from := int(hit.from)
+		if from < prevEnd {
+			continue
+		}
+
+		start, end, matchEnd := from, int(hit.to), int(hit.to)
+		if re := e.anchoredRegexes[hit.id]; re != nil {
+			loc := re.FindStringSubmatchIndex(text[from:])
+			if loc == nil {
+				continue
+			}
+			for i := range loc {
+				if loc[i] >= 0 {
+					loc[i] += from
+				}
+			}
+			start, end = secretSpan(loc, e.captureGroups[hit.id])
+			matchEnd = loc[1]
+		}
+		prevEnd = max(matchEnd, from+1)
+
+		if result, ok := newMatchResult(e.rules[e.patternRules[hit.id]], text[start:end], start, end); ok {
+			results = append(results, result)
+		}
+	}
+
 	return results
 }
 
@@ -286,13 +586,31 @@ func (e *HyperscanEngine) Close() error {
 
 // Name returns the engine name
 func (e *HyperscanEngine) Name() string {
+	if e.somLeftMost {
+		return "Hyperscan/Vectorscan (SOM)"
+	}
 	return "Hyperscan/Vectorscan"
 }
 
+// Rules returns the rules compiled into the engine
+func (e *HyperscanEngine) Rules() []RuntimeRule {
+	return slices.Clone(e.rules)
+}
+
+// Warnings returns the rules skipped by the last CompileRules
+func (e *HyperscanEngine) Warnings() []CompileWarning {
+	return slices.Clone(e.warnings)
+}
+
 // GoRegexEngine implements PatternEngine using Go's built-in regex
 type GoRegexEngine struct {
-	rules    []RuntimeRule
-	patterns []*regexp.Regexp
+	rules         []RuntimeRule
+	patterns      []*regexp.Regexp
+	patternRules  []int // Index into rules of the rule each pattern belongs to
+	captureGroups []int // Index of the capture group holding the secret, per pattern, or -1 for the default
+	multiPattern  bool  // Whether any rule has more than one pattern
+	prefilter     *prefilter
+	warnings      []CompileWarning // Rules skipped by the last CompileRules
 }
 
 // NewGoRegexEngine creates a new Go regex engine
@@ -300,23 +618,74 @@ func NewGoRegexEngine() *GoRegexEngine {
 	return &GoRegexEngine{}
 }
 
-// CompileRules compiles multiple rules for Go regex
+// CompileRules compiles multiple rules for Go regex, skipping disabled rules.
+// Rules with a pattern Go regex can't compile are skipped and reported by
+// Warnings, unless none of the rules compile.
 func (e *GoRegexEngine) CompileRules(rules []Rule) error {
+	rules = EnabledRules(rules)
+	e.warnings = nil
+
 	// Convert to RuntimeRules for memory efficiency
 	e.rules = make([]RuntimeRule, len(rules))
 	for i, rule := range rules {
+		if err := checkRuleType(rule); err != nil {
+			return err
+		}
+		if err := checkAllowlist(rule); err != nil {
+			return err
+		}
+		if err := checkValidator(rule); err != nil {
+			return err
+		}
 		e.rules[i] = rule.ToRuntimeRule()
 	}
-	e.patterns = make([]*regexp.Regexp, len(rules))
 
-	for i, rule := range rules {
-		pattern := NormalizeExtendedRegex(rule.Pattern)
-		compiled, err := regexp.Compile(pattern)
+	// Each of a rule's patterns is compiled separately and mapped back to the
+	// rule. Patterns are compiled with (?s) so . matches newlines when scanning
+	// whole files, as with Hyperscan's DotAll flag.
+	e.patterns = nil
+	e.patternRules = nil
+	e.captureGroups = nil
+	e.multiPattern = false
+	var rulePatterns []string
+	var firstErr error
+	compiledRules := e.rules[:0]
+	for _, rule := range e.rules {
+		patterns := make([]*regexp.Regexp, len(rule.Patterns))
+		groups := make([]int, len(rule.Patterns))
+		var err error
+		for j, pattern := range rule.Patterns {
+			if patterns[j], err = regexp.Compile("(?s)" + NormalizeExtendedRegex(pattern)); err != nil {
+				break
+			}
+			if groups[j], err = captureGroupIndex(patterns[j], rule.CaptureGroup); err != nil {
+				return fmt.Errorf("rule '%s' has invalid capture group: %w", rule.Name, err)
+			}
+		}
 		if err != nil {
-			return fmt.Errorf("failed to compile rule '%s': %w", rule.Name, err)
+			err = fmt.Errorf("failed to compile rule '%s': %w", rule.Name, redactedError{err})
+			firstErr = cmp.Or(firstErr, err)
+			e.warnings = append(e.warnings, CompileWarning{RuleID: rule.ID, RuleName: rule.Name, Engine: e.Name(), Err: err})
+			continue
+		}
+
+		for range patterns {
+			e.patternRules = append(e.patternRules, len(compiledRules))
 		}
-		e.patterns[i] = compiled
+		e.patterns = append(e.patterns, patterns...)
+		e.captureGroups = append(e.captureGroups, groups...)
+		rulePatterns = append(rulePatterns, rule.Patterns...)
+		e.multiPattern = e.multiPattern || len(rule.Patterns) > 1
+		compiledRules = append(compiledRules, rule)
 	}
+	e.rules = compiledRules
+
+	if len(e.rules) == 0 && firstErr != nil {
+		return firstErr
+	}
+
+	// Patterns are only run on text containing one of their required literals
+	e.prefilter = newPrefilter(rulePatterns)
 
 	return nil
 }
@@ -325,44 +694,29 @@ func (e *GoRegexEngine) CompileRules(rules []Rule) error {
 func (e *GoRegexEngine) FindAllInLine(line string) []MatchResult {
 	var results []MatchResult
 
-	for i, pattern := range e.patterns {
-		matches := pattern.FindAllString(line, -1)
-
-		for _, match := range matches {
-			// Always redact the match - never show raw secrets
-			var redacted string
-			if len(e.rules[i].Redact) > 0 &&
-				e.rules[i].Redact[0] > 0 &&
-				e.rules[i].Redact[1] > 0 &&
-				len(match) > e.rules[i].Redact[0]+e.rules[i].Redact[1] {
-				// Use rule-specific redaction offsets
-				redacted = match[:e.rules[i].Redact[0]] + strings.Repeat("*", min(5, len(match))) + match[len(match)-e.rules[i].Redact[1]:]
-			} else if len(match) > 8 {
-				// Fallback: show first 4 and last 4 chars
-				redacted = match[:4] + strings.Repeat("*", min(5, len(match)-8)) + match[len(match)-4:]
-			} else {
-				// Very short match: fully redact
-				redacted = strings.Repeat("*", len(match))
-			}
+	var candidates []bool
+	if e.prefilter != nil {
+		candidates = prefilterCandidates(e.prefilter, line)
+	}
 
-			// Calculate entropy and check if it meets the minimum requirement
-			entropy := ShannonEntropy(match)
-			entropyMet := entropy >= e.rules[i].Entropy
+	for i, pattern := range e.patterns {
+		if candidates != nil && !candidates[i] {
+			continue
+		}
+		matches := pattern.FindAllStringSubmatchIndex(line, -1)
 
-			results = append(results, MatchResult{
-				Start:                   0,
-				End:                     0,
-				Match:                   match,
-				Redacted:                redacted,
-				RuleName:                e.rules[i].Name,
-				RuleID:                  e.rules[i].ID,
-				Entropy:                 entropy,
-				RuleEntropyThreshold:    e.rules[i].Entropy,
-				RuleEntropyThresholdMet: entropyMet,
-			})
+		for _, loc := range matches {
+			start, end := secretSpan(loc, e.captureGroups[i])
+			if result, ok := newMatchResult(e.rules[e.patternRules[i]], line[start:end], start, end); ok {
+				results = append(results, result)
+			}
 		}
 	}
 
+	if e.multiPattern {
+		results = dedupeMatches(results)
+	}
+
 	return results
 }
 
@@ -370,45 +724,29 @@ func (e *GoRegexEngine) FindAllInLine(line string) []MatchResult {
 func (e *GoRegexEngine) FindAllInContent(content []byte) []MatchResult {
 	var results []MatchResult
 
+	var candidates []bool
+	if e.prefilter != nil {
+		candidates = prefilterCandidates(e.prefilter, content)
+	}
+
 	for i, pattern := range e.patterns {
-		matches := pattern.FindAllIndex(content, -1)
-		for _, match := range matches {
-			matchText := string(content[match[0]:match[1]])
-
-			// Always redact the match - never show raw secrets
-			var redacted string
-			if len(e.rules[i].Redact) > 0 &&
-				e.rules[i].Redact[0] > 0 &&
-				e.rules[i].Redact[1] > 0 &&
-				len(matchText) > e.rules[i].Redact[0]+e.rules[i].Redact[1] {
-				// Use rule-specific redaction offsets
-				redacted = matchText[:e.rules[i].Redact[0]] + strings.Repeat("*", min(5, len(matchText))) + matchText[len(matchText)-e.rules[i].Redact[1]:]
-			} else if len(matchText) > 8 {
-				// Fallback: show first 4 and last 4 chars
-				redacted = matchText[:4] + strings.Repeat("*", min(5, len(matchText)-8)) + matchText[len(matchText)-4:]
-			} else {
-				// Very short match: fully redact
-				redacted = strings.Repeat("*", len(matchText))
+		if candidates != nil && !candidates[i] {
+			continue
+		}
+		matches := pattern.FindAllSubmatchIndex(content, -1)
+		for _, loc := range matches {
+			start, end := secretSpan(loc, e.captureGroups[i])
+			matchText := string(content[start:end])
+			if result, ok := newMatchResult(e.rules[e.patternRules[i]], matchText, start, end); ok {
+				results = append(results, result)
 			}
-
-			// Calculate entropy and check if it meets the minimum requirement
-			entropy := ShannonEntropy(matchText)
-			entropyMet := entropy >= e.rules[i].Entropy
-
-			results = append(results, MatchResult{
-				Start:                   match[0],
-				End:                     match[1],
-				Match:                   matchText,
-				Redacted:                redacted,
-				RuleName:                e.rules[i].Name,
-				RuleID:                  e.rules[i].ID,
-				Entropy:                 entropy,
-				RuleEntropyThreshold:    e.rules[i].Entropy,
-				RuleEntropyThresholdMet: entropyMet,
-			})
 		}
 	}
 
+	if e.multiPattern {
+		results = dedupeMatches(results)
+	}
+
 	return results
 }
 
@@ -422,27 +760,136 @@ func (e *GoRegexEngine) Name() string {
 	return "Go Regex"
 }
 
+// Rules returns the rules compiled into the engine
+func (e *GoRegexEngine) Rules() []RuntimeRule {
+	return slices.Clone(e.rules)
+}
+
+// Warnings returns the rules skipped by the last CompileRules
+func (e *GoRegexEngine) Warnings() []CompileWarning {
+	return slices.Clone(e.warnings)
+}
+
+// newMatchResult builds the result for a rule match at [start, end), applying
+// the rule's type-specific processing, allowlist, redaction, and entropy
+// check. It returns false if processing or the allowlist discards the match.
+func newMatchResult(rule RuntimeRule, match string, start, end int) (MatchResult, bool) {
+	match, start, end, ok := processMatch(rule, match, start, end)
+	if !ok || allowlisted(rule, match) {
+		return MatchResult{}, false
+	}
+
+	// Always redact the match - never show raw secrets
+	var mask Mask
+	if rule.Mask != nil {
+		mask = *rule.Mask
+	}
+	redacted := redactMatch(match, rule.Redact, mask)
+
+	// Calculate entropy and check if it meets the minimum requirement
+	entropy := ShannonEntropy(match)
+	entropyMet := entropy >= rule.Entropy
+
+	// Matches that meet the threshold must also pass the rule's validator
+	if entropyMet && rule.Validator != nil && !rule.Validator(match) {
+		return MatchResult{}, false
+	}
+
+	return MatchResult{
+		Start:                   start,
+		End:                     end,
+		Match:                   match,
+		Redacted:                redacted,
+		RuleName:                rule.Name,
+		RuleID:                  rule.ID,
+		Severity:                rule.Severity,
+		Priority:                rule.Priority,
+		Entropy:                 entropy,
+		RuleEntropyThreshold:    rule.Entropy,
+		RuleEntropyThresholdMet: entropyMet,
+		redact:                  rule.Redact,
+		ruleMask:                rule.Mask != nil,
+	}, true
+}
+
+// dedupeMatches removes repeated matches of a rule at the same position,
+// which occur when several of the rule's patterns match the same text
+func dedupeMatches(results []MatchResult) []MatchResult {
+	type matchKey struct {
+		ruleID     string
+		start, end int
+	}
+
+	seen := make(map[matchKey]bool, len(results))
+	deduped := results[:0]
+	for _, result := range results {
+		key := matchKey{result.RuleID, result.Start, result.End}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, result)
+	}
+	return deduped
+}
+
+// secretSpan returns the span of the secret within a regex match, given the
+// match's submatch index pairs. The secret is the given capture group, if it
+// is not negative and participated in the match. Otherwise it is the last
+// capture group that participated in the match, or the whole match if there
+// is none, so prefix keywords outside the group don't affect entropy or
+// redaction.
+func secretSpan(loc []int, group int) (int, int) {
+	if group >= 0 && 2*group+1 < len(loc) && loc[2*group] >= 0 {
+		return loc[2*group], loc[2*group+1]
+	}
+
+	for i := len(loc) - 2; i >= 2; i -= 2 {
+		if loc[i] >= 0 {
+			return loc[i], loc[i+1]
+		}
+	}
+	return loc[0], loc[1]
+}
+
+// captureGroupIndex resolves a rule's capture group, a name or an index, to
+// the index of the group in re. It returns -1 if group is empty.
+func captureGroupIndex(re *regexp.Regexp, group string) (int, error) {
+	if group == "" {
+		return -1, nil
+	}
+
+	if index, err := strconv.Atoi(group); err == nil {
+		if index < 0 || index > re.NumSubexp() {
+			return 0, fmt.Errorf("capture group %d out of range, pattern has %d groups", index, re.NumSubexp())
+		}
+		return index, nil
+	}
+
+	if index := re.SubexpIndex(group); index >= 0 {
+		return index, nil
+	}
+	return 0, fmt.Errorf("no capture group named '%s'", group)
+}
+
 // quickMatchWithRegex refines a match with the exact location using a pre-compiled regex.
-// If there are multiple capture groups, we return the index of the last one.
+// The location of the secret span within the capture group is returned, see secretSpan.
 // Returns nil if refinement fails, so the original Hyperscan match is preserved.
-func quickMatchWithRegex(line string, re *regexp.Regexp) []uint64 {
+func quickMatchWithRegex(line string, re *regexp.Regexp, group int) []uint64 {
 	// If regex is nil (compilation failed), return nil to keep original match
 	if re == nil {
 		return nil
 	}
 
-	// Get the capture groups
-	cg := re.FindStringSubmatch(line)
+	// Get the capture group locations
+	loc := re.FindStringSubmatchIndex(line)
 
 	// No match found, return nil to keep original match
-	if len(cg) == 0 {
+	if loc == nil {
 		return nil
 	}
 
-	// Get the index of the last capture group
-	lastMatch := cg[len(cg)-1]
-	lastMatchIndex := strings.LastIndex(line, lastMatch)
-	lastMatchEnd := lastMatchIndex + len(lastMatch)
+	start, end := secretSpan(loc, group)
 
-	return []uint64{uint64(lastMatchIndex), uint64(lastMatchEnd)}
+	return []uint64{uint64(start), uint64(end)}
 }
@@ -1,8 +1,16 @@
 package poltergeist
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/flier/gohs/hyperscan"
 )
 
 func TestEngineCompilationErrors(t *testing.T) {
@@ -25,6 +33,12 @@ func TestEngineCompilationErrors(t *testing.T) {
 		t.Error("Expected Go regex engine to fail with invalid pattern")
 	}
 
+	// The redacted error still wraps the compiler's error
+	var syntaxErr *syntax.Error
+	if !errors.As(err, &syntaxErr) || syntaxErr.Code != syntax.ErrMissingBracket {
+		t.Errorf("Expected the error to wrap a *syntax.Error, got %v", err)
+	}
+
 	// Test Hyperscan engine with invalid pattern (if available)
 	if IsHyperscanAvailable() {
 		hsEngine := NewHyperscanEngine()
@@ -34,6 +48,11 @@ func TestEngineCompilationErrors(t *testing.T) {
 		if err == nil {
 			t.Error("Expected Hyperscan engine to fail with invalid pattern")
 		}
+
+		var compileErr *hyperscan.CompileError
+		if !errors.As(err, &compileErr) {
+			t.Errorf("Expected the error to wrap a *hyperscan.CompileError, got %v", err)
+		}
 	}
 }
 
@@ -124,6 +143,171 @@ func TestEngineRedactionAlwaysRedacts(t *testing.T) {
 	}
 }
 
+func TestEngineSecretCaptureGroup(t *testing.T) {
+	rules := []Rule{
+		{
+			Name: "Secret Key",
+			ID:   "test.secret_key",
+			Pattern: `(?x)
+				secret_key
+				[\s"'=:]{1,5}
+				([a-zA-Z0-9]{20})`,
+			Redact:  []int{2, 2},
+			Entropy: 4.0,
+		},
+		{
+			Name:    "Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-zA-Z0-9]{16}`,
+		},
+	}
+
+	engine := NewGoRegexEngine()
+	defer engine.Close()
+	if err := engine.CompileRules(rules); err != nil {
+		t.Fatalf("CompileRules failed: %v", err)
+	}
+
+	secret := "Zk8qW2vB7xN4mP9sL3tR"
+	input := `secret_key="` + secret + `" tok_aZ3kQ9xLm2Pw7vRt`
+
+	for name, results := range map[string][]MatchResult{
+		"FindAllInLine":    engine.FindAllInLine(input),
+		"FindAllInContent": engine.FindAllInContent([]byte(input)),
+	} {
+		if len(results) != 2 {
+			t.Fatalf("%s: expected 2 matches, got %d", name, len(results))
+		}
+
+		// Only the capture group is the secret; the keyword prefix would
+		// otherwise lower the entropy below the threshold
+		result := results[0]
+		if result.Match != secret || input[result.Start:result.End] != secret {
+			t.Errorf("%s: expected match %q, got %q at [%d, %d)", name, secret, result.Match, result.Start, result.End)
+		}
+		if result.Entropy != ShannonEntropy(secret) || !result.RuleEntropyThresholdMet {
+			t.Errorf("%s: expected entropy %.2f of the token only, got %.2f", name, ShannonEntropy(secret), result.Entropy)
+		}
+		if result.Redacted != "Zk*****tR" {
+			t.Errorf("%s: expected redaction offsets to apply to the token, got %q", name, result.Redacted)
+		}
+
+		// Without a capture group the whole match is the secret
+		if results[1].Match != "tok_aZ3kQ9xLm2Pw7vRt" {
+			t.Errorf("%s: expected the whole match without a capture group, got %q", name, results[1].Match)
+		}
+	}
+}
+
+func TestMultiplePatterns(t *testing.T) {
+	rules := []Rule{
+		{
+			Name:     "Versioned Token",
+			ID:       "test.versioned",
+			Pattern:  `\bold_[a-zA-Z0-9]{16}\b`,
+			Patterns: []string{`\bnew_v2_[a-zA-Z0-9]{20}\b`, `\bnew_v2_[a-zA-Z0-9]{10,}\b`},
+		},
+		{
+			Name:    "Other Token",
+			ID:      "test.other",
+			Pattern: `\bkey_[a-zA-Z0-9]{16}\b`,
+		},
+	}
+
+	engines := []PatternEngine{NewGoRegexEngine()}
+	if IsHyperscanAvailable() {
+		engines = append(engines, NewHyperscanEngine())
+	}
+
+	line := "a=old_aZ3kQ9xLm2Pw7vRt b=new_v2_bB8nM4cV1xZ6qW0eYt2 c=key_cC7mN3bV2xZ5qW9r"
+
+	for _, engine := range engines {
+		defer engine.Close()
+
+		if err := engine.CompileRules(rules); err != nil {
+			t.Fatalf("%s: CompileRules failed: %v", engine.Name(), err)
+		}
+
+		for name, results := range map[string][]MatchResult{
+			"FindAllInLine":    engine.FindAllInLine(line),
+			"FindAllInContent": engine.FindAllInContent([]byte(line)),
+		} {
+			// Hyperscan only reports start offsets when scanning lines
+			if name == "FindAllInContent" && engine.Name() != "Go Regex" {
+				continue
+			}
+
+			got := make(map[string]string)
+			for _, result := range results {
+				if _, dup := got[result.Match]; dup {
+					t.Errorf("%s %s: duplicate match %q", engine.Name(), name, result.Match)
+				}
+				got[result.Match] = result.RuleID
+			}
+
+			want := map[string]string{
+				"old_aZ3kQ9xLm2Pw7vRt":       "test.versioned",
+				"new_v2_bB8nM4cV1xZ6qW0eYt2": "test.versioned",
+				"key_cC7mN3bV2xZ5qW9r":       "test.other",
+			}
+			if len(got) != len(want) {
+				t.Errorf("%s %s: expected %d matches, got %v", engine.Name(), name, len(want), got)
+			}
+			for match, ruleID := range want {
+				if got[match] != ruleID {
+					t.Errorf("%s %s: expected %q to match %s, got %q", engine.Name(), name, match, ruleID, got[match])
+				}
+			}
+		}
+
+		if rules := NewScanner(engine).ActiveRules(); len(rules) != 2 || len(rules[0].Patterns) != 3 {
+			t.Errorf("%s: expected 2 active rules with the versioned rule carrying 3 patterns, got %+v", engine.Name(), rules)
+		}
+	}
+}
+
+func TestDisabledRules(t *testing.T) {
+	disabled := false
+	enabled := true
+	rules := []Rule{
+		{Name: "Default Token", ID: "test.default", Pattern: `tok_[a-zA-Z0-9]{16}`},
+		{Name: "Experimental Token", ID: "test.experimental", Pattern: `exp_[a-zA-Z0-9]{16}`, Enabled: &disabled},
+		{Name: "Enabled Token", ID: "test.enabled", Pattern: `key_[a-zA-Z0-9]{16}`, Enabled: &enabled},
+	}
+
+	engines := []PatternEngine{NewGoRegexEngine()}
+	if IsHyperscanAvailable() {
+		engines = append(engines, NewHyperscanEngine())
+	}
+
+	for _, engine := range engines {
+		defer engine.Close()
+
+		if err := engine.CompileRules(rules); err != nil {
+			t.Fatalf("%s: CompileRules failed: %v", engine.Name(), err)
+		}
+
+		scanner := NewScanner(engine)
+		var active []string
+		for _, rule := range scanner.ActiveRules() {
+			active = append(active, rule.ID)
+		}
+		if strings.Join(active, ",") != "test.default,test.enabled" {
+			t.Errorf("%s: expected active rules [test.default test.enabled], got %v", engine.Name(), active)
+		}
+
+		line := "tok_aZ3kQ9xLm2Pw7vRt exp_bB8nM4cV1xZ6qW0e key_cC7mN3bV2xZ5qW9r"
+		for _, result := range engine.FindAllInLine(line) {
+			if result.RuleID == "test.experimental" {
+				t.Errorf("%s: disabled rule produced a match", engine.Name())
+			}
+		}
+		if got := len(engine.FindAllInLine(line)); got != 2 {
+			t.Errorf("%s: expected 2 matches from enabled rules, got %d", engine.Name(), got)
+		}
+	}
+}
+
 func TestFilterOverlappingGenericMatches(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -207,3 +391,337 @@ func TestFilterOverlappingGenericMatches(t *testing.T) {
 		})
 	}
 }
+
+func TestSOMMatches(t *testing.T) {
+	rule := Rule{Name: "Test Token", ID: "test.token", Pattern: `\b(?:tok|key)_([a-z0-9]{8,})\b`, Redact: []int{0, 0}, Entropy: 1.0}
+	anchored, err := compileAnchored(rule.Pattern)
+	if err != nil {
+		t.Fatalf("compileAnchored failed: %v", err)
+	}
+
+	engine := &HyperscanEngine{
+		somLeftMost:     true,
+		rules:           []RuntimeRule{rule.ToRuntimeRule()},
+		patternRules:    []int{0},
+		captureGroups:   []int{-1},
+		anchoredRegexes: []*regexp.Regexp{anchored},
+	}
+
+	goEngine := NewGoRegexEngine()
+	defer goEngine.Close()
+	if err := goEngine.CompileRules([]Rule{rule}); err != nil {
+		t.Fatalf("CompileRules failed: %v", err)
+	}
+
+	line := "a=tok_abcd1234 b=key_efgh5678ijkl"
+
+	// Hyperscan reports every end of every match in order of the end, with
+	// the leftmost start for each
+	hits := []somHit{
+		{id: 0, from: 2, to: 14},
+		{id: 0, from: 17, to: 29},
+		{id: 0, from: 17, to: 33},
+		{id: 0, from: 21, to: 33}, // Within the previous match
+	}
+
+	got := engine.somMatches(line, hits)
+	want := goEngine.FindAllInLine(line)
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d matches, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i].Start != want[i].Start || got[i].End != want[i].End || got[i].Match != want[i].Match {
+			t.Errorf("Match %d: expected %q at [%d, %d), got %q at [%d, %d)",
+				i, want[i].Match, want[i].Start, want[i].End, got[i].Match, got[i].Start, got[i].End)
+		}
+	}
+}
+
+func TestHyperscanSOMOffsets(t *testing.T) {
+	if !IsHyperscanAvailable() {
+		t.Skip("Hyperscan is not available")
+	}
+
+	rules := []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `\btok_([a-zA-Z0-9]{16})\b`, Redact: []int{0, 0}, Entropy: 1.0},
+		{Name: "Test Key", ID: "test.key", Pattern: `(?i)api[_-]?key\s*=\s*"?([a-z0-9]{20,})`, Redact: []int{0, 0}, Entropy: 1.0},
+		{Name: "Test Block", ID: "test.block", Pattern: `-----BEGIN TEST-----[\s\S]*?-----END TEST-----`, Redact: []int{0, 0}, Entropy: 1.0},
+	}
+
+	goEngine := NewGoRegexEngine()
+	somEngine := NewHyperscanSOMEngine()
+	defer goEngine.Close()
+	defer somEngine.Close()
+
+	for _, engine := range []PatternEngine{goEngine, somEngine} {
+		if err := engine.CompileRules(rules); err != nil {
+			t.Fatalf("%s: CompileRules failed: %v", engine.Name(), err)
+		}
+	}
+
+	inputs := []string{
+		"tok_aZ3kQ9xLm2Pw7vRt",
+		"a=tok_aZ3kQ9xLm2Pw7vRt b=tok_bB8nM4cV1xZ6qW0e",
+		`API_KEY = "abcdefghij0123456789xyz" and api-key=ZZZZZZZZZZZZZZZZZZZZZZ`,
+		"tok_tooshort tok_aZ3kQ9xLm2Pw7vRtX",
+		"header\n-----BEGIN TEST-----\nabc\n-----END TEST-----\nfooter",
+	}
+
+	for _, input := range inputs {
+		for name, find := range map[string]func(PatternEngine) []MatchResult{
+			"FindAllInLine":    func(e PatternEngine) []MatchResult { return e.FindAllInLine(input) },
+			"FindAllInContent": func(e PatternEngine) []MatchResult { return e.FindAllInContent([]byte(input)) },
+		} {
+			want, got := find(goEngine), find(somEngine)
+			if len(got) != len(want) {
+				t.Errorf("%s(%q): expected %d matches, got %d", name, input, len(want), len(got))
+				continue
+			}
+			for i := range want {
+				if got[i].RuleID != want[i].RuleID || got[i].Start != want[i].Start || got[i].End != want[i].End {
+					t.Errorf("%s(%q) match %d: expected %s [%d, %d), got %s [%d, %d)", name, input, i,
+						want[i].RuleID, want[i].Start, want[i].End, got[i].RuleID, got[i].Start, got[i].End)
+				}
+			}
+		}
+	}
+}
+
+func TestCaptureGroup(t *testing.T) {
+	// Without CaptureGroup the trailing comment group would be reported, as
+	// the last group that participated in the match
+	pattern := `(?P<secret>tok_[a-z0-9]{16})(?:\s*#\s*(\w+))?`
+	line := `x = tok_a1b2c3d4e5f6g7h8 # expires`
+	secretStart := strings.Index(line, "tok_")
+	secretEnd := secretStart + len("tok_a1b2c3d4e5f6g7h8")
+
+	tests := []struct {
+		name      string
+		group     string
+		wantMatch string
+	}{
+		{name: "default", group: "", wantMatch: "expires"},
+		{name: "name", group: "secret", wantMatch: "tok_a1b2c3d4e5f6g7h8"},
+		{name: "index", group: "1", wantMatch: "tok_a1b2c3d4e5f6g7h8"},
+		{name: "whole match", group: "0", wantMatch: "tok_a1b2c3d4e5f6g7h8 # expires"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re := regexp.MustCompile(pattern)
+			group, err := captureGroupIndex(re, tt.group)
+			if err != nil {
+				t.Fatalf("captureGroupIndex failed: %v", err)
+			}
+
+			loc := quickMatchWithRegex(line, re, group)
+			if got := line[loc[0]:loc[1]]; got != tt.wantMatch {
+				t.Errorf("quickMatchWithRegex refined to %q, expected %q", got, tt.wantMatch)
+			}
+
+			engine := NewGoRegexEngine()
+			defer engine.Close()
+			if err := engine.CompileRules([]Rule{{Name: "Test", ID: "test.group", Pattern: pattern, CaptureGroup: tt.group, Redact: []int{0, 0}, Entropy: 1.0}}); err != nil {
+				t.Fatalf("CompileRules failed: %v", err)
+			}
+			results := engine.FindAllInLine(line)
+			if len(results) != 1 || results[0].Match != tt.wantMatch {
+				t.Fatalf("Expected match %q, got %+v", tt.wantMatch, results)
+			}
+			if tt.group == "secret" && (results[0].Start != secretStart || results[0].End != secretEnd) {
+				t.Errorf("Expected the named group at [%d, %d), got [%d, %d)", secretStart, secretEnd, results[0].Start, results[0].End)
+			}
+		})
+	}
+
+	// Groups that don't exist fail compilation
+	for _, group := range []string{"missing", "3", "-1"} {
+		engine := NewGoRegexEngine()
+		if err := engine.CompileRules([]Rule{{Name: "Test", ID: "test.group", Pattern: pattern, CaptureGroup: group}}); err == nil {
+			t.Errorf("Expected CompileRules to fail for capture group %q", group)
+		}
+	}
+}
+
+func TestHyperscanScratchAllocationFailure(t *testing.T) {
+	if !IsHyperscanAvailable() {
+		t.Skip("Hyperscan is not available")
+	}
+
+	rules := []Rule{{Name: "Test Token", ID: "test.token", Pattern: `\btok_([a-zA-Z0-9]{16})\b`, Redact: []int{0, 0}, Entropy: 1.0}}
+	line := "a=tok_aZ3kQ9xLm2Pw7vRt"
+
+	// Failing to allocate scratch space fails compilation
+	t.Run("compile", func(t *testing.T) {
+		allocate := newScratch
+		t.Cleanup(func() {
+			newScratch = allocate
+		})
+		newScratch = func(db hyperscan.Database) (*hyperscan.Scratch, error) {
+			return nil, errors.New("out of memory")
+		}
+
+		engine := NewHyperscanEngine()
+		if err := engine.CompileRules(rules); err == nil || !strings.Contains(err.Error(), "scratch") {
+			t.Fatalf("Expected CompileRules to fail allocating scratch space, got %v", err)
+		}
+	})
+
+	// Failing later falls back to Go regex instead of finding nothing
+	hsEngine := NewHyperscanEngine().(*HyperscanEngine)
+	defer hsEngine.Close()
+	if err := hsEngine.CompileRules(rules); err != nil {
+		t.Fatalf("CompileRules failed: %v", err)
+	}
+	hsEngine.scratchPool = sync.Pool{New: func() any { return nil }}
+
+	if results := hsEngine.FindAllInLine(line); len(results) != 1 || results[0].Match != "aZ3kQ9xLm2Pw7vRt" {
+		t.Errorf("FindAllInLine without scratch: expected 1 match, got %+v", results)
+	}
+	if results := hsEngine.FindAllInContent([]byte(line)); len(results) != 1 || results[0].Match != "aZ3kQ9xLm2Pw7vRt" {
+		t.Errorf("FindAllInContent without scratch: expected 1 match, got %+v", results)
+	}
+}
+
+func TestHyperscanCompileErrorNamesRule(t *testing.T) {
+	if !IsHyperscanAvailable() {
+		t.Skip("Hyperscan is not available")
+	}
+
+	var rules []Rule
+	for i := range 200 {
+		rules = append(rules, Rule{
+			Name:    fmt.Sprintf("Token %03d", i),
+			ID:      fmt.Sprintf("test.token.%03d", i),
+			Pattern: fmt.Sprintf(`\btok%03d_([a-zA-Z0-9]{16})\b`, i),
+			Redact:  []int{0, 0},
+			Entropy: 1.0,
+		})
+	}
+
+	tests := []struct {
+		name string
+		bad  []int
+		want []string
+	}{
+		{name: "single bad rule", bad: []int{137}, want: []string{"Token 137"}},
+		{name: "several bad rules", bad: []int{181, 42, 99}, want: []string{"Token 042", "Token 099", "Token 181"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broken := slices.Clone(rules)
+			for _, i := range tt.bad {
+				broken[i].Pattern = `tok_(?<unsupported`
+			}
+
+			engine := NewHyperscanEngine()
+			defer engine.Close()
+
+			// The bad rules are skipped with a warning each, in rule order
+			if err := engine.CompileRules(broken); err != nil {
+				t.Fatalf("CompileRules failed: %v", err)
+			}
+			var names []string
+			for _, warning := range engine.(*HyperscanEngine).Warnings() {
+				names = append(names, warning.RuleName)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("Expected warnings for %v, got %v", tt.want, names)
+			}
+			if got := len(engine.(*HyperscanEngine).Rules()); got != len(rules)-len(tt.bad) {
+				t.Errorf("Expected %d rules compiled, got %d", len(rules)-len(tt.bad), got)
+			}
+		})
+	}
+
+	// With every rule bad, CompileRules fails naming the first
+	broken := slices.Clone(rules[:3])
+	for i := range broken {
+		broken[i].Pattern = `tok_(?<unsupported`
+	}
+	engine := NewHyperscanEngine()
+	defer engine.Close()
+	err := engine.CompileRules(broken)
+	if err == nil || !strings.Contains(err.Error(), "failed to compile pattern for rule 'Token 000'") {
+		t.Errorf("Expected error naming rule %q, got %v", "Token 000", err)
+	}
+}
+
+func TestCompileWarnings(t *testing.T) {
+	rules := []Rule{
+		{Name: "Token", ID: "test.token", Pattern: `tok_[a-z0-9]{8}`, Redact: []int{0, 0}, Entropy: 1.0},
+		// \Z is supported by Hyperscan but not Go regex
+		{Name: "End Token", ID: "test.end", Pattern: `end_[a-z0-9]{8}\Z`, Redact: []int{0, 0}, Entropy: 1.0},
+	}
+
+	engine := NewGoRegexEngine()
+	defer engine.Close()
+	if err := engine.CompileRules(rules); err != nil {
+		t.Fatalf("CompileRules failed: %v", err)
+	}
+
+	warnings := engine.Warnings()
+	if len(warnings) != 1 || warnings[0].RuleID != "test.end" || warnings[0].Engine != engine.Name() {
+		t.Fatalf("Expected a warning for test.end, got %v", warnings)
+	}
+	if !strings.Contains(warnings[0].String(), "skipped rule 'End Token' (test.end)") {
+		t.Errorf("Expected the warning to name the rule, got %q", warnings[0])
+	}
+
+	// The other rule is still compiled and matched
+	matches := engine.FindAllInLine("tok_abcd1234 end_abcd1234")
+	if len(matches) != 1 || matches[0].RuleID != "test.token" {
+		t.Errorf("Expected only test.token to match, got %v", matches)
+	}
+
+	// Compiling again clears the warnings
+	if err := engine.CompileRules(rules[:1]); err != nil {
+		t.Fatalf("CompileRules failed: %v", err)
+	}
+	if warnings := engine.Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+
+	if IsHyperscanAvailable() {
+		hsEngine := NewHyperscanEngine()
+		defer hsEngine.Close()
+		if err := hsEngine.CompileRules(rules); err != nil {
+			t.Fatalf("CompileRules failed: %v", err)
+		}
+		if warnings := hsEngine.(*HyperscanEngine).Warnings(); len(warnings) != 0 {
+			t.Errorf("Expected Hyperscan to compile every rule, got %v", warnings)
+		}
+	}
+}
+
+func TestCheckRuleCompatibility(t *testing.T) {
+	hyperscan := IsHyperscanAvailable()
+	disabled := false
+
+	// Hyperscan only accepts rules when it's available
+	tests := []struct {
+		name string
+		rule Rule
+		goOK bool
+		hsOK bool
+	}{
+		{name: "both engines", rule: Rule{Name: "Token", ID: "test.token", Pattern: `tok_[a-z0-9]{8}`}, goOK: true, hsOK: true},
+		{name: "disabled rule", rule: Rule{Name: "Token", ID: "test.token", Pattern: `tok_[a-z0-9]{8}`, Enabled: &disabled}, goOK: true, hsOK: true},
+		// Hyperscan rejects patterns that match empty text
+		{name: "Go regex only", rule: Rule{Name: "Token", ID: "test.token", Pattern: `(tok_[a-z0-9]{8})?`}, goOK: true},
+		{name: "invalid", rule: Rule{Name: "Token", ID: "test.token", Pattern: `tok_[unclosed`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goOK, hsOK, goErr, hsErr := CheckRuleCompatibility(tt.rule)
+			if goOK != tt.goOK || (goErr == nil) != tt.goOK {
+				t.Errorf("Expected Go regex ok %v, got %v (%v)", tt.goOK, goOK, goErr)
+			}
+			if hsOK != (tt.hsOK && hyperscan) || (hsErr == nil) != hsOK {
+				t.Errorf("Expected Hyperscan ok %v, got %v (%v)", tt.hsOK && hyperscan, hsOK, hsErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package poltergeist
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MatchExplanation breaks down why a match was or wasn't flagged
+type MatchExplanation struct {
+	Entropy          float64            `json:"entropy"`           // Shannon entropy of the match
+	EntropyThreshold float64            `json:"entropy_threshold"` // Minimum entropy required by the rule
+	EntropyMet       bool               `json:"entropy_met"`       // Whether the entropy threshold was met
+	Charset          string             `json:"charset"`           // Character set detected in the match
+	Length           int                `json:"length"`            // Length of the match in bytes
+	Checks           []ExplanationCheck `json:"checks"`            // Individual checks applied to the match
+	Flagged          bool               `json:"flagged"`           // Whether the match passed every check
+	Summary          string             `json:"summary"`           // Compact human-readable explanation
+}
+
+// ExplanationCheck is the outcome of a single check applied to a match
+type ExplanationCheck struct {
+	Name   string `json:"name"`   // Name of the check (e.g. "entropy")
+	Passed bool   `json:"passed"` // Whether the match passed the check
+	Detail string `json:"detail"` // What was compared
+}
+
+// ExplainMatch builds an explanation for a match. The explanation never
+// includes the matched text itself, so it is safe to print alongside
+// redacted output.
+func ExplainMatch(match MatchResult) *MatchExplanation {
+	explanation := &MatchExplanation{
+		Entropy:          match.Entropy,
+		EntropyThreshold: match.RuleEntropyThreshold,
+		EntropyMet:       match.RuleEntropyThresholdMet,
+		Charset:          DetectCharset(match.Match),
+		Length:           len(match.Match),
+	}
+
+	comparison := "<"
+	if match.RuleEntropyThresholdMet {
+		comparison = ">="
+	}
+	explanation.Checks = append(explanation.Checks, ExplanationCheck{
+		Name:   "entropy",
+		Passed: match.RuleEntropyThresholdMet,
+		Detail: fmt.Sprintf("%.2f %s %.2f", match.Entropy, comparison, match.RuleEntropyThreshold),
+	})
+
+	explanation.Flagged = true
+	var failed []string
+	for _, check := range explanation.Checks {
+		if !check.Passed {
+			explanation.Flagged = false
+			failed = append(failed, check.Name)
+		}
+	}
+
+	verdict := "flagged"
+	if !explanation.Flagged {
+		verdict = "not flagged (failed: " + strings.Join(failed, ", ") + ")"
+	}
+	explanation.Summary = fmt.Sprintf("%s: entropy %s, %s charset, %d chars",
+		verdict, explanation.Checks[0].Detail, explanation.Charset, explanation.Length)
+
+	return explanation
+}
+
+// DetectCharset returns the narrowest character set that contains every
+// character of s: "numeric", "hex", "alphanumeric", "base64", "base64url",
+// or "mixed" for anything else.
+func DetectCharset(s string) string {
+	if s == "" {
+		return "mixed"
+	}
+
+	var hasHexLetter, hasOtherLetter, hasBase64Symbol, hasURLSymbol, hasPadding, hasOther bool
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+		case (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F'):
+			hasHexLetter = true
+		case (r >= 'g' && r <= 'z') || (r >= 'G' && r <= 'Z'):
+			hasOtherLetter = true
+		case r == '+' || r == '/':
+			hasBase64Symbol = true
+		case r == '-' || r == '_':
+			hasURLSymbol = true
+		case r == '=':
+			hasPadding = true
+		default:
+			hasOther = true
+		}
+	}
+
+	switch {
+	case hasOther || (hasBase64Symbol && hasURLSymbol):
+		return "mixed"
+	case hasBase64Symbol || (hasPadding && !hasURLSymbol):
+		return "base64"
+	case hasURLSymbol:
+		return "base64url"
+	case hasOtherLetter:
+		return "alphanumeric"
+	case hasHexLetter:
+		return "hex"
+	default:
+		return "numeric"
+	}
+}
@@ -0,0 +1,118 @@
+package poltergeist
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplainMatches(t *testing.T) {
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-zA-Z0-9]{16}`,
+			Entropy: 3.5,
+		},
+	})
+	scanner.ExplainMatches = true
+
+	content := "high=tok_aZ3kQ9xLm2Pw7vRt\nlow=tok_aaaaaaaaaaaaaaaa\n"
+	results, err := scanner.ScanReader(strings.NewReader(content), "creds.txt")
+	if err != nil {
+		t.Fatalf("ScanReader failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	tests := []struct {
+		name    string
+		result  ScanResult
+		flagged bool
+		verdict string
+	}{
+		{name: "high entropy", result: results[0], flagged: true, verdict: "flagged: entropy "},
+		{name: "low entropy", result: results[1], flagged: false, verdict: "not flagged (failed: entropy)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			explanation := tt.result.Explanation
+			if explanation == nil {
+				t.Fatal("Expected explanation to be set")
+			}
+
+			if explanation.Entropy != tt.result.Entropy {
+				t.Errorf("Entropy = %.2f, expected %.2f", explanation.Entropy, tt.result.Entropy)
+			}
+			if explanation.EntropyThreshold != 3.5 {
+				t.Errorf("EntropyThreshold = %.2f, expected 3.5", explanation.EntropyThreshold)
+			}
+			if explanation.EntropyMet != tt.flagged {
+				t.Errorf("EntropyMet = %v, expected %v", explanation.EntropyMet, tt.flagged)
+			}
+			if explanation.Flagged != tt.flagged {
+				t.Errorf("Flagged = %v, expected %v", explanation.Flagged, tt.flagged)
+			}
+			if explanation.Charset != "base64url" {
+				t.Errorf("Charset = %q, expected base64url", explanation.Charset)
+			}
+			if explanation.Length != 20 {
+				t.Errorf("Length = %d, expected 20", explanation.Length)
+			}
+			if len(explanation.Checks) != 1 || explanation.Checks[0].Name != "entropy" || explanation.Checks[0].Passed != tt.flagged {
+				t.Errorf("Unexpected checks: %+v", explanation.Checks)
+			}
+			if !strings.HasPrefix(explanation.Summary, tt.verdict) {
+				t.Errorf("Summary = %q, expected prefix %q", explanation.Summary, tt.verdict)
+			}
+			if strings.Contains(explanation.Summary, tt.result.Match) {
+				t.Errorf("Summary must not contain the matched text: %q", explanation.Summary)
+			}
+		})
+	}
+}
+
+func TestExplainMatchesDisabled(t *testing.T) {
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-zA-Z0-9]{16}`,
+		},
+	})
+
+	results, err := scanner.ScanReader(strings.NewReader("tok_aZ3kQ9xLm2Pw7vRt\n"), "creds.txt")
+	if err != nil {
+		t.Fatalf("ScanReader failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+	if results[0].Explanation != nil {
+		t.Errorf("Expected no explanation when ExplainMatches is false, got %+v", results[0].Explanation)
+	}
+}
+
+func TestDetectCharset(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1234567890", "numeric"},
+		{"deadBEEF0123", "hex"},
+		{"abcXYZ123", "alphanumeric"},
+		{"YWJjZA+/==", "base64"},
+		{"YWJjZA==", "base64"},
+		{"abc_def-123", "base64url"},
+		{"user:pass@host", "mixed"},
+		{"a+b-c", "mixed"},
+		{"", "mixed"},
+	}
+
+	for _, tt := range tests {
+		if got := DetectCharset(tt.input); got != tt.expected {
+			t.Errorf("DetectCharset(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package poltergeist
+
+import (
+	"crypto/sha256"
+)
+
+// GroupedFinding is a secret matched by one rule, with every location it was
+// found at
+type GroupedFinding struct {
+	RuleID    string            `json:"rule_id"`
+	RuleName  string            `json:"rule_name"`
+	Severity  string            `json:"severity"`
+	Match     string            `json:"-"` // The original matched text (excluded from JSON)
+	Redacted  string            `json:"redacted"`
+	Locations []FindingLocation `json:"locations"`
+}
+
+// FindingLocation is a place a grouped secret was found
+type FindingLocation struct {
+	FilePath   string `json:"file_path"`
+	LineNumber int    `json:"line_number"`
+}
+
+// GroupBySecret collapses results reporting the same secret with the same
+// rule into one finding listing each location, so a secret copied into many
+// files is reviewed once. Secrets are compared by hash, and groups and their
+// locations keep the order of results.
+func GroupBySecret(results []ScanResult) []GroupedFinding {
+	type groupKey struct {
+		ruleID string
+		secret [sha256.Size]byte
+	}
+
+	var groups []GroupedFinding
+	index := make(map[groupKey]int)
+	for _, result := range results {
+		key := groupKey{ruleID: result.RuleID, secret: sha256.Sum256([]byte(result.Match))}
+		location := FindingLocation{FilePath: result.FilePath, LineNumber: result.LineNumber}
+
+		if i, ok := index[key]; ok {
+			groups[i].Locations = append(groups[i].Locations, location)
+			continue
+		}
+
+		index[key] = len(groups)
+		groups = append(groups, GroupedFinding{
+			RuleID:    result.RuleID,
+			RuleName:  result.RuleName,
+			Severity:  result.Severity,
+			Match:     result.Match,
+			Redacted:  result.Redacted,
+			Locations: []FindingLocation{location},
+		})
+	}
+
+	return groups
+}
@@ -0,0 +1,54 @@
+package poltergeist
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupBySecret(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.env", "TOKEN=tok_aZ3kQ9xLm2Pw7vRt\n")
+	writeTestFile(t, dir, "b.env", "# copied\nTOKEN=tok_aZ3kQ9xLm2Pw7vRt\n")
+	writeTestFile(t, dir, filepath.Join("sub", "c.env"), "\n\nTOKEN=tok_aZ3kQ9xLm2Pw7vRt\nOTHER=tok_bB8nM4cV1xZ6qW0e\n")
+
+	scanner := newTestScanner(t, []Rule{{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`, Redact: []int{4, 4}}})
+	results, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	SortResults(results)
+
+	groups := GroupBySecret(results)
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d: %+v", len(groups), groups)
+	}
+
+	group := groups[0]
+	if group.RuleID != "test.token" || group.Match != "tok_aZ3kQ9xLm2Pw7vRt" || group.Redacted != results[0].Redacted {
+		t.Errorf("Unexpected group %+v", group)
+	}
+	want := []FindingLocation{
+		{FilePath: filepath.Join(dir, "a.env"), LineNumber: 1},
+		{FilePath: filepath.Join(dir, "b.env"), LineNumber: 2},
+		{FilePath: filepath.Join(dir, "sub", "c.env"), LineNumber: 3},
+	}
+	if len(group.Locations) != len(want) {
+		t.Fatalf("Expected %d locations, got %+v", len(want), group.Locations)
+	}
+	for i, location := range want {
+		if group.Locations[i] != location {
+			t.Errorf("Location %d = %+v, expected %+v", i, group.Locations[i], location)
+		}
+	}
+
+	if len(groups[1].Locations) != 1 || groups[1].Match != "tok_bB8nM4cV1xZ6qW0e" {
+		t.Errorf("Expected the other secret in its own group, got %+v", groups[1])
+	}
+
+	// The same secret matched by another rule is a separate finding
+	other := append([]ScanResult{}, results[0])
+	other[0].RuleID = "other.token"
+	if groups := GroupBySecret(append(other, results[0])); len(groups) != 2 {
+		t.Errorf("Expected a group per rule, got %+v", groups)
+	}
+}
@@ -0,0 +1,286 @@
+package poltergeist
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// historyBlob is a file version added or modified by a commit
+type historyBlob struct {
+	path      string
+	blob      string
+	commit    string
+	author    string
+	timestamp time.Time
+}
+
+// ScanGitHistory scans every version of every file committed to the history
+// of HEAD in repoDir, so secrets that were later deleted are still found.
+// Each blob is scanned once, and its findings report the path it was added
+// at, and the commit that added it, its author, and its time in GitCommit,
+// GitAuthor, and GitTimestamp. Scanner.MaxCommits limits the scan to the most
+// recent commits. Blobs are subject to the same size and binary checks as
+// files, and update the scanner metrics in the same way.
+func ScanGitHistory(repoDir string, scanner *Scanner) ([]ScanResult, error) {
+	return ScanGitHistoryContext(context.Background(), repoDir, scanner)
+}
+
+// ScanGitHistoryContext is like ScanGitHistory but stops once ctx is done,
+// returning the results found so far along with ctx.Err()
+func ScanGitHistoryContext(ctx context.Context, repoDir string, scanner *Scanner) ([]ScanResult, error) {
+	blobs, err := historyBlobs(ctx, repoDir, scanner.MaxCommits)
+	if err != nil {
+		return nil, err
+	}
+	if len(blobs) == 0 {
+		return nil, nil
+	}
+
+	batch, err := newCatFileBatch(ctx, repoDir)
+	if err != nil {
+		return nil, err
+	}
+	defer batch.close()
+
+	var results []ScanResult
+	for _, blob := range blobs {
+		if err := ctx.Err(); err != nil {
+			SortResults(results)
+			return results, err
+		}
+
+		blobResults, err := scanner.scanBlob(batch, blob)
+		if err != nil {
+			if ctx.Err() != nil {
+				SortResults(results)
+				return results, ctx.Err()
+			}
+			return nil, err
+		}
+		results = append(results, blobResults...)
+	}
+
+	SortResults(results)
+	if scanner.Verify {
+		scanner.verifyResults(ctx, results)
+	}
+	return results, nil
+}
+
+// scanBlob scans one blob read from batch, skipping empty, too large, and
+// binary blobs and updating metrics as scanJob does for files
+func (s *Scanner) scanBlob(batch *catFileBatch, blob historyBlob) ([]ScanResult, error) {
+	content, size, err := batch.open(blob.blob)
+	if err != nil {
+		return nil, err
+	}
+	defer content.discard()
+
+	switch {
+	case size == 0:
+		s.logSkipped(blob.path, "empty")
+		atomic.AddInt64(&s.Metrics.FilesSkipped, 1)
+		return nil, nil
+	case size > s.MaxFileSize:
+		s.logSkipped(blob.path, "too large")
+		atomic.AddInt64(&s.Metrics.FilesSkipped, 1)
+		return nil, nil
+	}
+
+	results, binary, err := s.scanStream(content, blob.path, 0)
+	if err != nil {
+		atomic.AddInt64(&s.Metrics.FilesSkipped, 1)
+		s.reportError(nil, "error scanning file", blob.path, err)
+		return nil, nil
+	}
+
+	for i := range results {
+		results[i].GitCommit = blob.commit
+		results[i].GitAuthor = blob.author
+		results[i].GitTimestamp = blob.timestamp
+	}
+
+	if binary {
+		// Keep the findings in the text before binary content
+		atomic.AddInt64(&s.Metrics.FilesSkipped, 1)
+		atomic.AddInt64(&s.Metrics.MatchesFound, int64(len(results)))
+		s.countMatches(results)
+		return results, nil
+	}
+
+	if s.Logger != nil {
+		s.Logger.Debug("scanned file", "path", blob.path, "commit", blob.commit, "matches", len(results))
+	}
+	atomic.AddInt64(&s.Metrics.FilesScanned, 1)
+	atomic.AddInt64(&s.Metrics.TotalBytes, size)
+	atomic.AddInt64(&s.Metrics.MatchesFound, int64(len(results)))
+	s.countMatches(results)
+	return results, nil
+}
+
+// historyBlobs lists the blobs added or modified by the commits in the
+// history of HEAD, oldest first, with each blob listed once for the first
+// commit that added it. maxCommits limits the history to the most recent
+// commits if positive.
+func historyBlobs(ctx context.Context, repoDir string, maxCommits int) ([]historyBlob, error) {
+	args := []string{"-C", repoDir, "log", "--no-renames", "--raw", "--no-abbrev", "-z", "--format=%H%x00%aI%x00%an"}
+	if maxCommits > 0 {
+		args = append(args, "--max-count="+strconv.Itoa(maxCommits))
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("failed to read git history: %s", msg)
+		}
+		return nil, fmt.Errorf("failed to read git history: %w", err)
+	}
+
+	blobs := parseHistoryLog(out)
+
+	// The log lists the newest commits first
+	var oldestFirst []historyBlob
+	seen := make(map[string]bool)
+	for i := len(blobs) - 1; i >= 0; i-- {
+		if !seen[blobs[i].blob] {
+			seen[blobs[i].blob] = true
+			oldestFirst = append(oldestFirst, blobs[i])
+		}
+	}
+	return oldestFirst, nil
+}
+
+// parseHistoryLog parses the output of historyBlobs' git log: NUL-separated
+// commit headers of hash, strict ISO 8601 author date, and author name, each
+// followed by raw diff records of metadata and path. Deletions, submodules,
+// and symbolic links are left out.
+func parseHistoryLog(out []byte) []historyBlob {
+	var blobs []historyBlob
+	var commit historyBlob
+
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i < len(fields); i++ {
+		field := strings.TrimPrefix(fields[i], "\n")
+		if field == "" {
+			continue
+		}
+
+		// Raw records look like ":100644 100644 <old blob> <new blob> M"
+		if strings.HasPrefix(field, ":") {
+			if i+1 >= len(fields) {
+				break
+			}
+			path := fields[i+1]
+			i++
+
+			meta := strings.Fields(field)
+			if len(meta) < 5 || commit.commit == "" {
+				continue
+			}
+			mode, blob, status := meta[1], meta[3], meta[4]
+			if status == "D" || mode == "160000" || mode == "120000" || strings.Trim(blob, "0") == "" {
+				continue
+			}
+
+			entry := commit
+			entry.path = path
+			entry.blob = blob
+			blobs = append(blobs, entry)
+			continue
+		}
+
+		// Commit headers
+		if i+2 >= len(fields) {
+			break
+		}
+		commit = historyBlob{commit: field, author: fields[i+2]}
+		commit.timestamp, _ = time.Parse(time.RFC3339, fields[i+1])
+		i += 2
+	}
+
+	return blobs
+}
+
+// catFileBatch reads blobs from a running git cat-file --batch
+type catFileBatch struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// newCatFileBatch starts git cat-file --batch in repoDir
+func newCatFileBatch(ctx context.Context, repoDir string) (*catFileBatch, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "cat-file", "--batch")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+
+	return &catFileBatch{cmd: cmd, stdin: stdin, stdout: bufio.NewReaderSize(stdout, 64*1024)}, nil
+}
+
+// open requests a blob, returning a reader of its content and its size. The
+// content must be discarded before the next blob is opened.
+func (b *catFileBatch) open(blob string) (*blobReader, int64, error) {
+	if _, err := io.WriteString(b.stdin, blob+"\n"); err != nil {
+		return nil, 0, fmt.Errorf("failed to read blob %s: %w", blob, err)
+	}
+
+	// The header is "<blob> blob <size>", or "<blob> missing"
+	header, err := b.stdout.ReadString('\n')
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read blob %s: %w", blob, err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 || fields[1] != "blob" {
+		return nil, 0, fmt.Errorf("failed to read blob %s: %s", blob, strings.TrimSpace(header))
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read blob %s: invalid size %q", blob, fields[2])
+	}
+
+	return &blobReader{LimitedReader: io.LimitedReader{R: b.stdout, N: size}, batch: b}, size, nil
+}
+
+// close stops git cat-file
+func (b *catFileBatch) close() {
+	b.stdin.Close()
+	_ = b.cmd.Wait()
+}
+
+// blobReader reads the content of one blob from a catFileBatch
+type blobReader struct {
+	io.LimitedReader
+	batch *catFileBatch
+}
+
+// discard skips the rest of the blob and the newline that follows it
+func (r *blobReader) discard() error {
+	if _, err := io.Copy(io.Discard, &r.LimitedReader); err != nil {
+		return err
+	}
+	if _, err := r.batch.stdout.ReadByte(); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package poltergeist
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanGitHistory(t *testing.T) {
+	repo := initTestRepo(t)
+	writeTestFile(t, repo, "README.md", "# demo\n")
+	writeTestFile(t, repo, filepath.Join("config", "app.env"), "APP_NAME=demo\nTOKEN=tok_deleted1\n")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "Add config")
+	added := runGit(t, repo, "rev-parse", "HEAD")
+
+	// Deleting the secret leaves it in the history
+	runGit(t, repo, "rm", "-q", filepath.Join("config", "app.env"))
+	runGit(t, repo, "commit", "-q", "-m", "Remove config")
+
+	writeTestFile(t, repo, "keys.txt", "KEY=tok_current1\n")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "Add keys")
+	current := runGit(t, repo, "rev-parse", "HEAD")
+
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8,}`,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		maxCommits int
+		want       map[string]string // path to commit
+		scanned    int64
+	}{
+		{
+			name:    "whole history",
+			want:    map[string]string{"config/app.env": added, "keys.txt": current},
+			scanned: 3,
+		},
+		{
+			name:       "latest commit",
+			maxCommits: 1,
+			want:       map[string]string{"keys.txt": current},
+			scanned:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := newTestScanner(t, rules)
+			scanner.MaxCommits = tt.maxCommits
+			results, err := ScanGitHistory(repo, scanner)
+			if err != nil {
+				t.Fatalf("ScanGitHistory failed: %v", err)
+			}
+
+			if len(results) != len(tt.want) {
+				t.Fatalf("Expected %d results, got %d: %+v", len(tt.want), len(results), results)
+			}
+			for _, result := range results {
+				commit, ok := tt.want[result.FilePath]
+				if !ok {
+					t.Errorf("Unexpected result in %s", result.FilePath)
+					continue
+				}
+				if result.GitCommit != commit || result.GitAuthor != "Test Author" || result.GitTimestamp.IsZero() {
+					t.Errorf("Expected %s to be attributed to Test Author in %s, got %q in %q at %v", result.FilePath, commit, result.GitAuthor, result.GitCommit, result.GitTimestamp)
+				}
+				if result.LineNumber < 1 {
+					t.Errorf("Expected a line number for %s, got %d", result.FilePath, result.LineNumber)
+				}
+			}
+			if scanner.Metrics.FilesScanned != tt.scanned {
+				t.Errorf("Expected %d blobs scanned, got %d", tt.scanned, scanner.Metrics.FilesScanned)
+			}
+		})
+	}
+}
+
+func TestScanGitHistoryBinaryTail(t *testing.T) {
+	repo := initTestRepo(t)
+
+	// Text past the sniffed head, then binary content
+	content := "TOKEN=tok_binarytail1\n" + strings.Repeat("x", 1024) + "\n" + strings.Repeat("\x00", 64)
+	writeTestFile(t, repo, "data.txt", content)
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "Add data")
+	commit := runGit(t, repo, "rev-parse", "HEAD")
+
+	scanner := newTestScanner(t, []Rule{{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-z0-9]{8,}`}})
+	results, err := ScanGitHistory(repo, scanner)
+	if err != nil {
+		t.Fatalf("ScanGitHistory failed: %v", err)
+	}
+
+	// The finding before the binary content is kept and attributed
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d: %+v", len(results), results)
+	}
+	if result := results[0]; result.GitCommit != commit || result.GitAuthor != "Test Author" || result.GitTimestamp.IsZero() {
+		t.Errorf("Expected the finding to be attributed to Test Author in %s, got %q in %q at %v", commit, result.GitAuthor, result.GitCommit, result.GitTimestamp)
+	}
+	if scanner.Metrics.FilesSkipped != 1 {
+		t.Errorf("Expected the blob to be counted as skipped, got %d skipped", scanner.Metrics.FilesSkipped)
+	}
+}
+
+func TestScanGitHistoryNotARepository(t *testing.T) {
+	initTestRepo(t)
+
+	scanner := newTestScanner(t, nil)
+	if _, err := ScanGitHistory(t.TempDir(), scanner); err == nil {
+		t.Error("Expected an error scanning the history of a directory that isn't a repository")
+	}
+}
+
+func TestParseHistoryLog(t *testing.T) {
+	blob := func(c byte) string {
+		b := make([]byte, 40)
+		for i := range b {
+			b[i] = c
+		}
+		return string(b)
+	}
+	zero := blob('0')
+
+	out := blob('c') + "\x002024-03-01T12:00:00+02:00\x00Jane Doe\x00\n" +
+		":100644 000000 " + blob('1') + " " + zero + " D\x00gone.env\x00" +
+		":000000 160000 " + zero + " " + blob('2') + " A\x00vendor/lib\x00" +
+		":100644 100644 " + blob('3') + " " + blob('4') + " M\x00app.env\x00" +
+		blob('d') + "\x002024-02-01T08:30:00-05:00\x00John Roe\x00\n" +
+		":000000 100644 " + zero + " " + blob('1') + " A\x00gone.env\x00"
+
+	blobs := parseHistoryLog([]byte(out))
+	if len(blobs) != 2 {
+		t.Fatalf("Expected 2 blobs, got %d: %+v", len(blobs), blobs)
+	}
+	if got := blobs[0]; got.path != "app.env" || got.blob != blob('4') || got.commit != blob('c') || got.author != "Jane Doe" {
+		t.Errorf("Unexpected first blob: %+v", got)
+	}
+	if got := blobs[1]; got.path != "gone.env" || got.blob != blob('1') || got.commit != blob('d') || got.author != "John Roe" {
+		t.Errorf("Unexpected second blob: %+v", got)
+	}
+	if _, offset := blobs[1].timestamp.Zone(); offset != -5*3600 || blobs[1].timestamp.Hour() != 8 {
+		t.Errorf("Expected the author's local time, got %v", blobs[1].timestamp)
+	}
+}
@@ -0,0 +1,204 @@
+package poltergeist
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// PoltergeistIgnoreFile is the name of the ignore file read from the scan
+// root. It uses .gitignore syntax and takes precedence over .gitignore files.
+const PoltergeistIgnoreFile = ".poltergeistignore"
+
+// gitIgnoreFile is the name of the per-directory git ignore file
+const gitIgnoreFile = ".gitignore"
+
+// ignorePattern is a single parsed line of a gitignore-style file
+type ignorePattern struct {
+	segments []string // Slash-separated glob segments ("**" matches any number of segments)
+	negate   bool     // Pattern started with '!' and re-includes matches
+	dirOnly  bool     // Pattern ended with '/' and only matches directories
+}
+
+// ignoreFile holds the patterns of one ignore file along with the directory
+// they are relative to
+type ignoreFile struct {
+	dir      string // Directory containing the file, as a name within the scanned fs.FS
+	patterns []ignorePattern
+}
+
+// ignoreMatcher decides whether names within a walked fs.FS are ignored. It is
+// safe for concurrent use by the goroutines of a walk, provided each
+// directory is entered before its contents are checked.
+type ignoreMatcher struct {
+	fsys     fs.FS
+	mu       sync.RWMutex           // Guards gitFiles
+	gitFiles map[string]*ignoreFile // .gitignore files keyed by directory
+	root     *ignoreFile            // .poltergeistignore from the scan root, if any
+}
+
+// newIgnoreMatcher creates a matcher for a walk of fsys starting at the root
+// directory, loading the root's .poltergeistignore if present
+func newIgnoreMatcher(fsys fs.FS, root string) *ignoreMatcher {
+	m := &ignoreMatcher{
+		fsys:     fsys,
+		gitFiles: make(map[string]*ignoreFile),
+	}
+
+	if data, err := fs.ReadFile(fsys, path.Join(root, PoltergeistIgnoreFile)); err == nil {
+		m.root = &ignoreFile{dir: root, patterns: parseIgnorePatterns(string(data))}
+	}
+
+	return m
+}
+
+// enterDir loads the .gitignore of a directory about to be walked
+func (m *ignoreMatcher) enterDir(dir string) {
+	data, err := fs.ReadFile(m.fsys, path.Join(dir, gitIgnoreFile))
+	if err != nil {
+		return
+	}
+
+	if patterns := parseIgnorePatterns(string(data)); len(patterns) > 0 {
+		m.mu.Lock()
+		m.gitFiles[dir] = &ignoreFile{dir: dir, patterns: patterns}
+		m.mu.Unlock()
+	}
+}
+
+// ignored reports whether name is excluded. Ignore files are consulted from
+// the shallowest directory to the deepest, followed by .poltergeistignore, and
+// the last matching pattern wins.
+func (m *ignoreMatcher) ignored(name string, isDir bool) bool {
+	ignored := false
+
+	// Collect ancestor directories from the walk root down to the parent
+	var dirs []string
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == "." || dir == "/" {
+			break
+		}
+	}
+
+	m.mu.RLock()
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if file, ok := m.gitFiles[dirs[i]]; ok {
+			ignored = file.match(name, isDir, ignored)
+		}
+	}
+	m.mu.RUnlock()
+
+	if m.root != nil {
+		ignored = m.root.match(name, isDir, ignored)
+	}
+
+	return ignored
+}
+
+// match applies the file's patterns to name, returning the updated ignore state
+func (f *ignoreFile) match(name string, isDir bool, ignored bool) bool {
+	rel := name
+	if f.dir != "." {
+		if !strings.HasPrefix(name, f.dir+"/") {
+			return ignored
+		}
+		rel = strings.TrimPrefix(name, f.dir+"/")
+	}
+
+	segments := strings.Split(rel, "/")
+	for _, pattern := range f.patterns {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if matchIgnoreSegments(pattern.segments, segments) {
+			ignored = !pattern.negate
+		}
+	}
+
+	return ignored
+}
+
+// parseIgnorePatterns parses gitignore-style content. Blank lines and lines
+// starting with '#' are skipped, a leading '!' negates the pattern, a trailing
+// '/' restricts it to directories, and patterns without a slash match at any
+// depth.
+func parseIgnorePatterns(content string) []ignorePattern {
+	var patterns []ignorePattern
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		// Trailing spaces are ignored unless escaped with a backslash
+		if trimmed := strings.TrimRight(line, " \t"); strings.HasSuffix(trimmed, "\\") && len(trimmed) < len(line) {
+			line = trimmed[:len(trimmed)-1] + " "
+		} else {
+			line = trimmed
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var pattern ignorePattern
+		if strings.HasPrefix(line, "!") {
+			pattern.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			pattern.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		// A slash at the start or in the middle anchors the pattern to the
+		// directory of the ignore file
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+
+		pattern.segments = strings.Split(line, "/")
+		if !anchored {
+			pattern.segments = append([]string{"**"}, pattern.segments...)
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns
+}
+
+// matchIgnoreSegments matches path segments against glob segments, where a
+// "**" segment matches zero or more path segments. A trailing "**" matches
+// everything inside a directory but not the directory itself.
+func matchIgnoreSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return len(segments) > 0
+			}
+			for i := 0; i < len(segments); i++ {
+				if matchIgnoreSegments(pattern, segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
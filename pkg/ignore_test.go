@@ -0,0 +1,139 @@
+package poltergeist
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIgnorePatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns string
+		path     string
+		isDir    bool
+		ignored  bool
+	}{
+		{name: "basename at any depth", patterns: "*.log", path: "a/b/debug.log", ignored: true},
+		{name: "basename no match", patterns: "*.log", path: "a/b/debug.txt", ignored: false},
+		{name: "directory only matches directory", patterns: "build/", path: "src/build", isDir: true, ignored: true},
+		{name: "directory only skips file", patterns: "build/", path: "src/build", ignored: false},
+		{name: "anchored leading slash", patterns: "/dist", path: "dist", isDir: true, ignored: true},
+		{name: "anchored leading slash nested", patterns: "/dist", path: "web/dist", isDir: true, ignored: false},
+		{name: "anchored middle slash", patterns: "config/secrets.yaml", path: "config/secrets.yaml", ignored: true},
+		{name: "anchored middle slash nested", patterns: "config/secrets.yaml", path: "app/config/secrets.yaml", ignored: false},
+		{name: "leading double star", patterns: "**/fixtures/*.json", path: "a/b/fixtures/x.json", ignored: true},
+		{name: "middle double star", patterns: "docs/**/draft.md", path: "docs/a/b/draft.md", ignored: true},
+		{name: "middle double star zero dirs", patterns: "docs/**/draft.md", path: "docs/draft.md", ignored: true},
+		{name: "trailing double star", patterns: "tmp/**", path: "tmp/a/b.txt", ignored: true},
+		{name: "trailing double star not dir itself", patterns: "tmp/**", path: "tmp", isDir: true, ignored: false},
+		{name: "negation", patterns: "*.env\n!example.env", path: "example.env", ignored: false},
+		{name: "negation then ignore", patterns: "!example.env\n*.env", path: "example.env", ignored: true},
+		{name: "comment and blank", patterns: "# *.txt\n\n", path: "a.txt", ignored: false},
+		{name: "escaped hash", patterns: "\\#notes", path: "#notes", ignored: true},
+		{name: "escaped bang", patterns: "\\!important", path: "!important", ignored: true},
+		{name: "trailing spaces trimmed", patterns: "secret.txt   ", path: "secret.txt", ignored: true},
+		{name: "crlf line endings", patterns: "*.log\r\n*.tmp\r\n", path: "x.tmp", ignored: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &ignoreFile{dir: ".", patterns: parseIgnorePatterns(tt.patterns)}
+			if got := file.match(tt.path, tt.isDir, false); got != tt.ignored {
+				t.Errorf("patterns %q on %q (dir=%v) = %v, expected %v", tt.patterns, tt.path, tt.isDir, got, tt.ignored)
+			}
+		})
+	}
+}
+
+func TestScanRespectsIgnoreFiles(t *testing.T) {
+	secret := []byte("TOKEN=tok_abcd1234\n")
+	fsys := fstest.MapFS{
+		".gitignore":             {Data: []byte("out/\n*.log\n!keep.log\n")},
+		".poltergeistignore":     {Data: []byte("fixtures/**/*.json\n")},
+		"app.txt":                {Data: secret},
+		"out/out.txt":            {Data: secret},
+		"out/nested/deep.txt":    {Data: secret},
+		"debug.log":              {Data: secret},
+		"keep.log":               {Data: secret},
+		"src/.gitignore":         {Data: []byte("generated.txt\n")},
+		"src/main.txt":           {Data: secret},
+		"src/generated.txt":      {Data: secret},
+		"other/generated.txt":    {Data: secret},
+		"fixtures/a/sample.json": {Data: secret},
+		"fixtures/readme.txt":    {Data: secret},
+	}
+
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	}
+
+	scanner := newTestScanner(t, rules)
+	results, err := scanner.ScanFS(fsys, ".")
+	if err != nil {
+		t.Fatalf("ScanFS failed: %v", err)
+	}
+
+	expected := map[string]bool{
+		"app.txt":             true,
+		"keep.log":            true,
+		"src/main.txt":        true,
+		"other/generated.txt": true,
+		"fixtures/readme.txt": true,
+	}
+
+	if len(results) != len(expected) {
+		t.Errorf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for _, result := range results {
+		if !expected[result.FilePath] {
+			t.Errorf("Unexpected result from ignored file %s", result.FilePath)
+		}
+	}
+
+	// Ignored files are neither scanned nor skipped; the ignore files themselves are scanned
+	if scanner.Metrics.FilesScanned != int64(len(expected))+3 {
+		t.Errorf("Expected %d files scanned, got %d", len(expected)+3, scanner.Metrics.FilesScanned)
+	}
+	if scanner.Metrics.FilesSkipped != 0 {
+		t.Errorf("Expected 0 files skipped, got %d", scanner.Metrics.FilesSkipped)
+	}
+
+	// Disabling ignore handling scans everything
+	scanner = newTestScanner(t, rules)
+	scanner.RespectIgnoreFiles = false
+	results, err = scanner.ScanFS(fsys, ".")
+	if err != nil {
+		t.Fatalf("ScanFS failed: %v", err)
+	}
+	if len(results) != 10 {
+		t.Errorf("Expected 10 results with ignore files disabled, got %d", len(results))
+	}
+}
+
+func TestScanDirectoryRespectsIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, ".gitignore", "node_modules/\n")
+	writeTestFile(t, dir, "index.txt", "TOKEN=tok_abcd1234\n")
+	writeTestFile(t, dir, filepath.Join("node_modules", "pkg", "index.txt"), "TOKEN=tok_abcd1234\n")
+
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+
+	results, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if len(results) != 1 || results[0].FilePath != filepath.Join(dir, "index.txt") {
+		t.Errorf("Expected a single result from index.txt, got %+v", results)
+	}
+}
@@ -0,0 +1,168 @@
+package poltergeist
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+
+	"golang.org/x/text/transform"
+)
+
+// DefaultMaxLineLength is the default Scanner.MaxLineLength
+const DefaultMaxLineLength = 10 * 1024 * 1024
+
+// longLineOverlap is the number of bytes shared by consecutive segments of a
+// long line, so that matches spanning a segment boundary are still found
+const longLineOverlap = 64 * 1024
+
+// lineReader reads lines like bufio.ScanLines, but splits lines longer than
+// the maximum length into overlapping segments rather than failing, so
+// minified files and data blobs are still scanned in bounded memory. Lines
+// may end with "\n", "\r\n", or a lone "\r".
+type lineReader struct {
+	r      *bufio.Reader
+	maxLen int // Maximum segment length, or 0 for no limit
+	err    error
+
+	buf      []byte // Unconsumed bytes of the current line, starting at offset
+	complete bool   // Whether buf holds the rest of the current line
+
+	segment []byte // Current segment
+	offset  int    // Byte offset of the segment within its line
+	prevEnd int    // End offset within the line of the previous segment of the same line, or 0
+	last    bool   // Whether the segment is the last one of its line
+}
+
+// newLineReader returns a lineReader splitting lines longer than maxLen, or
+// never splitting lines if maxLen is 0
+func newLineReader(r io.Reader, maxLen int) *lineReader {
+	l := &lineReader{
+		r:      bufio.NewReaderSize(transform.NewReader(r, lineEndings{}), 128*1024),
+		maxLen: maxLen,
+		last:   true,
+	}
+
+	// A leading UTF-8 byte order mark isn't part of the first line
+	if head, _ := l.r.Peek(len(utf8BOM)); bytes.Equal(head, utf8BOM) {
+		l.r.Discard(len(utf8BOM))
+	}
+	return l
+}
+
+// next advances to the next segment, returning false at the end of the input
+// or on a read error
+func (l *lineReader) next() bool {
+	if l.err != nil {
+		return false
+	}
+
+	if l.last {
+		// Start a new line
+		l.buf = l.buf[:0]
+		l.complete = false
+		l.offset = 0
+		l.prevEnd = 0
+	} else {
+		// Continue the current line, keeping the tail of the previous
+		// segment so matches across the boundary are found
+		overlap := min(longLineOverlap, l.maxLen/2)
+		consumed := len(l.segment) - overlap
+		l.prevEnd = l.offset + len(l.segment)
+		l.buf = l.buf[:copy(l.buf, l.buf[consumed:])]
+		l.offset += consumed
+	}
+
+	for !l.complete && (l.maxLen == 0 || len(l.buf) <= l.maxLen) {
+		chunk, err := l.r.ReadSlice('\n')
+		l.buf = append(l.buf, chunk...)
+
+		switch {
+		case err == nil:
+			l.buf = dropCR(l.buf[:len(l.buf)-1])
+			l.complete = true
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF):
+			if len(l.buf) == 0 && l.offset == 0 {
+				return false
+			}
+			l.buf = dropCR(l.buf)
+			l.complete = true
+		default:
+			l.err = err
+			return false
+		}
+	}
+
+	if l.maxLen > 0 && len(l.buf) > l.maxLen {
+		l.segment = l.buf[:l.maxLen]
+		l.last = false
+	} else {
+		l.segment = l.buf
+		l.last = true
+	}
+
+	return true
+}
+
+// text returns the current segment as a string
+func (l *lineReader) text() string {
+	return string(l.segment)
+}
+
+// dropCR drops a trailing carriage return, as bufio.ScanLines does
+func dropCR(data []byte) []byte {
+	if len(data) > 0 && data[len(data)-1] == '\r' {
+		return data[:len(data)-1]
+	}
+	return data
+}
+
+// lineEndings is a transformer replacing each carriage return that isn't
+// followed by a newline with a newline, so lines ending with a lone "\r" are
+// split like any other. Offsets are unchanged, as one byte replaces another.
+type lineEndings struct {
+	transform.NopResetter
+}
+
+// Transform implements transform.Transformer
+func (lineEndings) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		i := bytes.IndexByte(src[nSrc:], '\r')
+		if i < 0 {
+			i = len(src) - nSrc
+		}
+		n := copy(dst[nDst:], src[nSrc:nSrc+i])
+		nDst += n
+		nSrc += n
+		if n < i {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		if nSrc == len(src) {
+			break
+		}
+
+		// Whether a carriage return ends a line depends on the next byte
+		if nSrc+1 == len(src) && !atEOF {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		if nDst == len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		if nSrc+1 < len(src) && src[nSrc+1] == '\n' {
+			dst[nDst] = '\r'
+		} else {
+			dst[nDst] = '\n'
+		}
+		nDst++
+		nSrc++
+	}
+	return nDst, nSrc, nil
+}
+
+// isLoneCR reports whether content has a carriage return at i that isn't
+// followed by a newline, which ends a line as lineEndings treats it
+func isLoneCR(content []byte, i int) bool {
+	return content[i] == '\r' && (i+1 == len(content) || content[i+1] != '\n')
+}
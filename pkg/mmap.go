@@ -0,0 +1,40 @@
+package poltergeist
+
+import (
+	"bytes"
+)
+
+// scanMapped scans the memory-mapped content of a file as a single block, as
+// scanStream scans content read from a file, reporting whether it was skipped
+// as binary instead. Results hold copies of the matched text, so they outlive
+// the mapping.
+func (s *Scanner) scanMapped(content []byte, filePath string) ([]ScanResult, bool, error) {
+	// Archives are extracted from a reader of the mapped content
+	head := content[:min(len(content), max(s.SniffBytes, archiveSniffBytes))]
+	if s.MaxDecompressedSize > 0 && (isGzip(head) || isZip(head) || isTar(head)) {
+		return s.scanStream(bytes.NewReader(content), filePath, 0)
+	}
+
+	// UTF-16 is transcoded to UTF-8, as scanStream does
+	if enc := detectUTF16(head); enc != nil {
+		decoded, err := enc.NewDecoder().Bytes(content)
+		if err != nil {
+			return nil, false, err
+		}
+		content = decoded
+		head = content[:min(len(content), max(s.SniffBytes, 0))]
+	}
+
+	if !s.forceScan(filePath) && s.isBinary(filePath, head[:min(len(head), max(s.SniffBytes, 0))]) {
+		s.logSkipped(filePath, "binary")
+		return nil, true, nil
+	}
+
+	var binary bool
+	if s.checkContent(filePath) {
+		if content, binary = textPrefix(content); binary {
+			s.logSkipped(filePath, "binary content after the first bytes")
+		}
+	}
+	return s.scanContent(filePath, content), binary, nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package poltergeist
+
+import (
+	"errors"
+	"os"
+)
+
+// mapFile is unsupported on this platform, so files are always read
+func mapFile(file *os.File) ([]byte, func() error, error) {
+	return nil, nil, errors.New("mmap is not supported on this platform")
+}
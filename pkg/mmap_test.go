@@ -0,0 +1,139 @@
+package poltergeist
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeLargeTextFile writes a file of lines, with a secret every hundredth
+// line, returning its path
+func writeLargeTextFile(tb testing.TB, lines int) string {
+	tb.Helper()
+
+	var content strings.Builder
+	for i := range lines {
+		fmt.Fprintf(&content, "line %d: the quick brown fox jumps over the lazy dog\n", i)
+		if i%100 == 0 {
+			fmt.Fprintf(&content, "\ttoken = \"tok_%08x%08x\" # line %d\n", i, i*31, i)
+		}
+	}
+
+	path := filepath.Join(tb.TempDir(), "large.txt")
+	if err := os.WriteFile(path, []byte(content.String()), 0644); err != nil {
+		tb.Fatalf("Failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestScanMmap(t *testing.T) {
+	path := writeLargeTextFile(t, 5000)
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-f0-9]{16}`,
+		},
+	}
+
+	// The mmap path scans whole files with FindAllInContent, so it must find
+	// the same matches as line-by-line scanning with every engine
+	for _, newEngine := range testEngines() {
+		t.Run(newEngine().Name(), func(t *testing.T) {
+			scan := func(threshold int64) []ScanResult {
+				scanner := newEngineTestScanner(t, newEngine(), rules)
+				scanner.MmapThreshold = threshold
+				scanner.ContextLines = 1
+				results, err := scanner.ScanDirectory(path)
+				if err != nil {
+					t.Fatalf("ScanDirectory with MmapThreshold %d failed: %v", threshold, err)
+				}
+				if scanner.Metrics.FilesScanned != 1 {
+					t.Fatalf("Expected 1 file scanned with MmapThreshold %d, got %d", threshold, scanner.Metrics.FilesScanned)
+				}
+
+				// Entropy can differ in the last bit between calls
+				for i := range results {
+					results[i].Entropy = math.Round(results[i].Entropy*1e9) / 1e9
+				}
+				return results
+			}
+
+			buffered := scan(0)
+			if len(buffered) != 50 {
+				t.Fatalf("Expected 50 results, got %d", len(buffered))
+			}
+			if mapped := scan(1024); !reflect.DeepEqual(mapped, buffered) {
+				t.Errorf("Expected the same results from the mmap and buffered paths, got %d and %d", len(mapped), len(buffered))
+				for i := range min(len(mapped), len(buffered)) {
+					if !reflect.DeepEqual(mapped[i], buffered[i]) {
+						t.Errorf("First difference:\nmmap:     %+v\nbuffered: %+v", mapped[i], buffered[i])
+						break
+					}
+				}
+			}
+		})
+	}
+
+	// Files below the threshold are read line by line, so matches can't span
+	// lines
+	multiline := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(multiline, []byte("BEGIN\nsecret\nEND\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	spanRules := []Rule{{Name: "Span", ID: "test.span", Pattern: `BEGIN\nsecret\nEND`}}
+	for _, tt := range []struct {
+		threshold int64
+		want      int
+	}{
+		{threshold: 1, want: 1},
+		{threshold: 1024, want: 0},
+	} {
+		scanner := newTestScanner(t, spanRules)
+		scanner.MmapThreshold = tt.threshold
+		results, err := scanner.ScanDirectory(multiline)
+		if err != nil {
+			t.Fatalf("ScanDirectory failed: %v", err)
+		}
+		if len(results) != tt.want {
+			t.Errorf("Expected %d multi-line matches with MmapThreshold %d, got %d", tt.want, tt.threshold, len(results))
+		}
+	}
+}
+
+func BenchmarkScanMmap(b *testing.B) {
+	path := writeLargeTextFile(b, 200000)
+	info, err := os.Stat(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	rules, err := LoadDefaultRules()
+	if err != nil {
+		b.Fatalf("LoadDefaultRules failed: %v", err)
+	}
+	engine := NewGoRegexEngine()
+	defer engine.Close()
+	if err := engine.CompileRules(rules); err != nil {
+		b.Fatalf("CompileRules failed: %v", err)
+	}
+
+	for _, threshold := range []int64{0, 1} {
+		b.Run(fmt.Sprintf("mmap=%t", threshold > 0), func(b *testing.B) {
+			scanner := NewScanner(engine)
+			scanner.MmapThreshold = threshold
+
+			b.SetBytes(info.Size())
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := scanner.ScanDirectory(path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
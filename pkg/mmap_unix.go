@@ -0,0 +1,28 @@
+//go:build unix
+
+package poltergeist
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapFile maps the content of file into memory read-only, returning it and a
+// function that unmaps it
+func mapFile(file *os.File) ([]byte, func() error, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := info.Size()
+	if size <= 0 || int64(int(size)) != size {
+		return nil, nil, fmt.Errorf("can't map %d bytes", size)
+	}
+
+	content, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, func() error { return syscall.Munmap(content) }, nil
+}
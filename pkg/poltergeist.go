@@ -35,14 +35,25 @@
 package poltergeist
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -51,13 +62,77 @@ import (
 type ScanResult struct {
 	FilePath                string  `json:"file_path"`
 	LineNumber              int     `json:"line_number"`
-	Match                   string  `json:"-"`                           // The original matched text (excluded from JSON)
-	Redacted                string  `json:"redacted"`                    // The redacted version of the match
-	RuleName                string  `json:"rule_name"`                   // Name of the rule that matched
-	RuleID                  string  `json:"rule_id"`                     // ID of the rule that matched
-	Entropy                 float64 `json:"entropy"`                     // Calculated Shannon entropy of the match
-	RuleEntropyThreshold    float64 `json:"rule_entropy_threshold"`      // Entropy threshold from the rule
-	RuleEntropyThresholdMet bool    `json:"rule_entropy_threshold_met"`  // Whether the match met the minimum entropy requirement
+	Column                  int     `json:"column"`                     // 1-based byte column of the start of the match on LineNumber (a tab counts as one byte)
+	EndLineNumber           int     `json:"end_line_number"`            // Line on which the match ends (equal to LineNumber unless the match spans lines)
+	EndColumn               int     `json:"end_column"`                 // 1-based byte column just past the end of the match on EndLineNumber
+	Match                   string  `json:"-"`                          // The original matched text (excluded from JSON)
+	Redacted                string  `json:"redacted"`                   // The redacted version of the match
+	RuleName                string  `json:"rule_name"`                  // Name of the rule that matched
+	RuleID                  string  `json:"rule_id"`                    // ID of the rule that matched
+	Severity                string  `json:"severity"`                   // Severity of the rule that matched
+	Entropy                 float64 `json:"entropy"`                    // Calculated Shannon entropy of the match
+	RuleEntropyThreshold    float64 `json:"rule_entropy_threshold"`     // Entropy threshold from the rule
+	RuleEntropyThresholdMet bool    `json:"rule_entropy_threshold_met"` // Whether the match met the minimum entropy requirement
+	Encoding                string  `json:"encoding,omitempty"`         // Encodings the match was decoded from, outermost first, e.g. "base64" (set when Scanner.DecodeEncodedBlobs is true)
+	Verified                *bool   `json:"verified,omitempty"`         // Whether the secret is active, if it was verified (set when Scanner.Verify is true)
+
+	GitAuthor    string    `json:"git_author,omitempty"`   // Author of the last change to the match's line (set when Scanner.GitBlame is true and the line is committed, and by ScanGitHistory to the commit that added the file version)
+	GitCommit    string    `json:"git_commit,omitempty"`   // Commit of the last change to the match's line
+	GitTimestamp time.Time `json:"git_timestamp,omitzero"` // Author time of GitCommit
+
+	Explanation   *MatchExplanation `json:"explanation,omitempty"`    // Why the match was or wasn't flagged (set when Scanner.ExplainMatches is true)
+	ContextBefore []string          `json:"context_before,omitempty"` // Lines preceding the match (set when Scanner.ContextLines > 0)
+	ContextAfter  []string          `json:"context_after,omitempty"`  // Lines following the match (set when Scanner.ContextLines > 0)
+}
+
+// Fingerprint returns a stable identifier for the finding: a hex SHA-256 over
+// the rule ID, the file path, and a SHA-256 of the matched secret. Identical
+// findings collapse to the same fingerprint regardless of line number, and
+// the raw secret can't be recovered from it. Path separators are normalized
+// so fingerprints match across operating systems.
+func (r ScanResult) Fingerprint() string {
+	secretHash := sha256.Sum256([]byte(r.Match))
+
+	h := sha256.New()
+	h.Write([]byte(r.RuleID + "\x00" + r.URIPath() + "\x00"))
+	h.Write([]byte(hex.EncodeToString(secretHash[:])))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// URIPath returns FilePath with forward slashes, whatever OS the scan ran
+// on, for output that must match across platforms such as fingerprints,
+// baselines, and SARIF URIs
+func (r ScanResult) URIPath() string {
+	return strings.ReplaceAll(r.FilePath, "\\", "/")
+}
+
+// CountUniqueSecrets returns the number of distinct matched values in
+// results, so a secret repeated across many files is counted once
+func CountUniqueSecrets(results []ScanResult) int {
+	seen := make(map[[sha256.Size]byte]struct{}, len(results))
+	for _, result := range results {
+		seen[sha256.Sum256([]byte(result.Match))] = struct{}{}
+	}
+	return len(seen)
+}
+
+// SortResults sorts results in place by file path, line number, rule ID, and
+// column, so output is the same from run to run
+func SortResults(results []ScanResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.FilePath != b.FilePath {
+			return a.FilePath < b.FilePath
+		}
+		if a.LineNumber != b.LineNumber {
+			return a.LineNumber < b.LineNumber
+		}
+		if a.RuleID != b.RuleID {
+			return a.RuleID < b.RuleID
+		}
+		return a.Column < b.Column
+	})
 }
 
 // MatchResult represents a single pattern match within content
@@ -68,17 +143,47 @@ type MatchResult struct {
 	Redacted                string  // The redacted text
 	RuleName                string  // Name of the rule that matched
 	RuleID                  string  // ID of the rule that matched
+	Severity                string  // Severity of the rule that matched
+	Priority                int     // Priority of the rule that matched
+	Encoding                string  // Encodings the match was decoded from, outermost first, or empty
 	Entropy                 float64 // Calculated Shannon entropy of the match
 	RuleEntropyThreshold    float64 // Entropy threshold from the rule
 	RuleEntropyThresholdMet bool    // Whether the match met the minimum entropy requirement
+
+	redact   []int // Redaction offsets of the rule, for redacting with Scanner.Mask
+	ruleMask bool  // Whether the rule sets its own mask, which takes precedence over Scanner.Mask
 }
 
 // ScanMetrics tracks scanning statistics
 type ScanMetrics struct {
-	FilesScanned int64 // Number of files actually scanned (not skipped)
-	FilesSkipped int64 // Number of files skipped (binary, too large, etc.)
-	TotalBytes   int64 // Total bytes of content scanned
-	MatchesFound int64 // Total number of matches found
+	FilesScanned  int64 // Number of files actually scanned (not skipped)
+	FilesSkipped  int64 // Number of files skipped (binary, too large, etc.)
+	TotalBytes    int64 // Total bytes of content scanned
+	MatchesFound  int64 // Total number of matches found
+	UniqueSecrets int64 // Number of distinct matched values among MatchesFound
+	ErrorsDropped int64 // Number of errors not delivered because the Errors channel was full
+}
+
+// ScanError describes a file that could not be accessed or scanned
+type ScanError struct {
+	Path string // Path of the file as reported in results
+	Err  error  // The underlying error
+}
+
+// Error implements the error interface
+func (e ScanError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e ScanError) Unwrap() error {
+	return e.Err
+}
+
+// ScanReport is the outcome of ScanDirectoryReport
+type ScanReport struct {
+	Results []ScanResult // Matches found
+	Errors  []ScanError  // Files that could not be accessed or scanned, sorted by path
 }
 
 // Scanner represents the secret scanner configuration
@@ -87,13 +192,217 @@ type Scanner struct {
 	WorkerCount      int
 	MaxFileSize      int64 // Maximum file size to scan (in bytes)
 	DisableRedaction bool  // If true, show full matches instead of redacted versions
+	Mask             Mask  // How redacted text is masked, for rules that don't set their own mask
+	WholeFile        bool  // If true, scan each file as a single block so matches can span lines
+	ExplainMatches   bool  // If true, attach a MatchExplanation to each result
+	DedupeOverlaps   bool  // If true, keep only the highest priority of overlapping matches from different rules
+	MaxFindings      int   // Stop directory scans after this many findings that meet their entropy threshold (0 = unlimited)
+	Verify           bool  // If true, check findings with the Verifier registered for their rule (see RegisterVerifier; not for ScanDirectoryStream)
+	GitBlame         bool  // If true, set the Git fields of findings in git working trees from git blame (not for ScanFS or streamed scans)
+	MaxCommits       int   // Limit ScanGitHistory to this many of the most recent commits (0 = all)
 	Metrics          *ScanMetrics
+
+	// RemoteToken, if set, authenticates ScanRemoteRepo's clones of private
+	// repositories over HTTPS. It's sent as the password of an HTTP Basic
+	// Authorization header, which GitHub and GitLab accept for access tokens.
+	RemoteToken string
+
+	// Errors, if set, receives each per-file error encountered while scanning a
+	// directory. Sends never block: when the channel is full the error is
+	// dropped and counted in Metrics.ErrorsDropped.
+	Errors chan<- ScanError
+
+	// RespectIgnoreFiles skips files excluded by .gitignore files found while
+	// walking a directory and by a .poltergeistignore file at the scan root.
+	// Ignored files are neither scanned nor counted. Enabled by default.
+	RespectIgnoreFiles bool
+
+	// RespectGitAttributes skips files marked binary or -text by .gitattributes
+	// files found while walking a directory, without reading them, and scans
+	// files marked text whatever their extension or content. Enabled by
+	// default.
+	RespectGitAttributes bool
+
+	// MaxInFlight is the maximum number of files queued for workers, and of
+	// results queued for collection, during a directory scan. It bounds the
+	// memory a scan uses beyond its results when the walk outpaces the
+	// workers or the workers outpace the consumer of ScanDirectoryStream.
+	// Defaults to DefaultMaxInFlight.
+	MaxInFlight int
+
+	// MmapThreshold, if positive, is the size from which files are
+	// memory-mapped and scanned as a single block, as with WholeFile, instead
+	// of being read line by line. This avoids copying large files into
+	// lines, but lets matches span lines. Files that can't be mapped, and
+	// all files on platforms without mmap, are read as usual.
+	MmapThreshold int64
+
+	// WalkConcurrency is the maximum number of directories read at once
+	// during a directory walk. Subdirectories are walked concurrently so
+	// workers aren't starved on trees of many small files, while the file
+	// descriptors held open stay within WalkConcurrency plus one per worker.
+	// 1 walks serially. Defaults to DefaultWalkConcurrency.
+	WalkConcurrency int
+
+	// FollowSymlinks walks symbolic links to directories during directory
+	// scans, such as those of mounted trees, and scans symbolic links to
+	// files at their target's size. Each directory is walked once, under the
+	// first of its paths reached, so links to an ancestor don't loop. Links
+	// are only followed on platforms with inodes (not Windows).
+	FollowSymlinks bool
+
+	// SkipDirs lists directory names (or glob patterns matched against the
+	// name) whose whole subtree is pruned from directory walks. Defaults to
+	// DefaultSkipDirs.
+	SkipDirs []string
+
+	// IncludeGlobs and ExcludeGlobs are globs of paths, relative to the
+	// scanned directory and slash-separated, that scope a directory scan
+	// independently of ignore files. When IncludeGlobs is non-empty only
+	// files matching one of them are scanned, and files matching one of
+	// ExcludeGlobs never are; files left out are neither scanned nor
+	// counted. A "**" segment matches any number of directories, so
+	// "**/*.env" matches env files anywhere and "testdata/**" everything in
+	// testdata. Directories matching one of ExcludeGlobs are pruned from
+	// the walk.
+	IncludeGlobs []string
+	ExcludeGlobs []string
+
+	// ContextLines is the number of lines before and after each match to
+	// include in ScanResult.ContextBefore and ContextAfter. Unless
+	// DisableRedaction is set, secrets in context lines are redacted.
+	ContextLines int
+
+	// Logger receives per-file access and scan errors as structured log
+	// records with path and error attributes, and at debug level each file
+	// scanned, or skipped with a reason attribute. Defaults to discarding them.
+	Logger *slog.Logger
+
+	// MaxLineLength is the length above which a line is scanned in
+	// overlapping segments instead of as a whole, bounding memory use on
+	// minified files and data blobs. Segments overlap by up to half this
+	// length, so matches longer than that may be missed across segment
+	// boundaries. 0 or less reads each line whole, however long.
+	// Defaults to DefaultMaxLineLength.
+	MaxLineLength int
+
+	// DecodeEncodedBlobs decodes base64 and hex runs of at least 20
+	// characters and scans the decoded text with the same rules, to find
+	// secrets embedded in encoded config or tokens. Findings span the
+	// encoded run and set ScanResult.Encoding. Decoded text is decoded once
+	// more, but no further.
+	DecodeEncodedBlobs bool
+
+	// MaxDecompressedSize is the most content scanned from a gzip file or an
+	// archive entry once decompressed. Files that decompress to more fail with
+	// ErrDecompressedSizeLimit. 0 skips gzip, tar, and zip files as binary.
+	// Defaults to DefaultMaxDecompressedSize.
+	MaxDecompressedSize int64
+
+	// MaxArchiveSize is the most content scanned from all the entries of a
+	// tar or zip archive once decompressed, and MaxArchiveEntries the most
+	// entries. Archives over either limit fail with ErrDecompressedSizeLimit
+	// or ErrArchiveEntryLimit. 0 means no limit. Defaults to
+	// DefaultMaxArchiveSize and DefaultMaxArchiveEntries.
+	MaxArchiveSize    int64
+	MaxArchiveEntries int
+
+	// BinaryExtensions are the lowercase extensions, with the leading dot,
+	// of files skipped as binary unless their content sniffs as text. With
+	// SniffBytes 0, they are skipped without reading them. Gzip, tar, and
+	// zip files are still extracted unless MaxDecompressedSize is 0.
+	// Defaults to DefaultBinaryExtensions.
+	BinaryExtensions map[string]bool
+
+	// ForceScanExtensions are lowercase extensions, with the leading dot, of
+	// files scanned even if their extension or content looks binary, such
+	// as ".pdf".
+	ForceScanExtensions []string
+
+	// SniffBytes is the number of bytes at the start of a file checked for
+	// binary content: content with a null byte, of a binary MIME type such as
+	// an image or executable, or with more than BinaryThreshold of its bytes
+	// non-printable. Content of a text MIME type is scanned whatever the
+	// file's extension. 0 or less disables the check. Defaults to
+	// DefaultSniffBytes and DefaultBinaryThreshold.
+	SniffBytes      int
+	BinaryThreshold float64
+
+	// OnProgress, if set, is called during directory scans with the number
+	// of files scanned and skipped so far, every progressInterval files and
+	// once when the walk finishes. Calls are serialized and the counts never
+	// decrease between calls, but the callback should return quickly as it
+	// holds up the worker that triggered it.
+	OnProgress func(scanned, skipped int64)
+
+	progressMu    sync.Mutex // Serializes OnProgress calls
+	progressFiles int64      // Files processed since the scanner was created
+
+	statsMu   sync.Mutex                     // Guards ruleStats and secrets
+	ruleStats map[string]int64               // Matches found per rule ID
+	secrets   map[[sha256.Size]byte]struct{} // Hashes of the distinct matched values
 }
 
+// progressInterval is the number of files between OnProgress calls
+const progressInterval = 16
+
+// DefaultSniffBytes is the default number of bytes at the start of a file
+// checked for binary content
+const DefaultSniffBytes = 512
+
+// DefaultBinaryThreshold is the default fraction of non-printable bytes above
+// which content is considered binary
+const DefaultBinaryThreshold = 0.30
+
+// DefaultBinaryExtensions are the extensions of files skipped as binary
+// without reading them by default
+var DefaultBinaryExtensions = map[string]bool{
+	".a":     true,
+	".avi":   true,
+	".bin":   true,
+	".bmp":   true,
+	".class": true,
+	".dll":   true,
+	".doc":   true,
+	".docx":  true,
+	".dylib": true,
+	".exe":   true,
+	".gif":   true,
+	".gz":    true,
+	".img":   true,
+	".iso":   true,
+	".jar":   true,
+	".jpg":   true,
+	".jpeg":  true,
+	".lib":   true,
+	".mov":   true,
+	".mp3":   true,
+	".mp4":   true,
+	".o":     true,
+	".obj":   true,
+	".pdf":   true,
+	".png":   true,
+	".rar":   true,
+	".so":    true,
+	".tar":   true,
+	".war":   true,
+	".xls":   true,
+	".xlsx":  true,
+	".zip":   true,
+}
+
+// DefaultSkipDirs are the directory names skipped by default. They rarely
+// contain first-party code and are expensive to walk.
+var DefaultSkipDirs = []string{".git", "node_modules", "vendor", "dist", "build"}
+
 // FileJob represents a file to be scanned
 type FileJob struct {
-	Path string
+	FS   fs.FS  // Filesystem containing the file (nil for the OS filesystem)
+	Name string // Name of the file within FS
+	Path string // Path reported in results
 	Info os.FileInfo
+
+	text bool // Marked text by .gitattributes, so scanned without binary checks
 }
 
 // LoadRulesFromFile loads rules from a YAML file
@@ -108,6 +417,10 @@ func LoadRulesFromFile(filename string) ([]Rule, error) {
 		return nil, fmt.Errorf("failed to parse YAML: %w", err)
 	}
 
+	if err := validateRules(ruleFile.Rules); err != nil {
+		return nil, err
+	}
+
 	return ruleFile.Rules, nil
 }
 
@@ -154,6 +467,32 @@ func LoadRules(path string) ([]Rule, error) {
 	}
 }
 
+// LoadRulesFromPaths loads and merges rules from a mix of files and
+// directories. Rule IDs must be unique across all paths; a duplicate ID is
+// reported as an error naming both paths.
+func LoadRulesFromPaths(paths []string) ([]Rule, error) {
+	var allRules []Rule
+	sources := make(map[string]string)
+
+	for _, path := range paths {
+		rules, err := LoadRules(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load rules from %s: %w", path, err)
+		}
+
+		for _, rule := range rules {
+			if source, ok := sources[rule.ID]; ok {
+				return nil, fmt.Errorf("duplicate rule ID '%s' in %s (already loaded from %s)", rule.ID, path, source)
+			}
+			sources[rule.ID] = path
+		}
+
+		allRules = append(allRules, rules...)
+	}
+
+	return allRules, nil
+}
+
 // IsHyperscanAvailable checks if hyperscan engine can be used
 func IsHyperscanAvailable() bool {
 	// Try to create a hyperscan engine and test compilation
@@ -191,6 +530,19 @@ func NewScanner(engine PatternEngine) *Scanner {
 		WorkerCount: 8,                 // Reasonable default
 		MaxFileSize: 100 * 1024 * 1024, // 100MB max file size
 		Metrics:     &ScanMetrics{},
+
+		RespectIgnoreFiles:  true,
+		SkipDirs:            slices.Clone(DefaultSkipDirs),
+		MaxLineLength:       DefaultMaxLineLength,
+		Logger:              slog.New(slog.DiscardHandler),
+		MaxDecompressedSize: DefaultMaxDecompressedSize,
+		MaxArchiveSize:      DefaultMaxArchiveSize,
+		MaxArchiveEntries:   DefaultMaxArchiveEntries,
+		BinaryExtensions:    maps.Clone(DefaultBinaryExtensions),
+		SniffBytes:          DefaultSniffBytes,
+		BinaryThreshold:     DefaultBinaryThreshold,
+
+		RespectGitAttributes: true,
 	}
 }
 
@@ -201,6 +553,19 @@ func NewScannerWithOptions(engine PatternEngine, workerCount int, maxFileSize in
 		WorkerCount: workerCount,
 		MaxFileSize: maxFileSize,
 		Metrics:     &ScanMetrics{},
+
+		RespectIgnoreFiles:  true,
+		SkipDirs:            slices.Clone(DefaultSkipDirs),
+		MaxLineLength:       DefaultMaxLineLength,
+		Logger:              slog.New(slog.DiscardHandler),
+		MaxDecompressedSize: DefaultMaxDecompressedSize,
+		MaxArchiveSize:      DefaultMaxArchiveSize,
+		MaxArchiveEntries:   DefaultMaxArchiveEntries,
+		BinaryExtensions:    maps.Clone(DefaultBinaryExtensions),
+		SniffBytes:          DefaultSniffBytes,
+		BinaryThreshold:     DefaultBinaryThreshold,
+
+		RespectGitAttributes: true,
 	}
 }
 
@@ -218,24 +583,211 @@ func FormatBytes(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
-// ScanDirectory scans a directory for pattern matches using parallel workers
+// ActiveRules returns the rules compiled into the scanner's engine, or nil if
+// the engine doesn't report them. Disabled rules are never active.
+func (s *Scanner) ActiveRules() []RuntimeRule {
+	if lister, ok := s.Engine.(interface{ Rules() []RuntimeRule }); ok {
+		return lister.Rules()
+	}
+	return nil
+}
+
+// ResetMetrics sets all metrics and rule statistics to zero, for measuring
+// each scan made with the same scanner. It must not be called while a scan is
+// running.
+func (s *Scanner) ResetMetrics() {
+	atomic.StoreInt64(&s.Metrics.FilesScanned, 0)
+	atomic.StoreInt64(&s.Metrics.FilesSkipped, 0)
+	atomic.StoreInt64(&s.Metrics.TotalBytes, 0)
+	atomic.StoreInt64(&s.Metrics.MatchesFound, 0)
+	atomic.StoreInt64(&s.Metrics.ErrorsDropped, 0)
+	atomic.StoreInt64(&s.Metrics.UniqueSecrets, 0)
+
+	s.statsMu.Lock()
+	s.ruleStats = nil
+	s.secrets = nil
+	s.statsMu.Unlock()
+}
+
+// MetricsSnapshot returns a copy of the current metrics. It is safe to call
+// while a scan is running.
+func (s *Scanner) MetricsSnapshot() ScanMetrics {
+	return ScanMetrics{
+		FilesScanned:  atomic.LoadInt64(&s.Metrics.FilesScanned),
+		FilesSkipped:  atomic.LoadInt64(&s.Metrics.FilesSkipped),
+		TotalBytes:    atomic.LoadInt64(&s.Metrics.TotalBytes),
+		MatchesFound:  atomic.LoadInt64(&s.Metrics.MatchesFound),
+		UniqueSecrets: atomic.LoadInt64(&s.Metrics.UniqueSecrets),
+		ErrorsDropped: atomic.LoadInt64(&s.Metrics.ErrorsDropped),
+	}
+}
+
+// RuleStats returns the number of matches found per rule ID, counted like
+// Metrics.MatchesFound before any entropy or severity filtering. Rules without
+// matches are absent. It is safe to call while a scan is running.
+func (s *Scanner) RuleStats() map[string]int64 {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	stats := make(map[string]int64, len(s.ruleStats))
+	for ruleID, count := range s.ruleStats {
+		stats[ruleID] = count
+	}
+	return stats
+}
+
+// countMatches adds the matches of a file to the per-rule statistics and the
+// distinct secret values. Only a hash of each value is kept.
+func (s *Scanner) countMatches(results []ScanResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	if s.ruleStats == nil {
+		s.ruleStats = make(map[string]int64)
+		s.secrets = make(map[[sha256.Size]byte]struct{})
+	}
+	for _, result := range results {
+		s.ruleStats[result.RuleID]++
+
+		hash := sha256.Sum256([]byte(result.Match))
+		if _, seen := s.secrets[hash]; !seen {
+			s.secrets[hash] = struct{}{}
+			atomic.AddInt64(&s.Metrics.UniqueSecrets, 1)
+		}
+	}
+}
+
+// ScanDirectory scans a directory for pattern matches using parallel workers.
+// The root may also be a single file. Result paths are rootPath joined with
+// the path of each file below it, and results are ordered as by SortResults.
+// Metrics are not reset between scans and accumulate across them; call
+// ResetMetrics first for per-scan counts.
+//
+// Every result, including those below their rule's entropy threshold, is held
+// in memory until the scan finishes, along with up to MaxInFlight queued
+// files and results. For very large trees, ScanDirectoryStream lets callers
+// keep only the results they need.
 func (s *Scanner) ScanDirectory(rootPath string) ([]ScanResult, error) {
-	// Channel for file jobs
-	jobs := make(chan FileJob, 1000)
+	return s.ScanDirectoryContext(context.Background(), rootPath)
+}
+
+// ScanDirectoryContext is like ScanDirectory but stops dispatching and scanning
+// files once ctx is done. When cancelled, the results found so far are
+// returned along with ctx.Err().
+func (s *Scanner) ScanDirectoryContext(ctx context.Context, rootPath string) ([]ScanResult, error) {
+	fsys, root, displayPath := directoryFS(rootPath)
+	results, err := s.scanFS(ctx, fsys, root, displayPath)
+	if s.GitBlame {
+		s.blameResults(ctx, results)
+	}
+	return results, err
+}
+
+// ScanDirectoryReport is like ScanDirectoryContext but also collects per-file
+// errors into the report, so callers can decide how to handle them. Errors
+// are still logged and delivered to the Errors channel if one is set. When
+// cancelled, the report holds the results and errors found so far and
+// ctx.Err() is returned.
+func (s *Scanner) ScanDirectoryReport(ctx context.Context, rootPath string) (*ScanReport, error) {
+	fsys, root, displayPath := directoryFS(rootPath)
+
+	errs := &errorCollector{}
+	results, err := s.collectFS(ctx, fsys, root, displayPath, errs)
+	if s.GitBlame {
+		s.blameResults(ctx, results)
+	}
+
+	sort.SliceStable(errs.errors, func(i, j int) bool {
+		return errs.errors[i].Path < errs.errors[j].Path
+	})
 
+	return &ScanReport{Results: results, Errors: errs.errors}, err
+}
+
+// ScanDirectoryStream is like ScanDirectoryContext but sends results on the
+// returned channel as they are found instead of collecting them in memory.
+// The results channel is closed when the scan finishes, after which the error
+// channel yields the scan error, if any, and is closed. Consumers must drain
+// the results channel or cancel ctx for the scan to finish. Results are sent
+// as found, so they are not verified even if Verify is set.
+func (s *Scanner) ScanDirectoryStream(ctx context.Context, rootPath string) (<-chan ScanResult, <-chan error) {
+	found := make(chan ScanResult, s.maxInFlight())
+	results := make(chan ScanResult, s.maxInFlight())
+	errc := make(chan error, 1)
+
+	var err error
+	go func() {
+		fsys, root, displayPath := directoryFS(rootPath)
+		err = s.walkFS(ctx, fsys, root, displayPath, found, nil)
+		close(found)
+	}()
+
+	// Forward results to the consumer, dropping them once the context is done
+	// in case the consumer has stopped reading
+	go func() {
+		defer close(errc)
+
+		for result := range found {
+			select {
+			case results <- result:
+			case <-ctx.Done():
+			}
+		}
+		close(results)
+
+		if err != nil {
+			errc <- err
+		}
+	}()
+
+	return results, errc
+}
+
+// directoryFS returns the filesystem, root, and display path mapping used to
+// scan rootPath. Result paths are rootPath joined with the path of each file
+// below it.
+func directoryFS(rootPath string) (fs.FS, string, func(name string) string) {
+	// Scan a single file from its parent directory so it is still walked
+	if info, err := os.Stat(rootPath); err == nil && !info.IsDir() {
+		return os.DirFS(filepath.Dir(rootPath)), filepath.Base(rootPath), func(string) string {
+			return rootPath
+		}
+	}
+
+	return os.DirFS(rootPath), ".", func(name string) string {
+		return filepath.Join(rootPath, filepath.FromSlash(name))
+	}
+}
+
+// ScanFS scans the tree rooted at root within fsys for pattern matches using
+// parallel workers. Result paths are the slash-separated names within fsys.
+// This allows scanning embedded or in-memory filesystems such as embed.FS
+// and fstest.MapFS.
+func (s *Scanner) ScanFS(fsys fs.FS, root string) ([]ScanResult, error) {
+	return s.scanFS(context.Background(), fsys, root, func(name string) string {
+		return name
+	})
+}
+
+// scanFS walks fsys from root and collects the results of every file. The
+// displayPath function maps a name within fsys to the path reported in results.
+func (s *Scanner) scanFS(ctx context.Context, fsys fs.FS, root string, displayPath func(name string) string) ([]ScanResult, error) {
+	return s.collectFS(ctx, fsys, root, displayPath, nil)
+}
+
+// collectFS is like scanFS but also adds per-file errors to errs if it is not
+// nil
+func (s *Scanner) collectFS(ctx context.Context, fsys fs.FS, root string, displayPath func(name string) string, errs *errorCollector) ([]ScanResult, error) {
 	// Channel for results
-	results := make(chan ScanResult, 1000)
+	results := make(chan ScanResult, s.maxInFlight())
 
 	// Channel to signal completion
 	done := make(chan bool)
 
-	// Start workers
-	var wg sync.WaitGroup
-	for i := 0; i < s.WorkerCount; i++ {
-		wg.Add(1)
-		go s.worker(jobs, results, &wg)
-	}
-
 	// Start result collector
 	var allResults []ScanResult
 	go func() {
@@ -245,123 +797,852 @@ func (s *Scanner) ScanDirectory(rootPath string) ([]ScanResult, error) {
 		done <- true
 	}()
 
+	err := s.walkFS(ctx, fsys, root, displayPath, results, errs)
+	close(results)
+
+	// Wait for result collection to complete
+	<-done
+
+	// Workers finish in arbitrary order
+	SortResults(allResults)
+
+	if s.Verify {
+		s.verifyResults(ctx, allResults)
+	}
+
+	return allResults, err
+}
+
+// walkFS walks fsys from root, dispatching files to parallel workers that send
+// their matches on results. Subdirectories are walked concurrently unless
+// WalkConcurrency is 1. Per-file errors are also added to errs if it is not
+// nil. It returns once every worker has finished.
+func (s *Scanner) walkFS(parent context.Context, fsys fs.FS, root string, displayPath func(name string) string, results chan<- ScanResult, errs *errorCollector) error {
+	// Stop the walk and workers early once MaxFindings is reached
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var limit *findingLimit
+	if s.MaxFindings > 0 {
+		limit = &findingLimit{max: int64(s.MaxFindings), cancel: cancel}
+	}
+
+	// Channel for file jobs
+	jobs := make(chan FileJob, s.maxInFlight())
+
+	// Start workers
+	var wg sync.WaitGroup
+	for i := 0; i < s.WorkerCount; i++ {
+		wg.Add(1)
+		go s.worker(ctx, jobs, results, errs, limit, &wg)
+	}
+
+	var ignore *ignoreMatcher
+	if s.RespectIgnoreFiles {
+		ignore = newIgnoreMatcher(fsys, root)
+	}
+
+	var attributes *attributesMatcher
+	if s.RespectGitAttributes {
+		attributes = newAttributesMatcher(fsys)
+	}
+
 	// Walk directory and send jobs
-	err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+	visit := func(name string, d fs.DirEntry, err error) error {
+		// Stop walking once the context is done
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error accessing %s: %v\n", path, err)
+			s.reportError(errs, "error accessing file", displayPath(name), err)
 			return nil // Continue with other files
 		}
 
+		// Prune skipped directories without visiting their contents
+		if d.IsDir() && name != root && s.skipDir(d.Name()) {
+			return fs.SkipDir
+		}
+
+		if ignore != nil && name != root && ignore.ignored(name, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			s.logSkipped(displayPath(name), "ignored")
+			return nil
+		}
+
+		if name != root && s.excluded(relativeName(root, name), d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			s.logSkipped(displayPath(name), "excluded")
+			return nil
+		}
+
 		// Skip directories
-		if info.IsDir() {
+		if d.IsDir() {
+			if ignore != nil {
+				ignore.enterDir(name)
+			}
+			if attributes != nil {
+				attributes.enterDir(name)
+			}
 			return nil
 		}
 
-		// Skip very large files
-		if info.Size() > s.MaxFileSize {
-			atomic.AddInt64(&s.Metrics.FilesSkipped, 1)
+		info, err := d.Info()
+		if err != nil {
+			s.reportError(errs, "error accessing file", displayPath(name), err)
+			return nil // Continue with other files
+		}
+
+		// Skip very large and empty files
+		if s.skipFileSize(displayPath(name), info) {
+			s.progress(false)
 			return nil
 		}
 
-		// Skip empty files
-		if info.Size() == 0 {
-			atomic.AddInt64(&s.Metrics.FilesSkipped, 1)
+		job := FileJob{FS: fsys, Name: name, Path: displayPath(name), Info: info}
+		if attributes != nil {
+			switch attributes.text(name) {
+			case textUnset:
+				s.logSkipped(job.Path, "binary (gitattributes)")
+				atomic.AddInt64(&s.Metrics.FilesSkipped, 1)
+				s.progress(false)
+				return nil
+			case textSet:
+				job.text = true
+			}
+		}
+
+		select {
+		case jobs <- job:
 			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
+	}
 
-		jobs <- FileJob{Path: path, Info: info}
-		return nil
-	})
+	var err error
+	if concurrency := s.walkConcurrency(); concurrency > 1 || s.FollowSymlinks {
+		err = walkDirConcurrent(fsys, root, walkOptions{
+			maxOpen:        concurrency,
+			followSymlinks: s.FollowSymlinks,
+			revisited: func(name string) {
+				if s.Logger != nil {
+					s.Logger.Debug("skipped directory", "path", displayPath(name), "reason", "already walked")
+				}
+			},
+		}, visit)
+	} else {
+		err = fs.WalkDir(fsys, root, visit)
+	}
 
 	// Close jobs channel and wait for workers to finish
 	close(jobs)
 	wg.Wait()
-	close(results)
 
-	// Wait for result collection to complete
-	<-done
+	s.progress(true)
 
-	return allResults, err
+	if ctxErr := parent.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	// Stopping at MaxFindings is not an error
+	if limit.reached() {
+		return nil
+	}
+
+	return err
+}
+
+// DefaultMaxInFlight is the default number of files queued for workers, and
+// of results queued for collection, during a directory scan
+const DefaultMaxInFlight = 1000
+
+// maxInFlight returns the number of files or results queued during a
+// directory scan
+func (s *Scanner) maxInFlight() int {
+	if s.MaxInFlight < 1 {
+		return DefaultMaxInFlight
+	}
+	return s.MaxInFlight
+}
+
+// findingLimit stops a scan once a maximum number of findings that meet
+// their entropy threshold is found
+type findingLimit struct {
+	max    int64
+	found  int64
+	cancel context.CancelFunc
+}
+
+// admit reports whether a result is within the limit, stopping the scan when
+// the limit is reached. Results below their entropy threshold are always
+// admitted. A nil limit admits every result.
+func (l *findingLimit) admit(result ScanResult) bool {
+	if l == nil || !result.RuleEntropyThresholdMet {
+		return true
+	}
+
+	found := atomic.AddInt64(&l.found, 1)
+	if found >= l.max {
+		l.cancel()
+	}
+	return found <= l.max
+}
+
+// reached reports whether the limit has been reached
+func (l *findingLimit) reached() bool {
+	return l != nil && atomic.LoadInt64(&l.found) >= l.max
+}
+
+// skipDir reports whether a directory name matches one of SkipDirs
+func (s *Scanner) skipDir(name string) bool {
+	for _, pattern := range s.SkipDirs {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether a path relative to the walk root is left out by
+// IncludeGlobs or ExcludeGlobs. Only ExcludeGlobs apply to directories, as
+// files within a directory can match an include that the directory doesn't.
+func (s *Scanner) excluded(name string, isDir bool) bool {
+	for _, pattern := range s.ExcludeGlobs {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	if isDir || len(s.IncludeGlobs) == 0 {
+		return false
+	}
+
+	for _, pattern := range s.IncludeGlobs {
+		if matchGlob(pattern, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// relativeName returns the path of name, a file or directory within a walk of
+// root, relative to root
+func relativeName(root, name string) string {
+	if root == "." {
+		return name
+	}
+	if rel, ok := strings.CutPrefix(name, root+"/"); ok {
+		return rel
+	}
+	return path.Base(name)
 }
 
 // worker processes file scan jobs
-func (s *Scanner) worker(jobs <-chan FileJob, results chan<- ScanResult, wg *sync.WaitGroup) {
+func (s *Scanner) worker(ctx context.Context, jobs <-chan FileJob, results chan<- ScanResult, errs *errorCollector, limit *findingLimit, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for job := range jobs {
-		if isBinaryFile(job.Path) {
-			atomic.AddInt64(&s.Metrics.FilesSkipped, 1)
+		// Once the context is done, drain remaining jobs without scanning them
+		if ctx.Err() != nil {
 			continue
 		}
 
-		fileResults, err := s.scanFile(job.Path)
+		fileResults, err := s.scanJob(job)
+		s.progress(false)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error scanning %s: %v\n", job.Path, err)
-			atomic.AddInt64(&s.Metrics.FilesSkipped, 1)
+			s.reportError(errs, "error scanning file", job.Path, err)
 			continue
 		}
 
-		// Successfully scanned a file
-		atomic.AddInt64(&s.Metrics.FilesScanned, 1)
-		atomic.AddInt64(&s.Metrics.TotalBytes, job.Info.Size())
+		for _, result := range fileResults {
+			if limit.admit(result) {
+				results <- result
+			}
+		}
+	}
+}
 
-		// Track matches found
-		matchCount := int64(len(fileResults))
-		atomic.AddInt64(&s.Metrics.MatchesFound, matchCount)
+// progress records that a file was processed, calling OnProgress every
+// progressInterval files, or regardless if final is set
+func (s *Scanner) progress(final bool) {
+	if s.OnProgress == nil {
+		return
+	}
+	if !final && atomic.AddInt64(&s.progressFiles, 1)%progressInterval != 0 {
+		return
+	}
 
-		for _, result := range fileResults {
-			results <- result
+	// Load the counters under the lock so successive calls never go backwards
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	s.OnProgress(atomic.LoadInt64(&s.Metrics.FilesScanned), atomic.LoadInt64(&s.Metrics.FilesSkipped))
+}
+
+// errorCollector accumulates the per-file errors of a scan from concurrent
+// workers
+type errorCollector struct {
+	mu     sync.Mutex
+	errors []ScanError
+}
+
+// add records a per-file error
+func (c *errorCollector) add(err ScanError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors = append(c.errors, err)
+}
+
+// reportError logs a per-file error, adds it to errs if it is not nil, and
+// delivers it to the Errors channel if one is set, without blocking the caller
+func (s *Scanner) reportError(errs *errorCollector, msg, path string, err error) {
+	if s.Logger != nil {
+		s.Logger.Warn(msg, "path", path, "error", redactSecrets(err.Error()))
+	}
+
+	if errs != nil {
+		errs.add(ScanError{Path: path, Err: err})
+	}
+
+	if s.Errors == nil {
+		return
+	}
+
+	select {
+	case s.Errors <- ScanError{Path: path, Err: err}:
+	default:
+		atomic.AddInt64(&s.Metrics.ErrorsDropped, 1)
+	}
+}
+
+// ScanFile scans a single file for pattern matches. The file is subject to the
+// same size and binary checks as files found by ScanDirectory, and the scanner
+// metrics are updated in the same way.
+func (s *Scanner) ScanFile(filePath string) ([]ScanResult, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", filePath)
+	}
+
+	// Skip very large and empty files
+	if s.skipFileSize(filePath, info) {
+		return nil, nil
+	}
+
+	results, err := s.scanJob(FileJob{Name: filePath, Path: filePath, Info: info})
+	if s.Verify {
+		s.verifyResults(context.Background(), results)
+	}
+	if s.GitBlame {
+		s.blameResults(context.Background(), results)
+	}
+	return results, err
+}
+
+// ScanPaths scans a mix of files and directories, scanning each file as
+// ScanFile does and walking each directory as ScanDirectory does. Results of
+// every path are merged and ordered as by SortResults, and the scanner
+// metrics accumulate across them. Every path must exist.
+func (s *Scanner) ScanPaths(paths []string) ([]ScanResult, error) {
+	return s.ScanPathsContext(context.Background(), paths)
+}
+
+// ScanPathsContext is like ScanPaths but stops scanning once ctx is done. When
+// cancelled, the results found so far are returned along with ctx.Err().
+func (s *Scanner) ScanPathsContext(ctx context.Context, paths []string) ([]ScanResult, error) {
+	infos := make([]os.FileInfo, len(paths))
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
 		}
+		infos[i] = info
 	}
+
+	var results []ScanResult
+	for i, path := range paths {
+		if err := ctx.Err(); err != nil {
+			SortResults(results)
+			return results, err
+		}
+
+		var pathResults []ScanResult
+		var err error
+		if infos[i].IsDir() {
+			pathResults, err = s.ScanDirectoryContext(ctx, path)
+		} else {
+			pathResults, err = s.ScanFile(path)
+		}
+		results = append(results, pathResults...)
+		if err != nil {
+			SortResults(results)
+			return results, err
+		}
+	}
+
+	SortResults(results)
+	return results, nil
 }
 
-// scanFile scans a single file for pattern matches
-func (s *Scanner) scanFile(filePath string) ([]ScanResult, error) {
-	file, err := os.Open(filePath)
+// skipFileSize reports whether a file should be skipped because it is too large
+// or empty, counting it as skipped if so
+func (s *Scanner) skipFileSize(path string, info os.FileInfo) bool {
+	switch {
+	case info.Size() == 0:
+		s.logSkipped(path, "empty")
+	case info.Size() > s.MaxFileSize:
+		s.logSkipped(path, "too large")
+	default:
+		return false
+	}
+
+	atomic.AddInt64(&s.Metrics.FilesSkipped, 1)
+	return true
+}
+
+// logSkipped logs a file skipped without scanning it at debug level
+func (s *Scanner) logSkipped(path, reason string) {
+	if s.Logger != nil {
+		s.Logger.Debug("skipped file", "path", path, "reason", reason)
+	}
+}
+
+// scanJob scans a single file job, skipping binary files and updating metrics
+func (s *Scanner) scanJob(job FileJob) ([]ScanResult, error) {
+	fileResults, binary, err := s.scanFile(job)
+	if binary {
+		// Files found to be binary partway through keep the findings in the
+		// text before the binary content
+		atomic.AddInt64(&s.Metrics.FilesSkipped, 1)
+		atomic.AddInt64(&s.Metrics.MatchesFound, int64(len(fileResults)))
+		s.countMatches(fileResults)
+		return fileResults, err
+	}
 	if err != nil {
+		atomic.AddInt64(&s.Metrics.FilesSkipped, 1)
 		return nil, err
 	}
+
+	// Successfully scanned a file
+	if s.Logger != nil {
+		s.Logger.Debug("scanned file", "path", job.Path, "matches", len(fileResults))
+	}
+	atomic.AddInt64(&s.Metrics.FilesScanned, 1)
+	atomic.AddInt64(&s.Metrics.TotalBytes, job.Info.Size())
+
+	// Track matches found
+	matchCount := int64(len(fileResults))
+	atomic.AddInt64(&s.Metrics.MatchesFound, matchCount)
+	s.countMatches(fileResults)
+
+	return fileResults, nil
+}
+
+// scanFile scans a single file for pattern matches, reporting whether it was
+// skipped as binary instead
+func (s *Scanner) scanFile(job FileJob) ([]ScanResult, bool, error) {
+	// Without content sniffing, skip known binary types before opening the file
+	if s.SniffBytes <= 0 && !job.text && s.hasBinaryExtension(job.Name) && !s.forceScan(job.Name) && !(s.MaxDecompressedSize > 0 && hasArchiveExtension(job.Name)) {
+		s.logSkipped(job.Path, "binary extension")
+		return nil, true, nil
+	}
+
+	var file fs.File
+	var err error
+	if job.FS != nil {
+		file, err = job.FS.Open(job.Name)
+	} else {
+		file, err = os.Open(job.Name)
+	}
+	if err != nil {
+		return nil, false, err
+	}
 	defer file.Close()
 
+	// Map large files instead of reading them, falling back to reading if
+	// the file can't be mapped
+	if osFile, ok := file.(*os.File); ok && s.MmapThreshold > 0 && job.Info.Size() >= s.MmapThreshold {
+		content, unmap, err := mapFile(osFile)
+		if err == nil {
+			defer unmap()
+			if job.text {
+				return s.scanContent(job.Path, content), false, nil
+			}
+			return s.scanMapped(content, job.Path)
+		}
+		if s.Logger != nil {
+			s.Logger.Debug("mmap failed, reading file instead", "path", job.Path, "error", err)
+		}
+	}
+
+	// Files marked text are scanned as they are, without sniffing
+	if job.text {
+		results, _, err := s.scanReader(file, job.Path, false)
+		return results, false, err
+	}
+
+	return s.scanStream(file, job.Path, 0)
+}
+
+// scanStream scans the content of a file read from r, extracting compressed
+// files and archives nested up to depth levels, and reporting whether it was
+// skipped as binary instead. Content found to be binary partway through is
+// also reported as binary, along with the results of the text before it.
+func (s *Scanner) scanStream(r io.Reader, filePath string, depth int) ([]ScanResult, bool, error) {
+	// Check the first bytes of the content for archives and binary content
+	head, content, err := sniff(r, max(s.SniffBytes, archiveSniffBytes))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if s.MaxDecompressedSize > 0 && depth < maxArchiveDepth {
+		switch {
+		case isGzip(head):
+			return s.scanGzip(content, filePath, depth)
+		case isZip(head):
+			return s.scanZip(r, content, filePath, depth)
+		case isTar(head):
+			return s.scanTar(content, filePath, depth)
+		}
+	}
+
+	// UTF-16 is transcoded to UTF-8, so its null bytes don't mark it binary
+	if decoded, ok := decodeUTF16(head, content); ok {
+		head, content, err = sniff(decoded, max(s.SniffBytes, 0))
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if !s.forceScan(filePath) && s.isBinary(filePath, head[:min(len(head), max(s.SniffBytes, 0))]) {
+		s.logSkipped(filePath, "binary")
+		return nil, true, nil
+	}
+
+	results, binary, err := s.scanReader(content, filePath, s.checkContent(filePath))
+	if binary {
+		s.logSkipped(filePath, "binary content after the first bytes")
+	}
+	return results, binary, err
+}
+
+// ScanReader scans content read from r for pattern matches, using name as the
+// FilePath of each result. This allows scanning in-memory content or streams
+// (HTTP bodies, stdin, archive entries) without writing them to disk first.
+// Unlike ScanFile, no binary or size checks are applied and the scanner
+// metrics are not updated.
+func (s *Scanner) ScanReader(r io.Reader, name string) ([]ScanResult, error) {
+	results, _, err := s.scanReader(r, name, false)
+	if s.Verify {
+		s.verifyResults(context.Background(), results)
+	}
+	return results, err
+}
+
+// scanReader is like ScanReader, but if stopAtBinary is set it stops at the
+// first line holding a null byte, reporting the content as binary along with
+// the results of the lines before it
+func (s *Scanner) scanReader(r io.Reader, name string, stopAtBinary bool) ([]ScanResult, bool, error) {
+	if s.WholeFile {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, false, err
+		}
+
+		var binary bool
+		if stopAtBinary {
+			content, binary = textPrefix(content)
+		}
+		return s.scanContent(name, content), binary, nil
+	}
+
+	return s.scanLines(r, name, stopAtBinary)
+}
+
+// textPrefix returns content up to the start of the first line holding a
+// null byte, and whether there is such a line
+func textPrefix(content []byte) ([]byte, bool) {
+	i := bytes.IndexByte(content, 0)
+	if i < 0 {
+		return content, false
+	}
+
+	lineStarts := lineStartOffsets(content[:i])
+	return content[:lineStarts[len(lineStarts)-1]], true
+}
+
+// scanLines scans content read from r line by line for pattern matches,
+// stopping at the first line holding a null byte if stopAtBinary is set and
+// reporting whether it did
+func (s *Scanner) scanLines(r io.Reader, filePath string, stopAtBinary bool) ([]ScanResult, bool, error) {
 	var results []ScanResult
-	scanner := bufio.NewScanner(file)
+	lines := newLineReader(r, max(s.MaxLineLength, 0))
 	lineNumber := 1
 
-	// Use a larger buffer for better performance
-	buf := make([]byte, 0, 128*1024)
-	scanner.Buffer(buf, 1024*1024*10) // 10MB max line length
+	// Inline directives suppress findings on their own line and the next
+	var previous, current *suppression
+
+	// Context lines are kept in a sliding window for the lines before a
+	// match, and appended to pending results as the lines after are read.
+	// Lines longer than the maximum line length contribute their first
+	// segment.
+	var before []string
+	var pending []int
+	var contextLine string
+
+	for lines.next() {
+		// Lines longer than the maximum line length are read in overlapping
+		// segments; offset is the position of this segment within the line
+		line := lines.text()
+		offset := lines.offset
+
+		// Binary content past the sniffed bytes would only produce garbage
+		// matches
+		if stopAtBinary && strings.IndexByte(line, 0) >= 0 {
+			return results, true, nil
+		}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+		if offset == 0 {
+			current = parseSuppression(line)
+			if s.ContextLines > 0 {
+				contextLine = line
+				pending = s.appendContextAfter(results, pending, line)
+			}
+		} else if current == nil {
+			current = parseSuppression(line)
+		}
 
 		// Find all matches in this line
 		matches := s.Engine.FindAllInLine(line)
 
 		// Filter out generic matches that overlap with non-generic matches
 		matches = filterOverlappingGenericMatches(matches)
+		if s.DedupeOverlaps {
+			matches = dedupeOverlappingMatches(matches)
+		}
+		if s.DecodeEncodedBlobs {
+			matches = append(matches, s.encodedMatches(line)...)
+		}
 
 		for _, match := range matches {
-			results = append(results, ScanResult{
-				FilePath:                filePath,
-				LineNumber:              lineNumber,
-				Match:                   match.Match,
-				Redacted:                match.Redacted,
-				RuleName:                match.RuleName,
-				RuleID:                  match.RuleID,
-				Entropy:                 match.Entropy,
-				RuleEntropyThreshold:    match.RuleEntropyThreshold,
-				RuleEntropyThresholdMet: match.RuleEntropyThresholdMet,
-			})
+			if current.suppresses(match.RuleID) || previous.suppresses(match.RuleID) {
+				continue
+			}
+
+			// Matches within the overlap were found in the previous segment
+			if offset+match.End <= lines.prevEnd {
+				continue
+			}
+
+			result := s.newScanResult(filePath, match)
+			result.LineNumber = lineNumber
+			result.Column = offset + match.Start + 1
+			result.EndLineNumber = lineNumber
+			result.EndColumn = offset + match.End + 1
+
+			if s.ContextLines > 0 {
+				result.ContextBefore = s.contextLines(before, result)
+				pending = append(pending, len(results))
+			}
+
+			results = append(results, result)
 		}
 
+		if !lines.last {
+			continue
+		}
+
+		if s.ContextLines > 0 {
+			before = append(before, contextLine)
+			if len(before) > s.ContextLines {
+				before = before[1:]
+			}
+		}
+
+		previous = current
 		lineNumber++
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	if lines.err != nil {
+		return nil, false, lines.err
 	}
 
-	return results, nil
+	return results, false, nil
+}
+
+// scanContent scans the content of a file as a single block, mapping match
+// offsets back to line and column positions so matches may span lines. A
+// leading UTF-8 byte order mark is skipped, as lineReader skips it.
+func (s *Scanner) scanContent(filePath string, content []byte) []ScanResult {
+	content = bytes.TrimPrefix(content, utf8BOM)
+	matches := s.Engine.FindAllInContent(content)
+
+	// Filter out generic matches that overlap with non-generic matches
+	matches = filterOverlappingGenericMatches(matches)
+	if s.DedupeOverlaps {
+		matches = dedupeOverlappingMatches(matches)
+	}
+	if s.DecodeEncodedBlobs {
+		matches = append(matches, s.encodedMatches(string(content))...)
+	}
+
+	lineStarts := lineStartOffsets(content)
+
+	var results []ScanResult
+	for _, match := range matches {
+		lineNumber, column := offsetToLineColumn(lineStarts, match.Start)
+		endLineNumber, endColumn := matchEndPosition(lineStarts, match.Start, match.End)
+
+		// Inline directives on the line a match starts on, or the line
+		// before it, suppress the match
+		if parseSuppression(contentLine(content, lineStarts, lineNumber)).suppresses(match.RuleID) ||
+			parseSuppression(contentLine(content, lineStarts, lineNumber-1)).suppresses(match.RuleID) {
+			continue
+		}
+
+		result := s.newScanResult(filePath, match)
+		result.LineNumber = lineNumber
+		result.Column = column
+		result.EndLineNumber = endLineNumber
+		result.EndColumn = endColumn
+
+		if s.ContextLines > 0 {
+			var before, after []string
+			for line := max(1, lineNumber-s.ContextLines); line < lineNumber; line++ {
+				before = append(before, contentLine(content, lineStarts, line))
+			}
+			for line := endLineNumber + 1; line <= min(len(lineStarts), endLineNumber+s.ContextLines); line++ {
+				// A trailing newline doesn't start another line
+				if line == len(lineStarts) && lineStarts[line-1] == len(content) {
+					break
+				}
+				after = append(after, contentLine(content, lineStarts, line))
+			}
+			result.ContextBefore = s.contextLines(before, result)
+			result.ContextAfter = s.contextLines(after, result)
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// appendContextAfter appends line to the ContextAfter of each pending result,
+// returning the results still waiting for more lines
+func (s *Scanner) appendContextAfter(results []ScanResult, pending []int, line string) []int {
+	remaining := pending[:0]
+	for _, i := range pending {
+		results[i].ContextAfter = append(results[i].ContextAfter, s.contextLines([]string{line}, results[i])...)
+		if len(results[i].ContextAfter) < s.ContextLines {
+			remaining = append(remaining, i)
+		}
+	}
+	return remaining
+}
+
+// contextLines returns a copy of the context lines around a result, redacted
+// unless redaction is disabled
+func (s *Scanner) contextLines(lines []string, result ScanResult) []string {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	context := make([]string, len(lines))
+	for i, line := range lines {
+		if s.DisableRedaction {
+			context[i] = line
+		} else {
+			context[i] = redactContextLine(line, result, s.Mask)
+		}
+	}
+	return context
+}
+
+// newScanResult builds the result for a match in filePath. Callers fill in
+// the match position.
+func (s *Scanner) newScanResult(filePath string, match MatchResult) ScanResult {
+	result := ScanResult{
+		FilePath:                filePath,
+		Match:                   match.Match,
+		Redacted:                s.redacted(match),
+		RuleName:                match.RuleName,
+		RuleID:                  match.RuleID,
+		Severity:                match.Severity,
+		Entropy:                 match.Entropy,
+		RuleEntropyThreshold:    match.RuleEntropyThreshold,
+		RuleEntropyThresholdMet: match.RuleEntropyThresholdMet,
+		Encoding:                match.Encoding,
+	}
+
+	if s.ExplainMatches {
+		result.Explanation = ExplainMatch(match)
+	}
+
+	return result
+}
+
+// redacted returns the redacted text of a match, masked with the scanner's
+// mask unless the match's rule sets its own
+func (s *Scanner) redacted(match MatchResult) string {
+	if s.Mask == (Mask{}) || match.ruleMask {
+		return match.Redacted
+	}
+	return redactMatch(match.Match, match.redact, s.Mask)
+}
+
+// lineStartOffsets returns the byte offset at which each line of content
+// begins, after each "\n", "\r\n", or lone "\r"
+func lineStartOffsets(content []byte) []int {
+	starts := []int{0}
+	for i, b := range content {
+		if b == '\n' || isLoneCR(content, i) {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// contentLine returns the text of a 1-based line of content, or an empty
+// string if the line doesn't exist
+func contentLine(content []byte, lineStarts []int, line int) string {
+	if line < 1 || line > len(lineStarts) {
+		return ""
+	}
+
+	end := len(content)
+	if line < len(lineStarts) {
+		end = lineStarts[line] - 1
+	}
+	return string(dropCR(content[lineStarts[line-1]:end]))
+}
+
+// offsetToLineColumn maps a byte offset to a 1-based line number and 1-based byte column
+func offsetToLineColumn(lineStarts []int, offset int) (int, int) {
+	// Index of the first line starting after offset, so the line containing it is one before
+	line := sort.Search(len(lineStarts), func(i int) bool {
+		return lineStarts[i] > offset
+	}) - 1
+
+	return line + 1, offset - lineStarts[line] + 1
+}
+
+// matchEndPosition returns the line holding the last byte of the range [start, end)
+// and the 1-based column just past that byte
+func matchEndPosition(lineStarts []int, start, end int) (int, int) {
+	if end <= start {
+		return offsetToLineColumn(lineStarts, start)
+	}
+
+	line, column := offsetToLineColumn(lineStarts, end-1)
+	return line, column + 1
 }
 
 // isGenericRule returns true if the rule ID indicates a generic rule
@@ -424,78 +1705,152 @@ func filterOverlappingGenericMatches(matches []MatchResult) []MatchResult {
 	return result
 }
 
-// isBinaryFile attempts to determine if a file is binary
-func isBinaryFile(filePath string) bool {
-	// First, check file extension for known binary types
-	ext := strings.ToLower(filepath.Ext(filePath))
-	binaryExts := map[string]bool{
-		".a":     true,
-		".avi":   true,
-		".bin":   true,
-		".bmp":   true,
-		".class": true,
-		".dll":   true,
-		".doc":   true,
-		".docx":  true,
-		".dylib": true,
-		".exe":   true,
-		".gif":   true,
-		".gz":    true,
-		".img":   true,
-		".iso":   true,
-		".jar":   true,
-		".jpg":   true,
-		".jpeg":  true,
-		".lib":   true,
-		".mov":   true,
-		".mp3":   true,
-		".mp4":   true,
-		".o":     true,
-		".obj":   true,
-		".pdf":   true,
-		".png":   true,
-		".rar":   true,
-		".so":    true,
-		".tar":   true,
-		".war":   true,
-		".xls":   true,
-		".xlsx":  true,
-		".zip":   true,
-	}
-
-	if binaryExts[ext] {
+// dedupeOverlappingMatches keeps only the most specific of each group of
+// overlapping matches, preserving the order of the matches kept
+func dedupeOverlappingMatches(matches []MatchResult) []MatchResult {
+	if len(matches) <= 1 {
+		return matches
+	}
+
+	// Consider the most specific matches first
+	order := make([]int, len(matches))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return moreSpecificMatch(matches[order[i]], matches[order[j]])
+	})
+
+	keep := make([]bool, len(matches))
+	for _, i := range order {
+		overlaps := false
+		for j, kept := range keep {
+			if kept && matchesOverlap(matches[i], matches[j]) {
+				overlaps = true
+				break
+			}
+		}
+		keep[i] = !overlaps
+	}
+
+	result := make([]MatchResult, 0, len(matches))
+	for i, m := range matches {
+		if keep[i] {
+			result = append(result, m)
+		}
+	}
+
+	return result
+}
+
+// moreSpecificMatch reports whether a is more specific than b: from the rule
+// with the higher priority, then the longer match, then the lexically smaller
+// rule ID
+func moreSpecificMatch(a, b MatchResult) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if a.End-a.Start != b.End-b.Start {
+		return a.End-a.Start > b.End-b.Start
+	}
+	return a.RuleID < b.RuleID
+}
+
+// hasBinaryExtension reports whether a file has an extension in
+// BinaryExtensions
+func (s *Scanner) hasBinaryExtension(filePath string) bool {
+	return s.BinaryExtensions[strings.ToLower(filepath.Ext(filePath))]
+}
+
+// forceScan reports whether a file has an extension in ForceScanExtensions
+func (s *Scanner) forceScan(filePath string) bool {
+	return slices.Contains(s.ForceScanExtensions, strings.ToLower(filepath.Ext(filePath)))
+}
+
+// checkContent reports whether content past the sniffed bytes of a file is
+// checked for binary content, which is skipped like a file sniffed as binary
+func (s *Scanner) checkContent(filePath string) bool {
+	return s.SniffBytes > 0 && !s.forceScan(filePath)
+}
+
+// isBinary reports whether a file is skipped as binary, from its name and the
+// first bytes of its content. A null byte always marks content as binary.
+// Otherwise content that sniffs as text is scanned and content that sniffs as
+// a binary format is skipped, whatever the extension. Anything else is skipped
+// if it has a binary extension or too many non-printable bytes.
+func (s *Scanner) isBinary(filePath string, head []byte) bool {
+	if len(head) == 0 {
+		return s.hasBinaryExtension(filePath)
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
 		return true
 	}
 
-	// For unknown extensions, read the first few bytes to check for binary content
-	file, err := os.Open(filePath)
-	if err != nil {
-		return true // Assume binary if we can't read it
+	switch mimeType := http.DetectContentType(head); {
+	case strings.HasPrefix(mimeType, "text/"):
+		return false
+	case isBinaryMIMEType(mimeType) || hasExecutableMagic(head):
+		return true
 	}
-	defer file.Close()
 
-	// Read first 512 bytes (standard for file type detection)
-	buffer := make([]byte, 512)
-	n, err := file.Read(buffer)
-	if err != nil && err != io.EOF {
-		return true // Assume binary if we can't read it
+	return s.hasBinaryExtension(filePath) || isBinaryContent(head, s.BinaryThreshold)
+}
+
+// binaryMIMETypePrefixes are the prefixes of MIME types detected by
+// http.DetectContentType that are never scanned as text
+var binaryMIMETypePrefixes = []string{
+	"image/", "audio/", "video/", "font/",
+	"application/pdf", "application/zip", "application/x-gzip", "application/x-rar-compressed",
+	"application/ogg", "application/wasm", "application/vnd.ms-fontobject",
+}
+
+// isBinaryMIMEType reports whether a detected MIME type is a binary format
+func isBinaryMIMEType(mimeType string) bool {
+	for _, prefix := range binaryMIMETypePrefixes {
+		if strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
 	}
+	return false
+}
+
+// executableMagic are the signatures of ELF and Mach-O executables, which
+// http.DetectContentType doesn't detect
+var executableMagic = [][]byte{
+	[]byte("\x7fELF"),
+	{0xfe, 0xed, 0xfa, 0xce}, {0xfe, 0xed, 0xfa, 0xcf},
+	{0xce, 0xfa, 0xed, 0xfe}, {0xcf, 0xfa, 0xed, 0xfe},
+}
+
+// hasExecutableMagic reports whether content starts with an executable
+// signature
+func hasExecutableMagic(head []byte) bool {
+	for _, magic := range executableMagic {
+		if bytes.HasPrefix(head, magic) {
+			return true
+		}
+	}
+	return false
+}
 
+// isBinaryContent attempts to determine if the first bytes of a file are
+// binary: if they contain a null byte, or more than threshold of them are
+// non-printable
+func isBinaryContent(buffer []byte, threshold float64) bool {
 	// Check for null bytes (common indicator of binary files)
-	for i := range n {
-		if buffer[i] == 0 {
+	for _, b := range buffer {
+		if b == 0 {
 			return true
 		}
 	}
 
-	// Additional heuristic: if more than 30% of bytes are non-printable, consider it binary
+	// Additional heuristic: if too many bytes are non-printable, consider it binary
 	nonPrintable := 0
-	for i := range n {
-		b := buffer[i]
+	for _, b := range buffer {
 		if b < 32 && b != 9 && b != 10 && b != 13 { // Not tab, newline, or carriage return
 			nonPrintable++
 		}
 	}
 
-	return float64(nonPrintable)/float64(n) > 0.30
+	return float64(nonPrintable)/float64(len(buffer)) > threshold
 }
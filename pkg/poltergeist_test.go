@@ -0,0 +1,1984 @@
+package poltergeist
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"time"
+)
+
+// newTestScanner compiles the given rules with the Go regex engine and returns a scanner
+func newTestScanner(t *testing.T, rules []Rule) *Scanner {
+	t.Helper()
+	return newEngineTestScanner(t, NewGoRegexEngine(), rules)
+}
+
+// newEngineTestScanner compiles the given rules with engine and returns a scanner
+func newEngineTestScanner(t *testing.T, engine PatternEngine, rules []Rule) *Scanner {
+	t.Helper()
+
+	t.Cleanup(func() {
+		engine.Close()
+	})
+
+	if err := engine.CompileRules(rules); err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+
+	return NewScanner(engine)
+}
+
+// writeTestFile writes content to name within dir, creating parent directories as needed
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory for %s: %v", name, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// testEngines returns the Go regex engine and, if Hyperscan is available,
+// both Hyperscan engines, for tests that must get the same results from each
+func testEngines() []func() PatternEngine {
+	engines := []func() PatternEngine{func() PatternEngine { return NewGoRegexEngine() }}
+	if IsHyperscanAvailable() {
+		engines = append(engines,
+			func() PatternEngine { return NewHyperscanEngine() },
+			func() PatternEngine { return NewHyperscanSOMEngine() },
+		)
+	}
+	return engines
+}
+
+func TestScanMultiLineMatchPositions(t *testing.T) {
+	rules := []Rule{
+		{
+			Name:    "Test Block",
+			ID:      "test.block",
+			Pattern: `(?s)-----BEGIN TEST BLOCK-----.*?-----END TEST BLOCK-----`,
+		},
+	}
+
+	dir := t.TempDir()
+	block := "-----BEGIN TEST BLOCK-----\nabc\ndef\n-----END TEST BLOCK-----"
+	writeTestFile(t, dir, "block.txt", "header\n"+block+"\nmiddle\n  "+block+"\nfooter\n")
+
+	for _, newEngine := range testEngines() {
+		engine := newEngine()
+		t.Run(engine.Name(), func(t *testing.T) {
+			scanner := newEngineTestScanner(t, engine, rules)
+			scanner.WholeFile = true
+
+			results, err := scanner.ScanDirectory(dir)
+			if err != nil {
+				t.Fatalf("ScanDirectory failed: %v", err)
+			}
+
+			// Every block is reported, not only the first
+			if len(results) != 2 {
+				t.Fatalf("Expected 2 matches, got %d", len(results))
+			}
+
+			for i, want := range []struct{ line, column, endLine int }{{2, 1, 5}, {7, 3, 10}} {
+				result := results[i]
+				if result.Match != block {
+					t.Errorf("Match %d: expected the block, got %q", i+1, result.Match)
+				}
+				if result.LineNumber != want.line || result.Column != want.column {
+					t.Errorf("Match %d: expected to start at line %d column %d, got line %d column %d",
+						i+1, want.line, want.column, result.LineNumber, result.Column)
+				}
+				if result.EndLineNumber != want.endLine {
+					t.Errorf("Match %d: expected to end on line %d, got %d", i+1, want.endLine, result.EndLineNumber)
+				}
+				if result.EndColumn != len("-----END TEST BLOCK-----")+1 {
+					t.Errorf("Match %d: expected end column %d, got %d", i+1, len("-----END TEST BLOCK-----")+1, result.EndColumn)
+				}
+			}
+		})
+	}
+}
+
+func TestScanPrivateKeyBlock(t *testing.T) {
+	rules, err := LoadRulesFromFile("rules/cert.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+	scanner := newTestScanner(t, rules)
+	scanner.WholeFile = true
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	block := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	dir := t.TempDir()
+	writeTestFile(t, dir, "id_rsa", "# deploy key\n"+string(block))
+
+	results, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 match for the key block, got %d: %+v", len(results), results)
+	}
+
+	result := results[0]
+	if result.RuleID != "ghost.cert.3" {
+		t.Errorf("Expected rule ghost.cert.3, got %s", result.RuleID)
+	}
+	endLine := 1 + bytes.Count(block, []byte("\n"))
+	if result.LineNumber != 2 || result.EndLineNumber != endLine {
+		t.Errorf("Expected match on lines 2-%d, got lines %d-%d", endLine, result.LineNumber, result.EndLineNumber)
+	}
+	if !result.RuleEntropyThresholdMet {
+		t.Errorf("Expected key block to meet the entropy threshold, got %f", result.Entropy)
+	}
+}
+
+func TestScanSingleLineMatchPositions(t *testing.T) {
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+
+	dir := t.TempDir()
+	writeTestFile(t, dir, "token.txt", "first line\nkey = tok_abcd1234\n")
+
+	results, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 match, got %d", len(results))
+	}
+
+	result := results[0]
+	if result.LineNumber != 2 || result.EndLineNumber != 2 {
+		t.Errorf("Expected match on line 2 only, got lines %d-%d", result.LineNumber, result.EndLineNumber)
+	}
+	if result.EndColumn != len("key = tok_abcd1234")+1 {
+		t.Errorf("Expected end column %d, got %d", len("key = tok_abcd1234")+1, result.EndColumn)
+	}
+}
+
+func TestScanFile(t *testing.T) {
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	}
+
+	dir := t.TempDir()
+
+	t.Run("text file with matches", func(t *testing.T) {
+		scanner := newTestScanner(t, rules)
+		path := writeTestFile(t, dir, "config.txt", "a = tok_abcd1234\nb = nothing\nc = tok_wxyz9876\n")
+
+		results, err := scanner.ScanFile(path)
+		if err != nil {
+			t.Fatalf("ScanFile failed: %v", err)
+		}
+
+		if len(results) != 2 {
+			t.Fatalf("Expected 2 matches, got %d", len(results))
+		}
+		if results[0].FilePath != path || results[0].LineNumber != 1 || results[1].LineNumber != 3 {
+			t.Errorf("Unexpected match locations: %+v", results)
+		}
+
+		if scanner.Metrics.FilesScanned != 1 || scanner.Metrics.MatchesFound != 2 {
+			t.Errorf("Expected 1 file scanned with 2 matches, got %d files and %d matches",
+				scanner.Metrics.FilesScanned, scanner.Metrics.MatchesFound)
+		}
+		if scanner.Metrics.TotalBytes != int64(len("a = tok_abcd1234\nb = nothing\nc = tok_wxyz9876\n")) {
+			t.Errorf("Unexpected total bytes: %d", scanner.Metrics.TotalBytes)
+		}
+	})
+
+	t.Run("binary file is skipped", func(t *testing.T) {
+		scanner := newTestScanner(t, rules)
+		path := writeTestFile(t, dir, "data.txt", "tok_abcd1234\x00\x01\x02")
+
+		results, err := scanner.ScanFile(path)
+		if err != nil {
+			t.Fatalf("ScanFile failed: %v", err)
+		}
+
+		if len(results) != 0 {
+			t.Errorf("Expected no matches for binary file, got %d", len(results))
+		}
+		if scanner.Metrics.FilesSkipped != 1 || scanner.Metrics.FilesScanned != 0 {
+			t.Errorf("Expected 1 skipped and 0 scanned files, got %d skipped and %d scanned",
+				scanner.Metrics.FilesSkipped, scanner.Metrics.FilesScanned)
+		}
+	})
+
+	t.Run("nonexistent file returns an error", func(t *testing.T) {
+		scanner := newTestScanner(t, rules)
+
+		if _, err := scanner.ScanFile(filepath.Join(dir, "missing.txt")); err == nil {
+			t.Error("Expected an error for a nonexistent file")
+		}
+	})
+}
+
+func TestScanPaths(t *testing.T) {
+	dir := t.TempDir()
+	first := writeTestFile(t, dir, "first.env", "A=tok_abcd1234\n")
+	second := writeTestFile(t, dir, "second.env", "# none\nB=tok_efgh5678\n")
+	writeTestFile(t, dir, filepath.Join("tree", "one.env"), "C=tok_ijkl9012\n")
+	writeTestFile(t, dir, filepath.Join("tree", "sub", "two.env"), "D=tok_mnop3456\nE=tok_qrst7890\n")
+	writeTestFile(t, dir, filepath.Join("tree", "empty.env"), "")
+	tree := filepath.Join(dir, "tree")
+
+	scanner := newTestScanner(t, []Rule{{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-z0-9]{8}`}})
+	results, err := scanner.ScanPaths([]string{second, tree, first})
+	if err != nil {
+		t.Fatalf("ScanPaths failed: %v", err)
+	}
+
+	want := []struct {
+		path string
+		line int
+	}{
+		{first, 1},
+		{second, 2},
+		{filepath.Join(tree, "one.env"), 1},
+		{filepath.Join(tree, "sub", "two.env"), 1},
+		{filepath.Join(tree, "sub", "two.env"), 2},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %d results, got %d: %+v", len(want), len(results), results)
+	}
+	for i, w := range want {
+		if results[i].FilePath != w.path || results[i].LineNumber != w.line {
+			t.Errorf("Result %d at %s:%d, expected %s:%d", i, results[i].FilePath, results[i].LineNumber, w.path, w.line)
+		}
+	}
+
+	if scanner.Metrics.FilesScanned != 4 || scanner.Metrics.FilesSkipped != 1 || scanner.Metrics.MatchesFound != 5 {
+		t.Errorf("Expected 4 files scanned, 1 skipped, and 5 matches, got %d, %d, and %d",
+			scanner.Metrics.FilesScanned, scanner.Metrics.FilesSkipped, scanner.Metrics.MatchesFound)
+	}
+
+	// A missing path fails before anything is scanned
+	scanner.ResetMetrics()
+	if _, err := scanner.ScanPaths([]string{first, filepath.Join(dir, "missing.env")}); err == nil {
+		t.Error("Expected an error for a missing path")
+	}
+	if scanner.Metrics.FilesScanned != 0 {
+		t.Errorf("Expected no files scanned, got %d", scanner.Metrics.FilesScanned)
+	}
+}
+
+func TestScanReader(t *testing.T) {
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+
+	input := "line one\nkey = tok_abcd1234\nline three\nline four\nother = tok_wxyz9876\n"
+	results, err := scanner.ScanReader(strings.NewReader(input), "memory.txt")
+	if err != nil {
+		t.Fatalf("ScanReader failed: %v", err)
+	}
+
+	expected := []struct {
+		line  int
+		match string
+	}{
+		{line: 2, match: "tok_abcd1234"},
+		{line: 5, match: "tok_wxyz9876"},
+	}
+
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d matches, got %d", len(expected), len(results))
+	}
+
+	for i, want := range expected {
+		if results[i].FilePath != "memory.txt" {
+			t.Errorf("Result %d: expected file path memory.txt, got %s", i, results[i].FilePath)
+		}
+		if results[i].LineNumber != want.line {
+			t.Errorf("Result %d: expected line %d, got %d", i, want.line, results[i].LineNumber)
+		}
+		if results[i].Match != want.match {
+			t.Errorf("Result %d: expected match %q, got %q", i, want.match, results[i].Match)
+		}
+	}
+}
+
+func TestScanFS(t *testing.T) {
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+
+	fsys := fstest.MapFS{
+		"app/config.env":   {Data: []byte("TOKEN=tok_abcd1234\n")},
+		"app/src/main.go":  {Data: []byte("package main\n\n// tok_wxyz9876\n")},
+		"app/README.md":    {Data: []byte("no secrets here\n")},
+		"app/empty.txt":    {Data: []byte{}},
+		"app/image.png":    {Data: []byte("\x89PNG\r\n\x1a\ntok_abcd1234")},
+		"app/data.txt":     {Data: []byte("tok_abcd1234\x00\x00\x00")},
+		"other/ignored.go": {Data: []byte("tok_00000000\n")},
+	}
+
+	results, err := scanner.ScanFS(fsys, "app")
+	if err != nil {
+		t.Fatalf("ScanFS failed: %v", err)
+	}
+
+	found := make(map[string]int)
+	for _, result := range results {
+		found[result.FilePath] = result.LineNumber
+	}
+
+	expected := map[string]int{
+		"app/config.env":  1,
+		"app/src/main.go": 3,
+	}
+	if len(found) != len(expected) {
+		t.Errorf("Expected matches in %d files, got %v", len(expected), found)
+	}
+	for path, line := range expected {
+		if found[path] != line {
+			t.Errorf("Expected match in %s on line %d, got line %d", path, line, found[path])
+		}
+	}
+
+	// The empty, .png, and binary content files are skipped
+	if scanner.Metrics.FilesScanned != 3 {
+		t.Errorf("Expected 3 files scanned, got %d", scanner.Metrics.FilesScanned)
+	}
+	if scanner.Metrics.FilesSkipped != 3 {
+		t.Errorf("Expected 3 files skipped, got %d", scanner.Metrics.FilesSkipped)
+	}
+}
+
+func TestBinaryDetectionOptions(t *testing.T) {
+	rules := []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-z0-9]{8}`},
+	}
+
+	// 4 of 18 bytes are non-printable, under the default 30% threshold
+	borderline := "tok_abcd1234\n\x01\x02\x03\x04\n"
+	// Printable for the first 114 bytes, then mostly non-printable
+	lateBinary := "tok_abcd1234\n" + strings.Repeat("x", 100) + "\n" + strings.Repeat("\x01\x02\x03", 50)
+
+	tests := []struct {
+		name      string
+		file      string
+		content   string
+		configure func(s *Scanner)
+		skipped   bool
+	}{
+		{name: "binary content type", file: "doc.pdf", content: "%PDF-1.4\ntok_abcd1234\n", skipped: true},
+		{name: "forced extension", file: "doc.pdf", content: "%PDF-1.4\ntok_abcd1234\n", configure: func(s *Scanner) { s.ForceScanExtensions = []string{".pdf"} }},
+		{name: "forced extension with binary content", file: "doc.pdf", content: "tok_abcd1234\n\x00\x01", configure: func(s *Scanner) { s.ForceScanExtensions = []string{".pdf"} }},
+		{name: "binary extension", file: "data.bin", content: "tok_abcd1234\n\x01\n", skipped: true},
+		{name: "custom binary extensions", file: "app.log", content: "tok_abcd1234\n\x01\n", configure: func(s *Scanner) { s.BinaryExtensions = map[string]bool{".log": true} }, skipped: true},
+		{name: "custom binary extensions replace the defaults", file: "data.bin", content: "tok_abcd1234\n\x01\n", configure: func(s *Scanner) { s.BinaryExtensions = map[string]bool{".log": true} }},
+		{name: "binary extension without sniffing", file: "data.bin", content: "tok_abcd1234\n", configure: func(s *Scanner) { s.SniffBytes = 0 }, skipped: true},
+		{name: "borderline content", file: "data.txt", content: borderline},
+		{name: "borderline content with lower threshold", file: "data.txt", content: borderline, configure: func(s *Scanner) { s.BinaryThreshold = 0.2 }, skipped: true},
+		{name: "binary content within sniff window", file: "data.txt", content: lateBinary, skipped: true},
+		{name: "binary content after sniff window", file: "data.txt", content: lateBinary, configure: func(s *Scanner) { s.SniffBytes = 64 }},
+		{name: "content check disabled", file: "data.txt", content: "tok_abcd1234\n\x00\x01", configure: func(s *Scanner) { s.SniffBytes = 0 }},
+		{name: "negative sniff bytes", file: "data.txt", content: "tok_abcd1234\n\x00\x01", configure: func(s *Scanner) { s.SniffBytes = -1 }},
+		{name: "negative sniff bytes with mmap", file: "data.txt", content: "tok_abcd1234\n\x00\x01", configure: func(s *Scanner) { s.SniffBytes, s.MmapThreshold = -1, 1 }},
+		{name: "negative sniff bytes with UTF-16 and mmap", file: "data.txt", content: "\xff\xfet\x00o\x00k\x00_\x00a\x00b\x00c\x00d\x001\x002\x003\x004\x00", configure: func(s *Scanner) { s.SniffBytes, s.MmapThreshold = -1, 1 }},
+		{name: "binary extension with negative sniff bytes", file: "data.bin", content: "tok_abcd1234\n", configure: func(s *Scanner) { s.SniffBytes = -1 }, skipped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := newTestScanner(t, rules)
+			if tt.configure != nil {
+				tt.configure(scanner)
+			}
+			path := writeTestFile(t, t.TempDir(), tt.file, tt.content)
+
+			results, err := scanner.ScanFile(path)
+			if err != nil {
+				t.Fatalf("ScanFile failed: %v", err)
+			}
+
+			skipped := scanner.Metrics.FilesSkipped == 1
+			if skipped != tt.skipped {
+				t.Errorf("Expected skipped %v, got %v", tt.skipped, skipped)
+			}
+			if !tt.skipped && len(results) != 1 {
+				t.Errorf("Expected 1 match, got %d", len(results))
+			}
+		})
+	}
+
+	// The defaults are not shared between scanners
+	scanner := newTestScanner(t, rules)
+	scanner.BinaryExtensions[".txt"] = true
+	if DefaultBinaryExtensions[".txt"] {
+		t.Error("Expected changing a scanner's binary extensions to leave the defaults unchanged")
+	}
+}
+
+func TestBinaryContentSniffing(t *testing.T) {
+	rules := []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-z0-9]{8}`},
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		skipped bool
+	}{
+		{name: "text with binary extension", file: "firmware.bin", content: "# build settings\nTOKEN=tok_abcd1234\n"},
+		{name: "text with image extension", file: "logo.png", content: "TOKEN=tok_abcd1234\n"},
+		{name: "extensionless ELF", file: "server", content: "\x7fELF\x02\x01\x01\x03tok_abcd1234\n", skipped: true},
+		{name: "ELF with text extension", file: "notes.txt", content: "\x7fELF\x02\x01\x01\x03tok_abcd1234\n", skipped: true},
+		{name: "Mach-O", file: "tool", content: "\xcf\xfa\xed\xfe\x07\x01tok_abcd1234\n", skipped: true},
+		{name: "PNG image", file: "logo.png", content: "\x89PNG\r\n\x1a\ntok_abcd1234\n", skipped: true},
+		{name: "image with text extension", file: "notes.txt", content: "GIF89a tok_abcd1234\n", skipped: true},
+		{name: "null bytes in text", file: "notes.txt", content: "TOKEN=tok_abcd1234\n\x00", skipped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := newTestScanner(t, rules)
+			path := writeTestFile(t, t.TempDir(), tt.file, tt.content)
+
+			results, err := scanner.ScanFile(path)
+			if err != nil {
+				t.Fatalf("ScanFile failed: %v", err)
+			}
+
+			skipped := scanner.Metrics.FilesSkipped == 1
+			if skipped != tt.skipped {
+				t.Errorf("Expected skipped %v, got %v", tt.skipped, skipped)
+			}
+			if !tt.skipped && len(results) != 1 {
+				t.Errorf("Expected 1 match, got %d", len(results))
+			}
+		})
+	}
+}
+
+func TestBinaryContentPastSniffedBytes(t *testing.T) {
+	rules := []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-z0-9]{8}`},
+	}
+
+	// 1KB of text with a token, then binary content holding another
+	text := "TOKEN=tok_abcd1234\n" + strings.Repeat("# padding line\n", 1024/15)
+	content := text + "\x00\x01\x02 tok_efgh5678 \xff\xfe\x00\n"
+
+	for _, mode := range []string{"line", "whole file", "mmap"} {
+		t.Run(mode, func(t *testing.T) {
+			scanner := newTestScanner(t, rules)
+			scanner.SniffBytes = 512
+			scanner.WholeFile = mode == "whole file"
+			if mode == "mmap" {
+				scanner.MmapThreshold = 1
+			}
+			path := writeTestFile(t, t.TempDir(), "notes.txt", content)
+
+			results, err := scanner.ScanFile(path)
+			if err != nil {
+				t.Fatalf("ScanFile failed: %v", err)
+			}
+			if len(results) != 1 || results[0].Match != "tok_abcd1234" {
+				t.Fatalf("Expected only the token before the binary content, got %+v", results)
+			}
+			if scanner.Metrics.FilesSkipped != 1 {
+				t.Errorf("Expected the file to be counted as skipped, got %d", scanner.Metrics.FilesSkipped)
+			}
+			if scanner.Metrics.MatchesFound != 1 {
+				t.Errorf("Expected 1 match found, got %d", scanner.Metrics.MatchesFound)
+			}
+		})
+	}
+
+	// Extensions forced to be scanned are read past binary content
+	scanner := newTestScanner(t, rules)
+	scanner.SniffBytes = 512
+	scanner.ForceScanExtensions = []string{".txt"}
+	results, err := scanner.ScanFile(writeTestFile(t, t.TempDir(), "notes.txt", content))
+	if err != nil {
+		t.Fatalf("ScanFile failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected both tokens when forcing binary scanning, got %d", len(results))
+	}
+}
+
+func TestScanDirectoryResultPaths(t *testing.T) {
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, filepath.Join("nested", "config.env"), "TOKEN=tok_abcd1234\n")
+
+	// Directory roots report paths joined to the root
+	results, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if len(results) != 1 || results[0].FilePath != path {
+		t.Errorf("Expected a single match in %s, got %+v", path, results)
+	}
+
+	// File roots report the path as given
+	results, err = scanner.ScanDirectory(path)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if len(results) != 1 || results[0].FilePath != path {
+		t.Errorf("Expected a single match in %s, got %+v", path, results)
+	}
+}
+
+// cancelingEngine wraps a PatternEngine and cancels a context the first time a line is scanned
+type cancelingEngine struct {
+	PatternEngine
+	cancel context.CancelFunc
+}
+
+func (e *cancelingEngine) FindAllInLine(line string) []MatchResult {
+	e.cancel()
+	return e.PatternEngine.FindAllInLine(line)
+}
+
+// cancelAfterEngine wraps a PatternEngine and cancels a context after a number of lines have been scanned
+type cancelAfterEngine struct {
+	PatternEngine
+	cancel context.CancelFunc
+	after  int64
+	lines  atomic.Int64
+}
+
+func (e *cancelAfterEngine) FindAllInLine(line string) []MatchResult {
+	if e.lines.Add(1) == e.after {
+		e.cancel()
+	}
+	return e.PatternEngine.FindAllInLine(line)
+}
+
+func TestScanDirectoryContextPartialResults(t *testing.T) {
+	const fileCount = 500
+
+	dir := t.TempDir()
+	for i := range fileCount {
+		writeTestFile(t, dir, fmt.Sprintf("file%03d.txt", i), "TOKEN=tok_abcd1234\nSECOND=tok_wxyz5678\n")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+	scanner.Engine = &cancelAfterEngine{PatternEngine: scanner.Engine, cancel: cancel, after: 50}
+
+	results, err := scanner.ScanDirectoryContext(ctx, dir)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	if len(results) == 0 {
+		t.Fatal("Expected partial results from files scanned before cancellation")
+	}
+	if len(results) >= fileCount*2 {
+		t.Errorf("Expected fewer than %d results after cancellation, got %d", fileCount*2, len(results))
+	}
+
+	// Every match from a file that finished scanning is returned
+	if int64(len(results)) != scanner.Metrics.MatchesFound {
+		t.Errorf("Expected %d partial results (matches found), got %d", scanner.Metrics.MatchesFound, len(results))
+	}
+	if int64(len(results)) != scanner.Metrics.FilesScanned*2 {
+		t.Errorf("Expected 2 results for each of the %d scanned files, got %d", scanner.Metrics.FilesScanned, len(results))
+	}
+}
+
+func TestScanDirectoryContextCancel(t *testing.T) {
+	const fileCount = 2000
+
+	dir := t.TempDir()
+	for i := range fileCount {
+		writeTestFile(t, dir, filepath.Join(fmt.Sprintf("dir%02d", i%20), fmt.Sprintf("file%04d.txt", i)), "TOKEN=tok_abcd1234\n")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+	scanner.Engine = &cancelingEngine{PatternEngine: scanner.Engine, cancel: cancel}
+
+	goroutinesBefore := runtime.NumGoroutine()
+
+	start := time.Now()
+	_, err := scanner.ScanDirectoryContext(ctx, dir)
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("Expected cancelled scan to return promptly, took %v", elapsed)
+	}
+	if scanner.Metrics.FilesScanned >= fileCount {
+		t.Errorf("Expected cancellation to stop the scan early, but all %d files were scanned", fileCount)
+	}
+
+	// Workers and the collector must have exited
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > goroutinesBefore && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if goroutines := runtime.NumGoroutine(); goroutines > goroutinesBefore {
+		t.Errorf("Goroutine leak: %d goroutines before scan, %d after", goroutinesBefore, goroutines)
+	}
+}
+
+func TestScannerErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "readable.txt", "TOKEN=tok_abcd1234\n")
+
+	// A dangling symlink is listed by the walk but can't be opened, even as root
+	unreadable := filepath.Join(dir, "unreadable.txt")
+	if err := os.Symlink(filepath.Join(dir, "missing.txt"), unreadable); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+	errs := make(chan ScanError, 10)
+	scanner.Errors = errs
+
+	results, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	close(errs)
+
+	if len(results) != 1 {
+		t.Errorf("Expected 1 result from the readable file, got %d", len(results))
+	}
+
+	var collected []ScanError
+	for scanErr := range errs {
+		collected = append(collected, scanErr)
+	}
+
+	if len(collected) != 1 {
+		t.Fatalf("Expected 1 scan error, got %d: %v", len(collected), collected)
+	}
+	if collected[0].Path != unreadable {
+		t.Errorf("Expected error for %s, got %s", unreadable, collected[0].Path)
+	}
+	if !errors.Is(collected[0], fs.ErrNotExist) {
+		t.Errorf("Expected error to wrap fs.ErrNotExist, got %v", collected[0].Err)
+	}
+	if scanner.Metrics.ErrorsDropped != 0 {
+		t.Errorf("Expected no dropped errors, got %d", scanner.Metrics.ErrorsDropped)
+	}
+}
+
+func TestScannerErrorsDoNotBlock(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 3 {
+		name := fmt.Sprintf("unreadable%d.txt", i)
+		if err := os.Symlink(filepath.Join(dir, "missing.txt"), filepath.Join(dir, name)); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+	}
+
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+
+	// An unbuffered channel with no reader must not stall the scan
+	scanner.Errors = make(chan ScanError)
+
+	if _, err := scanner.ScanDirectory(dir); err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if scanner.Metrics.ErrorsDropped != 3 {
+		t.Errorf("Expected 3 dropped errors, got %d", scanner.Metrics.ErrorsDropped)
+	}
+}
+
+func TestScanDirectoryReport(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "readable.txt", "TOKEN=tok_abcd1234\n")
+
+	// Dangling symlinks are listed by the walk but can't be opened, even as root
+	var unreadable []string
+	for i := range 2 {
+		name := filepath.Join(dir, fmt.Sprintf("unreadable%d.txt", i))
+		if err := os.Symlink(filepath.Join(dir, "missing.txt"), name); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+		unreadable = append(unreadable, name)
+	}
+
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+
+	// Capture stderr to check that errors are not printed
+	stderr := os.Stderr
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	os.Stderr = w
+	report, err := scanner.ScanDirectoryReport(context.Background(), dir)
+	os.Stderr = stderr
+	w.Close()
+
+	printed, _ := io.ReadAll(r)
+	r.Close()
+
+	if err != nil {
+		t.Fatalf("ScanDirectoryReport failed: %v", err)
+	}
+	if len(printed) != 0 {
+		t.Errorf("Expected nothing on stderr, got %q", printed)
+	}
+	if len(report.Results) != 1 {
+		t.Errorf("Expected 1 result from the readable file, got %d", len(report.Results))
+	}
+
+	if len(report.Errors) != len(unreadable) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(unreadable), len(report.Errors), report.Errors)
+	}
+	for i, path := range unreadable {
+		if report.Errors[i].Path != path {
+			t.Errorf("Error %d: expected path %s, got %s", i, path, report.Errors[i].Path)
+		}
+		if !errors.Is(report.Errors[i], fs.ErrNotExist) {
+			t.Errorf("Error %d: expected to wrap fs.ErrNotExist, got %v", i, report.Errors[i].Err)
+		}
+	}
+}
+
+func TestScannerLogger(t *testing.T) {
+	dir := t.TempDir()
+
+	// A dangling symlink is listed by the walk but can't be opened, even as root
+	unreadable := filepath.Join(dir, "unreadable.txt")
+	if err := os.Symlink(filepath.Join(dir, "missing.txt"), unreadable); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+
+	var logs bytes.Buffer
+	scanner.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+
+	if _, err := scanner.ScanDirectory(dir); err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	var record struct {
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+		Path  string `json:"path"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a single JSON log record, got %q: %v", logs.String(), err)
+	}
+
+	if record.Level != "WARN" || record.Path != unreadable || record.Error == "" {
+		t.Errorf("Unexpected log record: %+v", record)
+	}
+}
+
+func TestScannerLoggerDebug(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "config.env", "TOKEN=tok_abcd1234\n")
+	writeTestFile(t, dir, "empty.txt", "")
+	writeTestFile(t, dir, "large.txt", strings.Repeat("x", 2048))
+	writeTestFile(t, dir, "image.png", "\x89PNG\r\n\x1a\n")
+	writeTestFile(t, dir, "debug.log", "tok_abcd1234\n")
+	writeTestFile(t, dir, ".gitignore", "*.log\n")
+
+	scanner := newTestScanner(t, []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-z0-9]{8}`},
+	})
+	scanner.MaxFileSize = 1024
+
+	var logs bytes.Buffer
+	scanner.Logger = slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	if _, err := scanner.ScanDirectory(dir); err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	type record struct {
+		Msg     string `json:"msg"`
+		Reason  string `json:"reason"`
+		Matches int    `json:"matches"`
+	}
+	got := make(map[string]record)
+	decoder := json.NewDecoder(&logs)
+	for decoder.More() {
+		var r struct {
+			record
+			Path string `json:"path"`
+		}
+		if err := decoder.Decode(&r); err != nil {
+			t.Fatalf("Invalid log record: %v", err)
+		}
+		got[filepath.Base(r.Path)] = r.record
+	}
+
+	want := map[string]record{
+		"config.env": {Msg: "scanned file", Matches: 1},
+		".gitignore": {Msg: "scanned file"},
+		"empty.txt":  {Msg: "skipped file", Reason: "empty"},
+		"large.txt":  {Msg: "skipped file", Reason: "too large"},
+		"image.png":  {Msg: "skipped file", Reason: "binary"},
+		"debug.log":  {Msg: "skipped file", Reason: "ignored"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected log records:\n got: %+v\nwant: %+v", got, want)
+	}
+}
+
+func TestScanDirectoryStream(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 50 {
+		content := fmt.Sprintf("TOKEN=tok_abcd%04d\nother line\nSECOND=tok_wxyz%04d\n", i, i)
+		writeTestFile(t, dir, filepath.Join(fmt.Sprintf("dir%d", i%5), fmt.Sprintf("file%02d.txt", i)), content)
+	}
+
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	}
+
+	expected, err := newTestScanner(t, rules).ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	resultsCh, errCh := newTestScanner(t, rules).ScanDirectoryStream(context.Background(), dir)
+
+	var streamed []ScanResult
+	for result := range resultsCh {
+		streamed = append(streamed, result)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("ScanDirectoryStream failed: %v", err)
+	}
+
+	if len(streamed) != 100 || len(streamed) != len(expected) {
+		t.Fatalf("Expected 100 streamed results matching ScanDirectory, got %d streamed and %d collected", len(streamed), len(expected))
+	}
+
+	key := func(r ScanResult) string {
+		return fmt.Sprintf("%s:%d:%d:%s", r.FilePath, r.LineNumber, r.EndColumn, r.Match)
+	}
+	seen := make(map[string]int)
+	for _, result := range expected {
+		seen[key(result)]++
+	}
+	for _, result := range streamed {
+		seen[key(result)]--
+	}
+	for k, count := range seen {
+		if count != 0 {
+			t.Errorf("Result %s differs between ScanDirectory and ScanDirectoryStream (count %d)", k, count)
+		}
+	}
+}
+
+func TestScanDirectoryStreamCancel(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 200 {
+		writeTestFile(t, dir, fmt.Sprintf("file%03d.txt", i), strings.Repeat("TOKEN=tok_abcd1234\n", 50))
+	}
+
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resultsCh, errCh := scanner.ScanDirectoryStream(ctx, dir)
+
+	// Read a single result, then stop consuming and cancel
+	<-resultsCh
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stream did not finish after cancellation")
+	}
+}
+
+func TestScanMaxInFlight(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 60 {
+		content := fmt.Sprintf("TOKEN=tok_abcd%04d\nother line\nSECOND=tok_wxyz%04d\n", i, i)
+		writeTestFile(t, dir, filepath.Join(fmt.Sprintf("dir%d", i%6), fmt.Sprintf("file%02d.txt", i)), content)
+	}
+
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	}
+
+	expected, err := newTestScanner(t, rules).ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if len(expected) != 120 {
+		t.Fatalf("Expected 120 results, got %d", len(expected))
+	}
+
+	for _, maxInFlight := range []int{1, 2} {
+		scanner := newTestScanner(t, rules)
+		scanner.MaxInFlight = maxInFlight
+		results, err := scanner.ScanDirectory(dir)
+		if err != nil {
+			t.Fatalf("ScanDirectory with MaxInFlight %d failed: %v", maxInFlight, err)
+		}
+		if !reflect.DeepEqual(roundResultEntropy(results), roundResultEntropy(expected)) {
+			t.Errorf("Expected the same results with MaxInFlight %d, got %d", maxInFlight, len(results))
+		}
+		if scanner.Metrics.FilesScanned != 60 {
+			t.Errorf("Expected 60 files scanned with MaxInFlight %d, got %d", maxInFlight, scanner.Metrics.FilesScanned)
+		}
+
+		// A slow consumer of a stream holds up the scan without losing results
+		scanner = newTestScanner(t, rules)
+		scanner.MaxInFlight = maxInFlight
+		resultsCh, errCh := scanner.ScanDirectoryStream(context.Background(), dir)
+		var streamed []ScanResult
+		for result := range resultsCh {
+			time.Sleep(100 * time.Microsecond)
+			streamed = append(streamed, result)
+		}
+		if err := <-errCh; err != nil {
+			t.Fatalf("ScanDirectoryStream with MaxInFlight %d failed: %v", maxInFlight, err)
+		}
+		SortResults(streamed)
+		if !reflect.DeepEqual(roundResultEntropy(streamed), roundResultEntropy(expected)) {
+			t.Errorf("Expected the same streamed results with MaxInFlight %d, got %d", maxInFlight, len(streamed))
+		}
+	}
+}
+
+// roundResultEntropy rounds the entropy of results, as roundEntropy does for
+// matches
+func roundResultEntropy(results []ScanResult) []ScanResult {
+	for i := range results {
+		results[i].Entropy = math.Round(results[i].Entropy*1e9) / 1e9
+	}
+	return results
+}
+
+// BenchmarkScanPeakHeap reports the peak heap allocation of scanning a tree
+// with many low-entropy matches, collecting every result with ScanDirectory
+// or keeping only findings from ScanDirectoryStream with a small MaxInFlight
+func BenchmarkScanPeakHeap(b *testing.B) {
+	dir := b.TempDir()
+	for i := range 200 {
+		var content strings.Builder
+		for j := range 200 {
+			fmt.Fprintf(&content, "placeholder = tok_aaaaaaaa # %d\n", j)
+		}
+		fmt.Fprintf(&content, "token = tok_%08x\n", i*7919)
+		name := filepath.Join(dir, fmt.Sprintf("dir%d", i%10), fmt.Sprintf("file%03d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content.String()), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	engine := NewGoRegexEngine()
+	defer engine.Close()
+	if err := engine.CompileRules([]Rule{{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-z0-9]{8}`, Entropy: 2}}); err != nil {
+		b.Fatalf("CompileRules failed: %v", err)
+	}
+
+	scans := []struct {
+		name string
+		scan func(s *Scanner) int
+	}{
+		{name: "collect", scan: func(s *Scanner) int {
+			results, _ := s.ScanDirectory(dir)
+			return len(results)
+		}},
+		{name: "stream", scan: func(s *Scanner) int {
+			s.MaxInFlight = 16
+			resultsCh, errCh := s.ScanDirectoryStream(context.Background(), dir)
+			var findings []ScanResult
+			for result := range resultsCh {
+				if result.RuleEntropyThresholdMet {
+					findings = append(findings, result)
+				}
+			}
+			<-errCh
+			return len(findings)
+		}},
+	}
+
+	for _, scan := range scans {
+		b.Run(scan.name, func(b *testing.B) {
+			var peak uint64
+			for b.Loop() {
+				runtime.GC()
+				done := make(chan struct{})
+				sampled := make(chan uint64)
+				go func() {
+					var stats runtime.MemStats
+					var highest uint64
+					ticker := time.NewTicker(time.Millisecond)
+					defer ticker.Stop()
+					for {
+						runtime.ReadMemStats(&stats)
+						highest = max(highest, stats.HeapAlloc)
+						select {
+						case <-done:
+							sampled <- highest
+							return
+						case <-ticker.C:
+						}
+					}
+				}()
+
+				scan.scan(NewScanner(engine))
+				close(done)
+				peak = max(peak, <-sampled)
+			}
+			b.ReportMetric(float64(peak), "peak-heap-bytes")
+		})
+	}
+}
+
+func TestScanSkipDirs(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "main.txt", "TOKEN=tok_abcd1234\n")
+	for i := range 20 {
+		writeTestFile(t, dir, filepath.Join(".git", "objects", fmt.Sprintf("obj%02d", i)), "TOKEN=tok_abcd1234\n")
+	}
+	// Files that would otherwise be counted as skipped
+	writeTestFile(t, dir, filepath.Join(".git", "index.png"), "not really an image")
+	writeTestFile(t, dir, filepath.Join(".git", "empty"), "")
+	writeTestFile(t, dir, filepath.Join("node_modules", "pkg", "index.txt"), "TOKEN=tok_abcd1234\n")
+	writeTestFile(t, dir, filepath.Join("src", "vendor", "lib.txt"), "TOKEN=tok_abcd1234\n")
+	writeTestFile(t, dir, filepath.Join("src", "vendored.txt"), "TOKEN=tok_abcd1234\n")
+
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	}
+
+	scanner := newTestScanner(t, rules)
+	results, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Errorf("Expected 2 results outside skipped directories, got %d", len(results))
+	}
+	if scanner.Metrics.FilesScanned != 2 {
+		t.Errorf("Expected 2 files scanned, got %d", scanner.Metrics.FilesScanned)
+	}
+	if scanner.Metrics.FilesSkipped != 0 {
+		t.Errorf("Expected skipped directories to contribute 0 skipped files, got %d", scanner.Metrics.FilesSkipped)
+	}
+
+	// The scan root itself is never pruned, even if its name matches
+	results, err = newTestScanner(t, rules).ScanDirectory(filepath.Join(dir, "node_modules"))
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("Expected 1 result when scanning a skipped directory directly, got %d", len(results))
+	}
+
+	// Clearing SkipDirs walks everything
+	scanner = newTestScanner(t, rules)
+	scanner.SkipDirs = nil
+	results, err = scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if len(results) != 24 {
+		t.Errorf("Expected 24 results with SkipDirs cleared, got %d", len(results))
+	}
+}
+
+func TestScanIncludeExcludeGlobs(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "app.env", "TOKEN=tok_abcd1234\n")
+	writeTestFile(t, dir, filepath.Join("web", "app.min.js"), "TOKEN=tok_abcd1234\n")
+	writeTestFile(t, dir, filepath.Join("web", "app.js"), "TOKEN=tok_abcd1234\n")
+	writeTestFile(t, dir, filepath.Join("testdata", "fixture.env"), "TOKEN=tok_abcd1234\n")
+	writeTestFile(t, dir, filepath.Join("src", "testdata", "fixture.env"), "TOKEN=tok_abcd1234\n")
+
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	}
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{
+			name: "no globs",
+			want: []string{"app.env", "src/testdata/fixture.env", "testdata/fixture.env", "web/app.js", "web/app.min.js"},
+		},
+		{
+			name:    "include only",
+			include: []string{"**/*.env"},
+			want:    []string{"app.env", "src/testdata/fixture.env", "testdata/fixture.env"},
+		},
+		{
+			name:    "include in a directory",
+			include: []string{"web/*.js"},
+			want:    []string{"web/app.js", "web/app.min.js"},
+		},
+		{
+			name:    "exclude only",
+			exclude: []string{"**/*.min.js", "testdata/**"},
+			want:    []string{"app.env", "src/testdata/fixture.env", "web/app.js"},
+		},
+		{
+			name:    "exclude a directory",
+			exclude: []string{"**/testdata"},
+			want:    []string{"app.env", "web/app.js", "web/app.min.js"},
+		},
+		{
+			name:    "include and exclude",
+			include: []string{"**/*.env", "**/*.js"},
+			exclude: []string{"**/*.min.js", "**/testdata/**"},
+			want:    []string{"app.env", "web/app.js"},
+		},
+		{
+			name:    "include matching nothing",
+			include: []string{"**/*.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := newTestScanner(t, rules)
+			scanner.IncludeGlobs = tt.include
+			scanner.ExcludeGlobs = tt.exclude
+			results, err := scanner.ScanDirectory(dir)
+			if err != nil {
+				t.Fatalf("ScanDirectory failed: %v", err)
+			}
+
+			var got []string
+			for _, result := range results {
+				rel, _ := filepath.Rel(dir, result.FilePath)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected results in %v, got %v", tt.want, got)
+			}
+			if scanner.Metrics.FilesScanned != int64(len(tt.want)) {
+				t.Errorf("Expected %d files scanned, got %d", len(tt.want), scanner.Metrics.FilesScanned)
+			}
+			if scanner.Metrics.FilesSkipped != 0 {
+				t.Errorf("Expected files left out not to be counted as skipped, got %d", scanner.Metrics.FilesSkipped)
+			}
+		})
+	}
+}
+
+func TestScanResultFingerprint(t *testing.T) {
+	base := ScanResult{
+		FilePath:   "config/app.env",
+		LineNumber: 3,
+		Match:      "tok_aZ3kQ9xLm2Pw7vRt",
+		RuleID:     "test.token",
+	}
+
+	with := func(modify func(r *ScanResult)) ScanResult {
+		r := base
+		modify(&r)
+		return r
+	}
+
+	fp := base.Fingerprint()
+	if len(fp) != 64 {
+		t.Fatalf("Expected a 64 character hex fingerprint, got %q", fp)
+	}
+	if strings.Contains(fp, base.Match) {
+		t.Error("Fingerprint must not contain the raw secret")
+	}
+
+	tests := []struct {
+		name  string
+		other ScanResult
+		equal bool
+	}{
+		{name: "different line", other: with(func(r *ScanResult) { r.LineNumber = 42 }), equal: true},
+		{name: "different redaction", other: with(func(r *ScanResult) { r.Redacted = "tok_*****" }), equal: true},
+		{name: "windows separators", other: with(func(r *ScanResult) { r.FilePath = `config\app.env` }), equal: true},
+		{name: "different rule", other: with(func(r *ScanResult) { r.RuleID = "test.other" }), equal: false},
+		{name: "different file", other: with(func(r *ScanResult) { r.FilePath = "config/other.env" }), equal: false},
+		{name: "different secret", other: with(func(r *ScanResult) { r.Match = "tok_bB8nM4cV1xZ6qW0e" }), equal: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.other.Fingerprint() == fp; got != tt.equal {
+				t.Errorf("Expected fingerprints equal = %v, got %v", tt.equal, got)
+			}
+		})
+	}
+}
+
+func TestScanResultURIPath(t *testing.T) {
+	unix := ScanResult{FilePath: "./config/app.env", LineNumber: 3, Match: "tok_aZ3kQ9xLm2Pw7vRt", RuleID: "test.token", Redacted: "tok_*****7vRt"}
+	windows := unix
+	windows.FilePath = `.\config\app.env`
+
+	if got := windows.URIPath(); got != "./config/app.env" {
+		t.Errorf("URIPath() = %q, expected ./config/app.env", got)
+	}
+	if windows.Fingerprint() != unix.Fingerprint() {
+		t.Error("Expected the same fingerprint for Windows and Unix paths")
+	}
+
+	baseline, err := GenerateBaseline([]ScanResult{windows})
+	if err != nil {
+		t.Fatalf("GenerateBaseline failed: %v", err)
+	}
+	if !strings.Contains(string(baseline), `"file_path": "./config/app.env"`) {
+		t.Errorf("Expected a slash-separated path in the baseline:\n%s", baseline)
+	}
+	if filtered := FilterAgainstBaseline([]ScanResult{unix}, baseline); len(filtered) != 0 {
+		t.Errorf("Expected a baseline written on Windows to suppress the Unix finding, got %v", filtered)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, []ScanResult{windows}, nil); err != nil {
+		t.Fatalf("WriteSARIF failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"uri": "config/app.env"`) {
+		t.Errorf("Expected a slash-separated SARIF URI:\n%s", buf.String())
+	}
+}
+
+func TestLoadRulesFromPaths(t *testing.T) {
+	ruleYAML := func(ids ...string) string {
+		var sb strings.Builder
+		sb.WriteString("rules:\n")
+		for _, id := range ids {
+			fmt.Fprintf(&sb, "  - name: %s\n    id: %s\n    pattern: tok_[a-z]{16}\n    entropy: 3.0\n    redact: [2, 2]\n", id, id)
+		}
+		return sb.String()
+	}
+
+	root := t.TempDir()
+	file := writeTestFile(t, root, "single.yaml", ruleYAML("pack.a.1"))
+	writeTestFile(t, root, "pack/b.yaml", ruleYAML("pack.b.1", "pack.b.2"))
+	writeTestFile(t, root, "pack/c.yml", ruleYAML("pack.c.1"))
+	dir := filepath.Join(root, "pack")
+
+	t.Run("merged", func(t *testing.T) {
+		rules, err := LoadRulesFromPaths([]string{file, dir})
+		if err != nil {
+			t.Fatalf("LoadRulesFromPaths failed: %v", err)
+		}
+
+		var ids []string
+		for _, rule := range rules {
+			ids = append(ids, rule.ID)
+		}
+		if strings.Join(ids, ",") != "pack.a.1,pack.b.1,pack.b.2,pack.c.1" {
+			t.Errorf("Unexpected merged rules: %v", ids)
+		}
+	})
+
+	t.Run("duplicate ID", func(t *testing.T) {
+		duplicate := writeTestFile(t, root, "duplicate.yaml", ruleYAML("pack.b.2"))
+
+		_, err := LoadRulesFromPaths([]string{dir, duplicate})
+		if err == nil {
+			t.Fatal("Expected an error for a duplicate rule ID")
+		}
+		if !strings.Contains(err.Error(), "pack.b.2") || !strings.Contains(err.Error(), duplicate) {
+			t.Errorf("Expected the error to name the ID and file, got: %v", err)
+		}
+	})
+
+	t.Run("missing path", func(t *testing.T) {
+		if _, err := LoadRulesFromPaths([]string{file, filepath.Join(root, "missing.yaml")}); err == nil {
+			t.Error("Expected an error for a missing path")
+		}
+	})
+}
+
+func TestScanResultColumn(t *testing.T) {
+	rules := []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+	}
+
+	// Columns count bytes, so the tab on the second line is a single column
+	content := "tok_aZ3kQ9xLm2Pw7vRt\n\tkey = \"tok_bB8nM4cV1xZ6qW0e\"\n"
+
+	expected := []struct {
+		line      int
+		column    int
+		endColumn int
+	}{
+		{line: 1, column: 1, endColumn: 21},
+		{line: 2, column: 9, endColumn: 29},
+	}
+
+	for _, wholeFile := range []bool{false, true} {
+		scanner := newTestScanner(t, rules)
+		scanner.WholeFile = wholeFile
+
+		results, err := scanner.ScanReader(strings.NewReader(content), "app.env")
+		if err != nil {
+			t.Fatalf("ScanReader failed: %v", err)
+		}
+		if len(results) != len(expected) {
+			t.Fatalf("WholeFile=%v: expected %d results, got %d", wholeFile, len(expected), len(results))
+		}
+
+		for i, want := range expected {
+			got := results[i]
+			if got.LineNumber != want.line || got.Column != want.column || got.EndColumn != want.endColumn {
+				t.Errorf("WholeFile=%v: result %d at %d:%d-%d, expected %d:%d-%d",
+					wholeFile, i, got.LineNumber, got.Column, got.EndColumn, want.line, want.column, want.endColumn)
+			}
+		}
+	}
+}
+
+func TestScanResultContextLines(t *testing.T) {
+	rules := []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+	}
+
+	content := strings.Join([]string{
+		"first=tok_aZ3kQ9xLm2Pw7vRt",
+		"line 2",
+		"line 3",
+		"middle=tok_bB8nM4cV1xZ6qW0e",
+		"line 5",
+		"line 6",
+		"line 7",
+		"last=tok_cC7mN3bV2xZ5qW9r",
+	}, "\n") + "\n"
+
+	expected := []struct {
+		before []string
+		after  []string
+	}{
+		{before: nil, after: []string{"line 2", "line 3"}},
+		{before: []string{"line 2", "line 3"}, after: []string{"line 5", "line 6"}},
+		{before: []string{"line 6", "line 7"}, after: nil},
+	}
+
+	for _, wholeFile := range []bool{false, true} {
+		scanner := newTestScanner(t, rules)
+		scanner.WholeFile = wholeFile
+		scanner.ContextLines = 2
+
+		results, err := scanner.ScanReader(strings.NewReader(content), "app.env")
+		if err != nil {
+			t.Fatalf("ScanReader failed: %v", err)
+		}
+		if len(results) != len(expected) {
+			t.Fatalf("WholeFile=%v: expected %d results, got %d", wholeFile, len(expected), len(results))
+		}
+
+		for i, want := range expected {
+			got := results[i]
+			if strings.Join(got.ContextBefore, "|") != strings.Join(want.before, "|") {
+				t.Errorf("WholeFile=%v: result %d context before = %q, expected %q", wholeFile, i, got.ContextBefore, want.before)
+			}
+			if strings.Join(got.ContextAfter, "|") != strings.Join(want.after, "|") {
+				t.Errorf("WholeFile=%v: result %d context after = %q, expected %q", wholeFile, i, got.ContextAfter, want.after)
+			}
+		}
+	}
+}
+
+func TestScanLineEndings(t *testing.T) {
+	rules := []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+	}
+	lines := []string{
+		"first=tok_aZ3kQ9xLm2Pw7vRt",
+		"line 2",
+		"  middle=tok_bB8nM4cV1xZ6qW0e",
+		"line 4",
+		"last=tok_cC7mN3bV2xZ5qW9r",
+	}
+	expected := []struct {
+		line, column int
+		before       string
+	}{
+		{line: 1, column: 7, before: ""},
+		{line: 3, column: 10, before: "line 2"},
+		{line: 5, column: 6, before: "line 4"},
+	}
+
+	for _, ending := range []string{"\n", "\r\n", "\r"} {
+		content := strings.Join(lines, ending) + ending
+		for _, wholeFile := range []bool{false, true} {
+			scanner := newTestScanner(t, rules)
+			scanner.WholeFile = wholeFile
+			scanner.ContextLines = 1
+
+			// Reading a byte at a time splits every CRLF across reads
+			results, err := scanner.ScanReader(iotest.OneByteReader(strings.NewReader(content)), "app.env")
+			if err != nil {
+				t.Fatalf("ScanReader failed: %v", err)
+			}
+			if len(results) != len(expected) {
+				t.Fatalf("%q, WholeFile=%v: expected %d results, got %d", ending, wholeFile, len(expected), len(results))
+			}
+			for i, want := range expected {
+				got := results[i]
+				if got.LineNumber != want.line || got.Column != want.column {
+					t.Errorf("%q, WholeFile=%v: result %d at %d:%d, expected %d:%d", ending, wholeFile, i, got.LineNumber, got.Column, want.line, want.column)
+				}
+				if strings.Join(got.ContextBefore, "|") != want.before {
+					t.Errorf("%q, WholeFile=%v: result %d context before = %q, expected %q", ending, wholeFile, i, got.ContextBefore, want.before)
+				}
+			}
+		}
+	}
+}
+
+func TestScanResultContextLinesRedacted(t *testing.T) {
+	rules := []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+	}
+
+	content := "a=tok_aZ3kQ9xLm2Pw7vRt\nb=tok_aZ3kQ9xLm2Pw7vRt\n"
+
+	for _, disableRedaction := range []bool{false, true} {
+		scanner := newTestScanner(t, rules)
+		scanner.ContextLines = 1
+		scanner.DisableRedaction = disableRedaction
+
+		results, err := scanner.ScanReader(strings.NewReader(content), "app.env")
+		if err != nil {
+			t.Fatalf("ScanReader failed: %v", err)
+		}
+		if len(results) != 2 || len(results[0].ContextAfter) != 1 {
+			t.Fatalf("Expected 2 results with context, got %+v", results)
+		}
+
+		leaked := strings.Contains(results[0].ContextAfter[0], "tok_aZ3kQ9xLm2Pw7vRt")
+		if leaked != disableRedaction {
+			t.Errorf("DisableRedaction=%v: context line %q", disableRedaction, results[0].ContextAfter[0])
+		}
+	}
+}
+
+func TestScanResultLongLine(t *testing.T) {
+	rules := []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+	}
+
+	// A single 20MB line, with secrets at the start, across the first segment
+	// boundary, and at the end
+	secrets := []string{"tok_aZ3kQ9xLm2Pw7vRt", "tok_bB8nM4cV1xZ6qW0e", "tok_cC7mN3bV2xZ5qW9r"}
+	line := []byte(strings.Repeat("x", 20*1024*1024))
+	offsets := []int{10, DefaultMaxLineLength - 10, len(line) - 30}
+	for i, secret := range secrets {
+		line[offsets[i]-1] = ' '
+		copy(line[offsets[i]:], secret)
+		line[offsets[i]+len(secret)] = ' '
+	}
+	content := string(line) + "\nnext = tok_dD6lK2jH1gF4dS8a\n"
+
+	results, err := newTestScanner(t, rules).ScanReader(strings.NewReader(content), "blob.min.js")
+	if err != nil {
+		t.Fatalf("ScanReader failed: %v", err)
+	}
+	if len(results) != len(secrets)+1 {
+		t.Fatalf("Expected %d results, got %d", len(secrets)+1, len(results))
+	}
+
+	for i, secret := range secrets {
+		if results[i].Match != secret || results[i].LineNumber != 1 || results[i].Column != offsets[i]+1 {
+			t.Errorf("Result %d = line %d column %d %q, expected line 1 column %d %q",
+				i, results[i].LineNumber, results[i].Column, results[i].Match, offsets[i]+1, secret)
+		}
+	}
+
+	if last := results[len(secrets)]; last.LineNumber != 2 || last.Column != 8 {
+		t.Errorf("Expected the following line to be line 2 column 8, got line %d column %d", last.LineNumber, last.Column)
+	}
+}
+
+func TestScannerMaxLineLength(t *testing.T) {
+	rules := []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+	}
+
+	// Lines just over the limit, with a secret across the segment boundary
+	tests := []struct {
+		name          string
+		maxLineLength int
+		prefix        int
+	}{
+		{name: "segmented", maxLineLength: 64, prefix: 50},
+		{name: "segmented at boundary", maxLineLength: 64, prefix: 44},
+		{name: "no limit", maxLineLength: 0, prefix: 50},
+		{name: "negative no limit", maxLineLength: -1, prefix: 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := strings.Repeat("x", tt.prefix) + " tok_aZ3kQ9xLm2Pw7vRt "
+			content := line + "\n" + line + "\n"
+
+			scanner := newTestScanner(t, rules)
+			scanner.MaxLineLength = tt.maxLineLength
+
+			results, err := scanner.ScanReader(strings.NewReader(content), "blob.min.js")
+			if err != nil {
+				t.Fatalf("ScanReader failed: %v", err)
+			}
+			if len(results) != 2 {
+				t.Fatalf("Expected 2 results, got %d: %+v", len(results), results)
+			}
+
+			for i, result := range results {
+				if result.LineNumber != i+1 || result.Column != tt.prefix+2 || result.EndColumn != tt.prefix+22 {
+					t.Errorf("Result %d = line %d columns %d-%d, expected line %d columns %d-%d",
+						i, result.LineNumber, result.Column, result.EndColumn, i+1, tt.prefix+2, tt.prefix+22)
+				}
+			}
+		})
+	}
+}
+
+func TestScannerResetMetrics(t *testing.T) {
+	rules := []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+	}
+
+	first := t.TempDir()
+	writeTestFile(t, first, "a.env", "key = tok_aZ3kQ9xLm2Pw7vRt\n")
+	writeTestFile(t, first, "b.env", "key = tok_bB8nM4cV1xZ6qW0e\n")
+
+	second := t.TempDir()
+	writeTestFile(t, second, "c.env", "key = tok_cC7mN3bV2xZ5qW9r\n")
+
+	scanner := newTestScanner(t, rules)
+
+	if _, err := scanner.ScanDirectory(first); err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if got := scanner.MetricsSnapshot(); got.FilesScanned != 2 || got.MatchesFound != 2 {
+		t.Errorf("First scan: expected 2 files and 2 matches, got %+v", got)
+	}
+
+	// Metrics accumulate unless reset
+	if _, err := scanner.ScanDirectory(second); err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if got := scanner.MetricsSnapshot(); got.FilesScanned != 3 || got.MatchesFound != 3 {
+		t.Errorf("Accumulated scans: expected 3 files and 3 matches, got %+v", got)
+	}
+
+	scanner.ResetMetrics()
+	if got := scanner.MetricsSnapshot(); got != (ScanMetrics{}) {
+		t.Errorf("Expected zero metrics after reset, got %+v", got)
+	}
+
+	if _, err := scanner.ScanDirectory(second); err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	want := ScanMetrics{FilesScanned: 1, TotalBytes: int64(len("key = tok_cC7mN3bV2xZ5qW9r\n")), MatchesFound: 1, UniqueSecrets: 1}
+	if got := scanner.MetricsSnapshot(); got != want {
+		t.Errorf("Scan after reset: expected %+v, got %+v", want, got)
+	}
+}
+
+func TestScannerOnProgress(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 50 {
+		writeTestFile(t, dir, fmt.Sprintf("file%02d.txt", i), fmt.Sprintf("TOKEN=tok_abcd%04d\n", i))
+	}
+	for i := range 10 {
+		writeTestFile(t, dir, fmt.Sprintf("empty%02d.txt", i), "")
+	}
+
+	scanner := newTestScanner(t, []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8}`,
+		},
+	})
+
+	type counts struct{ scanned, skipped int64 }
+	var observed []counts
+	scanner.OnProgress = func(scanned, skipped int64) {
+		observed = append(observed, counts{scanned, skipped})
+	}
+
+	if _, err := scanner.ScanDirectory(dir); err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	if len(observed) < 2 {
+		t.Fatalf("Expected periodic and final progress calls, got %v", observed)
+	}
+	for i := 1; i < len(observed); i++ {
+		if observed[i].scanned < observed[i-1].scanned || observed[i].skipped < observed[i-1].skipped {
+			t.Errorf("Progress went backwards: %v then %v", observed[i-1], observed[i])
+		}
+	}
+	if last := observed[len(observed)-1]; last != (counts{50, 10}) {
+		t.Errorf("Expected final progress of 50 scanned and 10 skipped, got %v", last)
+	}
+}
+
+func TestScanDirectoryOrdering(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 30 {
+		content := fmt.Sprintf("B=tokB_%04dabcd\nA=tokA_%04dabcd tokB_%04dwxyz\n", i, i, i)
+		writeTestFile(t, dir, fmt.Sprintf("sub%d/file%02d.txt", i%3, i), content)
+	}
+
+	scanner := newTestScanner(t, []Rule{
+		{Name: "Token B", ID: "test.b", Pattern: `tokB_[a-z0-9]{8}`},
+		{Name: "Token A", ID: "test.a", Pattern: `tokA_[a-z0-9]{8}`},
+	})
+
+	first, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	second, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	if len(first) != 90 || len(second) != len(first) {
+		t.Fatalf("Expected 90 results from each scan, got %d and %d", len(first), len(second))
+	}
+
+	for i := range first {
+		if first[i].FilePath != second[i].FilePath || first[i].LineNumber != second[i].LineNumber ||
+			first[i].RuleID != second[i].RuleID || first[i].Match != second[i].Match {
+			t.Fatalf("Result %d differs between scans: %+v vs %+v", i, first[i], second[i])
+		}
+	}
+
+	for i := 1; i < len(first); i++ {
+		a, b := first[i-1], first[i]
+		if a.FilePath > b.FilePath ||
+			a.FilePath == b.FilePath && a.LineNumber > b.LineNumber ||
+			a.FilePath == b.FilePath && a.LineNumber == b.LineNumber && a.RuleID > b.RuleID {
+			t.Errorf("Results %d and %d are out of order: %s:%d %s, %s:%d %s",
+				i-1, i, a.FilePath, a.LineNumber, a.RuleID, b.FilePath, b.LineNumber, b.RuleID)
+		}
+	}
+}
+
+func TestScannerDedupeOverlaps(t *testing.T) {
+	rules := []Rule{
+		{Name: "Upper Token", ID: "test.upper", Pattern: `[A-Z0-9]{20}`},
+		{Name: "AWS Access Key", ID: "test.aws.access", Pattern: `AKIA[A-Z0-9]{16}`},
+	}
+
+	content := "key = AKIAQ3ZKX7LM2PW9VRTB\nother = ZQ3ZKX7LM2PW9VRTBAB1\n"
+
+	for _, wholeFile := range []bool{false, true} {
+		for _, dedupe := range []bool{false, true} {
+			scanner := newTestScanner(t, rules)
+			scanner.WholeFile = wholeFile
+			scanner.DedupeOverlaps = dedupe
+
+			results, err := scanner.ScanReader(strings.NewReader(content), "app.env")
+			if err != nil {
+				t.Fatalf("ScanReader failed: %v", err)
+			}
+			SortResults(results)
+
+			var got []string
+			for _, result := range results {
+				got = append(got, fmt.Sprintf("%d:%s", result.LineNumber, result.RuleID))
+			}
+
+			want := []string{"1:test.aws.access", "2:test.upper"}
+			if !dedupe {
+				want = []string{"1:test.aws.access", "1:test.upper", "2:test.upper"}
+			}
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("WholeFile=%v DedupeOverlaps=%v: got %v, expected %v", wholeFile, dedupe, got, want)
+			}
+		}
+	}
+}
+
+func TestScannerDedupeOverlapsPriority(t *testing.T) {
+	// The generic rule's match is longer and its ID sorts first, so it wins
+	// every tie-break except priority
+	tests := []struct {
+		name             string
+		genericPriority  int
+		specificPriority int
+		want             string
+	}{
+		{name: "no priority", want: "test.a.generic"},
+		{name: "specific higher", specificPriority: 10, want: "test.specific"},
+		{name: "generic higher", genericPriority: 10, specificPriority: 5, want: "test.a.generic"},
+		{name: "negative generic", genericPriority: -1, want: "test.specific"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := newTestScanner(t, []Rule{
+				{Name: "Generic Token", ID: "test.a.generic", Pattern: `[A-Za-z0-9_]{24,}`, Priority: tt.genericPriority},
+				{Name: "Specific Token", ID: "test.specific", Pattern: `sk_live_[A-Za-z0-9]{16}`, Priority: tt.specificPriority},
+			})
+			scanner.DedupeOverlaps = true
+
+			results, err := scanner.ScanReader(strings.NewReader("key = sk_live_aZ3kQ9xLm2Pw7vRtXYZ\n"), "app.env")
+			if err != nil {
+				t.Fatalf("ScanReader failed: %v", err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("Expected 1 result, got %d: %+v", len(results), results)
+			}
+			if results[0].RuleID != tt.want {
+				t.Errorf("Expected %s to win, got %s", tt.want, results[0].RuleID)
+			}
+		})
+	}
+}
+
+func TestScannerRuleStats(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 10 {
+		content := fmt.Sprintf("A=tokA_%04dabcd\n", i)
+		if i%3 == 0 {
+			content += fmt.Sprintf("B=tokB_%04dabcd tokB_%04dwxyz\n", i, i)
+		}
+		writeTestFile(t, dir, fmt.Sprintf("file%02d.txt", i), content)
+	}
+
+	scanner := newTestScanner(t, []Rule{
+		{Name: "Token A", ID: "test.a", Pattern: `tokA_[a-z0-9]{8}`},
+		{Name: "Token B", ID: "test.b", Pattern: `tokB_[a-z0-9]{8}`},
+		{Name: "Token C", ID: "test.c", Pattern: `tokC_[a-z0-9]{8}`},
+	})
+
+	results, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	want := make(map[string]int64)
+	for _, result := range results {
+		want[result.RuleID]++
+	}
+
+	stats := scanner.RuleStats()
+	if len(stats) != len(want) || stats["test.a"] != 10 || stats["test.b"] != 8 {
+		t.Errorf("Expected 10 test.a and 8 test.b matches, got %v", stats)
+	}
+	for ruleID, count := range want {
+		if stats[ruleID] != count {
+			t.Errorf("Rule %s: expected %d matches, got %d", ruleID, count, stats[ruleID])
+		}
+	}
+	if _, ok := stats["test.c"]; ok {
+		t.Errorf("Expected no entry for a rule without matches, got %v", stats)
+	}
+
+	scanner.ResetMetrics()
+	if stats := scanner.RuleStats(); len(stats) != 0 {
+		t.Errorf("Expected no stats after reset, got %v", stats)
+	}
+}
+
+func TestScannerUniqueSecrets(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 5 {
+		writeTestFile(t, dir, fmt.Sprintf("file%d.env", i), "KEY=tok_aZ3kQ9xLm2Pw7vRt\nCOPY=tok_aZ3kQ9xLm2Pw7vRt\n")
+	}
+	writeTestFile(t, dir, "other.env", "KEY=tok_bB8nM4cV1xZ6qW0e\n")
+
+	scanner := newTestScanner(t, []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+	})
+
+	results, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	metrics := scanner.MetricsSnapshot()
+	if metrics.MatchesFound != 11 || metrics.UniqueSecrets != 2 {
+		t.Errorf("Expected 11 matches of 2 unique secrets, got %d matches of %d", metrics.MatchesFound, metrics.UniqueSecrets)
+	}
+
+	if unique := CountUniqueSecrets(results); unique != 2 {
+		t.Errorf("CountUniqueSecrets = %d, expected 2", unique)
+	}
+
+	// A single repeated secret counts once
+	var repeated []ScanResult
+	for _, result := range results {
+		if result.Match == "tok_aZ3kQ9xLm2Pw7vRt" {
+			repeated = append(repeated, result)
+		}
+	}
+	if len(repeated) != 10 || CountUniqueSecrets(repeated) != 1 {
+		t.Errorf("Expected 10 occurrences of 1 unique secret, got %d of %d", len(repeated), CountUniqueSecrets(repeated))
+	}
+}
+
+func TestScannerMaxFindings(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 500 {
+		writeTestFile(t, dir, fmt.Sprintf("file%03d.env", i), fmt.Sprintf("A=tok_aZ3kQ9xLm2Pw%04d\nB=tok_bB8nM4cV1xZ6%04d\n", i, i))
+	}
+
+	scanner := newTestScanner(t, []Rule{
+		{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-zA-Z0-9]{16}`},
+	})
+
+	for _, maxFindings := range []int{1, 3} {
+		scanner.ResetMetrics()
+		scanner.MaxFindings = maxFindings
+
+		results, err := scanner.ScanDirectory(dir)
+		if err != nil {
+			t.Fatalf("MaxFindings=%d: ScanDirectory failed: %v", maxFindings, err)
+		}
+		if len(results) != maxFindings {
+			t.Errorf("MaxFindings=%d: expected %d results, got %d", maxFindings, maxFindings, len(results))
+		}
+		if scanned := scanner.MetricsSnapshot().FilesScanned; scanned >= 500 {
+			t.Errorf("MaxFindings=%d: expected the scan to stop early, scanned %d files", maxFindings, scanned)
+		}
+	}
+
+	scanner.ResetMetrics()
+	scanner.MaxFindings = 0
+
+	results, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	if len(results) != 1000 {
+		t.Errorf("Expected all 1000 results without a limit, got %d", len(results))
+	}
+}
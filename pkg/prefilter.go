@@ -0,0 +1,303 @@
+package poltergeist
+
+import (
+	"regexp/syntax"
+	"slices"
+)
+
+// minPrefilterLiteral is the shortest literal worth prefiltering on; shorter
+// literals appear in too many lines to skip any work
+const minPrefilterLiteral = 3
+
+// maxPrefilterExpansions limits how many strings a part of a pattern is
+// expanded into when finding its literals
+const maxPrefilterExpansions = 16
+
+// prefilter finds which patterns may match some text by searching it for
+// their required literals at once, with an Aho-Corasick automaton. Literals
+// are matched ignoring ASCII case, so it never rules out a pattern that can
+// match, whatever the pattern's case sensitivity.
+type prefilter struct {
+	classes     [256]int32 // Symbol of each byte, with 0 for bytes in no literal
+	numClasses  int32
+	next        []int32 // Transitions, indexed by state*numClasses + symbol
+	out         [][]int // Patterns with a literal ending at each state
+	always      []int   // Patterns without a literal, which are always run
+	numPatterns int
+}
+
+// newPrefilter builds a prefilter for patterns, which are compiled as the Go
+// regex engine compiles them. Patterns without a literal that every match
+// contains are always run.
+func newPrefilter(patterns []string) *prefilter {
+	p := &prefilter{numPatterns: len(patterns)}
+
+	literals := make([][]string, len(patterns))
+	for i, pattern := range patterns {
+		literals[i] = requiredLiterals(pattern)
+		if literals[i] == nil {
+			p.always = append(p.always, i)
+			continue
+		}
+		for _, literal := range literals[i] {
+			for j := range len(literal) {
+				c := lowerASCII(literal[j])
+				if p.classes[c] == 0 {
+					p.numClasses++
+					p.classes[c] = p.numClasses
+				}
+			}
+		}
+	}
+	p.numClasses++ // Symbol 0
+	for c := 'A'; c <= 'Z'; c++ {
+		p.classes[c] = p.classes[c+'a'-'A']
+	}
+
+	// Build the trie of literals, with state 0 as the root
+	p.next = make([]int32, p.numClasses)
+	p.out = [][]int{nil}
+	for i, alternatives := range literals {
+		for _, literal := range alternatives {
+			state := int32(0)
+			for j := range len(literal) {
+				symbol := p.classes[literal[j]]
+				if p.next[state*p.numClasses+symbol] == 0 {
+					p.next[state*p.numClasses+symbol] = int32(len(p.out))
+					p.next = append(p.next, make([]int32, p.numClasses)...)
+					p.out = append(p.out, nil)
+				}
+				state = p.next[state*p.numClasses+symbol]
+			}
+			if !slices.Contains(p.out[state], i) {
+				p.out[state] = append(p.out[state], i)
+			}
+		}
+	}
+
+	// Turn the trie into an automaton breadth first, following failure links
+	// for missing transitions and merging the outputs of failure states
+	fail := make([]int32, len(p.out))
+	var queue []int32
+	for symbol := range p.numClasses {
+		if child := p.next[symbol]; child != 0 {
+			queue = append(queue, child)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for _, i := range p.out[fail[state]] {
+			if !slices.Contains(p.out[state], i) {
+				p.out[state] = append(p.out[state], i)
+			}
+		}
+
+		for symbol := range p.numClasses {
+			child := p.next[state*p.numClasses+symbol]
+			if child == 0 {
+				p.next[state*p.numClasses+symbol] = p.next[fail[state]*p.numClasses+symbol]
+				continue
+			}
+			fail[child] = p.next[fail[state]*p.numClasses+symbol]
+			queue = append(queue, child)
+		}
+	}
+
+	return p
+}
+
+// prefilterCandidates reports which patterns may match text
+func prefilterCandidates[T string | []byte](p *prefilter, text T) []bool {
+	candidates := make([]bool, p.numPatterns)
+	for _, i := range p.always {
+		candidates[i] = true
+	}
+
+	state := int32(0)
+	for i := range len(text) {
+		state = p.next[state*p.numClasses+p.classes[text[i]]]
+		for _, pattern := range p.out[state] {
+			candidates[pattern] = true
+		}
+	}
+	return candidates
+}
+
+// requiredLiterals returns literals of which every match of pattern contains
+// at least one, or nil if there are none worth prefiltering on
+func requiredLiterals(pattern string) []string {
+	re, err := syntax.Parse("(?s)"+NormalizeExtendedRegex(pattern), syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	return literalsOf(re.Simplify())
+}
+
+// literalsOf returns the best set of literals of which every match of re
+// contains one, preferring sets whose shortest literal is longest
+func literalsOf(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		literal := literalRun(re.Rune, re.Flags&syntax.FoldCase != 0)
+		if len(literal) < minPrefilterLiteral {
+			return nil
+		}
+		return []string{literal}
+
+	case syntax.OpCapture, syntax.OpPlus:
+		return literalsOf(re.Sub[0])
+
+	case syntax.OpRepeat:
+		if re.Min < 1 {
+			return nil
+		}
+		return literalsOf(re.Sub[0])
+
+	case syntax.OpConcat:
+		// Runs of subexpressions matching a few fixed strings, such as
+		// gh[op]_, are expanded into every string they match
+		var best []string
+		consider := func(literals []string) {
+			if literals != nil && shortest(literals) >= minPrefilterLiteral && (best == nil || shortest(literals) > shortest(best)) {
+				best = literals
+			}
+		}
+
+		run := []string{""}
+		for _, sub := range re.Sub {
+			strs := expansions(sub)
+			if strs == nil {
+				consider(run)
+				consider(literalsOf(sub))
+				run = []string{""}
+				continue
+			}
+			if len(run)*len(strs) > maxPrefilterExpansions {
+				consider(run)
+				run = []string{""}
+			}
+			run = product(run, strs)
+		}
+		consider(run)
+		return best
+
+	case syntax.OpAlternate:
+		var all []string
+		for _, sub := range re.Sub {
+			literals := literalsOf(sub)
+			if literals == nil {
+				return nil
+			}
+			all = append(all, literals...)
+		}
+		return all
+	}
+
+	return nil
+}
+
+// expansions returns every string re can match, lower cased, if there are
+// at most maxPrefilterExpansions of them and the prefilter can match them all
+func expansions(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		literal := literalRun(re.Rune, re.Flags&syntax.FoldCase != 0)
+		if len(literal) != len(re.Rune) {
+			return nil
+		}
+		return []string{literal}
+
+	case syntax.OpCharClass:
+		var strs []string
+		for i := 0; i < len(re.Rune); i += 2 {
+			for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+				if r >= 0x80 || len(strs) == maxPrefilterExpansions {
+					return nil
+				}
+				if s := string(rune(lowerASCII(byte(r)))); !slices.Contains(strs, s) {
+					strs = append(strs, s)
+				}
+			}
+		}
+		return strs
+
+	case syntax.OpCapture:
+		return expansions(re.Sub[0])
+
+	case syntax.OpConcat:
+		strs := []string{""}
+		for _, sub := range re.Sub {
+			subStrs := expansions(sub)
+			if subStrs == nil || len(strs)*len(subStrs) > maxPrefilterExpansions {
+				return nil
+			}
+			strs = product(strs, subStrs)
+		}
+		return strs
+
+	case syntax.OpAlternate:
+		var strs []string
+		for _, sub := range re.Sub {
+			subStrs := expansions(sub)
+			if subStrs == nil || len(strs)+len(subStrs) > maxPrefilterExpansions {
+				return nil
+			}
+			strs = append(strs, subStrs...)
+		}
+		return strs
+
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return []string{""}
+	}
+
+	return nil
+}
+
+// product returns every concatenation of a string in a with one in b
+func product(a, b []string) []string {
+	strs := make([]string, 0, len(a)*len(b))
+	for _, x := range a {
+		for _, y := range b {
+			strs = append(strs, x+y)
+		}
+	}
+	return strs
+}
+
+// literalRun returns the longest run of runes in a literal that the prefilter
+// can match, lower cased. Only ASCII is matched, and the prefilter ignores
+// ASCII case, but case-insensitive k and s also match non-ASCII runes (K and
+// ſ), so those break runs in case-insensitive literals.
+func literalRun(runes []rune, foldCase bool) string {
+	var best, run []byte
+	for _, r := range runes {
+		if r >= 0x80 || foldCase && (r == 'k' || r == 'K' || r == 's' || r == 'S') {
+			run = run[:0]
+			continue
+		}
+		run = append(run, lowerASCII(byte(r)))
+		if len(run) > len(best) {
+			best = slices.Clone(run)
+		}
+	}
+	return string(best)
+}
+
+// shortest returns the length of the shortest of literals
+func shortest(literals []string) int {
+	n := len(literals[0])
+	for _, literal := range literals[1:] {
+		n = min(n, len(literal))
+	}
+	return n
+}
+
+// lowerASCII returns the lower case of an ASCII letter, or c otherwise
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,126 @@
+package poltergeist
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaskChar is the character that replaces the hidden part of a
+// redacted secret
+const DefaultMaskChar = '*'
+
+// fixedMaskLength is the number of mask characters shown in place of the
+// hidden part of a secret, unless the mask preserves its length
+const fixedMaskLength = 5
+
+// Mask controls how redaction hides the middle of a secret. The zero Mask
+// shows five DefaultMaskChar characters, whatever the secret's length.
+type Mask struct {
+	Char           rune // Mask character, defaults to DefaultMaskChar
+	PreserveLength bool // If true, show one mask character per hidden character instead of a fixed count
+}
+
+// hide returns the mask for hidden text, count characters long unless the
+// mask preserves the text's length
+func (m Mask) hide(hidden string, count int) string {
+	if m.PreserveLength {
+		count = utf8.RuneCountInString(hidden)
+	}
+
+	char := m.Char
+	if char == 0 {
+		char = DefaultMaskChar
+	}
+	return strings.Repeat(string(char), count)
+}
+
+// candidateSecretPattern matches runs of characters that commonly make up
+// tokens, keys, and other credentials. Path separators and dots are excluded
+// so file paths in log lines stay readable.
+var candidateSecretPattern = regexp.MustCompile(`[A-Za-z0-9_+=-]{16,}`)
+
+// candidateSecretEntropy is the minimum entropy for a token in a log line to
+// be treated as a possible secret
+const candidateSecretEntropy = 3.0
+
+// redactMatch redacts a matched secret, preserving the number of leading and
+// trailing characters given by the rule's redact offsets. When the offsets
+// can't be applied, the first and last 4 characters are kept, and very short
+// matches are fully redacted. The raw secret is never returned.
+func redactMatch(match string, redact []int, mask Mask) string {
+	if len(redact) > 1 &&
+		redact[0] > 0 &&
+		redact[1] > 0 &&
+		len(match) > redact[0]+redact[1] {
+		// Use rule-specific redaction offsets
+		hidden := match[redact[0] : len(match)-redact[1]]
+		return match[:redact[0]] + mask.hide(hidden, min(fixedMaskLength, len(match))) + match[len(match)-redact[1]:]
+	}
+
+	if len(match) > 8 {
+		// Fallback: show first 4 and last 4 chars
+		return match[:4] + mask.hide(match[4:len(match)-4], min(fixedMaskLength, len(match)-8)) + match[len(match)-4:]
+	}
+
+	// Very short match: fully redact
+	return mask.hide(match, len(match))
+}
+
+// redactContextLine redacts a line shown as context around a result: the
+// result's match wherever it appears, and anything else that looks like a
+// secret, masked with mask
+func redactContextLine(line string, result ScanResult, mask Mask) string {
+	if result.Match != "" {
+		line = strings.ReplaceAll(line, result.Match, result.Redacted)
+	}
+	return redactCandidateSecrets(line, mask)
+}
+
+// redactSecrets redacts anything in text that looks like a secret, so error
+// and log lines can be printed without leaking matched content. A candidate
+// secret is a long token containing both letters and digits with high enough
+// entropy; ordinary words, paths, and short values are left untouched.
+func redactSecrets(text string) string {
+	return redactCandidateSecrets(text, Mask{})
+}
+
+// redactedError is an error whose message is redacted with redactSecrets, such
+// as a compile error quoting a pattern, while errors.Is and errors.As still
+// see the original error
+type redactedError struct {
+	err error
+}
+
+// Error returns the original error's message with secrets redacted
+func (e redactedError) Error() string {
+	return redactSecrets(e.err.Error())
+}
+
+// Unwrap returns the original error
+func (e redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactCandidateSecrets redacts anything in text that looks like a secret,
+// as redactSecrets does, masked with mask
+func redactCandidateSecrets(text string, mask Mask) string {
+	return candidateSecretPattern.ReplaceAllStringFunc(text, func(token string) string {
+		if !isCandidateSecret(token) {
+			return token
+		}
+		return redactMatch(token, nil, mask)
+	})
+}
+
+// isCandidateSecret reports whether a token looks like it could be a secret
+func isCandidateSecret(token string) bool {
+	hasLetter := strings.IndexFunc(token, func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+	}) >= 0
+	hasDigit := strings.IndexFunc(token, func(r rune) bool {
+		return r >= '0' && r <= '9'
+	}) >= 0
+
+	return hasLetter && hasDigit && ShannonEntropy(token) >= candidateSecretEntropy
+}
@@ -0,0 +1,152 @@
+package poltergeist
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"sort"
+)
+
+// reportTemplate is the self-contained page written by WriteHTMLReport. It
+// loads no external resources, so it can be shared as a single file.
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Poltergeist scan report</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2rem auto; max-width: 72rem; padding: 0 1rem; color: #1f2328; }
+h1 { font-size: 1.6rem; }
+h2 { font-size: 1.1rem; margin: 2rem 0 0.5rem; word-break: break-all; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #d1d9e0; padding: 0.4rem 0.6rem; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+code { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; word-break: break-all; }
+.summary td:first-child { font-weight: 600; width: 14rem; }
+.count { color: #59636e; font-weight: normal; }
+.severity { border-radius: 1rem; display: inline-block; font-size: 0.8rem; padding: 0.1rem 0.6rem; background: #eff2f5; }
+.severity-critical { background: #82071e; color: #fff; }
+.severity-high { background: #cf222e; color: #fff; }
+.severity-medium { background: #bf8700; color: #fff; }
+.severity-low { background: #0969da; color: #fff; }
+</style>
+</head>
+<body>
+<h1>Poltergeist scan report</h1>
+<table class="summary">
+<tr><td>Findings</td><td id="finding-count">{{len .Results}}</td></tr>
+<tr><td>Files with findings</td><td>{{len .Files}}</td></tr>
+{{- range .Severities}}
+<tr><td>Severity {{.Name}}</td><td>{{.Count}}</td></tr>
+{{- end}}
+<tr><td>Files scanned</td><td>{{.Metrics.FilesScanned}}</td></tr>
+<tr><td>Files skipped</td><td>{{.Metrics.FilesSkipped}}</td></tr>
+<tr><td>Content scanned</td><td>{{.Bytes}}</td></tr>
+<tr><td>Rules</td><td>{{.RuleCount}}</td></tr>
+</table>
+{{- if not .Files}}
+<p>No secrets found.</p>
+{{- end}}
+{{- range .Files}}
+<section class="file">
+<h2><code>{{.Path}}</code> <span class="count">({{len .Results}} {{if eq (len .Results) 1}}finding{{else}}findings{{end}})</span></h2>
+<table>
+<tr><th>Location</th><th>Rule</th><th>Severity</th><th>Redacted match</th><th>Entropy</th></tr>
+{{- range .Results}}
+<tr class="finding">
+<td>{{.LineNumber}}:{{.Column}}</td>
+<td title="{{.Description}}">{{.RuleName}}<br><code>{{.RuleID}}</code></td>
+<td><span class="severity severity-{{.Severity}}">{{.Severity}}</span></td>
+<td><code>{{.Redacted}}</code></td>
+<td>{{printf "%.2f" .Entropy}} / {{printf "%.2f" .RuleEntropyThreshold}}</td>
+</tr>
+{{- end}}
+</table>
+</section>
+{{- end}}
+</body>
+</html>
+`))
+
+// reportFile is the findings of one file in an HTML report
+type reportFile struct {
+	Path    string
+	Results []reportResult
+}
+
+// reportResult is a finding in an HTML report, with its rule's description
+type reportResult struct {
+	ScanResult
+	Description string
+}
+
+// reportSeverity is the number of findings of a severity in an HTML report
+type reportSeverity struct {
+	Name  string
+	Count int
+}
+
+// WriteHTMLReport writes results as a self-contained HTML page for sharing
+// with people who don't use the CLI. Findings are grouped by file with their
+// counts and severities, alongside the scan's metrics. Only redacted matches
+// are included. Rules supply the description shown for each finding.
+func WriteHTMLReport(w io.Writer, results []ScanResult, rules []Rule, summary ScanMetrics) error {
+	descriptions := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		descriptions[rule.ID] = rule.Description
+	}
+
+	sorted := slices.Clone(results)
+	SortResults(sorted)
+
+	var files []reportFile
+	severityCounts := make(map[string]int)
+	for _, result := range sorted {
+		if len(files) == 0 || files[len(files)-1].Path != result.FilePath {
+			files = append(files, reportFile{Path: result.FilePath})
+		}
+		file := &files[len(files)-1]
+		file.Results = append(file.Results, reportResult{ScanResult: result, Description: descriptions[result.RuleID]})
+		severityCounts[result.Severity]++
+	}
+
+	// Most severe first, followed by any unknown severities
+	var severities []reportSeverity
+	for _, severity := range slices.Backward(Severities) {
+		if count := severityCounts[severity]; count > 0 {
+			severities = append(severities, reportSeverity{Name: severity, Count: count})
+			delete(severityCounts, severity)
+		}
+	}
+	var others []reportSeverity
+	for severity, count := range severityCounts {
+		others = append(others, reportSeverity{Name: severity, Count: count})
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].Name < others[j].Name
+	})
+	severities = append(severities, others...)
+
+	data := struct {
+		Results    []ScanResult
+		Files      []reportFile
+		Severities []reportSeverity
+		Metrics    ScanMetrics
+		Bytes      string
+		RuleCount  int
+	}{
+		Results:    results,
+		Files:      files,
+		Severities: severities,
+		Metrics:    summary,
+		Bytes:      FormatBytes(summary.TotalBytes),
+		RuleCount:  len(rules),
+	}
+
+	if err := reportTemplate.Execute(w, data); err != nil {
+		return fmt.Errorf("failed to write HTML report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package poltergeist
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestWriteHTMLReport(t *testing.T) {
+	results := []ScanResult{
+		{FilePath: "src/main.go", LineNumber: 12, Column: 5, Match: "tok_aZ3kQ9xLm2Pw7vRt", Redacted: "tok_*****7vRt", RuleName: "Test Token", RuleID: "test.token", Severity: SeverityHigh},
+		{FilePath: "config/app.env", LineNumber: 3, Column: 7, Match: "key_0123456789abcdef", Redacted: "key_*****cdef", RuleName: "Test Key", RuleID: "test.key", Severity: SeverityCritical},
+		{FilePath: "src/main.go", LineNumber: 2, Column: 1, Match: "tok_<b>script</b>99", Redacted: "tok_<b>*****</b>99", RuleName: "Test Token", RuleID: "test.token", Severity: SeverityHigh},
+	}
+	rules := []Rule{
+		{Name: "Test Token", ID: "test.token", Description: "A test token."},
+		{Name: "Test Key", ID: "test.key", Description: "A test key."},
+	}
+	metrics := ScanMetrics{FilesScanned: 10, FilesSkipped: 2, TotalBytes: 4096}
+
+	var buf bytes.Buffer
+	if err := WriteHTMLReport(&buf, results, rules, metrics); err != nil {
+		t.Fatalf("WriteHTMLReport failed: %v", err)
+	}
+
+	doc, err := html.Parse(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML report: %v", err)
+	}
+
+	// Collect the file headings, the finding rows of each file, and the
+	// finding count
+	var files []string
+	rows := make(map[string]int)
+	var findingCount string
+	var walk func(n *html.Node, file string)
+	walk = func(n *html.Node, file string) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "h2":
+				file = textOf(n.FirstChild)
+				files = append(files, file)
+			case n.Data == "tr" && attr(n, "class") == "finding":
+				rows[files[len(files)-1]]++
+			case attr(n, "id") == "finding-count":
+				findingCount = textOf(n)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, file)
+		}
+	}
+	walk(doc, "")
+
+	if want := []string{"config/app.env", "src/main.go"}; strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected file groups %v, got %v", want, files)
+	}
+	if rows["config/app.env"] != 1 || rows["src/main.go"] != 2 {
+		t.Errorf("Expected 1 and 2 findings per file, got %v", rows)
+	}
+	if findingCount != "3" {
+		t.Errorf("Expected a finding count of 3, got %q", findingCount)
+	}
+
+	output := buf.String()
+	for _, want := range []string{"(2 findings)", "(1 finding)", "Severity critical</td><td>1", "Severity high</td><td>2", "4.0 KB", `title="A test token."`} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in report", want)
+		}
+	}
+	for _, result := range results {
+		if strings.Contains(output, result.Match) {
+			t.Errorf("Expected the raw match %q not to be in the report", result.Match)
+		}
+	}
+	if strings.Contains(output, "<b>") {
+		t.Error("Expected matched text to be escaped")
+	}
+}
+
+func TestWriteHTMLReportNoResults(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHTMLReport(&buf, nil, nil, ScanMetrics{FilesScanned: 3}); err != nil {
+		t.Fatalf("WriteHTMLReport failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "No secrets found.") {
+		t.Errorf("Expected a no findings message:\n%s", buf.String())
+	}
+	if _, err := html.Parse(&buf); err != nil {
+		t.Errorf("Failed to parse HTML report: %v", err)
+	}
+}
+
+// textOf returns the text content of n and its descendants
+func textOf(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textOf(c))
+	}
+	return sb.String()
+}
+
+// attr returns the value of n's attribute key, or "" if it has none
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -2,8 +2,12 @@ package poltergeist
 
 import (
 	"embed"
+	"errors"
 	"fmt"
 	"math"
+	"net/netip"
+	"regexp"
+	"slices"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -34,17 +38,70 @@ type Rule struct {
 	// Tags are categorization tags.
 	Tags []string `yaml:"tags"`
 
+	// Enabled controls whether the rule is compiled. Defaults to true, so
+	// experimental rules can ship disabled with `enabled: false`.
+	Enabled *bool `yaml:"enabled"` // optional
+
+	// Severity is the triage priority of findings: low, medium, high, or
+	// critical. Defaults to DefaultSeverity.
+	Severity string `yaml:"severity"` // optional
+
+	// Priority decides which of overlapping matches from different rules is
+	// kept when Scanner.DedupeOverlaps is set. Higher wins. Defaults to 0.
+	Priority int `yaml:"priority"` // optional
+
 	// Pattern is a regex pattern for matching.
 	Pattern string `yaml:"pattern"`
 
+	// CaptureGroup selects the capture group holding the secret, by name
+	// (for (?P<name>...) groups) or index. Defaults to the last group that
+	// participated in the match, or the whole match if there is none.
+	CaptureGroup string `yaml:"capture_group"` // optional
+
+	// Patterns are additional regex patterns for variants of the same
+	// secret, such as old and new prefixes. Matches from every pattern are
+	// reported under the rule's ID.
+	Patterns []string `yaml:"patterns"` // optional
+
+	// Type selects how matches are processed. Empty or "regex" reports the
+	// regex match, "connstring" reports the password of a connection URI,
+	// and "host" reports hosts within Domains or CIDRs.
+	Type string `yaml:"type"` // optional
+
+	// Domains are the domains reported by "host" rules. A match is reported
+	// if it equals a domain or is a subdomain of one.
+	Domains []string `yaml:"domains"` // optional
+
+	// CIDRs are the IP ranges reported by "host" rules. Defaults to the
+	// private ranges in DefaultPrivateCIDRs.
+	CIDRs []string `yaml:"cidrs"` // optional
+
+	// Allowlist is a list of regex patterns for known-benign matches, such as
+	// documentation placeholders. Matches whose text matches any of these
+	// patterns are dropped.
+	Allowlist []string `yaml:"allowlist"` // optional
+
 	// Redact is a list of byte offsets, between which the matched text
 	// should be replaced with the redaction string to prevent leaking
 	// sensitive data.
 	Redact []int `yaml:"redact"`
 
+	// MaskChar is the character shown in place of the redacted text.
+	// Defaults to the scanner's mask, or "*".
+	MaskChar string `yaml:"mask_char"` // optional
+
+	// MaskPreserveLength shows one mask character per redacted character
+	// instead of a fixed count, overriding the scanner's mask.
+	MaskPreserveLength bool `yaml:"mask_preserve_length"` // optional
+
 	// Entropy is the minimum entropy threshold for matches.
 	Entropy float64 `yaml:"entropy"`
 
+	// Validator names a built-in check, such as "luhn", or one added with
+	// RegisterValidator, that matches must pass in addition to the entropy
+	// threshold to be reported.
+	Validator string `yaml:"validator"` // optional
+
 	// Tests are test cases for rule validation - both positive and negative.
 	Tests Test `yaml:"tests"`
 
@@ -67,23 +124,236 @@ type Test struct {
 
 // RuntimeRule contains only the rule fields needed for pattern matching at runtime
 type RuntimeRule struct {
-	Name    string
-	ID      string
-	Pattern string
-	Redact  []int
-	Entropy float64
+	Name         string
+	ID           string
+	Tags         []string
+	Pattern      string
+	Patterns     []string // Every pattern of the rule, starting with Pattern
+	CaptureGroup string   // Capture group holding the secret, see Rule.CaptureGroup
+	Type         string
+	Severity     string
+	Priority     int
+	Redact       []int
+	Mask         *Mask // Redaction mask, if the rule sets one
+	Entropy      float64
+	Validator    func(string) bool // Structural check matches must pass, if any
+	Domains      []string          // Lowercased domains for host rules
+	Networks     []netip.Prefix    // IP ranges for host rules
+	Allowlist    []*regexp.Regexp  // Compiled allowlist patterns
+}
+
+// Validate checks the rule's fields, so an invalid rule fails when it is
+// loaded rather than misbehaving during a scan. The returned error describes
+// every invalid field.
+func (r Rule) Validate() error {
+	var errs []error
+
+	if r.ID == "" {
+		errs = append(errs, errors.New("id is required"))
+	}
+
+	if len(r.AllPatterns()) == 0 {
+		errs = append(errs, errors.New("pattern or patterns is required"))
+	}
+
+	if len(r.Redact) != 2 {
+		errs = append(errs, fmt.Errorf("redact must be a pair of offsets [prefix, suffix], got %v", r.Redact))
+	} else if r.Redact[0] < 0 || r.Redact[1] < 0 {
+		errs = append(errs, fmt.Errorf("redact offsets must not be negative, got %v", r.Redact))
+	}
+
+	if r.MaskChar != "" && utf8.RuneCountInString(r.MaskChar) != 1 {
+		errs = append(errs, fmt.Errorf("mask_char must be a single character, got '%s'", r.MaskChar))
+	}
+
+	if r.Entropy <= 0 {
+		errs = append(errs, fmt.Errorf("entropy must be greater than zero, got %g", r.Entropy))
+	}
+
+	if r.Severity != "" && !ValidSeverity(r.Severity) {
+		errs = append(errs, fmt.Errorf("severity must be one of %s, got '%s'", strings.Join(Severities, ", "), r.Severity))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid rule '%s': %w", r.ID, errors.Join(errs...))
+	}
+	return nil
+}
+
+// validateRules returns the validation error of the first invalid rule
+func validateRules(rules []Rule) error {
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AllPatterns returns the rule's Pattern followed by its Patterns, skipping
+// empty entries
+func (r *Rule) AllPatterns() []string {
+	patterns := make([]string, 0, 1+len(r.Patterns))
+	for _, pattern := range append([]string{r.Pattern}, r.Patterns...) {
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// IsEnabled reports whether the rule is enabled. Rules are enabled unless
+// Enabled is explicitly set to false.
+func (r *Rule) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// EnabledRules returns the rules that are enabled
+func EnabledRules(rules []Rule) []Rule {
+	enabled := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.IsEnabled() {
+			enabled = append(enabled, rule)
+		}
+	}
+	return enabled
+}
+
+// FilterRulesByTags returns the rules that have at least one of the include
+// tags and none of the exclude tags. An empty include list keeps every rule
+// that isn't excluded. Tags are compared case-insensitively.
+func FilterRulesByTags(rules []Rule, include, exclude []string) []Rule {
+	filtered := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		if len(include) > 0 && !hasAnyTag(rule, include) {
+			continue
+		}
+		if hasAnyTag(rule, exclude) {
+			continue
+		}
+		filtered = append(filtered, rule)
+	}
+	return filtered
+}
+
+// FilterRulesByID returns the rules with the given IDs, in their original
+// order. It returns an error naming any ID that doesn't match a rule.
+func FilterRulesByID(rules []Rule, ids []string) ([]Rule, error) {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	filtered := make([]Rule, 0, len(ids))
+	found := make(map[string]bool, len(ids))
+	for _, rule := range rules {
+		if wanted[rule.ID] {
+			filtered = append(filtered, rule)
+			found[rule.ID] = true
+		}
+	}
+
+	var unknown []string
+	for _, id := range ids {
+		if !found[id] && !slices.Contains(unknown, id) {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown rule ID(s): %s", strings.Join(unknown, ", "))
+	}
+
+	return filtered, nil
+}
+
+// hasAnyTag reports whether the rule has any of the given tags, ignoring case
+func hasAnyTag(rule Rule, tags []string) bool {
+	for _, tag := range rule.Tags {
+		for _, want := range tags {
+			if strings.EqualFold(tag, want) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // ToRuntimeRule converts a Rule to a RuntimeRule, excluding test and history data
 // to improve memory efficiency in the engine.
 func (r *Rule) ToRuntimeRule() RuntimeRule {
-	return RuntimeRule{
-		Name:    r.Name,
-		ID:      r.ID,
-		Pattern: r.Pattern,
-		Redact:  r.Redact,
-		Entropy: r.Entropy,
+	runtimeRule := RuntimeRule{
+		Name:         r.Name,
+		ID:           r.ID,
+		Tags:         r.Tags,
+		Pattern:      r.Pattern,
+		Patterns:     r.AllPatterns(),
+		CaptureGroup: r.CaptureGroup,
+		Type:         r.Type,
+		Severity:     r.Severity,
+		Priority:     r.Priority,
+		Redact:       r.Redact,
+		Entropy:      r.Entropy,
+	}
+
+	if r.Validator != "" {
+		runtimeRule.Validator, _ = lookupValidator(r.Validator)
+	}
+
+	if runtimeRule.Severity == "" {
+		runtimeRule.Severity = DefaultSeverity
+	}
+
+	if r.MaskChar != "" || r.MaskPreserveLength {
+		var char rune
+		if r.MaskChar != "" {
+			char, _ = utf8.DecodeRuneInString(r.MaskChar)
+		}
+		runtimeRule.Mask = &Mask{Char: char, PreserveLength: r.MaskPreserveLength}
 	}
+
+	if len(r.Allowlist) > 0 {
+		runtimeRule.Allowlist = allowlistPatterns(r.Allowlist)
+	}
+
+	if r.Type == RuleTypeHost {
+		runtimeRule.Domains = hostDomains(r.Domains)
+		runtimeRule.Networks = hostNetworks(r.CIDRs)
+	}
+
+	return runtimeRule
+}
+
+// toRule converts a RuntimeRule back to a Rule with its matching fields set,
+// for APIs such as Verifier that take a Rule
+func (r *RuntimeRule) toRule() Rule {
+	// Patterns starts with Pattern, unless the rule only has Patterns
+	patterns := r.Patterns
+	if r.Pattern != "" && len(patterns) > 0 {
+		patterns = patterns[1:]
+	}
+
+	rule := Rule{
+		Name:         r.Name,
+		ID:           r.ID,
+		Tags:         r.Tags,
+		Severity:     r.Severity,
+		Priority:     r.Priority,
+		Pattern:      r.Pattern,
+		Patterns:     patterns,
+		CaptureGroup: r.CaptureGroup,
+		Type:         r.Type,
+		Redact:       r.Redact,
+		Entropy:      r.Entropy,
+	}
+
+	if r.Mask != nil {
+		if r.Mask.Char != 0 {
+			rule.MaskChar = string(r.Mask.Char)
+		}
+		rule.MaskPreserveLength = r.Mask.PreserveLength
+	}
+
+	return rule
 }
 
 // LoadDefaultRules loads the built-in default rules embedded in the package
@@ -119,6 +389,10 @@ func LoadDefaultRules() ([]Rule, error) {
 			return nil, fmt.Errorf("failed to parse embedded default YAML file %s: %w", name, err)
 		}
 
+		if err := validateRules(ruleFile.Rules); err != nil {
+			return nil, fmt.Errorf("invalid embedded default rule file %s: %w", name, err)
+		}
+
 		allRules = append(allRules, ruleFile.Rules...)
 	}
 
@@ -127,7 +401,8 @@ func LoadDefaultRules() ([]Rule, error) {
 
 // NormalizeExtendedRegex normalizes PCRE extended regex syntax for Go regex.
 // This handles the (?x) extended syntax by removing whitespace and comments
-// outside of character classes.
+// outside of character classes. A ] escaped, first in a class (as in []] and
+// [^]]), or ending a POSIX class such as [:alpha:] doesn't end the class.
 //
 // The conversion will fail if flags are combined with the extended syntax,
 // but formatting tests will catch rules that are written with the correct
@@ -145,9 +420,17 @@ func NormalizeExtendedRegex(pattern string) string {
 	var result strings.Builder
 	inCharClass := false
 	inEscape := false
+	inComment := false
+	inPosixClass := false
+	classStart := 0 // Length of result after the [ opening the character class
+	var prev rune
 
 	for i, r := range pattern {
 		switch {
+		case inComment:
+			// Comments run to the end of the line
+			inComment = r != '\n' && r != '\r'
+
 		case inEscape:
 			// Previous character was a backslash, include this character as-is
 			result.WriteRune(r)
@@ -162,11 +445,25 @@ func NormalizeExtendedRegex(pattern string) string {
 			// Entering a character class
 			result.WriteRune(r)
 			inCharClass = true
+			classStart = result.Len()
+
+		case r == '[' && inCharClass && strings.HasPrefix(pattern[i+1:], ":"):
+			// Entering a POSIX class such as [:alpha:] inside a character class
+			result.WriteRune(r)
+			inPosixClass = true
+
+		case r == ']' && inPosixClass:
+			// Exiting a POSIX class if it follows the closing :
+			result.WriteRune(r)
+			inPosixClass = prev != ':'
 
 		case r == ']' && inCharClass:
-			// Exiting a character class
+			// Exiting a character class, unless the ] is its first character
+			// and so a literal
 			result.WriteRune(r)
-			inCharClass = false
+			if class := result.String()[classStart:]; class != "]" && class != "^]" {
+				inCharClass = false
+			}
 
 		case inCharClass:
 			// Inside character class, preserve all characters including whitespace
@@ -174,11 +471,7 @@ func NormalizeExtendedRegex(pattern string) string {
 
 		case r == '#' && !inCharClass:
 			// Comment outside character class - skip until end of line
-			for j := i + 1; j < len(pattern); j++ {
-				if pattern[j] == '\n' || pattern[j] == '\r' {
-					break
-				}
-			}
+			inComment = true
 
 		case unicode.IsSpace(r) && !inCharClass:
 			// Whitespace outside character class - skip it
@@ -188,6 +481,7 @@ func NormalizeExtendedRegex(pattern string) string {
 			// Regular character outside character class
 			result.WriteRune(r)
 		}
+		prev = r
 	}
 
 	return result.String()
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
@@ -39,214 +40,216 @@ func setupTests() error {
 	return nil
 }
 
-// TestRulesValidation tests that rules compile and the patterns match as expected
+// TestRulesValidation tests that the packaged rules meet the standard
+// ValidateRules checks: their fields are complete, their patterns compile with
+// every engine, and their test cases match as expected
 func TestRulesValidation(t *testing.T) {
 	// Add platform info for debugging
 	t.Logf("Testing on platform: %s/%s", runtime.GOOS, runtime.GOARCH)
+	t.Logf("Hyperscan available: %v", IsHyperscanAvailable())
 
-	// Test Hyperscan availability first
-	hyperscanAvailable := IsHyperscanAvailable()
-	t.Logf("Hyperscan available: %v", hyperscanAvailable)
-
-	// Track unique IDs
-	seenIDs := make(map[string]bool)
+	problems := make(map[string][]RuleValidationError)
+	for _, problem := range ValidateRules(testRules) {
+		problems[problem.RuleID] = append(problems[problem.RuleID], problem)
+	}
 
-	// Test each rule for compliance with all requirements
 	for _, rule := range testRules {
 		t.Run(rule.ID, func(t *testing.T) {
-			validateRule(t, rule, seenIDs)
+			for _, problem := range problems[rule.ID] {
+				t.Error(problem)
+			}
 		})
 	}
 }
 
-// validateRule validates a single rule's structure and requirements
-func validateRule(t *testing.T, rule Rule, seenIDs map[string]bool) {
-	// Rule must have a name
-	if rule.Name == "" {
-		t.Errorf("Rule %s has empty name", rule.ID)
-	}
-
-	// Rule ID must be lowercase, alphanumeric, and periods only
-	if !regexp.MustCompile(`^[a-z0-9.]+$`).MatchString(rule.ID) {
-		t.Errorf("Rule ID '%s' must be lowercase, alphanumeric, and periods only", rule.ID)
-	}
-
-	// Rule ID must be unique
-	if rule.ID == "" {
-		t.Errorf("Rule has empty ID")
-		return
-	}
-	if seenIDs[rule.ID] {
-		t.Errorf("Rule ID '%s' is not unique - found duplicate", rule.ID)
-	}
-	seenIDs[rule.ID] = true
-
-	// Rule must have a description
-	if rule.Description == "" {
-		t.Errorf("Rule %s has empty description", rule.ID)
+func TestNormalizeExtendedRegex(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    string
+	}{
+		{name: "not extended", pattern: `tok_ [a-z] # not a comment`, want: `tok_ [a-z] # not a comment`},
+		{name: "whitespace", pattern: "(?x)\n  \\b\n    (tok_[a-z0-9]{8})\n  \\b\n", want: `\b(tok_[a-z0-9]{8})\b`},
+		{name: "comment line", pattern: "(?x)\n  # the token prefix (tok_)\n  tok_\n  [a-z0-9]{8}\n", want: `tok_[a-z0-9]{8}`},
+		{name: "trailing comment", pattern: "(?x)\n  tok_ # prefix [unclosed\n  [a-z0-9]{8} # body\n", want: `tok_[a-z0-9]{8}`},
+		{name: "comment with carriage return", pattern: "(?x) tok_ # prefix\r\n [a-z0-9]{8}", want: `tok_[a-z0-9]{8}`},
+		{name: "comment at end", pattern: "(?x) tok_[a-z0-9]{8} # no newline", want: `tok_[a-z0-9]{8}`},
+		{name: "escaped hash", pattern: `(?x) tok_\# [a-z]`, want: `tok_\#[a-z]`},
+		{name: "hash in class", pattern: `(?x) tok_[# a-z]{8}`, want: `tok_[# a-z]{8}`},
+		{name: "escaped bracket in class", pattern: `(?x) [a\]b ] c`, want: `[a\]b ]c`},
+		{name: "leading bracket in class", pattern: `(?x) []a ] c`, want: `[]a ]c`},
+		{name: "leading bracket in negated class", pattern: `(?x) [^]a ] c`, want: `[^]a ]c`},
+		{name: "only a bracket in class", pattern: `(?x) []] c [^]] d`, want: `[]]c[^]]d`},
+		{name: "POSIX class", pattern: `(?x) [[:alpha:] _] c`, want: `[[:alpha:] _]c`},
+		{name: "escaped backslash ends class", pattern: `(?x) [a\\] c`, want: `[a\\]c`},
 	}
 
-	// Rule must have tags
-	if len(rule.Tags) == 0 {
-		t.Errorf("Rule %s has no tags", rule.ID)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeExtendedRegex(tt.pattern)
+			if got != tt.want {
+				t.Errorf("NormalizeExtendedRegex(%q) = %q; want %q", tt.pattern, got, tt.want)
+			}
+			if _, err := regexp.Compile(got); err != nil {
+				t.Errorf("Normalized pattern %q doesn't compile: %v", got, err)
+			}
+		})
 	}
+}
 
-	// Rule must have a pattern
-	if rule.Pattern == "" {
-		t.Errorf("Rule %s has empty pattern", rule.ID)
-		return
+func TestShannonEntropy(t *testing.T) {
+	tests := []struct {
+		input   string
+		entropy float64
+	}{
+		{input: "", entropy: 0.0},
+		{input: "A", entropy: 0.0},
+		{input: "AAAA", entropy: 0.0},
+		{input: "aaaaabbbbcc", entropy: 1.494919},
+		{input: "ABCDEFGHIJKLMNOPQRSTUVWXYZ", entropy: 4.700440},
+		{input: "abcdefghijklmnopqrstuvwxyz", entropy: 4.700440},
+		{input: "0123456789", entropy: 3.321928},
+		{input: "!@#$%^&*()", entropy: 3.321928},
+		{input: "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!@#$%^&*()", entropy: 6.169925},
 	}
 
-	// If rule pattern starts with regex flag, it must be (?x) and no other flags
-	if strings.HasPrefix(rule.Pattern, "(?") {
-		// Find the end of the flags section
-		flagEnd := strings.Index(rule.Pattern, ")")
-		if flagEnd == -1 {
-			t.Errorf("Rule %s has malformed pattern flags", rule.ID)
-			return
-		}
-
-		flags := rule.Pattern[2:flagEnd] // Extract just the flag characters
-		if flags != "x" {
-			t.Errorf("Rule %s pattern has invalid flags '%s' - only (?x) is allowed", rule.ID, flags)
+	const tolerance = 1e-6
+	for _, tt := range tests {
+		entropy := ShannonEntropy(tt.input)
+		if math.Abs(entropy-tt.entropy) > tolerance {
+			t.Errorf("ShannonEntropy(%q) = %f; want %f", tt.input, entropy, tt.entropy)
 		}
 	}
+}
 
-	// Create a per-test hyperscan engine for thread safety
-	hyperscanEngine := NewHyperscanEngine()
-	t.Cleanup(func() {
-		hyperscanEngine.Close()
-	})
-
-	// Rule pattern must compile with Hyperscan regex engine
-	if err := hyperscanEngine.CompileRules([]Rule{rule}); err != nil {
-		t.Errorf("Rule %s doesn't compile with Hyperscan regex engine: %v", rule.ID, err)
-		return
-	}
-
-	// Rule pattern must compile with standard Go regex engine
-	pattern := NormalizeExtendedRegex(rule.Pattern)
-	regex, err := regexp.Compile(pattern)
-	if err != nil {
-		t.Errorf("Rule %s doesn't compile with Go regex engine: %v", rule.ID, err)
-		return
-	}
-
-	// Rule must have a redaction offsets
-	if len(rule.Redact) != 2 {
-		t.Errorf("Rule %s has invalid redaction offsets: %v", rule.ID, rule.Redact)
-	}
-
-	// Rule must have a non-zero minimum entropy
-	if rule.Entropy == 0.0 {
-		t.Errorf("Rule %s has zero entropy - entropy must be specified as a float", rule.ID)
-	}
-
-	// Rule must have assert test cases
-	if len(rule.Tests.Assert) == 0 {
-		t.Errorf("Rule %s has no assert test cases", rule.ID)
-	}
-
-	// Rule must have assert_not test cases
-	if len(rule.Tests.AssertNot) == 0 {
-		t.Errorf("Rule %s has no assert_not test cases", rule.ID)
+func TestFilterRulesByTags(t *testing.T) {
+	rules := []Rule{
+		{ID: "aws.key", Tags: []string{"aws", "key"}},
+		{ID: "gcp.key", Tags: []string{"GCP", "key"}},
+		{ID: "aws.deprecated", Tags: []string{"aws", "deprecated"}},
+		{ID: "untagged"},
 	}
 
-	// Validate assert test cases
-	for i, assertCase := range rule.Tests.Assert {
-		t.Run(fmt.Sprintf("assert_%d", i+1), func(t *testing.T) {
-			validateAssertCase(t, rule, assertCase, i+1, hyperscanEngine, regex)
-		})
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{name: "no filters", want: []string{"aws.key", "gcp.key", "aws.deprecated", "untagged"}},
+		{name: "include only", include: []string{"aws", "gcp"}, want: []string{"aws.key", "gcp.key", "aws.deprecated"}},
+		{name: "include is case-insensitive", include: []string{"gcp"}, want: []string{"gcp.key"}},
+		{name: "exclude only", exclude: []string{"Deprecated"}, want: []string{"aws.key", "gcp.key", "untagged"}},
+		{name: "combined", include: []string{"aws"}, exclude: []string{"deprecated"}, want: []string{"aws.key"}},
+		{name: "no match", include: []string{"azure"}, want: nil},
 	}
 
-	// Validate assert_not test cases
-	for i, assertNotCase := range rule.Tests.AssertNot {
-		t.Run(fmt.Sprintf("assert_not_%d", i+1), func(t *testing.T) {
-			validateAssertNotCase(t, rule, assertNotCase, i+1, hyperscanEngine, regex)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, rule := range FilterRulesByTags(rules, tt.include, tt.exclude) {
+				got = append(got, rule.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("FilterRulesByTags(%v, %v) = %v, expected %v", tt.include, tt.exclude, got, tt.want)
+			}
 		})
 	}
-
-	// Rule must have at least one history entry
-	if len(rule.History) == 0 {
-		t.Errorf("Rule %s has no history entries - at least one entry is required", rule.ID)
-	}
 }
 
-// validateAssertCase validates a single assert test case
-func validateAssertCase(t *testing.T, rule Rule, assertCase string, caseNum int, hyperscanEngine PatternEngine, regex *regexp.Regexp) {
-	// Test with Hyperscan engine
-	matches := hyperscanEngine.FindAllInLine(assertCase)
-	if len(matches) == 0 {
-		t.Errorf("Rule %s pattern should match assert case %d, but doesn't (Hyperscan)", rule.ID, caseNum)
+func TestFilterRulesByID(t *testing.T) {
+	rules := []Rule{
+		{ID: "ghost.aws.1"},
+		{ID: "ghost.gcp.1"},
+		{ID: "ghost.github.1"},
 	}
 
-	// Test with Go regex engine
-	if !regex.MatchString(assertCase) {
-		t.Errorf("Rule %s pattern should match assert case %d, but doesn't (Go)", rule.ID, caseNum)
-	}
-
-	// Rule redact offsets must be less than the length of the assert case
-	if rule.Redact[0]+rule.Redact[1] >= len(assertCase) {
-		t.Errorf("Rule %s sum of redaction offsets %v can't be greater than the length of the test pattern (%d)", rule.ID, rule.Redact, len(assertCase))
-	}
-
-	if len(matches) > 0 {
-		// matched content entropy must be greater than or equal to rule entropy
-		entropy := ShannonEntropy(matches[0].Match)
-		if entropy < rule.Entropy {
-			t.Errorf("Rule %s requires entropy of at least %f, but got %f from assert case %d", rule.ID, rule.Entropy, entropy, caseNum)
+	t.Run("valid subset", func(t *testing.T) {
+		filtered, err := FilterRulesByID(rules, []string{"ghost.github.1", "ghost.aws.1"})
+		if err != nil {
+			t.Fatalf("FilterRulesByID failed: %v", err)
 		}
-	}
-}
-
-// validateAssertNotCase validates a single assert_not test case
-func validateAssertNotCase(t *testing.T, rule Rule, assertNotCase string, caseNum int, hyperscanEngine PatternEngine, regex *regexp.Regexp) {
-	// Test with Hyperscan engine
-	matches := hyperscanEngine.FindAllInLine(assertNotCase)
-	if len(matches) > 0 {
-		// we matched, now check if the entropy is met
-		entropy := ShannonEntropy(matches[0].Match)
-		if entropy >= rule.Entropy {
-			t.Errorf("Rule %s pattern should not match assert_not case %d with high entropy (%f >= %f), but does (Hyperscan)", rule.ID, caseNum, entropy, rule.Entropy)
-		} else {
-			t.Logf("Rule %s pattern should not match assert_not case %d, but does (Hyperscan)", rule.ID, caseNum)
+		if len(filtered) != 2 || filtered[0].ID != "ghost.aws.1" || filtered[1].ID != "ghost.github.1" {
+			t.Errorf("Expected [ghost.aws.1 ghost.github.1] in rule order, got %+v", filtered)
 		}
-	}
+	})
 
-	goMatches := regex.FindAllString(assertNotCase, -1)
-	if len(goMatches) > 0 {
-		// we matched, now check if the entropy is met
-		entropy := ShannonEntropy(goMatches[0])
-		if entropy >= rule.Entropy {
-			t.Errorf("Rule %s pattern should not match assert_not case %d with high entropy (%f >= %f), but does (Go)", rule.ID, caseNum, entropy, rule.Entropy)
-		} else {
-			t.Logf("Rule %s pattern should not match assert_not case %d, but does (Go)", rule.ID, caseNum)
+	t.Run("unknown ID", func(t *testing.T) {
+		_, err := FilterRulesByID(rules, []string{"ghost.aws.1", "ghost.azure.9"})
+		if err == nil {
+			t.Fatal("Expected an error for an unknown rule ID")
 		}
-	}
+		if !strings.Contains(err.Error(), "ghost.azure.9") || strings.Contains(err.Error(), "ghost.aws.1") {
+			t.Errorf("Expected the error to name only the unknown ID, got: %v", err)
+		}
+	})
 }
 
-func TestShannonEntropy(t *testing.T) {
+func TestRuleValidate(t *testing.T) {
+	valid := Rule{Name: "Test Token", ID: "test.token", Pattern: `tok_[a-z]{16}`, Redact: []int{4, 4}, Entropy: 3.0}
+
 	tests := []struct {
-		input   string
-		entropy float64
+		name    string
+		modify  func(r *Rule)
+		wantErr []string
 	}{
-		{input: "", entropy: 0.0},
-		{input: "A", entropy: 0.0},
-		{input: "AAAA", entropy: 0.0},
-		{input: "aaaaabbbbcc", entropy: 1.494919},
-		{input: "ABCDEFGHIJKLMNOPQRSTUVWXYZ", entropy: 4.700440},
-		{input: "abcdefghijklmnopqrstuvwxyz", entropy: 4.700440},
-		{input: "0123456789", entropy: 3.321928},
-		{input: "!@#$%^&*()", entropy: 3.321928},
-		{input: "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!@#$%^&*()", entropy: 6.169925},
+		{name: "valid", modify: func(r *Rule) {}},
+		{name: "zero redact offsets", modify: func(r *Rule) { r.Redact = []int{0, 0} }},
+		{name: "missing redact", modify: func(r *Rule) { r.Redact = nil }, wantErr: []string{"redact must be a pair"}},
+		{name: "single redact offset", modify: func(r *Rule) { r.Redact = []int{4} }, wantErr: []string{"redact must be a pair"}},
+		{name: "multi-character mask", modify: func(r *Rule) { r.MaskChar = "##" }, wantErr: []string{"mask_char must be a single character"}},
+		{name: "unicode mask", modify: func(r *Rule) { r.MaskChar = "•" }},
+		{name: "negative redact offset", modify: func(r *Rule) { r.Redact = []int{4, -1} }, wantErr: []string{"must not be negative"}},
+		{name: "zero entropy", modify: func(r *Rule) { r.Entropy = 0 }, wantErr: []string{"entropy must be greater than zero"}},
+		{name: "invalid severity", modify: func(r *Rule) { r.Severity = "severe" }, wantErr: []string{"severity"}},
+		{name: "missing id", modify: func(r *Rule) { r.ID = "" }, wantErr: []string{"id is required"}},
+		{name: "patterns only", modify: func(r *Rule) { r.Patterns = []string{r.Pattern}; r.Pattern = "" }},
+		{name: "missing pattern", modify: func(r *Rule) { r.Pattern = "" }, wantErr: []string{"pattern or patterns is required"}},
+		{
+			name:    "every bad field is reported",
+			modify:  func(r *Rule) { r.Redact = []int{-1, 2}; r.Entropy = 0 },
+			wantErr: []string{"must not be negative", "entropy must be greater than zero"},
+		},
 	}
 
-	const tolerance = 1e-6
 	for _, tt := range tests {
-		entropy := ShannonEntropy(tt.input)
-		if math.Abs(entropy-tt.entropy) > tolerance {
-			t.Errorf("ShannonEntropy(%q) = %f; want %f", tt.input, entropy, tt.entropy)
-		}
+		t.Run(tt.name, func(t *testing.T) {
+			rule := valid
+			tt.modify(&rule)
+
+			err := rule.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Expected rule to be valid, got: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("Expected a validation error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected error to contain %q, got: %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadRulesValidates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	content := "rules:\n  - name: Test Token\n    id: test.token\n    pattern: tok_[a-z]{16}\n    redact: [4]\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write rules: %v", err)
+	}
+
+	_, err := LoadRulesFromFile(path)
+	if err == nil {
+		t.Fatal("Expected loading an invalid rule to fail")
+	}
+	if !strings.Contains(err.Error(), "test.token") {
+		t.Errorf("Expected the error to name the rule, got: %v", err)
 	}
 }
 
@@ -0,0 +1,164 @@
+package poltergeist
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ruleIDPattern is the format of rule IDs: lowercase letters, digits, and
+// periods
+var ruleIDPattern = regexp.MustCompile(`^[a-z0-9.]+$`)
+
+// RuleValidationError is a problem ValidateRules found with a rule
+type RuleValidationError struct {
+	RuleID string
+	Err    error
+}
+
+// Error describes the problem and the rule it was found in
+func (e RuleValidationError) Error() string {
+	return fmt.Sprintf("rule '%s': %v", e.RuleID, e.Err)
+}
+
+// Unwrap returns the underlying problem
+func (e RuleValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidRuleID reports whether id is in the format of rule IDs, such as
+// ghost.gitlab.1: lowercase letters, digits, and periods
+func ValidRuleID(id string) bool {
+	return ruleIDPattern.MatchString(id)
+}
+
+// ValidateRules checks rules to the standard of the packaged rules: every
+// field Validate checks, plus a name, description, tags, test cases, and
+// history, unique IDs, and patterns that compile with the Go regex engine and
+// Hyperscan, if it is available. Each assert case must match with at least
+// the rule's entropy in every engine, and no assert_not case may. It returns
+// every problem found, in rule order.
+func ValidateRules(rules []Rule) []RuleValidationError {
+	hyperscan := IsHyperscanAvailable()
+	seenIDs := make(map[string]bool)
+
+	var problems []RuleValidationError
+	for _, rule := range rules {
+		errs := checkRuleFields(rule)
+		if rule.ID != "" && seenIDs[rule.ID] {
+			errs = append(errs, errors.New("id is not unique"))
+		}
+		seenIDs[rule.ID] = true
+		errs = append(errs, checkRuleTests(rule, hyperscan)...)
+
+		for _, err := range errs {
+			problems = append(problems, RuleValidationError{RuleID: rule.ID, Err: err})
+		}
+	}
+	return problems
+}
+
+// checkRuleFields returns the problems with a rule's fields
+func checkRuleFields(rule Rule) []error {
+	var errs []error
+
+	// Validate describes every invalid field in one joined error
+	if err := rule.Validate(); err != nil {
+		if joined, ok := errors.Unwrap(err).(interface{ Unwrap() []error }); ok {
+			errs = append(errs, joined.Unwrap()...)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+
+	if rule.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if rule.ID != "" && !ValidRuleID(rule.ID) {
+		errs = append(errs, errors.New("id must be lowercase letters, digits, and periods only"))
+	}
+	if rule.Description == "" {
+		errs = append(errs, errors.New("description is required"))
+	}
+	if len(rule.Tags) == 0 {
+		errs = append(errs, errors.New("at least one tag is required"))
+	}
+
+	// Patterns may only set the extended flag, so they behave the same in
+	// every engine
+	for i, pattern := range rule.AllPatterns() {
+		if !strings.HasPrefix(pattern, "(?") {
+			continue
+		}
+		end := strings.Index(pattern, ")")
+		if end == -1 {
+			errs = append(errs, fmt.Errorf("pattern %d has malformed flags", i+1))
+		} else if flags := pattern[2:end]; flags != "x" {
+			errs = append(errs, fmt.Errorf("pattern %d has flags '%s' - only (?x) is allowed", i+1, flags))
+		}
+	}
+
+	if len(rule.Tests.Assert) == 0 {
+		errs = append(errs, errors.New("at least one assert test case is required"))
+	}
+	if len(rule.Tests.AssertNot) == 0 {
+		errs = append(errs, errors.New("at least one assert_not test case is required"))
+	}
+	if len(rule.History) == 0 {
+		errs = append(errs, errors.New("at least one history entry is required"))
+	}
+
+	return errs
+}
+
+// checkRuleTests compiles a rule with the Go regex engine, and Hyperscan if
+// hyperscan is set, returning the problems compiling it and running its test
+// cases in each engine
+func checkRuleTests(rule Rule, hyperscan bool) []error {
+	var errs []error
+
+	if len(rule.Redact) == 2 {
+		for i, assertCase := range rule.Tests.Assert {
+			if rule.Redact[0]+rule.Redact[1] >= len(assertCase) {
+				errs = append(errs, fmt.Errorf("redact offsets %v cover all of assert case %d", rule.Redact, i+1))
+			}
+		}
+	}
+
+	engines := []PatternEngine{NewGoRegexEngine()}
+	if hyperscan {
+		engines = append(engines, NewHyperscanEngine())
+	}
+
+	// Disabled rules are tested as if they were enabled
+	rule.Enabled = nil
+	for _, engine := range engines {
+		defer engine.Close()
+		if err := compileRule(engine, rule); err != nil {
+			errs = append(errs, fmt.Errorf("doesn't compile with %s engine: %w", engine.Name(), err))
+			continue
+		}
+
+		for i, assertCase := range rule.Tests.Assert {
+			matches := engine.FindAllInLine(assertCase)
+			switch {
+			case len(matches) == 0:
+				errs = append(errs, fmt.Errorf("assert case %d doesn't match (%s)", i+1, engine.Name()))
+			case !matches[0].RuleEntropyThresholdMet:
+				errs = append(errs, fmt.Errorf("assert case %d matches with entropy %f, below the rule's %g (%s)", i+1, matches[0].Entropy, rule.Entropy, engine.Name()))
+			}
+		}
+
+		for i, assertNotCase := range rule.Tests.AssertNot {
+			for _, match := range engine.FindAllInLine(assertNotCase) {
+				if match.RuleEntropyThresholdMet {
+					errs = append(errs, fmt.Errorf("assert_not case %d matches with entropy %f, at least the rule's %g (%s)", i+1, match.Entropy, rule.Entropy, engine.Name()))
+					break
+				}
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,99 @@
+package poltergeist
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// validRule returns a rule that passes ValidateRules
+func validRule() Rule {
+	return Rule{
+		Name:        "Test Token",
+		ID:          "test.token.1",
+		Description: "A test token.",
+		Tags:        []string{"test"},
+		Pattern:     `(?x)\b(tok_[a-zA-Z0-9]{16})\b`,
+		Redact:      []int{4, 4},
+		Entropy:     3.0,
+		Tests: Test{
+			Assert:    []string{"TOKEN=tok_aZ3kQ9xLm2Pw7vRt"},
+			AssertNot: []string{"TOKEN=tok_aaaaaaaaaaaaaaaa", "TOKEN=tok_short"},
+		},
+		History: []string{"01/01/2026 - initial version"},
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	if problems := ValidateRules(testRules); len(problems) != 0 {
+		t.Errorf("Expected the packaged rules to pass, got %v", problems)
+	}
+	if problems := ValidateRules([]Rule{validRule()}); len(problems) != 0 {
+		t.Errorf("Expected the rule to pass, got %v", problems)
+	}
+
+	failingAssert := validRule()
+	failingAssert.ID = "test.token.2"
+	failingAssert.Tests.Assert = append(failingAssert.Tests.Assert, "TOKEN=tok_missing")
+
+	lowEntropy := validRule()
+	lowEntropy.ID = "test.token.3"
+	lowEntropy.Tests.AssertNot = []string{"TOKEN=tok_Ab1Cd2Ef3Gh4Ij5K"}
+
+	incomplete := validRule()
+	incomplete.ID = "Test_Token"
+	incomplete.Description = ""
+	incomplete.Entropy = 0
+	incomplete.Pattern = `(?i)tok_[a-z0-9]{16}`
+
+	tests := []struct {
+		name string
+		rule Rule
+		want []string
+	}{
+		{name: "failing assert case", rule: failingAssert, want: []string{"assert case 2 doesn't match (Go Regex)"}},
+		{name: "matching assert_not case", rule: lowEntropy, want: []string{"assert_not case 1 matches with entropy"}},
+		{
+			name: "incomplete rule",
+			rule: incomplete,
+			want: []string{
+				"entropy must be greater than zero",
+				"id must be lowercase letters, digits, and periods only",
+				"description is required",
+				"pattern 1 has flags 'i' - only (?x) is allowed",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := ValidateRules([]Rule{validRule(), tt.rule})
+			if len(problems) < len(tt.want) {
+				t.Fatalf("Expected at least %d problems, got %v", len(tt.want), problems)
+			}
+			for _, problem := range problems {
+				if problem.RuleID != tt.rule.ID {
+					t.Errorf("Expected only problems with %s, got %v", tt.rule.ID, problem)
+				}
+			}
+			for _, want := range tt.want {
+				found := false
+				for _, problem := range problems {
+					found = found || strings.Contains(problem.Error(), want)
+				}
+				if !found {
+					t.Errorf("Expected a problem containing %q, got %v", want, problems)
+				}
+			}
+		})
+	}
+
+	// Duplicate IDs are reported on the second rule
+	problems := ValidateRules([]Rule{validRule(), validRule()})
+	if len(problems) != 1 || problems[0].Err.Error() != "id is not unique" {
+		t.Errorf("Expected a duplicate ID problem, got %v", problems)
+	}
+	if !errors.Is(problems[0], problems[0].Err) {
+		t.Error("Expected the problem to unwrap to its error")
+	}
+}
@@ -0,0 +1,196 @@
+package poltergeist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SARIF constants for the 2.1.0 log format
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+
+	// sarifFingerprintKey identifies the partial fingerprint used to
+	// deduplicate findings across runs
+	sarifFingerprintKey = "poltergeistFingerprint/v1"
+)
+
+// sarifLog is the top-level SARIF document
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string               `json:"id"`
+	Name             string               `json:"name"`
+	ShortDescription sarifMessage         `json:"shortDescription"`
+	FullDescription  *sarifMessage        `json:"fullDescription,omitempty"`
+	HelpURI          string               `json:"helpUri,omitempty"`
+	Properties       *sarifRuleProperties `json:"properties,omitempty"`
+}
+
+type sarifRuleProperties struct {
+	Tags []string `json:"tags,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           *int              `json:"ruleIndex,omitempty"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// WriteSARIF writes results as a SARIF 2.1.0 log, for consumers such as
+// GitHub code scanning. Each rule becomes a SARIF rule and each result a
+// SARIF result located by file, line, and column. Messages only contain the
+// redacted match, and each result carries its Fingerprint for deduplication.
+func WriteSARIF(w io.Writer, results []ScanResult, rules []Rule) error {
+	driver := sarifDriver{
+		Name:           "poltergeist",
+		InformationURI: "https://github.com/ghostsecurity/poltergeist",
+		Rules:          make([]sarifRule, 0, len(rules)),
+	}
+
+	ruleIndexes := make(map[string]int, len(rules))
+	for _, rule := range rules {
+		if _, seen := ruleIndexes[rule.ID]; seen {
+			continue
+		}
+		ruleIndexes[rule.ID] = len(driver.Rules)
+		driver.Rules = append(driver.Rules, newSARIFRule(rule))
+	}
+
+	sarifResults := make([]sarifResult, 0, len(results))
+	for _, result := range results {
+		sr := sarifResult{
+			RuleID:  result.RuleID,
+			Level:   "error",
+			Message: sarifMessage{Text: fmt.Sprintf("%s: %s", result.RuleName, result.Redacted)},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: sarifURI(result)},
+					Region:           sarifResultRegion(result),
+				},
+			}},
+			PartialFingerprints: map[string]string{
+				sarifFingerprintKey: result.Fingerprint(),
+			},
+		}
+
+		if index, ok := ruleIndexes[result.RuleID]; ok {
+			sr.RuleIndex = &index
+		}
+
+		// Matches below the entropy threshold are likely false positives
+		if !result.RuleEntropyThresholdMet {
+			sr.Level = "note"
+		}
+
+		sarifResults = append(sarifResults, sr)
+	}
+
+	log := sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: driver},
+			Results: sarifResults,
+		}},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(log); err != nil {
+		return fmt.Errorf("failed to write SARIF: %w", err)
+	}
+
+	return nil
+}
+
+// newSARIFRule converts a rule to its SARIF description
+func newSARIFRule(rule Rule) sarifRule {
+	sr := sarifRule{
+		ID:               rule.ID,
+		Name:             rule.Name,
+		ShortDescription: sarifMessage{Text: rule.Name},
+	}
+
+	if rule.Description != "" {
+		sr.FullDescription = &sarifMessage{Text: rule.Description}
+	}
+	if len(rule.Refs) > 0 {
+		sr.HelpURI = rule.Refs[0]
+	}
+	if len(rule.Tags) > 0 {
+		sr.Properties = &sarifRuleProperties{Tags: rule.Tags}
+	}
+
+	return sr
+}
+
+// sarifURI converts a result's path to a relative, slash-separated artifact URI
+func sarifURI(result ScanResult) string {
+	return strings.TrimPrefix(result.URIPath(), "./")
+}
+
+// sarifResultRegion returns the region of a result. Results without a column
+// fall back to deriving it from the match length for single-line matches.
+func sarifResultRegion(result ScanResult) sarifRegion {
+	region := sarifRegion{
+		StartLine:   result.LineNumber,
+		StartColumn: result.Column,
+		EndLine:     result.EndLineNumber,
+		EndColumn:   result.EndColumn,
+	}
+
+	if region.StartColumn == 0 && result.EndLineNumber == result.LineNumber && result.EndColumn > len(result.Match) {
+		region.StartColumn = result.EndColumn - len(result.Match)
+	}
+
+	return region
+}
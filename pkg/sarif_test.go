@@ -0,0 +1,143 @@
+package poltergeist
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	rules := []Rule{
+		{
+			Name:        "Test Token",
+			ID:          "test.token",
+			Description: "Test token.",
+			Tags:        []string{"test", "token"},
+			Pattern:     `tok_[a-zA-Z0-9]{16}`,
+			Entropy:     3.5,
+			Refs:        []string{"https://example.com/tokens"},
+		},
+		{
+			Name:    "Unused Rule",
+			ID:      "test.unused",
+			Pattern: `unused_[0-9]+`,
+		},
+	}
+
+	scanner := newTestScanner(t, rules)
+	content := "a=tok_aZ3kQ9xLm2Pw7vRt\nb=tok_aaaaaaaaaaaaaaaa\n  c=tok_aZ3kQ9xLm2Pw7vRt\n"
+	results, err := scanner.ScanReader(strings.NewReader(content), "./config/app.env")
+	if err != nil {
+		t.Fatalf("ScanReader failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, results, rules); err != nil {
+		t.Fatalf("WriteSARIF failed: %v", err)
+	}
+
+	if strings.Contains(buf.String(), "tok_aZ3kQ9xLm2Pw7vRt") {
+		t.Error("SARIF output must not contain the raw secret")
+	}
+
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						ID               string `json:"id"`
+						FullDescription  struct{ Text string }
+						HelpURI          string `json:"helpUri"`
+						ShortDescription struct{ Text string }
+						Properties       struct{ Tags []string }
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				RuleIndex *int   `json:"ruleIndex"`
+				Level     string `json:"level"`
+				Message   struct{ Text string }
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine   int `json:"startLine"`
+							StartColumn int `json:"startColumn"`
+							EndLine     int `json:"endLine"`
+							EndColumn   int `json:"endColumn"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+				PartialFingerprints map[string]string `json:"partialFingerprints"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("SARIF output is not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	if log.Version != "2.1.0" {
+		t.Errorf("Expected SARIF version 2.1.0, got %q", log.Version)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("Expected 1 run, got %d", len(log.Runs))
+	}
+	run := log.Runs[0]
+
+	if run.Tool.Driver.Name != "poltergeist" {
+		t.Errorf("Expected driver name poltergeist, got %q", run.Tool.Driver.Name)
+	}
+	if len(run.Tool.Driver.Rules) != 2 {
+		t.Fatalf("Expected 2 SARIF rules, got %d", len(run.Tool.Driver.Rules))
+	}
+	rule := run.Tool.Driver.Rules[0]
+	if rule.ID != "test.token" || rule.FullDescription.Text != "Test token." || rule.HelpURI != "https://example.com/tokens" {
+		t.Errorf("Unexpected SARIF rule: %+v", rule)
+	}
+	if strings.Join(rule.Properties.Tags, ",") != "test,token" {
+		t.Errorf("Expected rule tags [test token], got %v", rule.Properties.Tags)
+	}
+
+	if len(run.Results) != 3 {
+		t.Fatalf("Expected 3 SARIF results, got %d", len(run.Results))
+	}
+
+	first := run.Results[0]
+	if first.RuleID != "test.token" || first.RuleIndex == nil || *first.RuleIndex != 0 {
+		t.Errorf("Unexpected rule reference: %s %v", first.RuleID, first.RuleIndex)
+	}
+	if first.Level != "error" {
+		t.Errorf("Expected level error, got %q", first.Level)
+	}
+	if run.Results[1].Level != "note" {
+		t.Errorf("Expected low-entropy result to have level note, got %q", run.Results[1].Level)
+	}
+
+	location := first.Locations[0].PhysicalLocation
+	if location.ArtifactLocation.URI != "config/app.env" {
+		t.Errorf("Expected artifact URI config/app.env, got %q", location.ArtifactLocation.URI)
+	}
+	if location.Region.StartLine != 1 || location.Region.StartColumn != 3 || location.Region.EndLine != 1 || location.Region.EndColumn != 23 {
+		t.Errorf("Unexpected region: %+v", location.Region)
+	}
+
+	// The same secret on different lines shares a fingerprint; a different secret does not
+	fingerprint := func(i int) string {
+		return run.Results[i].PartialFingerprints[sarifFingerprintKey]
+	}
+	if fingerprint(0) == "" || fingerprint(0) != fingerprint(2) {
+		t.Errorf("Expected identical secrets to share a fingerprint, got %q and %q", fingerprint(0), fingerprint(2))
+	}
+	if fingerprint(0) == fingerprint(1) {
+		t.Error("Expected different secrets to have different fingerprints")
+	}
+}
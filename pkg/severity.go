@@ -0,0 +1,46 @@
+package poltergeist
+
+// Severity levels for rules, from least to most severe
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// DefaultSeverity is the severity of rules that don't set one
+const DefaultSeverity = SeverityMedium
+
+// Severities lists the supported severity levels, from least to most severe
+var Severities = []string{SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+
+// severityRanks orders the severity levels for comparison
+var severityRanks = map[string]int{
+	SeverityLow:      1,
+	SeverityMedium:   2,
+	SeverityHigh:     3,
+	SeverityCritical: 4,
+}
+
+// ValidSeverity reports whether severity is one of the supported levels
+func ValidSeverity(severity string) bool {
+	_, ok := severityRanks[severity]
+	return ok
+}
+
+// SeverityAtLeast reports whether severity is at or above min. Unknown
+// severities are below every level.
+func SeverityAtLeast(severity, min string) bool {
+	return severityRanks[severity] >= severityRanks[min]
+}
+
+// FilterBySeverity returns the results whose severity is at or above min
+func FilterBySeverity(results []ScanResult, min string) []ScanResult {
+	var filtered []ScanResult
+	for _, result := range results {
+		if SeverityAtLeast(result.Severity, min) {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
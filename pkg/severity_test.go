@@ -0,0 +1,97 @@
+package poltergeist
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadRulesSeverityValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		severity string
+		wantErr  bool
+	}{
+		{name: "unset", severity: "", wantErr: false},
+		{name: "critical", severity: "critical", wantErr: false},
+		{name: "invalid", severity: "severe", wantErr: true},
+		{name: "wrong case", severity: "High", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := "rules:\n  - name: Test Token\n    id: test.token\n    pattern: tok_[a-z]{16}\n    entropy: 3.0\n    redact: [2, 2]\n"
+			if tt.severity != "" {
+				content += "    severity: " + tt.severity + "\n"
+			}
+
+			path := filepath.Join(t.TempDir(), "rules.yaml")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write rules: %v", err)
+			}
+
+			rules, err := LoadRulesFromFile(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error for an invalid severity")
+				}
+				if !strings.Contains(err.Error(), tt.severity) {
+					t.Errorf("Expected error to name the severity, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadRulesFromFile failed: %v", err)
+			}
+			if len(rules) != 1 || rules[0].Severity != tt.severity {
+				t.Errorf("Expected severity %q, got %+v", tt.severity, rules)
+			}
+		})
+	}
+}
+
+func TestScanResultSeverity(t *testing.T) {
+	rules := []Rule{
+		{Name: "Critical Token", ID: "test.critical", Pattern: `crit_[a-zA-Z0-9]{16}`, Severity: SeverityCritical},
+		{Name: "Default Token", ID: "test.default", Pattern: `tok_[a-zA-Z0-9]{16}`},
+		{Name: "Low Token", ID: "test.low", Pattern: `low_[a-zA-Z0-9]{16}`, Severity: SeverityLow},
+	}
+
+	content := "crit_aZ3kQ9xLm2Pw7vRt\ntok_bB8nM4cV1xZ6qW0e\nlow_cC7mN3bV2xZ5qW9r\n"
+	results, err := newTestScanner(t, rules).ScanReader(strings.NewReader(content), "app.env")
+	if err != nil {
+		t.Fatalf("ScanReader failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	for i, want := range []string{SeverityCritical, DefaultSeverity, SeverityLow} {
+		if results[i].Severity != want {
+			t.Errorf("Result %d (%s): expected severity %q, got %q", i, results[i].RuleID, want, results[i].Severity)
+		}
+	}
+
+	filterTests := []struct {
+		min  string
+		want []string
+	}{
+		{min: SeverityLow, want: []string{"test.critical", "test.default", "test.low"}},
+		{min: SeverityMedium, want: []string{"test.critical", "test.default"}},
+		{min: SeverityHigh, want: []string{"test.critical"}},
+		{min: SeverityCritical, want: []string{"test.critical"}},
+	}
+
+	for _, tt := range filterTests {
+		t.Run(tt.min, func(t *testing.T) {
+			var got []string
+			for _, result := range FilterBySeverity(results, tt.min) {
+				got = append(got, result.RuleID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("FilterBySeverity(%s) = %v, expected %v", tt.min, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package poltergeist
+
+import (
+	"strings"
+)
+
+// SuppressDirective is the inline comment that suppresses findings on the line
+// it appears on and on the following line. It may be followed by a
+// comma-separated list of rule IDs to only suppress those rules, for example
+// "poltergeist:ignore ghost.aws.1". "poltergeist:ignore-line" is an alias.
+const SuppressDirective = "poltergeist:ignore"
+
+// suppression is a parsed inline suppression directive. A nil suppression
+// suppresses nothing.
+type suppression struct {
+	ruleIDs map[string]bool // Rules to suppress, or nil to suppress all rules
+}
+
+// parseSuppression returns the suppression directive in line, or nil if the
+// line has none
+func parseSuppression(line string) *suppression {
+	i := strings.Index(line, SuppressDirective)
+	if i < 0 {
+		return nil
+	}
+
+	rest := strings.TrimPrefix(line[i+len(SuppressDirective):], "-line")
+
+	// The directive must end at a word boundary, e.g. not "poltergeist:ignored"
+	if rest != "" && isRuleIDChar(rune(rest[0])) {
+		return nil
+	}
+
+	// An optional list of rule IDs follows on the same line
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || strings.IndexFunc(fields[0], func(r rune) bool { return !isRuleIDChar(r) && r != ',' }) >= 0 {
+		return &suppression{}
+	}
+
+	ruleIDs := make(map[string]bool)
+	for _, id := range strings.Split(fields[0], ",") {
+		if id != "" {
+			ruleIDs[id] = true
+		}
+	}
+	if len(ruleIDs) == 0 {
+		return &suppression{}
+	}
+
+	return &suppression{ruleIDs: ruleIDs}
+}
+
+// suppresses reports whether the directive suppresses findings for ruleID
+func (s *suppression) suppresses(ruleID string) bool {
+	if s == nil {
+		return false
+	}
+	return s.ruleIDs == nil || s.ruleIDs[ruleID]
+}
+
+// isRuleIDChar reports whether r may appear in a rule ID
+func isRuleIDChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-'
+}
@@ -0,0 +1,87 @@
+package poltergeist
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseSuppression(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		suppressed map[string]bool
+	}{
+		{name: "no directive", line: `key = "tok_aZ3kQ9xLm2Pw7vRt"`, suppressed: map[string]bool{"a.1": false}},
+		{name: "ignore", line: `key = "x" // poltergeist:ignore`, suppressed: map[string]bool{"a.1": true, "b.1": true}},
+		{name: "ignore line", line: `key = "x" # poltergeist:ignore-line`, suppressed: map[string]bool{"a.1": true}},
+		{name: "block comment", line: `/* poltergeist:ignore */`, suppressed: map[string]bool{"a.1": true}},
+		{name: "rule scoped", line: `// poltergeist:ignore a.1`, suppressed: map[string]bool{"a.1": true, "b.1": false}},
+		{name: "rule list", line: `// poltergeist:ignore-line a.1,b.1`, suppressed: map[string]bool{"a.1": true, "b.1": true, "c.1": false}},
+		{name: "not a directive", line: `// poltergeist:ignored`, suppressed: map[string]bool{"a.1": false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := parseSuppression(tt.line)
+			for ruleID, want := range tt.suppressed {
+				if got := s.suppresses(ruleID); got != want {
+					t.Errorf("suppresses(%q) = %v, expected %v", ruleID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInlineSuppression(t *testing.T) {
+	rules := []Rule{
+		{Name: "Token A", ID: "test.a", Pattern: `tokA_[a-zA-Z0-9]{16}`},
+		{Name: "Token B", ID: "test.b", Pattern: `tokB_[a-zA-Z0-9]{16}`},
+	}
+
+	content := strings.Join([]string{
+		`kept = "tokA_aZ3kQ9xLm2Pw7vRt"`,
+		`same = "tokA_bB8nM4cV1xZ6qW0e" // poltergeist:ignore`,
+		`# poltergeist:ignore-line`,
+		`prev = "tokA_cC7mN3bV2xZ5qW9r"`,
+		`after = "tokA_dD6lK2jH1gF4dS8a"`,
+		`both = "tokA_eE5kJ1hG9fD3sA7q tokB_fF4jH0gF8dS2aQ6w" // poltergeist:ignore test.a`,
+		`# poltergeist:ignore test.b`,
+		`scoped = "tokA_gG3hG9fD7sA1qW5e tokB_hH2gF8dS6aQ0wE4r"`,
+	}, "\n")
+
+	expected := []struct {
+		line  int
+		match string
+	}{
+		{line: 1, match: "tokA_aZ3kQ9xLm2Pw7vRt"},
+		{line: 5, match: "tokA_dD6lK2jH1gF4dS8a"},
+		{line: 6, match: "tokB_fF4jH0gF8dS2aQ6w"},
+		{line: 8, match: "tokA_gG3hG9fD7sA1qW5e"},
+	}
+
+	for _, wholeFile := range []bool{false, true} {
+		scanner := newTestScanner(t, rules)
+		scanner.WholeFile = wholeFile
+
+		results, err := scanner.ScanReader(strings.NewReader(content), "app.env")
+		if err != nil {
+			t.Fatalf("ScanReader failed: %v", err)
+		}
+		if len(results) != len(expected) {
+			t.Fatalf("WholeFile=%v: expected %d results, got %d: %+v", wholeFile, len(expected), len(results), results)
+		}
+
+		// Whole-file results are ordered by rule rather than by line
+		sort.Slice(results, func(i, j int) bool {
+			return results[i].LineNumber < results[j].LineNumber
+		})
+
+		for i, want := range expected {
+			if results[i].LineNumber != want.line || results[i].Match != want.match {
+				t.Errorf("WholeFile=%v: result %d = line %d %q, expected line %d %q",
+					wholeFile, i, results[i].LineNumber, results[i].Match, want.line, want.match)
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package poltergeist
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Built-in validators, named by a rule's Validator field
+const (
+	// ValidatorLuhn accepts card numbers of 12 to 19 digits, optionally
+	// separated by spaces or dashes, with a valid Luhn check digit.
+	ValidatorLuhn = "luhn"
+
+	// ValidatorAWSAccessKey accepts AWS access key IDs: a known 4 character
+	// prefix followed by 16 base32 characters.
+	ValidatorAWSAccessKey = "aws-access-key"
+
+	// ValidatorBase64 accepts text that decodes as standard or URL-safe
+	// base64, padded or not.
+	ValidatorBase64 = "base64"
+
+	// ValidatorHex accepts an even number of hex digits.
+	ValidatorHex = "hex"
+)
+
+// validatorsMu guards validators, which may be registered while rules are
+// being compiled
+var validatorsMu sync.RWMutex
+
+// validators maps validator names to functions that report whether a match
+// is structurally valid
+var validators = map[string]func(string) bool{
+	ValidatorLuhn:         validLuhn,
+	ValidatorAWSAccessKey: validAWSAccessKey,
+	ValidatorBase64:       validBase64,
+	ValidatorHex:          validHex,
+}
+
+// awsAccessKeyPrefixes are the prefixes of AWS access key IDs by resource type
+var awsAccessKeyPrefixes = []string{"ABIA", "ACCA", "AGPA", "AIDA", "AIPA", "AKIA", "ANPA", "ANVA", "AROA", "APKA", "ASIA"}
+
+// RegisterValidator makes a validator available to rules under name, so
+// library users can check matches with their own logic, such as an internal
+// format checker. Registering a name again, including a built-in one,
+// replaces the previous validator. Rules look up their validator when they
+// are compiled, so register validators before compiling rules that use them.
+// It is safe to call concurrently.
+func RegisterValidator(name string, fn func(match string) bool) {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	validators[name] = fn
+}
+
+// lookupValidator returns the validator registered under name
+func lookupValidator(name string) (func(string) bool, bool) {
+	validatorsMu.RLock()
+	defer validatorsMu.RUnlock()
+	fn, ok := validators[name]
+	return fn, ok && fn != nil
+}
+
+// checkValidator returns an error if the rule names a validator that isn't
+// registered
+func checkValidator(rule Rule) error {
+	if rule.Validator == "" {
+		return nil
+	}
+	if _, ok := lookupValidator(rule.Validator); !ok {
+		return fmt.Errorf("rule '%s' has unknown validator '%s'", rule.Name, rule.Validator)
+	}
+	return nil
+}
+
+// validLuhn reports whether s is a card number with a valid Luhn check digit
+func validLuhn(s string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(s)
+	if len(digits) < 12 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := range len(digits) {
+		c := digits[len(digits)-1-i]
+		if c < '0' || c > '9' {
+			return false
+		}
+
+		// Every second digit from the right is doubled
+		d := int(c - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+
+	return sum%10 == 0
+}
+
+// validAWSAccessKey reports whether s is shaped like an AWS access key ID
+func validAWSAccessKey(s string) bool {
+	if len(s) != 20 {
+		return false
+	}
+
+	prefixOK := strings.HasPrefix(s, "A3T")
+	for _, prefix := range awsAccessKeyPrefixes {
+		prefixOK = prefixOK || strings.HasPrefix(s, prefix)
+	}
+	if !prefixOK {
+		return false
+	}
+
+	for _, c := range s[4:] {
+		if (c < 'A' || c > 'Z') && (c < '2' || c > '7') {
+			return false
+		}
+	}
+	return true
+}
+
+// validBase64 reports whether s decodes as base64 in any of the encodings
+// tried when decoding encoded blobs
+func validBase64(s string) bool {
+	for _, encoding := range base64Encodings {
+		if _, err := encoding.DecodeString(s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validHex reports whether s decodes as hex
+func validHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return s != "" && err == nil
+}
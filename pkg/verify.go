@@ -0,0 +1,102 @@
+package poltergeist
+
+import (
+	"context"
+	"sync"
+)
+
+// Verifier checks whether a found secret is still active, typically by
+// calling the issuing service. No verifiers are registered by default, since
+// using a leaked credential may not be authorized; register them with
+// RegisterVerifier and enable Scanner.Verify to opt in.
+type Verifier interface {
+	// Verify reports whether secret, matched by rule, is active. An error
+	// means the status couldn't be determined.
+	Verify(ctx context.Context, rule Rule, secret string) (active bool, err error)
+}
+
+// verifiersMu guards verifiers
+var verifiersMu sync.RWMutex
+
+// verifiers maps rule IDs and tags to the verifier for their findings
+var verifiers = map[string]Verifier{}
+
+// RegisterVerifier sets the verifier for findings of the rule with the given
+// ID, or of rules with the given tag. A verifier registered for a rule's ID
+// takes precedence over one registered for its tags, which are tried in
+// order. Registering a nil verifier removes it. It is safe to call
+// concurrently.
+func RegisterVerifier(key string, v Verifier) {
+	verifiersMu.Lock()
+	defer verifiersMu.Unlock()
+
+	if v == nil {
+		delete(verifiers, key)
+		return
+	}
+	verifiers[key] = v
+}
+
+// lookupVerifier returns the verifier registered for the rule's ID or one of
+// its tags
+func lookupVerifier(rule RuntimeRule) (Verifier, bool) {
+	verifiersMu.RLock()
+	defer verifiersMu.RUnlock()
+
+	for _, key := range append([]string{rule.ID}, rule.Tags...) {
+		if v, ok := verifiers[key]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// verifyResults sets Verified on the results that meet their entropy
+// threshold and whose rule has a verifier. Each distinct secret is verified
+// once per rule. Verification errors are logged and leave Verified unset.
+func (s *Scanner) verifyResults(ctx context.Context, results []ScanResult) {
+	rules := make(map[string]RuntimeRule)
+	for _, rule := range s.ActiveRules() {
+		rules[rule.ID] = rule
+	}
+
+	type verifyKey struct {
+		ruleID string
+		secret string
+	}
+	verified := make(map[verifyKey]*bool)
+
+	for i := range results {
+		result := &results[i]
+		if !result.RuleEntropyThresholdMet {
+			continue
+		}
+
+		rule, ok := rules[result.RuleID]
+		if !ok {
+			continue
+		}
+		verifier, ok := lookupVerifier(rule)
+		if !ok {
+			continue
+		}
+
+		key := verifyKey{result.RuleID, result.Match}
+		if active, ok := verified[key]; ok {
+			result.Verified = active
+			continue
+		}
+
+		active, err := verifier.Verify(ctx, rule.toRule(), result.Match)
+		if err != nil {
+			if s.Logger != nil {
+				s.Logger.Warn("failed to verify finding", "path", result.FilePath, "rule", result.RuleID, "error", redactSecrets(err.Error()))
+			}
+			verified[key] = nil
+			continue
+		}
+
+		verified[key] = &active
+		result.Verified = &active
+	}
+}
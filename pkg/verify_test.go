@@ -0,0 +1,164 @@
+package poltergeist
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVerifier reports the secrets in active as active and fails for the
+// secrets in failing, counting calls per secret
+type fakeVerifier struct {
+	active  map[string]bool
+	failing map[string]bool
+
+	mu    sync.Mutex
+	calls map[string]int
+	rules []string
+}
+
+func (v *fakeVerifier) Verify(ctx context.Context, rule Rule, secret string) (bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.calls == nil {
+		v.calls = make(map[string]int)
+	}
+	v.calls[secret]++
+	v.rules = append(v.rules, rule.ID)
+
+	if v.failing[secret] {
+		return false, errors.New("verification service unavailable")
+	}
+	return v.active[secret], nil
+}
+
+func TestScannerVerify(t *testing.T) {
+	verifier := &fakeVerifier{
+		active:  map[string]bool{"tok_Active1a2b3c4d": true},
+		failing: map[string]bool{"tok_Broken1a2b3c4d": true},
+	}
+	RegisterVerifier("test-verify", verifier)
+	t.Cleanup(func() {
+		RegisterVerifier("test-verify", nil)
+	})
+
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Tags:    []string{"test-verify"},
+			Pattern: `\b(tok_[A-Za-z0-9]+)\b`,
+			Redact:  []int{4, 0},
+			Entropy: 3.0,
+		},
+		{
+			Name:    "Unverified Token",
+			ID:      "test.other",
+			Pattern: `\b(oth_[A-Za-z0-9]+)\b`,
+			Redact:  []int{4, 0},
+			Entropy: 3.0,
+		},
+	}
+
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.env", "A=tok_Active1a2b3c4d\nB=tok_Revoked1a2b3c4\nC=tok_Broken1a2b3c4d\nD=tok_aaaa\nE=oth_Other1a2b3c4d5\n")
+	writeTestFile(t, dir, "b.env", "A=tok_Active1a2b3c4d\n")
+
+	// Verification is off by default
+	results, err := newTestScanner(t, rules).ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	for _, result := range results {
+		if result.Verified != nil {
+			t.Errorf("Expected no verification without Scanner.Verify, got %v for %s", *result.Verified, result.Match)
+		}
+	}
+	if len(verifier.calls) != 0 {
+		t.Fatalf("Expected no verifier calls without Scanner.Verify, got %v", verifier.calls)
+	}
+
+	scanner := newTestScanner(t, rules)
+	scanner.Verify = true
+	results, err = scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+
+	active, revoked := true, false
+	want := map[string]*bool{
+		"tok_Active1a2b3c4d": &active,
+		"tok_Revoked1a2b3c4": &revoked,
+		"tok_Broken1a2b3c4d": nil, // Verification failed
+		"tok_aaaa":           nil, // Below the entropy threshold
+		"oth_Other1a2b3c4d5": nil, // No verifier for the rule
+	}
+	for _, result := range results {
+		expected, ok := want[result.Match]
+		if !ok {
+			t.Fatalf("Unexpected match %q", result.Match)
+		}
+		switch {
+		case expected == nil && result.Verified != nil:
+			t.Errorf("%s: expected no verification, got %v", result.Match, *result.Verified)
+		case expected != nil && result.Verified == nil:
+			t.Errorf("%s: expected verified %v, got none", result.Match, *expected)
+		case expected != nil && *result.Verified != *expected:
+			t.Errorf("%s: expected verified %v, got %v", result.Match, *expected, *result.Verified)
+		}
+	}
+
+	// Each distinct secret is verified once, with the rule that matched it
+	if verifier.calls["tok_Active1a2b3c4d"] != 1 {
+		t.Errorf("Expected the repeated secret to be verified once, got %d calls", verifier.calls["tok_Active1a2b3c4d"])
+	}
+	if _, ok := verifier.calls["tok_aaaa"]; ok {
+		t.Error("Expected low entropy matches not to be verified")
+	}
+	for _, id := range verifier.rules {
+		if id != "test.token" {
+			t.Errorf("Expected verification with rule test.token, got %s", id)
+		}
+	}
+
+	// Content scanned from a reader is verified too
+	results, err = scanner.ScanReader(strings.NewReader("A=tok_Active1a2b3c4d\n"), "stdin")
+	if err != nil {
+		t.Fatalf("ScanReader failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Verified == nil || !*results[0].Verified {
+		t.Errorf("Expected ScanReader to verify the active secret, got %+v", results)
+	}
+}
+
+func TestLookupVerifier(t *testing.T) {
+	byID, byTag := &fakeVerifier{}, &fakeVerifier{}
+	RegisterVerifier("test.lookup", byID)
+	RegisterVerifier("test-lookup-tag", byTag)
+	t.Cleanup(func() {
+		RegisterVerifier("test.lookup", nil)
+		RegisterVerifier("test-lookup-tag", nil)
+	})
+
+	tests := []struct {
+		name string
+		rule RuntimeRule
+		want Verifier
+	}{
+		{name: "ID takes precedence", rule: RuntimeRule{ID: "test.lookup", Tags: []string{"test-lookup-tag"}}, want: byID},
+		{name: "tag", rule: RuntimeRule{ID: "test.other", Tags: []string{"api", "test-lookup-tag"}}, want: byTag},
+		{name: "none", rule: RuntimeRule{ID: "test.other", Tags: []string{"api"}}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := lookupVerifier(tt.rule)
+			if ok != (tt.want != nil) || got != tt.want {
+				t.Errorf("lookupVerifier() = %v, %v, expected %v", got, ok, tt.want)
+			}
+		})
+	}
+}
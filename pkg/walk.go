@@ -0,0 +1,200 @@
+package poltergeist
+
+import (
+	"io/fs"
+	"path"
+	"sync"
+)
+
+// DefaultWalkConcurrency is the default number of directories read at once
+// during a directory walk
+const DefaultWalkConcurrency = 16
+
+// walkConcurrency returns the number of directories read at once during a
+// directory walk
+func (s *Scanner) walkConcurrency() int {
+	if s.WalkConcurrency < 1 {
+		return DefaultWalkConcurrency
+	}
+	return s.WalkConcurrency
+}
+
+// walkOptions configures a walkDirConcurrent walk
+type walkOptions struct {
+	maxOpen        int               // Maximum number of directories read at once
+	followSymlinks bool              // Walk symbolic links to directories
+	revisited      func(name string) // If set, called for each directory skipped as already walked
+}
+
+// walkDirConcurrent is like fs.WalkDir but walks subdirectories in up to
+// opts.maxOpen goroutines, each reading one directory at a time, so the file
+// descriptors held open stay bounded. fn may be called concurrently and
+// entries are visited in no particular order, except that a directory is
+// visited before its contents. fn returning fs.SkipDir skips a directory, and
+// any other error stops the walk, which returns the first such error once
+// the calls in progress finish.
+//
+// With opts.followSymlinks, symbolic links are visited as their targets, so
+// links to directories are walked. Each directory is then walked once, by
+// device and inode, under whichever of its paths is reached first, which
+// breaks cycles such as a link to an ancestor. Links are only followed on
+// platforms that report inodes.
+func walkDirConcurrent(fsys fs.FS, root string, opts walkOptions, fn fs.WalkDirFunc) error {
+	info, err := fs.Stat(fsys, root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		w := &concurrentWalk{fsys: fsys, fn: fn, opts: opts, sem: make(chan struct{}, max(opts.maxOpen, 1))}
+		if opts.followSymlinks {
+			w.visited = make(map[fileID]bool)
+		}
+		w.sem <- struct{}{}
+		w.walk(root, fs.FileInfoToDirEntry(info))
+		w.wg.Wait()
+		err = w.err
+	}
+
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// concurrentWalk is the state of a walkDirConcurrent walk
+type concurrentWalk struct {
+	fsys fs.FS
+	fn   fs.WalkDirFunc
+	opts walkOptions
+	sem  chan struct{} // Holds a slot for each walking goroutine
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	err     error           // First error returned by fn
+	visited map[fileID]bool // Directories walked, when following symlinks
+}
+
+// walk visits name, and if it is a directory visits each file and walks each
+// subdirectory, in a new goroutine if a slot is free
+func (w *concurrentWalk) walk(name string, d fs.DirEntry) {
+	if w.stopped() {
+		return
+	}
+
+	if !d.IsDir() {
+		if err := w.fn(name, d, nil); err != nil && err != fs.SkipDir {
+			w.stop(err)
+		}
+		return
+	}
+
+	entries, ok := w.readDir(name, d)
+	if !ok {
+		return
+	}
+
+	for _, entry := range entries {
+		child := path.Join(name, entry.Name())
+		if entry.Type()&fs.ModeSymlink != 0 && w.opts.followSymlinks {
+			entry = w.resolve(child, entry)
+		}
+		if !entry.IsDir() {
+			w.walk(child, entry)
+			continue
+		}
+
+		select {
+		case w.sem <- struct{}{}:
+			w.wg.Add(1)
+			go func() {
+				defer w.wg.Done()
+				defer func() { <-w.sem }()
+				w.walk(child, entry)
+			}()
+		default:
+			w.walk(child, entry)
+		}
+	}
+}
+
+// readDir visits a directory and reads its entries, reporting false if fn
+// skips the directory or stops the walk, or it was already walked
+func (w *concurrentWalk) readDir(name string, d fs.DirEntry) ([]fs.DirEntry, bool) {
+	if w.opts.followSymlinks && !w.firstVisit(d) {
+		if w.opts.revisited != nil {
+			w.opts.revisited(name)
+		}
+		return nil, false
+	}
+
+	if err := w.fn(name, d, nil); err != nil {
+		if err != fs.SkipDir {
+			w.stop(err)
+		}
+		return nil, false
+	}
+
+	// As with fs.WalkDir, fn is called again for a directory that can't be
+	// read, and any entries read are still walked
+	entries, err := fs.ReadDir(w.fsys, name)
+	if err != nil {
+		if err := w.fn(name, d, err); err != nil {
+			if err != fs.SkipDir {
+				w.stop(err)
+			}
+			return nil, false
+		}
+	}
+	return entries, true
+}
+
+// resolve returns an entry for the target of a symbolic link, or the link's
+// own entry if the target can't be read or identified, so the link is
+// visited as a file as it would be without following
+func (w *concurrentWalk) resolve(name string, link fs.DirEntry) fs.DirEntry {
+	info, err := fs.Stat(w.fsys, name)
+	if err != nil {
+		return link
+	}
+	if _, ok := fileIDOf(info); info.IsDir() && !ok {
+		return link
+	}
+	return fs.FileInfoToDirEntry(info)
+}
+
+// firstVisit records that a directory is being walked, reporting whether it
+// hadn't been already. Directories that can't be identified are always
+// walked, as they can only be reached without following links.
+func (w *concurrentWalk) firstVisit(d fs.DirEntry) bool {
+	info, err := d.Info()
+	if err != nil {
+		return true
+	}
+	id, ok := fileIDOf(info)
+	if !ok {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.visited[id] {
+		return false
+	}
+	w.visited[id] = true
+	return true
+}
+
+// stop records the error that stops the walk, keeping the first
+func (w *concurrentWalk) stop(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// stopped reports whether the walk has been stopped
+func (w *concurrentWalk) stopped() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err != nil
+}
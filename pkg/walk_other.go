@@ -0,0 +1,17 @@
+//go:build !unix
+
+package poltergeist
+
+import "io/fs"
+
+// fileID identifies a file by device and inode
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// fileIDOf reports false, as file info doesn't include inodes on this
+// platform
+func fileIDOf(info fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
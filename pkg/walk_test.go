@@ -0,0 +1,257 @@
+package poltergeist
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeDeepTree writes a tree of depth levels below dir, each directory
+// holding fanout subdirectories and a few files, some with secrets
+func writeDeepTree(t *testing.T, dir string, depth, fanout int) {
+	t.Helper()
+
+	for i := 0; i < 3; i++ {
+		content := fmt.Sprintf("name = file%d\n", i)
+		if i == 1 {
+			content += fmt.Sprintf("token = tok_%x%08d\n", depth, len(dir))
+		}
+		writeTestFile(t, dir, fmt.Sprintf("file%d.txt", i), content)
+	}
+	if depth == 0 {
+		return
+	}
+	for i := 0; i < fanout; i++ {
+		writeDeepTree(t, filepath.Join(dir, fmt.Sprintf("dir%d", i)), depth-1, fanout)
+	}
+}
+
+func TestConcurrentWalkMatchesSerial(t *testing.T) {
+	root := t.TempDir()
+	writeDeepTree(t, root, 4, 3)
+
+	// Ignore files, skipped directories, and excludes prune parts of the tree
+	writeTestFile(t, root, filepath.Join("dir0", ".gitignore"), "file2.txt\ndir1/\n")
+	writeTestFile(t, root, filepath.Join("dir1", "dir1", ".gitignore"), "*\n!file1.txt\n")
+	writeTestFile(t, root, PoltergeistIgnoreFile, "dir2/dir0/file0.txt\n")
+	writeTestFile(t, root, filepath.Join("dir2", "node_modules", "pkg.js"), "token = tok_vendored1\n")
+	writeTestFile(t, root, filepath.Join("dir2", "empty.txt"), "")
+
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8,}`,
+		},
+	}
+
+	scan := func(concurrency int) ([]ScanResult, ScanMetrics) {
+		scanner := newTestScanner(t, rules)
+		scanner.WalkConcurrency = concurrency
+		scanner.ExcludeGlobs = []string{"dir2/dir2/**"}
+		results, err := scanner.ScanDirectory(root)
+		if err != nil {
+			t.Fatalf("ScanDirectory with WalkConcurrency %d failed: %v", concurrency, err)
+		}
+		return results, scanner.MetricsSnapshot()
+	}
+
+	serial, serialMetrics := scan(1)
+	if len(serial) == 0 {
+		t.Fatal("Expected the serial walk to find secrets")
+	}
+
+	for _, concurrency := range []int{2, 8, 0} {
+		results, metrics := scan(concurrency)
+		if !reflect.DeepEqual(results, serial) {
+			t.Errorf("WalkConcurrency %d found %d results, the serial walk %d", concurrency, len(results), len(serial))
+		}
+		if metrics != serialMetrics {
+			t.Errorf("WalkConcurrency %d metrics %+v differ from the serial walk's %+v", concurrency, metrics, serialMetrics)
+		}
+	}
+}
+
+// countingFS tracks the directories being read and ignore files being
+// loaded at once
+type countingFS struct {
+	fs.FS
+	open    int64
+	maxOpen int64
+}
+
+func (c *countingFS) enter() func() {
+	open := atomic.AddInt64(&c.open, 1)
+	for {
+		max := atomic.LoadInt64(&c.maxOpen)
+		if open <= max || atomic.CompareAndSwapInt64(&c.maxOpen, max, open) {
+			break
+		}
+	}
+	return func() { atomic.AddInt64(&c.open, -1) }
+}
+
+func (c *countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	defer c.enter()()
+	return fs.ReadDir(c.FS, name)
+}
+
+func (c *countingFS) ReadFile(name string) ([]byte, error) {
+	defer c.enter()()
+	return fs.ReadFile(c.FS, name)
+}
+
+func TestWalkDirConcurrent(t *testing.T) {
+	root := t.TempDir()
+	writeDeepTree(t, root, 3, 4)
+
+	var want []string
+	err := fs.WalkDir(os.DirFS(root), ".", func(name string, d fs.DirEntry, err error) error {
+		if d.IsDir() && d.Name() == "dir3" {
+			return fs.SkipDir
+		}
+		want = append(want, name)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WalkDir failed: %v", err)
+	}
+
+	const maxOpen = 3
+	fsys := &countingFS{FS: os.DirFS(root)}
+	var mu sync.Mutex
+	var got []string
+	err = walkDirConcurrent(fsys, ".", walkOptions{maxOpen: maxOpen}, func(name string, d fs.DirEntry, err error) error {
+		if d.IsDir() {
+			// Read an ignore file as the scanner does on entering a directory
+			fsys.ReadFile(path.Join(name, gitIgnoreFile))
+			if d.Name() == "dir3" {
+				return fs.SkipDir
+			}
+		}
+		mu.Lock()
+		got = append(got, name)
+		mu.Unlock()
+		return err
+	})
+	if err != nil {
+		t.Fatalf("walkDirConcurrent failed: %v", err)
+	}
+
+	sort.Strings(want)
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the same %d entries as WalkDir, got %d", len(want), len(got))
+	}
+	if fsys.maxOpen > maxOpen {
+		t.Errorf("Expected at most %d directories read at once, got %d", maxOpen, fsys.maxOpen)
+	}
+
+	// Errors from fn stop the walk
+	stop := fmt.Errorf("stop")
+	err = walkDirConcurrent(os.DirFS(root), ".", walkOptions{maxOpen: maxOpen}, func(name string, d fs.DirEntry, err error) error {
+		if path.Base(name) == "file1.txt" {
+			return stop
+		}
+		return err
+	})
+	if err != stop {
+		t.Errorf("Expected the walk to stop with fn's error, got %v", err)
+	}
+
+	// A missing root is passed to fn
+	err = walkDirConcurrent(os.DirFS(root), "missing", walkOptions{maxOpen: maxOpen}, func(name string, d fs.DirEntry, err error) error {
+		return err
+	})
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected a not exist error for a missing root, got %v", err)
+	}
+}
+
+func TestScanFollowSymlinks(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "top.env", "TOKEN=tok_toplevel\n")
+	writeTestFile(t, root, filepath.Join("a", "b", "deep.env"), "TOKEN=tok_deepfile\n")
+
+	// A mounted tree outside the scanned directory, linked twice
+	outside := t.TempDir()
+	writeTestFile(t, outside, "mounted.env", "TOKEN=tok_mounted1\n")
+
+	links := map[string]string{
+		filepath.Join("a", "b", "up"): filepath.Join("..", ".."), // The scan root
+		filepath.Join("a", "self"):    ".",                       // Its own directory
+		"mount":                       outside,
+		"mount2":                      outside,
+		"top-link.env":                "top.env",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("Symlinks are not supported: %v", err)
+		}
+	}
+
+	rules := []Rule{
+		{
+			Name:    "Test Token",
+			ID:      "test.token",
+			Pattern: `tok_[a-z0-9]{8,}`,
+		},
+	}
+
+	for _, concurrency := range []int{1, 8} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			scanner := newTestScanner(t, rules)
+			scanner.FollowSymlinks = true
+			scanner.WalkConcurrency = concurrency
+
+			done := make(chan struct{})
+			var results []ScanResult
+			var err error
+			go func() {
+				defer close(done)
+				results, err = scanner.ScanDirectory(root)
+			}()
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("Scan following symlinks did not terminate")
+			}
+			if err != nil {
+				t.Fatalf("ScanDirectory failed: %v", err)
+			}
+
+			// Each directory is walked once, while the link to a file is
+			// scanned like any file
+			counts := make(map[string]int)
+			for _, result := range results {
+				counts[result.Match]++
+			}
+			want := map[string]int{"tok_toplevel": 2, "tok_deepfile": 1, "tok_mounted1": 1}
+			if !reflect.DeepEqual(counts, want) {
+				t.Errorf("Expected matches %v, got %v", want, counts)
+			}
+			if scanner.Metrics.FilesScanned != 4 {
+				t.Errorf("Expected 4 files scanned, got %d", scanner.Metrics.FilesScanned)
+			}
+		})
+	}
+
+	// Without following, linked directories aren't walked
+	results, err := newTestScanner(t, rules).ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("ScanDirectory failed: %v", err)
+	}
+	for _, result := range results {
+		if result.Match == "tok_mounted1" {
+			t.Errorf("Expected the linked directory not to be walked without FollowSymlinks, found %s", result.FilePath)
+		}
+	}
+}
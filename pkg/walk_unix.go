@@ -0,0 +1,23 @@
+//go:build unix
+
+package poltergeist
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID identifies a file by device and inode
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// fileIDOf returns the device and inode of a file, if its info reports them
+func fileIDOf(info fs.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}